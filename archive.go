@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing/fstest"
+)
+
+// maxArchiveSize bounds the size of an archive read into memory, and of
+// its extracted files, so that a compressed archive cannot exhaust memory.
+const maxArchiveSize = 1 << 30
+
+// archiveRoot is where an archive, or a repository cloned by --repo, is
+// mapped: paths reported for it are names within it rooted at the
+// filesystem root, as for AnalyzeFS.
+var archiveRoot = string(filepath.Separator)
+
+// loadArchive reads the .tar.gz or .zip archive at path, or from stdin
+// when path is -, into memory.
+func loadArchive(path string) (*MappedFS, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(io.LimitReader(os.Stdin, maxArchiveSize+1))
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := openArchive(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read archive %s: %w", path, err)
+	}
+	return &MappedFS{FS: fsys, Root: archiveRoot}, nil
+}
+
+// openArchive returns the files of a .tar.gz or .zip archive, recognized
+// by its content, such as a Terraform Cloud configuration version.
+func openArchive(data []byte) (fs.FS, error) {
+	if len(data) > maxArchiveSize {
+		return nil, fmt.Errorf("archive is larger than %d bytes", maxArchiveSize)
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("\x1f\x8b")):
+		return tarGzFS(data)
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		var size uint64
+		for _, file := range zr.File {
+			if size += file.UncompressedSize64; size > maxArchiveSize {
+				return nil, fmt.Errorf("archive expands to more than %d bytes", maxArchiveSize)
+			}
+		}
+		return zr, nil
+	}
+	return nil, errors.New("not a .tar.gz or .zip archive")
+}
+
+// tarGzFS reads the directories, regular files and symbolic links of a
+// .tar.gz archive into memory.
+func tarGzFS(data []byte) (fs.FS, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	files := fstest.MapFS{}
+	var size int64
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(strings.TrimLeft(header.Name, "/"))
+		if !fs.ValidPath(name) {
+			return nil, fmt.Errorf("archive entry %q is outside the archive", header.Name)
+		}
+		if name == "." {
+			continue
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			files[name] = &fstest.MapFile{Mode: fs.ModeDir | 0755}
+		case tar.TypeReg:
+			if size += header.Size; size > maxArchiveSize {
+				return nil, fmt.Errorf("archive expands to more than %d bytes", maxArchiveSize)
+			}
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			files[name] = &fstest.MapFile{Data: content, Mode: header.FileInfo().Mode().Perm()}
+		case tar.TypeSymlink:
+			files[name] = &fstest.MapFile{Data: []byte(header.Linkname), Mode: fs.ModeSymlink | 0777}
+		}
+	}
+}
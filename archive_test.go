@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenArchive(t *testing.T) {
+	files := map[string]string{
+		"./envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	}
+	for name, data := range map[string][]byte{
+		"tar.gz": tarGz(t, files),
+		"zip":    zipArchive(t, files),
+	} {
+		t.Run(name, func(t *testing.T) {
+			fsys, err := openArchive(data)
+			if err != nil {
+				t.Fatalf("openArchive failed: %v", err)
+			}
+			root := filepath.Join(archiveRoot, "envs", "prod")
+			output, err := AnalyzeWithOptions(root, AnalyzeOptions{FS: &MappedFS{FS: fsys, Root: archiveRoot}})
+			if err != nil {
+				t.Fatalf("Analyze failed: %v", err)
+			}
+			if len(output.LocalModules) != 1 || output.LocalModules[0].ResolvedPath != filepath.Join(archiveRoot, "modules", "vpc") {
+				t.Errorf("expected the vpc module in the archive, got %+v", output.LocalModules)
+			}
+			if len(output.RemoteModules) != 1 || output.RemoteModules[0].Source != "cloudposse/label/null" {
+				t.Errorf("expected the label module, got %+v", output.RemoteModules)
+			}
+		})
+	}
+
+	if _, err := openArchive(tarGz(t, map[string]string{"../escape.tf": ""})); err == nil {
+		t.Error("expected an error for an entry outside the archive")
+	}
+	if _, err := openArchive([]byte(`module "vpc" {}`)); err == nil {
+		t.Error("expected an error for data that is not an archive")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// Backend is the state storage a root module configures in its terraform
+// block: the type of its backend block, or "cloud" for a cloud block, and
+// the constant string settings of its configuration. Nested settings are
+// keyed by their dotted path, such as workspaces.name, and credentials are
+// left out.
+type Backend struct {
+	Type   string            `json:"type"`
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// backendCloud is the Backend type of a cloud block.
+const backendCloud = "cloud"
+
+// sensitiveBackendSettings lists the backend settings that hold
+// credentials, which are never reported.
+var sensitiveBackendSettings = map[string]bool{
+	"access_key":                  true,
+	"secret_key":                  true,
+	"token":                       true,
+	"password":                    true,
+	"sas_token":                   true,
+	"client_secret":               true,
+	"client_certificate_password": true,
+	"credentials":                 true,
+	"encryption_key":              true,
+	"kms_encryption_key":          true,
+	"access_token":                true,
+	"sse_customer_key":            true,
+}
+
+// newBackend returns the Backend of a backend or cloud block.
+func newBackend(block *hcl.Block) *Backend {
+	backend := &Backend{Type: backendCloud, Config: make(map[string]string)}
+	if block.Type == "backend" {
+		backend.Type = block.Labels[0]
+	}
+	flattenBody(block.Body, "", backend.Config)
+	for key := range backend.Config {
+		name := key[strings.LastIndex(key, ".")+1:]
+		if sensitiveBackendSettings[name] {
+			delete(backend.Config, key)
+		}
+	}
+	if len(backend.Config) == 0 {
+		backend.Config = nil
+	}
+	return backend
+}
+
+// loadBackend returns the backend the module in dir configures, or nil
+// when it has no backend or cloud block and keeps its state locally. Files
+// that fail to parse are skipped, as tfconfig reports them.
+func loadBackend(fsys fileSystem, dir string) *Backend {
+	paths, err := listTerraformFilesIn(fsys, dir)
+	if err != nil {
+		return nil
+	}
+	parser := hclparse.NewParser()
+	var backend *Backend
+	for _, path := range paths {
+		src, err := fsys.readFile(path)
+		if err != nil {
+			continue
+		}
+		var file *hcl.File
+		if strings.HasSuffix(path, ".tf.json") {
+			file, _ = parser.ParseJSON(src, path)
+		} else {
+			file, _ = parser.ParseHCL(src, path)
+		}
+		if file == nil {
+			continue
+		}
+		content, _, _ := file.Body.PartialContent(terraformBlockSchema)
+		for _, block := range content.Blocks {
+			if block.Type != "terraform" {
+				continue
+			}
+			backends, _, _ := block.Body.PartialContent(backendBlockSchema)
+			for _, b := range backends.Blocks {
+				backend = newBackend(b)
+			}
+		}
+	}
+	return backend
+}
+
+// stateLocation returns where a root with backend stores its state. Cloud
+// blocks store it like the remote backend, which terraform_remote_state
+// reads them with.
+func (b *Backend) stateLocation() stateLocation {
+	if b == nil {
+		return stateLocation{Backend: "local", Config: map[string]string{"path": "terraform.tfstate"}}
+	}
+	loc := stateLocation{Backend: b.Type, Config: make(map[string]string)}
+	if loc.Backend == backendCloud {
+		loc.Backend = "remote"
+	}
+	for key, value := range b.Config {
+		loc.Config[key] = value
+	}
+	if loc.Backend == "local" && loc.Config["path"] == "" {
+		loc.Config["path"] = "terraform.tfstate"
+	}
+	return loc
+}
+
+// tfcWorkspace returns the Terraform Cloud workspace, as
+// organization/workspace, that a cloud block or remote backend selects by
+// name, or "" when it selects workspaces by tags or prefix.
+func (b *Backend) tfcWorkspace() string {
+	if b == nil || (b.Type != backendCloud && b.Type != "remote") {
+		return ""
+	}
+	org, name := b.Config["organization"], b.Config["workspaces.name"]
+	if org == "" || name == "" {
+		return ""
+	}
+	return org + "/" + name
+}
+
+// backendWorkspaces returns workspaces with the Terraform Cloud workspace
+// of every discovered root that has no configured workspace but names one
+// in its cloud block or remote backend.
+func backendWorkspaces(discovery *Discovery, workspaces map[string][]Workspace) map[string][]Workspace {
+	merged := make(map[string][]Workspace, len(workspaces))
+	for dir, ws := range workspaces {
+		merged[dir] = ws
+	}
+	for _, root := range discovery.Roots {
+		if _, ok := merged[root.Path]; ok || root.Analysis == nil {
+			continue
+		}
+		if ws := root.Analysis.Backend.tfcWorkspace(); ws != "" {
+			merged[root.Path] = []Workspace{{TFC: ws}}
+		}
+	}
+	return merged
+}
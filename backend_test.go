@@ -0,0 +1,98 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze_Backend(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"s3/main.tf": `
+terraform {
+  backend "s3" {
+    bucket     = "acme-state"
+    key        = "network/terraform.tfstate"
+    region     = var.region
+    access_key = "AKIA"
+  }
+}
+`,
+		"cloud/main.tf": `
+terraform {
+  cloud {
+    organization = "acme"
+    workspaces {
+      name = "app"
+    }
+  }
+}
+`,
+		"local/main.tf": `variable "x" {}`,
+	})
+
+	output, err := Analyze(filepath.Join(tempDir, "s3"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	expected := &Backend{Type: "s3", Config: map[string]string{"bucket": "acme-state", "key": "network/terraform.tfstate"}}
+	if !reflect.DeepEqual(output.Backend, expected) {
+		t.Errorf("expected %+v without credentials or expressions, got %+v", expected, output.Backend)
+	}
+
+	output, err = Analyze(filepath.Join(tempDir, "cloud"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if output.Backend.Type != backendCloud || output.Backend.tfcWorkspace() != "acme/app" {
+		t.Errorf("expected the cloud workspace acme/app, got %+v", output.Backend)
+	}
+
+	output, err = Analyze(filepath.Join(tempDir, "local"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if output.Backend != nil {
+		t.Errorf("expected no backend, got %+v", output.Backend)
+	}
+}
+
+func TestBackendWorkspaces(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"app/main.tf": `
+terraform {
+  cloud {
+    organization = "acme"
+    workspaces {
+      name = "app"
+    }
+  }
+}
+`,
+		"mapped/main.tf": `
+terraform {
+  backend "remote" {
+    organization = "acme"
+    workspaces {
+      name = "ignored"
+    }
+  }
+}
+`,
+	})
+	discovery, err := Discover(tempDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	mapped := filepath.Join(tempDir, "mapped")
+	workspaces := backendWorkspaces(discovery, map[string][]Workspace{mapped: {{Spacelift: "mapped"}}})
+	expected := map[string][]Workspace{
+		filepath.Join(tempDir, "app"): {{TFC: "acme/app"}},
+		mapped:                        {{Spacelift: "mapped"}},
+	}
+	if !reflect.DeepEqual(workspaces, expected) {
+		t.Errorf("expected %v, got %v", expected, workspaces)
+	}
+}
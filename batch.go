@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// AnalyzeDirs analyzes every root module in dirs with opts, in order, and
+// returns their outputs. Directories listed twice are analyzed once. When
+// opts has no cache, an in-memory one is shared between the roots, so
+// modules they have in common are parsed once. Roots that fail to analyze
+// are reported in errs and left out of the outputs; the analysis stops
+// when ctx is done.
+func AnalyzeDirs(ctx context.Context, dirs []string, opts AnalyzeOptions) (outputs []*Output, errs []error) {
+	if opts.Cache == nil {
+		opts.Cache = NewCache()
+	}
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		absDir := toAbsPath(dir)
+		if seen[absDir] {
+			continue
+		}
+		seen[absDir] = true
+
+		output, err := AnalyzeContext(ctx, absDir, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return outputs, append(errs, err)
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", dir, err))
+			continue
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, errs
+}
+
+// writeBatchFiles prints the files of every output once, in the format of
+// --files-only.
+func writeBatchFiles(w io.Writer, outputs []*Output, groupByModule bool) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, output := range outputs {
+		for _, f := range CollectAllFiles(output) {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	if groupByModule {
+		writeFilesByModule(w, files, outputs)
+		return
+	}
+	for _, f := range files {
+		fmt.Fprintln(w, f)
+	}
+}
+
+// runBatch analyzes the directories read from stdin for --dirs-from-stdin
+// and writes their outputs as a JSON array, or their files with
+// --files-only. It fails when any directory could not be analyzed, after
+// writing the outputs of the others.
+func runBatch(ctx context.Context, w io.Writer, opts AnalyzeOptions, filesOnly, groupByModule bool) int {
+	dirs, err := readStdin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+		return exitError
+	}
+	outputs, errs := AnalyzeDirs(ctx, dirs, opts)
+	opts.Progress.Done("analyzed %d root modules", len(outputs))
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+
+	if filesOnly {
+		writeBatchFiles(w, outputs, groupByModule)
+	} else {
+		if outputs == nil {
+			outputs = []*Output{}
+		}
+		jsonOutput, _ := json.MarshalIndent(outputs, "", "  ")
+		fmt.Fprintln(w, string(jsonOutput))
+	}
+	if len(errs) > 0 {
+		return exitError
+	}
+	return 0
+}
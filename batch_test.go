@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeDirs(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"prod/main.tf":                `module "vpc" { source = "../modules/vpc" }`,
+		"dev/main.tf":                 `module "vpc" { source = "../modules/vpc" }`,
+		"modules/vpc/main.tf":         `module "subnets" { source = "./subnets" }`,
+		"modules/vpc/subnets/main.tf": "",
+	})
+	t.Chdir(tempDir)
+
+	cache := NewCache()
+	outputs, errs := AnalyzeDirs(t.Context(), []string{"prod", "dev", "./prod", "missing"}, AnalyzeOptions{Cache: cache})
+	if len(outputs) != 2 || outputs[0].RootModule.ResolvedPath != filepath.Join(tempDir, "prod") || outputs[1].RootModule.ResolvedPath != filepath.Join(tempDir, "dev") {
+		t.Fatalf("expected prod and dev analyzed once each, got %d outputs", len(outputs))
+	}
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "missing: ") {
+		t.Errorf("expected an error for the missing directory, got %v", errs)
+	}
+	if hits, _ := cache.stats(); hits < 2 {
+		t.Errorf("expected the shared modules of dev to come from the cache, got %d hits", hits)
+	}
+
+	var b strings.Builder
+	writeBatchFiles(&b, outputs, false)
+	if got := strings.Count(b.String(), filepath.Join("modules", "vpc", "main.tf")); got != 1 {
+		t.Errorf("expected shared module files listed once, got:\n%s", b.String())
+	}
+}
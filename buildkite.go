@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultStepCommand is the command of each generated pipeline step, run in
+// the root module directory.
+const defaultStepCommand = "terraform init -input=false && terraform plan -input=false"
+
+// BuildkiteStep is a command step of a Buildkite pipeline that runs in one
+// root module directory. Steps of projects also select the project's
+// workspace and carry its -var-file arguments.
+type BuildkiteStep struct {
+	Label     string
+	Key       string
+	Dir       string
+	Command   string
+	DependsOn []string
+	Workspace string
+	VarFiles  string
+}
+
+var buildkiteKeyUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// BuildkiteSteps returns one step per root or project in roots, with
+// directories relative to dir. A step depends on the steps of the roots it
+// depends on according to dependencies, when those roots are part of the
+// pipeline.
+func BuildkiteSteps(roots []Root, dependencies map[string][]string, dir, command string) []BuildkiteStep {
+	keys := make(map[string][]string)
+	var steps []BuildkiteStep
+	for _, root := range roots {
+		rel, err := filepath.Rel(dir, root.Path)
+		if err != nil {
+			rel = root.Path
+		}
+		rel = filepath.ToSlash(rel)
+		name := rel
+		if root.Project != "" {
+			name = root.Project
+		}
+		step := BuildkiteStep{
+			Label:     ":terraform: " + name,
+			Key:       "plan-" + strings.Trim(buildkiteKeyUnsafe.ReplaceAllString(name, "-"), "-"),
+			Dir:       rel,
+			Command:   command,
+			Workspace: root.Workspace,
+			VarFiles:  varFilesEnv(root.Path, root.VarFiles),
+		}
+		keys[root.Path] = append(keys[root.Path], step.Key)
+		steps = append(steps, step)
+	}
+	for i, root := range roots {
+		for _, dep := range dependencies[root.Path] {
+			steps[i].DependsOn = append(steps[i].DependsOn, keys[dep]...)
+		}
+	}
+	return steps
+}
+
+// writeBuildkitePipeline writes steps as a pipeline for buildkite-agent
+// pipeline upload. Each step changes to its root directory, which is also
+// exported as TF_ROOT, and selects its project's workspace with
+// TF_WORKSPACE and variable files with TFMR_VAR_FILES.
+func writeBuildkitePipeline(w io.Writer, steps []BuildkiteStep) {
+	if len(steps) == 0 {
+		fmt.Fprintf(w, "steps: []\n")
+		return
+	}
+	fmt.Fprintf(w, "steps:\n")
+	for _, step := range steps {
+		fmt.Fprintf(w, "  - label: %s\n", yamlQuote(step.Label))
+		fmt.Fprintf(w, "    key: %s\n", yamlQuote(step.Key))
+		fmt.Fprintf(w, "    command: %s\n", yamlQuote("cd "+shellQuote(step.Dir)+" && "+step.Command))
+		fmt.Fprintf(w, "    env:\n")
+		fmt.Fprintf(w, "      TF_ROOT: %s\n", yamlQuote(step.Dir))
+		if step.Workspace != "" {
+			fmt.Fprintf(w, "      TF_WORKSPACE: %s\n", yamlQuote(step.Workspace))
+		}
+		if step.VarFiles != "" {
+			fmt.Fprintf(w, "      TFMR_VAR_FILES: %s\n", yamlQuote(step.VarFiles))
+		}
+		if len(step.DependsOn) > 0 {
+			fmt.Fprintf(w, "    depends_on:\n")
+			for _, key := range step.DependsOn {
+				fmt.Fprintf(w, "      - %s\n", yamlQuote(key))
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildkiteSteps(t *testing.T) {
+	dir := t.TempDir()
+	app := filepath.Join(dir, "infra", "envs", "app")
+	network := filepath.Join(dir, "infra", "envs", "network")
+	dependencies := map[string][]string{
+		app:     {network, filepath.Join(dir, "infra", "envs", "dns")},
+		network: nil,
+	}
+
+	steps := BuildkiteSteps([]Root{{Path: app}, {Path: network}}, dependencies, dir, "terraform plan")
+	expected := []BuildkiteStep{
+		{Label: ":terraform: infra/envs/app", Key: "plan-infra-envs-app", Dir: "infra/envs/app", Command: "terraform plan", DependsOn: []string{"plan-infra-envs-network"}},
+		{Label: ":terraform: infra/envs/network", Key: "plan-infra-envs-network", Dir: "infra/envs/network", Command: "terraform plan"},
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, steps)
+	}
+
+	if steps := BuildkiteSteps([]Root{{Path: app}}, dependencies, dir, "terraform plan"); len(steps[0].DependsOn) != 0 {
+		t.Errorf("expected no dependency on roots outside the pipeline, got %v", steps[0].DependsOn)
+	}
+
+	var b strings.Builder
+	writeBuildkitePipeline(&b, steps)
+	for _, want := range []string{
+		"steps:\n  - label: ':terraform: infra/envs/app'\n",
+		"    command: 'cd ''infra/envs/app'' && terraform plan'\n",
+		"    depends_on:\n      - 'plan-infra-envs-network'\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("expected pipeline to contain %q, got:\n%s", want, b.String())
+		}
+	}
+
+	projects := BuildkiteSteps([]Root{
+		{Path: app, Project: "app-prod", Workspace: "prod", VarFiles: []string{filepath.Join(app, "prod.tfvars")}},
+		{Path: app, Project: "app-dev", Workspace: "dev"},
+		{Path: network},
+	}, dependencies, dir, "terraform plan")
+	if p := projects[0]; p.Label != ":terraform: app-prod" || p.Key != "plan-app-prod" || p.Dir != "infra/envs/app" || p.VarFiles != "-var-file=prod.tfvars" ||
+		!reflect.DeepEqual(p.DependsOn, []string{"plan-infra-envs-network"}) {
+		t.Errorf("unexpected project step %+v", p)
+	}
+	b.Reset()
+	writeBuildkitePipeline(&b, projects)
+	if want := "      TF_WORKSPACE: 'dev'\n"; !strings.Contains(b.String(), want) {
+		t.Errorf("expected pipeline to contain %q, got:\n%s", want, b.String())
+	}
+
+	b.Reset()
+	writeBuildkitePipeline(&b, nil)
+	if b.String() != "steps: []\n" {
+		t.Errorf("expected an empty pipeline, got %q", b.String())
+	}
+}
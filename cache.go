@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// cacheVersion is bumped whenever the Cache encoding, the meaning of its
+// keys or the module calls parsed from the same files change, so that a
+// file restored from an older or newer release is never trusted: LoadCache
+// rejects it and the run starts from an empty cache. Fields that older
+// releases can ignore may be added without a bump.
+const cacheVersion = 3
+
+// Cache stores the parsed module calls of module directories keyed by the
+// directory content hash, as computed by hashModuleDir. Because the key
+// only depends on file names and contents, entries can be shared between
+// roots and between checkouts, and an entry can never be served for a
+// directory whose Terraform files changed. A Cache is safe for concurrent
+// use. Its file format is described by CacheSchema.
+type Cache struct {
+	Version int                    `json:"version"`
+	Modules map[string][]GraphCall `json:"modules"`
+
+	mu     sync.Mutex
+	used   map[string]bool
+	hits   int64
+	misses int64
+}
+
+// NewCache returns an empty cache.
+func NewCache() *Cache {
+	return &Cache{
+		Version: cacheVersion,
+		Modules: make(map[string][]GraphCall),
+		used:    make(map[string]bool),
+	}
+}
+
+// LoadCache reads a cache file. A missing file yields an empty cache.
+func LoadCache(path string) (*Cache, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewCache(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewCache()
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse cache %s: %w", path, err)
+	}
+	if c.Version != cacheVersion {
+		return nil, fmt.Errorf("cache %s has version %d, expected %d", path, c.Version, cacheVersion)
+	}
+	if c.Modules == nil {
+		c.Modules = make(map[string][]GraphCall)
+	}
+	return c, nil
+}
+
+// loadCacheOrWarn loads the cache at path, starting from an empty cache
+// with a warning when the file is unreadable or from another version.
+func loadCacheOrWarn(path string) *Cache {
+	c, err := LoadCache(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring cache: %v\n", err)
+		return NewCache()
+	}
+	return c
+}
+
+// lookup returns the cached module calls for a directory with the given
+// content hash, located at dir. It is safe to call on a nil cache.
+func (c *Cache) lookup(hash, dir string) ([]*moduleCall, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	graphCalls, ok := c.Modules[hash]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.used[hash] = true
+	return moduleCallsFromGraph(graphCalls, dir), true
+}
+
+// store records the module calls parsed from a directory.
+func (c *Cache) store(hash string, calls []*moduleCall) {
+	graphCalls := []GraphCall{}
+	for _, call := range calls {
+		graphCalls = append(graphCalls, newGraphCall(call))
+	}
+	sort.Slice(graphCalls, func(i, j int) bool { return graphCalls[i].Name < graphCalls[j].Name })
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Modules[hash] = graphCalls
+	c.used[hash] = true
+}
+
+// moduleCalls returns the module calls declared in dir, parsing the
+// directory only when its content hash is not cached. It is safe to call
+// on a nil cache.
+func (c *Cache) moduleCalls(dir string) ([]*moduleCall, error) {
+	var hash string
+	if c != nil {
+		var err error
+		hash, _, err = hashModuleDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if calls, ok := c.lookup(hash, dir); ok {
+			return calls, nil
+		}
+	}
+
+	calls, err := loadModuleCalls(localFS{}, dir)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		c.store(hash, calls)
+	}
+	return calls, nil
+}
+
+// stats returns the number of lookups that were and were not served from
+// the cache.
+func (c *Cache) stats() (hits, misses int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Save writes the entries used since the cache was loaded, dropping stale
+// entries so the file does not grow without bound.
+func (c *Cache) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pruned := &Cache{Version: cacheVersion, Modules: make(map[string][]GraphCall)}
+	for hash := range c.used {
+		pruned.Modules[hash] = c.Modules[hash]
+	}
+	data, err := json.Marshal(pruned)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
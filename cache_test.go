@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCache_ReusesAndPrunesEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	rootDir := filepath.Join(tempDir, "root")
+	cachePath := filepath.Join(tempDir, "cache.json")
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+	})
+
+	cache, err := LoadCache(cachePath)
+	if err != nil {
+		t.Fatalf("LoadCache failed on missing file: %v", err)
+	}
+	if _, err := AnalyzeWithOptions(rootDir, AnalyzeOptions{Cache: cache}); err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(cache.Modules) != 2 {
+		t.Fatalf("expected 2 cache entries, got %d", len(cache.Modules))
+	}
+	if err := cache.Save(cachePath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	cache, err = LoadCache(cachePath)
+	if err != nil {
+		t.Fatalf("LoadCache failed: %v", err)
+	}
+	vpcHash, _, err := hashModuleDir(filepath.Join(tempDir, "modules", "vpc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Modules[vpcHash][0].Version = "cached"
+
+	output, err := AnalyzeWithOptions(rootDir, AnalyzeOptions{Cache: cache})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if output.RemoteModules[0].Version != "cached" {
+		t.Errorf("expected cached calls to be reused, got version %s", output.RemoteModules[0].Version)
+	}
+
+	vpcMain := `
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.26.0"
+}
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "modules", "vpc", "main.tf"), []byte(vpcMain), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, _ = LoadCache(cachePath)
+	output, err = AnalyzeWithOptions(rootDir, AnalyzeOptions{Cache: cache})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if output.RemoteModules[0].Version != "0.26.0" {
+		t.Errorf("expected changed directory to be parsed again, got version %s", output.RemoteModules[0].Version)
+	}
+	if err := cache.Save(cachePath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	cache, _ = LoadCache(cachePath)
+	if _, ok := cache.Modules[vpcHash]; ok {
+		t.Error("expected stale entry to be pruned on save")
+	}
+	if len(cache.Modules) != 2 {
+		t.Errorf("expected 2 cache entries after pruning, got %d", len(cache.Modules))
+	}
+}
+
+func TestLoadCache_RejectsOtherVersions(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(cachePath, []byte(`{"version":999,"modules":{}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCache(cachePath); err == nil {
+		t.Error("expected an error for a cache with another version")
+	}
+}
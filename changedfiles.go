@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// readPaths reads paths from r, one per line, skipping blank lines and
+// unquoting those quoted by git.
+func readPaths(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			paths = append(paths, unquoteGitPath(line))
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// unquoteGitPath returns path unquoted if git quoted it, as git diff and
+// git status do with core.quotePath for paths with non-ASCII characters,
+// control characters, double quotes or backslashes: in double quotes with
+// C-style escapes and non-ASCII bytes as octal escapes, such as
+// "caf\303\251.tf". Other paths are returned as they are.
+func unquoteGitPath(path string) string {
+	if len(path) < 2 || path[0] != '"' || path[len(path)-1] != '"' {
+		return path
+	}
+	unquoted, err := strconv.Unquote(path)
+	if err != nil {
+		return path
+	}
+	return unquoted
+}
+
+// changedFilesParsers reads changed files in each --stdin-format.
+var changedFilesParsers = map[string]func(io.Reader) ([]string, error){
+	"lines":       readPaths,
+	"nul":         readNULPaths,
+	"name-status": readNameStatus,
+	"porcelain":   readPorcelain,
+	"json":        readJSONPaths,
+}
+
+func stdinFormatNames() []string {
+	var names []string
+	for name := range changedFilesParsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// addStdinFormatFlag registers --stdin-format on the flag set of a command
+// reading changed files from stdin, returning the selected format.
+func addStdinFormatFlag(flags *flag.FlagSet) *string {
+	format := "lines"
+	flags.Func("stdin-format", "format of the changed files read from stdin: lines (one path per line, the default), nul (NUL-separated paths, as printed with -z), name-status (git diff --name-status), porcelain (git status --porcelain or --porcelain=v2, without -z) or json (an array of paths or of GitHub API file objects)", func(value string) error {
+		if _, ok := changedFilesParsers[value]; !ok {
+			return fmt.Errorf("unknown format %q, expected one of %s", value, strings.Join(stdinFormatNames(), ", "))
+		}
+		format = value
+		return nil
+	})
+	return &format
+}
+
+// readNULPaths reads NUL-separated paths, as printed by git diff
+// --name-only -z or find -print0. Paths are taken as they are, including
+// leading and trailing spaces and newlines.
+func readNULPaths(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for scanner.Scan() {
+		if path := scanner.Text(); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// readNameStatus reads the changed files of git diff --name-status output:
+// a status letter, with a similarity score for renames and copies, and the
+// paths, separated by tabs. Renames and copies list the original path
+// before the new one, and both are changed files.
+func readNameStatus(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		expected := 2
+		if line[0] == 'R' || line[0] == 'C' {
+			expected = 3
+		}
+		if len(fields) != expected || fields[0] == "" {
+			return nil, fmt.Errorf("invalid git diff --name-status line %q", line)
+		}
+		for _, path := range fields[1:] {
+			paths = append(paths, unquoteGitPath(path))
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// readPorcelain reads the changed files of git status --porcelain output,
+// in version 1 or 2: every path with a staged, unstaged or untracked
+// change, and both the new and the original path of renames and copies.
+// Ignored files and header lines are skipped.
+func readPorcelain(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		linePaths, err := porcelainPaths(line)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range linePaths {
+			paths = append(paths, unquoteGitPath(path))
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// porcelainPaths returns the paths of a line of git status --porcelain
+// output. Version 2 lines start with a one-character record type, version
+// 1 lines with the two-character XY status.
+func porcelainPaths(line string) ([]string, error) {
+	if len(line) > 2 && line[1] == ' ' && strings.IndexByte("12u?!", line[0]) >= 0 {
+		// Version 2: the path follows the fields of the record type, and
+		// renames and copies add the original path after a tab.
+		fields := map[byte]int{'1': 8, '2': 9, 'u': 10, '?': 1, '!': 1}[line[0]]
+		parts := strings.SplitN(line, " ", fields+1)
+		if len(parts) != fields+1 {
+			return nil, fmt.Errorf("invalid git status --porcelain=v2 line %q", line)
+		}
+		switch line[0] {
+		case '!':
+			return nil, nil
+		case '2':
+			path, orig, ok := strings.Cut(parts[fields], "\t")
+			if !ok {
+				return nil, fmt.Errorf("invalid git status --porcelain=v2 line %q", line)
+			}
+			return []string{path, orig}, nil
+		}
+		return []string{parts[fields]}, nil
+	}
+
+	if len(line) < 4 || line[2] != ' ' {
+		return nil, fmt.Errorf("invalid git status --porcelain line %q", line)
+	}
+	if line[:2] == "!!" {
+		return nil, nil
+	}
+	path := line[3:]
+	if line[0] == 'R' || line[0] == 'C' || line[1] == 'R' || line[1] == 'C' {
+		// Renames and copies print the original path first.
+		if orig, renamed, ok := strings.Cut(path, " -> "); ok {
+			return []string{renamed, orig}, nil
+		}
+	}
+	return []string{path}, nil
+}
+
+// jsonChangedFile is an element of --stdin-format json input: a path, or a
+// file object of the GitHub API, as listed by the pull request files and
+// compare endpoints, whose previous_filename is also changed by a rename.
+type jsonChangedFile []string
+
+func (f *jsonChangedFile) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*f = jsonChangedFile{path}
+		return nil
+	}
+	var file struct {
+		Filename         string `json:"filename"`
+		PreviousFilename string `json:"previous_filename"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil || file.Filename == "" {
+		return fmt.Errorf("expected a path or an object with a filename, got %s", data)
+	}
+	*f = jsonChangedFile{file.Filename}
+	if file.PreviousFilename != "" {
+		*f = append(*f, file.PreviousFilename)
+	}
+	return nil
+}
+
+// readJSONPaths reads the changed files of JSON input: an array of paths or
+// of GitHub API file objects, or an object holding such an array in files,
+// such as a GitHub compare response. Several values may follow each other,
+// as gh api --paginate prints the pages of a list.
+func readJSONPaths(r io.Reader) ([]string, error) {
+	var paths []string
+	decoder := json.NewDecoder(r)
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == io.EOF {
+			return paths, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse changed files: %w", err)
+		}
+		var files []jsonChangedFile
+		if bytes.HasPrefix(value, []byte("{")) {
+			var object struct {
+				Files []jsonChangedFile `json:"files"`
+			}
+			if err := json.Unmarshal(value, &object); err != nil {
+				return nil, fmt.Errorf("failed to parse changed files: %w", err)
+			}
+			files = object.Files
+		} else if err := json.Unmarshal(value, &files); err != nil {
+			return nil, fmt.Errorf("failed to parse changed files: %w", err)
+		}
+		for _, file := range files {
+			paths = append(paths, file...)
+		}
+	}
+}
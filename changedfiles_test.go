@@ -0,0 +1,252 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnquoteGitPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"modules/vpc/main.tf", "modules/vpc/main.tf"},
+		{"modules/my vpc/main.tf", "modules/my vpc/main.tf"},
+		{`"modules/caf\303\251/main.tf"`, "modules/café/main.tf"},
+		{`"modules/tab\there/main.tf"`, "modules/tab\there/main.tf"},
+		{`"modules/\"quoted\"/main.tf"`, `modules/"quoted"/main.tf`},
+		{`"modules/back\\slash/main.tf"`, `modules/back\slash/main.tf`},
+		{`"unterminated\"`, `"unterminated\"`},
+		{`"`, `"`},
+	}
+	for _, tt := range tests {
+		if got := unquoteGitPath(tt.path); got != tt.expected {
+			t.Errorf("unquoteGitPath(%q) = %q, expected %q", tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestReadPaths_GitQuoted(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "app" {
+  source = "../../modules/café"
+}
+`,
+		"modules/café/main.tf": `variable "name" {}`,
+	})
+	output, err := Analyze(filepath.Join(tempDir, "envs", "prod"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	// As printed by git diff --name-only with the default core.quotePath.
+	input := "\n" + `"` + filepath.ToSlash(tempDir) + `/modules/caf\303\251/main.tf"` + "\n\n"
+	paths, err := readPaths(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("readPaths failed: %v", err)
+	}
+	expected := filepath.Join(tempDir, "modules", "café", "main.tf")
+	if len(paths) != 1 || paths[0] != filepath.ToSlash(expected) {
+		t.Fatalf("expected the unquoted path %s, got %q", expected, paths)
+	}
+	if !IsAffected(paths, output) {
+		t.Error("expected the unquoted path to affect the root")
+	}
+}
+
+func TestReadPorcelain(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name: "version 1",
+			input: `## main...origin/main
+ M envs/prod/main.tf
+M  modules/vpc/main.tf
+A  modules/new/main.tf
+ D modules/old/main.tf
+?? modules/vpc/outputs.tf
+!! .terraform/modules/modules.json
+R  modules/net/main.tf -> modules/network/main.tf
+RM "modules/caf\303\251/main.tf" -> "modules/my cafe/main.tf"
+`,
+			expected: []string{
+				"envs/prod/main.tf",
+				"modules/vpc/main.tf",
+				"modules/new/main.tf",
+				"modules/old/main.tf",
+				"modules/vpc/outputs.tf",
+				"modules/network/main.tf",
+				"modules/net/main.tf",
+				"modules/my cafe/main.tf",
+				"modules/café/main.tf",
+			},
+		},
+		{
+			name: "version 2",
+			input: `# branch.oid 4b825dc642cb6eb9a060e54bf8d69288fbee4904
+# branch.head main
+1 .M N... 100644 100644 100644 3f1c1d2 3f1c1d2 envs/prod/main.tf
+1 A. N... 000000 100644 100644 0000000 9a2b3c4 modules/my vpc/main.tf
+2 R. N... 100644 100644 100644 3f1c1d2 3f1c1d2 R100 modules/network/main.tf	modules/net/main.tf
+u UU N... 100644 100644 100644 100644 1111111 2222222 3333333 modules/conflict/main.tf
+? "modules/caf\303\251/main.tf"
+! .terraform/modules/modules.json
+`,
+			expected: []string{
+				"envs/prod/main.tf",
+				"modules/my vpc/main.tf",
+				"modules/network/main.tf",
+				"modules/net/main.tf",
+				"modules/conflict/main.tf",
+				"modules/café/main.tf",
+			},
+		},
+		{
+			name:     "empty",
+			input:    "\n",
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := readPorcelain(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("readPorcelain failed: %v", err)
+			}
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, paths)
+			}
+		})
+	}
+
+	for _, input := range []string{"modules/vpc/main.tf\n", "2 R. N... 100644 100644 100644 3f1c1d2 3f1c1d2 R100 modules/network/main.tf\n"} {
+		if _, err := readPorcelain(strings.NewReader(input)); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestReadJSONPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "array of paths",
+			input:    `["envs/prod/main.tf", "modules/café/main.tf"]`,
+			expected: []string{"envs/prod/main.tf", "modules/café/main.tf"},
+		},
+		{
+			name: "pull request files",
+			input: `[
+  {"sha": "bbcd538", "filename": "modules/vpc/main.tf", "status": "modified", "additions": 1, "deletions": 1},
+  {"sha": "3f1c1d2", "filename": "modules/network/main.tf", "status": "renamed", "previous_filename": "modules/net/main.tf"}
+]`,
+			expected: []string{"modules/vpc/main.tf", "modules/network/main.tf", "modules/net/main.tf"},
+		},
+		{
+			name:     "compare response",
+			input:    `{"status": "ahead", "ahead_by": 1, "files": [{"filename": "envs/prod/main.tf", "status": "modified"}]}`,
+			expected: []string{"envs/prod/main.tf"},
+		},
+		{
+			name:     "paginated",
+			input:    "[{\"filename\": \"a.tf\"}]\n[{\"filename\": \"b.tf\"}]\n",
+			expected: []string{"a.tf", "b.tf"},
+		},
+		{
+			name:     "empty",
+			input:    "",
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := readJSONPaths(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("readJSONPaths failed: %v", err)
+			}
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, paths)
+			}
+		})
+	}
+
+	for _, input := range []string{`envs/prod/main.tf`, `[{"status": "modified"}]`, `[1]`, `{"files": "a.tf"}`} {
+		if _, err := readJSONPaths(strings.NewReader(input)); err == nil {
+			t.Errorf("expected an error for %s", input)
+		}
+	}
+}
+
+func TestReadNULPaths(t *testing.T) {
+	paths, err := readNULPaths(strings.NewReader("envs/prod/main.tf\x00 leading space.tf\x00new\nline.tf\x00\x00modules/café/main.tf"))
+	if err != nil {
+		t.Fatalf("readNULPaths failed: %v", err)
+	}
+	expected := []string{"envs/prod/main.tf", " leading space.tf", "new\nline.tf", "modules/café/main.tf"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %q, got %q", expected, paths)
+	}
+}
+
+func TestReadNameStatus(t *testing.T) {
+	input := "M\tenvs/prod/main.tf\n" +
+		"A\tmodules/my vpc/main.tf\n" +
+		"D\tmodules/old/main.tf\r\n" +
+		"R087\tmodules/net/main.tf\tmodules/network/main.tf\n" +
+		"C100\tmodules/vpc/main.tf\tmodules/vpc2/main.tf\n" +
+		"T\t\"modules/caf\\303\\251/link.tf\"\n\n"
+	paths, err := readNameStatus(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("readNameStatus failed: %v", err)
+	}
+	expected := []string{
+		"envs/prod/main.tf",
+		"modules/my vpc/main.tf",
+		"modules/old/main.tf",
+		"modules/net/main.tf",
+		"modules/network/main.tf",
+		"modules/vpc/main.tf",
+		"modules/vpc2/main.tf",
+		"modules/café/link.tf",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %q, got %q", expected, paths)
+	}
+
+	for _, input := range []string{"envs/prod/main.tf\n", "R100\tmodules/net/main.tf\n", "M\ta.tf\tb.tf\n"} {
+		if _, err := readNameStatus(strings.NewReader(input)); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestAddStdinFormatFlag(t *testing.T) {
+	for _, name := range stdinFormatNames() {
+		flags := newFlagSet("test")
+		format := addStdinFormatFlag(flags)
+		if err := flags.Parse([]string{"--stdin-format", name}); err != nil || *format != name {
+			t.Errorf("expected --stdin-format %s to be accepted, got %q, %v", name, *format, err)
+		}
+	}
+
+	flags := newFlagSet("test")
+	flags.SetOutput(io.Discard)
+	format := addStdinFormatFlag(flags)
+	if *format != "lines" {
+		t.Errorf("expected the lines format by default, got %q", *format)
+	}
+	if err := flags.Parse([]string{"--stdin-format", "csv"}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
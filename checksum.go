@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// checksumHashes are the digest types of the checksum parameter of archive
+// addresses, keyed by name and by the length of their hex encoding, which
+// identifies the type of checksums given without one.
+var checksumHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+var checksumLengths = map[int]string{32: "md5", 40: "sha1", 64: "sha256", 128: "sha512"}
+
+// packageChecksum is an expected archive digest, as given by the checksum
+// parameter of an archive address such as a registry's download location:
+// sha256:<hex>, or the hex digest alone.
+type packageChecksum struct {
+	Type   string
+	Digest string
+}
+
+// String returns the checksum as <type>:<hex>.
+func (c packageChecksum) String() string {
+	return c.Type + ":" + c.Digest
+}
+
+// parseChecksum parses the value of a checksum parameter. Checksum files,
+// given as file:<url>, are not supported.
+func parseChecksum(value string) (packageChecksum, error) {
+	typ, digest, ok := strings.Cut(value, ":")
+	if !ok {
+		typ, digest = checksumLengths[len(value)], value
+	}
+	if _, known := checksumHashes[typ]; ok && !known {
+		return packageChecksum{}, fmt.Errorf("unsupported checksum type %q", typ)
+	}
+	digest = strings.ToLower(digest)
+	if _, err := hex.DecodeString(digest); err != nil || typ == "" {
+		return packageChecksum{}, fmt.Errorf("invalid checksum %q", value)
+	}
+	if checksumLengths[len(digest)] != typ {
+		return packageChecksum{}, fmt.Errorf("invalid %s checksum %q", typ, digest)
+	}
+	return packageChecksum{Type: typ, Digest: digest}, nil
+}
+
+// verify returns an error unless data has the checksum's digest.
+func (c packageChecksum) verify(data []byte) error {
+	h := checksumHashes[c.Type]()
+	h.Write(data)
+	if got := hex.EncodeToString(h.Sum(nil)); got != c.Digest {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s:%s", c, c.Type, got)
+	}
+	return nil
+}
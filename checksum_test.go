@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseChecksum(t *testing.T) {
+	sha := strings.Repeat("ab", 32)
+	tests := []struct {
+		value    string
+		expected string
+		wantErr  bool
+	}{
+		{"sha256:" + strings.ToUpper(sha), "sha256:" + sha, false},
+		{sha, "sha256:" + sha, false},
+		{"md5:" + strings.Repeat("0", 32), "md5:" + strings.Repeat("0", 32), false},
+		{"sha256:" + strings.Repeat("0", 32), "", true},
+		{"crc32:00000000", "", true},
+		{"file:https://example.com/SHA256SUMS", "", true},
+		{"sha256:not-hex", "", true},
+		{"abc", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			c, err := parseChecksum(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && c.String() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, c)
+			}
+		})
+	}
+}
+
+func TestFetch_RegistryChecksum(t *testing.T) {
+	archive := tarGz(t, map[string]string{"main.tf": `resource "aws_vpc" "this" {}`})
+	sum := sha256.Sum256(archive)
+	digest := hex.EncodeToString(sum[:])
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/terraform.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"modules.v1": "/api/modules/v1/"}`))
+	})
+	for name, checksum := range map[string]string{"vpc": "sha256:" + digest, "tampered": strings.Repeat("0", 64)} {
+		mux.HandleFunc("/api/modules/v1/org/"+name+"/aws/versions", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"modules":[{"versions":[{"version":"1.0.0"}]}]}`))
+		})
+		mux.HandleFunc("/api/modules/v1/org/"+name+"/aws/1.0.0/download", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Terraform-Get", "/archives/vpc.tar.gz?archive=tar.gz&checksum="+checksum)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	mux.HandleFunc("/archives/vpc.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "" {
+			t.Errorf("expected the archive parameters to be removed, got %q", r.URL.RawQuery)
+		}
+		w.Write(archive)
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+	fetcher := newModuleFetcher(server.Client(), ModuleInstallation{})
+
+	dest := filepath.Join(t.TempDir(), "vpc")
+	_, checksum, err := fetcher.fetch(context.Background(), host+"/org/vpc/aws", "", dest)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if checksum != "sha256:"+digest {
+		t.Errorf("expected the verified checksum sha256:%s, got %q", digest, checksum)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "main.tf")); err != nil {
+		t.Errorf("expected the verified archive to be extracted: %v", err)
+	}
+
+	dest = filepath.Join(t.TempDir(), "tampered")
+	if _, _, err := fetcher.fetch(context.Background(), host+"/org/tampered/aws", "", dest); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be extracted from a mismatching archive, got %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// CodeownersEntry assigns owners to a module directory that is part of the
+// module tree of one or more discovered roots.
+type CodeownersEntry struct {
+	Dir    string
+	Owners []string
+	Roots  []string
+}
+
+// PlanCodeowners returns an entry for every root and local module directory
+// of the discovered roots, sorted by directory, with the owners configured
+// for its nearest ancestor in owners. Directories without configured owners
+// are returned separately.
+func PlanCodeowners(discovery *Discovery, owners map[string][]string) (entries, unowned []CodeownersEntry) {
+	roots := make(map[string][]string)
+	for _, root := range discovery.Roots {
+		for _, dir := range append([]string{root.Path}, localModulePaths(root.Analysis)...) {
+			if !slices.Contains(roots[dir], root.Path) {
+				roots[dir] = append(roots[dir], root.Path)
+			}
+		}
+	}
+	dirs := make([]string, 0, len(roots))
+	for dir := range roots {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		entry := CodeownersEntry{Dir: dir, Roots: roots[dir]}
+		entry.Owners = configuredOwners(dir, owners)
+		if len(entry.Owners) == 0 {
+			unowned = append(unowned, entry)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, unowned
+}
+
+// configuredOwners returns the owners of the nearest ancestor of dir, or dir
+// itself, in owners.
+func configuredOwners(dir string, owners map[string][]string) []string {
+	for {
+		if teams, ok := owners[dir]; ok {
+			return teams
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// codeownersPath returns the CODEOWNERS pattern of a directory: its path
+// relative to the repository root, anchored with a leading slash.
+func codeownersPath(repoDir, dir string) (string, error) {
+	rel, err := filepath.Rel(repoDir, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the repository %s", dir, repoDir)
+	}
+	if rel == "." {
+		return "/", nil
+	}
+	return "/" + filepath.ToSlash(rel) + "/", nil
+}
+
+// writeCodeowners writes one CODEOWNERS line per entry. Entries are sorted
+// by directory, so nested directories follow their parents and take
+// precedence, as the last matching CODEOWNERS pattern wins.
+func writeCodeowners(w io.Writer, entries []CodeownersEntry, repoDir string) error {
+	fmt.Fprintf(w, "# Generated by %s codeowners.\n", programName)
+	for _, entry := range entries {
+		pattern, err := codeownersPath(repoDir, entry.Dir)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s %s\n", pattern, strings.Join(entry.Owners, " "))
+	}
+	return nil
+}
+
+// codeownersRule is a line of a CODEOWNERS file.
+type codeownersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// parseCodeowners reads the rules of a CODEOWNERS file.
+func parseCodeowners(data []byte) ([]codeownersRule, error) {
+	var rules []codeownersRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		pattern, err := compileCodeownersPattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern %q: %w", line, fields[0], err)
+		}
+		rule := codeownersRule{pattern: pattern}
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "#") {
+				break
+			}
+			rule.owners = append(rule.owners, owner)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// compileCodeownersPattern translates a gitignore-style CODEOWNERS pattern
+// into a regular expression over slash-separated paths relative to the
+// repository root. A pattern matching a directory matches everything below
+// it.
+func compileCodeownersPattern(pattern string) (*regexp.Regexp, error) {
+	p := strings.TrimPrefix(pattern, "/")
+	anchored := p != pattern
+	dirOnly := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+	if strings.Contains(p, "/") {
+		anchored = true
+	}
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case p[i] == '*':
+			re.WriteString("[^/]*")
+		case p[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	if dirOnly {
+		re.WriteString("/.*$")
+	} else {
+		re.WriteString("(?:/.*)?$")
+	}
+	return regexp.Compile(re.String())
+}
+
+// codeownersOf returns the owners of a slash-separated path relative to the
+// repository root. The last matching rule wins; a rule without owners
+// leaves the path unowned.
+func codeownersOf(rules []codeownersRule, path string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].pattern.MatchString(path) {
+			return rules[i].owners
+		}
+	}
+	return nil
+}
+
+// CodeownersProblem is a module file that CODEOWNERS leaves unowned, or
+// assigns to other owners than the configuration.
+type CodeownersProblem struct {
+	Kind     string
+	File     string
+	Owners   []string
+	Expected []string
+}
+
+const (
+	problemUnowned  = "unowned"
+	problemMismatch = "mismatch"
+)
+
+// CheckCodeowners verifies that rules assign owners to every Terraform file
+// in the module trees of the discovered roots and, where owners are
+// configured for the file's module directory, that they are the same.
+func CheckCodeowners(discovery *Discovery, owners map[string][]string, rules []codeownersRule, repoDir string) []CodeownersProblem {
+	seen := make(map[string]bool)
+	var problems []CodeownersProblem
+	check := func(dir string, files []string) {
+		expected := configuredOwners(dir, owners)
+		for _, file := range files {
+			if seen[file] {
+				continue
+			}
+			seen[file] = true
+			rel, err := filepath.Rel(repoDir, file)
+			if err != nil {
+				continue
+			}
+			actual := codeownersOf(rules, filepath.ToSlash(rel))
+			switch {
+			case len(actual) == 0:
+				problems = append(problems, CodeownersProblem{Kind: problemUnowned, File: file, Expected: expected})
+			case len(expected) > 0 && !sameOwners(actual, expected):
+				problems = append(problems, CodeownersProblem{Kind: problemMismatch, File: file, Owners: actual, Expected: expected})
+			}
+		}
+	}
+	for _, root := range discovery.Roots {
+		check(root.Path, root.Analysis.RootModule.Files)
+		for _, m := range root.Analysis.LocalModules {
+			check(m.ResolvedPath, m.Files)
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool {
+		return problems[i].File < problems[j].File
+	})
+	return problems
+}
+
+// sameOwners reports whether a and b list the same owners in any order,
+// comparing case-insensitively as GitHub does.
+func sameOwners(a, b []string) bool {
+	normalize := func(owners []string) []string {
+		var out []string
+		for _, o := range owners {
+			out = append(out, strings.ToLower(o))
+		}
+		sort.Strings(out)
+		return slices.Compact(out)
+	}
+	return slices.Equal(normalize(a), normalize(b))
+}
+
+func writeCodeownersProblems(w io.Writer, problems []CodeownersProblem) {
+	for _, p := range problems {
+		switch p.Kind {
+		case problemUnowned:
+			fmt.Fprintf(w, "%s\t%s\n", p.Kind, p.File)
+		case problemMismatch:
+			fmt.Fprintf(w, "%s\t%s\t%s (configured: %s)\n", p.Kind, p.File, strings.Join(p.Owners, " "), strings.Join(p.Expected, " "))
+		}
+	}
+}
+
+func runCodeowners(args []string) (code int) {
+	flags := newFlagSet("codeowners")
+	check := flags.String("check", "", "verify this CODEOWNERS file instead of generating one (exit 0=every module file owned as configured, 1=problems found)")
+	configPath := flags.String("config", "", "configuration file with owners (default "+defaultConfigFile+" in the working directory, if present)")
+	outputPath := flags.String("output", "", "write the generated CODEOWNERS to this file, atomically replacing it, instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s codeowners [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Generate or check CODEOWNERS entries covering the module tree of every root\n")
+		fmt.Fprintf(flags.Output(), "under a directory, from the owners mapping of the configuration file. Paths\n")
+		fmt.Fprintf(flags.Output(), "are relative to the working directory, which should be the repository root.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	repoDir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	discovery, err := DiscoverWithOptions(flags.Arg(0), config.analyzeOptions())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	if *check != "" {
+		data, err := os.ReadFile(*check)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		rules, err := parseCodeowners(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", *check, err)
+			return exitError
+		}
+		problems := CheckCodeowners(discovery, config.Owners, rules, repoDir)
+		writeCodeownersProblems(os.Stdout, problems)
+		if len(problems) > 0 {
+			return exitInvalid
+		}
+		return exitValid
+	}
+
+	entries, unowned := PlanCodeowners(discovery, config.Owners)
+	for _, entry := range unowned {
+		fmt.Fprintf(os.Stderr, "Warning: no owners configured for %s (used by %s)\n", entry.Dir, strings.Join(entry.Roots, ", "))
+	}
+	stdout, outputFile := newOutput(*outputPath)
+	defer func() { code = outputFile.close(code) }()
+	if err := writeCodeowners(stdout, entries, repoDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return 0
+}
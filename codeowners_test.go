@@ -0,0 +1,94 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompileCodeownersPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*", "infra/envs/prod/main.tf", true},
+		{"*.tf", "infra/main.tf", true},
+		{"/infra/modules/", "infra/modules/vpc/main.tf", true},
+		{"/infra/modules/", "other/infra/modules/main.tf", false},
+		{"modules/", "infra/modules/vpc/main.tf", true},
+		{"infra/envs/*", "infra/envs/prod", true},
+		{"infra/envs/*", "infra/envs/prod/main.tf", true},
+		{"/infra/**/main.tf", "infra/envs/prod/main.tf", true},
+		{"/infra/**/main.tf", "infra/envs/prod/outputs.tf", false},
+		{"docs/**", "docs/a/b.md", true},
+	}
+	for _, tt := range tests {
+		re, err := compileCodeownersPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("compileCodeownersPattern(%q) failed: %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("pattern %q on %q: expected %v, got %v", tt.pattern, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestCodeowners(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"infra/envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+
+module "dns" {
+  source = "../../shared/dns"
+}
+`,
+		"infra/modules/vpc/main.tf": `variable "cidr" {}`,
+		"infra/shared/dns/main.tf":  `variable "zone" {}`,
+	})
+	discovery, err := Discover(filepath.Join(tempDir, "infra"))
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	owners := map[string][]string{
+		filepath.Join(tempDir, "infra", "envs"):    {"@org/platform"},
+		filepath.Join(tempDir, "infra", "modules"): {"@org/network", "@org/platform"},
+	}
+
+	entries, unowned := PlanCodeowners(discovery, owners)
+	if len(unowned) != 1 || unowned[0].Dir != filepath.Join(tempDir, "infra", "shared", "dns") {
+		t.Errorf("expected shared/dns to be unowned, got %+v", unowned)
+	}
+	var b strings.Builder
+	if err := writeCodeowners(&b, entries, tempDir); err != nil {
+		t.Fatalf("writeCodeowners failed: %v", err)
+	}
+	expected := "# Generated by terraform-module-resolve codeowners.\n" +
+		"/infra/envs/prod/ @org/platform\n" +
+		"/infra/modules/vpc/ @org/network @org/platform\n"
+	if b.String() != expected {
+		t.Errorf("unexpected CODEOWNERS\nexpected:\n%s\ngot:\n%s", expected, b.String())
+	}
+
+	rules, err := parseCodeowners([]byte(`# Infrastructure
+/infra/ @org/platform
+/infra/modules/ @ORG/platform @org/network # reviewed by networking
+/infra/shared/
+`))
+	if err != nil {
+		t.Fatalf("parseCodeowners failed: %v", err)
+	}
+	problems := CheckCodeowners(discovery, owners, rules, tempDir)
+	if len(problems) != 1 || problems[0].Kind != problemUnowned || !strings.HasSuffix(problems[0].File, filepath.Join("shared", "dns", "main.tf")) {
+		t.Errorf("expected only shared/dns/main.tf to be unowned, got %+v", problems)
+	}
+
+	rules, _ = parseCodeowners([]byte("* @org/platform\n"))
+	problems = CheckCodeowners(discovery, owners, rules, tempDir)
+	if len(problems) != 1 || problems[0].Kind != problemMismatch || !strings.HasSuffix(problems[0].File, filepath.Join("vpc", "main.tf")) {
+		t.Errorf("expected a mismatch for modules/vpc/main.tf, got %+v", problems)
+	}
+}
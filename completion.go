@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// programName is the name completions and the man page are generated for.
+const programName = "terraform-module-resolve"
+
+// flagSetRecorder, when set, receives every flag set created by a command
+// handler. describeCommand uses it to read a command's flag definitions.
+var flagSetRecorder func(*flag.FlagSet)
+
+// newFlagSet returns the flag set of a command. Handlers must create it
+// with this function and write their usage to flags.Output() so that
+// completions and the man page can be derived from them.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	if flagSetRecorder != nil {
+		flagSetRecorder(flags)
+	}
+	return flags
+}
+
+func init() {
+	// Registered here because the generators read subcommands, which
+	// would otherwise refer to itself during initialization.
+	subcommands["completion"] = runCompletion
+	subcommands["man"] = runMan
+}
+
+// commandInfo describes a command as defined by its handler.
+type commandInfo struct {
+	// Name is the subcommand name, empty for the default command.
+	Name string
+
+	// Synopsis lists the usage lines without their "Usage:" prefix.
+	Synopsis []string
+
+	// Description is the paragraphs of the usage text between the synopsis
+	// and the options, and any that follow the options.
+	Description []string
+
+	Flags []*flag.Flag
+}
+
+// Summary returns the first sentence of the command's description.
+func (c commandInfo) Summary() string {
+	if len(c.Description) == 0 {
+		return ""
+	}
+	summary, _, _ := strings.Cut(strings.Join(strings.Fields(c.Description[0]), " "), ". ")
+	return strings.TrimSuffix(summary, ".")
+}
+
+// describeCommands returns the default command followed by the
+// subcommands in name order.
+func describeCommands() []commandInfo {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	commands := []commandInfo{describeCommand("", runAnalyze)}
+	for _, name := range names {
+		commands = append(commands, describeCommand(name, subcommands[name]))
+	}
+	return commands
+}
+
+// describeCommand runs a handler with -h to capture its flag set and usage
+// text. Handlers return as soon as parsing their flags fails.
+func describeCommand(name string, run func(args []string) int) commandInfo {
+	var flags *flag.FlagSet
+	var usage bytes.Buffer
+	flagSetRecorder = func(f *flag.FlagSet) {
+		flags = f
+		f.SetOutput(&usage)
+	}
+	arg0 := os.Args[0]
+	os.Args[0] = programName
+	defer func() {
+		flagSetRecorder = nil
+		os.Args[0] = arg0
+	}()
+	run([]string{"-h"})
+
+	info := commandInfo{Name: name}
+	if flags == nil {
+		return info
+	}
+	flags.VisitAll(func(f *flag.Flag) {
+		info.Flags = append(info.Flags, f)
+	})
+	for i, paragraph := range strings.Split(strings.TrimSpace(usage.String()), "\n\n") {
+		if i == 0 {
+			for _, line := range strings.Split(paragraph, "\n") {
+				line = strings.TrimPrefix(strings.TrimSpace(line), "Usage:")
+				info.Synopsis = append(info.Synopsis, strings.TrimSpace(line))
+			}
+			continue
+		}
+		if strings.HasPrefix(paragraph, "Options:") {
+			continue
+		}
+		info.Description = append(info.Description, paragraph)
+	}
+	return info
+}
+
+// isBoolFlag reports whether f takes no value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// completionShells maps the shells of the completion command to their
+// script generators.
+var completionShells = map[string]func(w io.Writer, commands []commandInfo){
+	"bash": writeBashCompletion,
+	"fish": writeFishCompletion,
+	"zsh":  writeZshCompletion,
+}
+
+func runCompletion(args []string) int {
+	flags := newFlagSet("completion")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s completion bash|zsh|fish\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Print a shell completion script for the commands and their flags.\n\n")
+		fmt.Fprintf(flags.Output(), "Examples:\n")
+		fmt.Fprintf(flags.Output(), "  source <(%s completion bash)\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  %s completion zsh > \"${fpath[1]}/_%s\"\n", os.Args[0], programName)
+		fmt.Fprintf(flags.Output(), "  %s completion fish > ~/.config/fish/completions/%s.fish\n", os.Args[0], programName)
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitError
+	}
+	write, ok := completionShells[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown shell %q\n", flags.Arg(0))
+		return exitError
+	}
+	write(os.Stdout, describeCommands())
+	return 0
+}
+
+// completionFunc is the shell function name of the completion scripts.
+var completionFunc = "_" + strings.ReplaceAll(programName, "-", "_")
+
+func flagNames(flags []*flag.Flag, values bool) string {
+	var names []string
+	for _, f := range flags {
+		if !values || !isBoolFlag(f) {
+			names = append(names, "--"+f.Name)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+func writeBashCompletion(w io.Writer, commands []commandInfo) {
+	var names []string
+	for _, c := range commands[1:] {
+		names = append(names, c.Name)
+	}
+
+	fmt.Fprintf(w, "# bash completion for %s\n", programName)
+	fmt.Fprintf(w, "%s() {\n", completionFunc)
+	fmt.Fprintf(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	fmt.Fprintf(w, "\tlocal commands=%q flags valueflags\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "\tcase ${COMP_WORDS[1]} in\n")
+	for _, c := range commands[1:] {
+		fmt.Fprintf(w, "\t%s) flags=%q valueflags=%q ;;\n", c.Name, flagNames(c.Flags, false), flagNames(c.Flags, true))
+	}
+	fmt.Fprintf(w, "\t*) flags=%q valueflags=%q ;;\n", flagNames(commands[0].Flags, false), flagNames(commands[0].Flags, true))
+	fmt.Fprintf(w, "\tesac\n")
+	fmt.Fprintf(w, "\tif [[ \" $valueflags \" == *\" $prev \"* ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\telif [[ $cur == -* ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\telif [[ $COMP_CWORD -eq 1 ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"$commands\" -- \"$cur\") $(compgen -d -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\telse\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\tfi\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o filenames -F %s %s\n", completionFunc, programName)
+}
+
+// zshSpec returns the _arguments specification of a flag.
+func zshSpec(f *flag.Flag) string {
+	usage := strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(f.Usage)
+	spec := fmt.Sprintf("--%s[%s]", f.Name, usage)
+	if !isBoolFlag(f) {
+		valueName, _ := flag.UnquoteUsage(f)
+		spec += ":" + valueName + ":_files"
+	}
+	return shellQuote(spec)
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func writeZshCompletion(w io.Writer, commands []commandInfo) {
+	fmt.Fprintf(w, "#compdef %s\n\n", programName)
+	fmt.Fprintf(w, "%s() {\n", completionFunc)
+	fmt.Fprintf(w, "\tlocal state\n")
+	fmt.Fprintf(w, "\tlocal -a commands\n")
+	fmt.Fprintf(w, "\tcommands=(\n")
+	for _, c := range commands[1:] {
+		fmt.Fprintf(w, "\t\t%s\n", shellQuote(c.Name+":"+strings.ReplaceAll(c.Summary(), ":", `\:`)))
+	}
+	fmt.Fprintf(w, "\t)\n\n")
+	fmt.Fprintf(w, "\tif (( CURRENT > 2 )); then\n")
+	fmt.Fprintf(w, "\t\tcase $words[2] in\n")
+	for _, c := range commands[1:] {
+		fmt.Fprintf(w, "\t\t%s)\n", c.Name)
+		fmt.Fprintf(w, "\t\t\tshift words\n")
+		fmt.Fprintf(w, "\t\t\t(( CURRENT-- ))\n")
+		fmt.Fprintf(w, "\t\t\t_arguments -s")
+		for _, f := range c.Flags {
+			fmt.Fprintf(w, " \\\n\t\t\t\t%s", zshSpec(f))
+		}
+		fmt.Fprintf(w, " \\\n\t\t\t\t'*:file:_files'\n")
+		fmt.Fprintf(w, "\t\t\treturn\n")
+		fmt.Fprintf(w, "\t\t\t;;\n")
+	}
+	fmt.Fprintf(w, "\t\tesac\n")
+	fmt.Fprintf(w, "\tfi\n\n")
+	fmt.Fprintf(w, "\t_arguments -s")
+	for _, f := range commands[0].Flags {
+		fmt.Fprintf(w, " \\\n\t\t%s", zshSpec(f))
+	}
+	fmt.Fprintf(w, " \\\n\t\t'1: :->first' \\\n\t\t'*:file:_files'\n")
+	fmt.Fprintf(w, "\tif [[ $state == first ]]; then\n")
+	fmt.Fprintf(w, "\t\t_describe -t commands command commands\n")
+	fmt.Fprintf(w, "\t\t_files -/\n")
+	fmt.Fprintf(w, "\tfi\n")
+	fmt.Fprintf(w, "}\n\n")
+	fmt.Fprintf(w, "%s \"$@\"\n", completionFunc)
+}
+
+func writeFishCompletion(w io.Writer, commands []commandInfo) {
+	fishQuote := func(s string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+	}
+	writeFlags := func(condition string, flags []*flag.Flag) {
+		for _, f := range flags {
+			fmt.Fprintf(w, "complete -c %s -n %s -l %s", programName, fishQuote(condition), f.Name)
+			if !isBoolFlag(f) {
+				fmt.Fprintf(w, " -r")
+			}
+			fmt.Fprintf(w, " -d %s\n", fishQuote(f.Usage))
+		}
+	}
+
+	var names []string
+	for _, c := range commands[1:] {
+		names = append(names, c.Name)
+	}
+	fmt.Fprintf(w, "# fish completion for %s\n", programName)
+	for _, c := range commands[1:] {
+		fmt.Fprintf(w, "complete -c %s -n '__fish_use_subcommand' -a %s -d %s\n", programName, c.Name, fishQuote(c.Summary()))
+	}
+	writeFlags("not __fish_seen_subcommand_from "+strings.Join(names, " "), commands[0].Flags)
+	for _, c := range commands[1:] {
+		writeFlags("__fish_seen_subcommand_from "+c.Name, c.Flags)
+	}
+}
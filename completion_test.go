@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDescribeCommands(t *testing.T) {
+	arg0 := os.Args[0]
+	commands := describeCommands()
+	if os.Args[0] != arg0 {
+		t.Errorf("expected os.Args[0] to be restored, got %q", os.Args[0])
+	}
+
+	if len(commands) != len(subcommands)+1 || commands[0].Name != "" {
+		t.Fatalf("expected the default command and %d subcommands, got %d", len(subcommands), len(commands))
+	}
+	for _, c := range commands {
+		if len(c.Synopsis) == 0 || !strings.HasPrefix(c.Synopsis[0], programName) {
+			t.Errorf("command %q: unexpected synopsis %q", c.Name, c.Synopsis)
+		}
+		if c.Summary() == "" {
+			t.Errorf("command %q: missing description", c.Name)
+		}
+	}
+
+	byName := make(map[string]commandInfo)
+	for _, c := range commands {
+		byName[c.Name] = c
+	}
+	var vendorFlags []string
+	for _, f := range byName["vendor"].Flags {
+		vendorFlags = append(vendorFlags, f.Name)
+	}
+	if !strings.Contains(strings.Join(vendorFlags, " "), "rewrite") {
+		t.Errorf("expected vendor flags to include rewrite, got %v", vendorFlags)
+	}
+	if got := byName["vendor"].Summary(); !strings.HasSuffix(got, "rewriting their sources to local paths") {
+		t.Errorf("expected the summary to span wrapped lines, got %q", got)
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	commands := describeCommands()
+	for shell, write := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			var buf bytes.Buffer
+			write(&buf, commands)
+			script := buf.String()
+			for _, want := range []string{"validate", "files-only", "rewrite"} {
+				if !strings.Contains(script, want) {
+					t.Errorf("expected the %s script to mention %q", shell, want)
+				}
+			}
+
+			path, err := exec.LookPath(shell)
+			if err != nil {
+				return
+			}
+			file := filepath.Join(t.TempDir(), "completion")
+			if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := exec.Command(path, "-n", file).CombinedOutput(); err != nil {
+				t.Errorf("%s -n failed: %v\n%s", shell, err, out)
+			}
+		})
+	}
+}
+
+func TestWriteManPage(t *testing.T) {
+	var buf bytes.Buffer
+	writeManPage(&buf, describeCommands())
+	page := buf.String()
+
+	for _, want := range []string{
+		".TH TERRAFORM\\-MODULE\\-RESOLVE 1",
+		".SH NAME\nterraform\\-module\\-resolve \\- resolve the local and remote modules",
+		".SS vendor\n",
+		"\\fB\\-\\-rewrite\\fR\n",
+		"\\fB\\-\\-format\\fR \\fIstring\\fR\n",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected man page to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultConfigFile is read from the working directory when no --config
+// flag is given.
+const defaultConfigFile = ".terraform-module-resolve.json"
+
+// Config is the optional configuration file shared by the commands.
+type Config struct {
+	// Replace maps remote module sources to local directories, like replace
+	// directives in go.mod. Keys may omit the ref query and //subdir of the
+	// sources they replace; a subdirectory is resolved inside the
+	// replacement. Relative directories are resolved against the directory
+	// containing the configuration file.
+	Replace map[string]string `json:"replace,omitempty"`
+
+	// ModuleInstallation selects the mirrors registry modules are fetched
+	// from. A relative filesystem mirror is resolved against the directory
+	// containing the configuration file.
+	ModuleInstallation ModuleInstallation `json:"module_installation,omitzero"`
+
+	// Owners maps directories to the CODEOWNERS owners, such as @org/team,
+	// of the module directories inside them; the nearest configured
+	// ancestor of a module directory owns it. Relative directories are
+	// resolved against the directory containing the configuration file.
+	Owners map[string][]string `json:"owners,omitempty"`
+
+	// Dependencies maps root module directories to the roots they depend
+	// on, such as roots whose outputs they read, so that generated
+	// pipelines run dependencies first. Relative directories are resolved
+	// against the directory containing the configuration file.
+	Dependencies map[string][]string `json:"dependencies,omitempty"`
+
+	// Workspaces maps root module directories to the Terraform Cloud
+	// workspaces and Spacelift stacks that apply them. Relative directories
+	// are resolved against the directory containing the configuration file.
+	Workspaces map[string][]Workspace `json:"workspaces,omitempty"`
+
+	// IncludeGlobs maps module directories to globs, relative to the
+	// module, of the files other than Terraform files that belong to it,
+	// such as templates/** or scripts/*.sh. Relative directories are
+	// resolved against the directory containing the configuration file.
+	IncludeGlobs map[string][]string `json:"include_globs,omitempty"`
+
+	// Projects declares named deployments of root modules, each with its
+	// own variable files and workspace. Discovery, affected detection and
+	// the generated pipelines then operate on projects instead of bare
+	// root directories. Relative directories, variable files and inputs
+	// are resolved against the directory containing the configuration
+	// file.
+	Projects []Project `json:"projects,omitempty"`
+
+	// RootFiles enables or disables, by class, the files that Terraform
+	// only reads in the root module and that affect only the root they
+	// belong to: lock for .terraform.lock.hcl, backend for backend.hcl,
+	// *.backend.hcl and *.backend.tfvars, and cloud for Terraform files
+	// that only hold the backend or cloud block. Classes that are not
+	// listed are enabled.
+	RootFiles map[string]bool `json:"root_files,omitempty"`
+}
+
+// LoadConfig reads the configuration file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	base, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	for source, dir := range config.Replace {
+		if isLocalPath(source) {
+			return nil, fmt.Errorf("invalid config %s: cannot replace local source %q", path, source)
+		}
+		if !filepath.IsAbs(dir) {
+			config.Replace[source] = filepath.Join(base, filepath.FromSlash(dir))
+		}
+	}
+	config.Owners = resolveDirKeys(base, config.Owners)
+	config.IncludeGlobs = resolveDirKeys(base, config.IncludeGlobs)
+	config.Dependencies = resolveDirKeys(base, config.Dependencies)
+	for root, deps := range config.Dependencies {
+		for i, dep := range deps {
+			deps[i] = resolveConfigDir(base, dep)
+		}
+		config.Dependencies[root] = deps
+	}
+	if len(config.Workspaces) > 0 {
+		workspaces := make(map[string][]Workspace, len(config.Workspaces))
+		for dir, ws := range config.Workspaces {
+			workspaces[resolveConfigDir(base, dir)] = ws
+		}
+		config.Workspaces = workspaces
+	}
+	if err := validateProjects(config.Projects); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := validateRootFiles(config.RootFiles); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	for i, p := range config.Projects {
+		config.Projects[i].Dir = resolveConfigDir(base, p.Dir)
+		for j, f := range p.VarFiles {
+			p.VarFiles[j] = resolveConfigDir(base, f)
+		}
+		for j, input := range p.Inputs {
+			p.Inputs[j] = resolveConfigDir(base, input)
+		}
+	}
+	if dir := config.ModuleInstallation.FilesystemMirror; dir != "" && !filepath.IsAbs(dir) {
+		config.ModuleInstallation.FilesystemMirror = filepath.Join(base, filepath.FromSlash(dir))
+	}
+	return &config, nil
+}
+
+// analyzeOptions returns the AnalyzeOptions that the configuration sets.
+func (c *Config) analyzeOptions() AnalyzeOptions {
+	return AnalyzeOptions{Replace: c.Replace, ModuleIncludeGlobs: c.IncludeGlobs, RootFiles: c.RootFiles}
+}
+
+// resolveConfigDir resolves a directory of the configuration file relative
+// to base, the directory containing it.
+func resolveConfigDir(base, dir string) string {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(base, filepath.FromSlash(dir))
+	}
+	return filepath.Clean(dir)
+}
+
+// resolveDirKeys returns m with its directory keys resolved against base.
+func resolveDirKeys(base string, m map[string][]string) map[string][]string {
+	if len(m) == 0 {
+		return m
+	}
+	resolved := make(map[string][]string, len(m))
+	for dir, values := range m {
+		resolved[resolveConfigDir(base, dir)] = values
+	}
+	return resolved
+}
+
+// loadConfigFlag loads the file named by a --config flag, or the default
+// configuration file when path is empty and the file exists.
+func loadConfigFlag(path string) (*Config, error) {
+	if path != "" {
+		return LoadConfig(path)
+	}
+	config, err := LoadConfig(defaultConfigFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	return config, err
+}
+
+// resolveModuleDir returns the directory a module call with source in dir
+// refers to: the directory of a local path, or the replacement of a remote
+// source. replaced reports the latter, and ok is false for remote sources
+// without a replacement.
+func resolveModuleDir(dir, source string, replace map[string]string) (path string, replaced, ok bool) {
+	if isLocalPath(source) {
+		path, _ = filepath.Abs(filepath.Join(dir, source))
+		return path, false, true
+	}
+	if len(replace) == 0 {
+		return "", false, false
+	}
+
+	if target, ok := replace[source]; ok {
+		return target, true, true
+	}
+	pkg, subdir := splitSourceSubdir(source)
+	target, ok := replace[pkg]
+	if !ok {
+		base, _, _ := strings.Cut(pkg, "?")
+		if target, ok = replace[base]; !ok {
+			return "", false, false
+		}
+	}
+	return filepath.Join(target, filepath.FromSlash(subdir)), true, true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"infra/.terraform-module-resolve.json": `{
+  "replace": {
+    "git::https://github.com/org/networking.git": "../networking",
+    "terraform-aws-modules/vpc/aws": "/opt/vpc"
+  },
+  "owners": {
+    "modules/network/": ["@org/network"]
+  },
+  "dependencies": {
+    "envs/app": ["envs/network"]
+  },
+  "workspaces": {
+    "envs/app": [{"tfc": "acme/app"}, {"spacelift": "app"}]
+  }
+}`,
+	})
+
+	config, err := LoadConfig(filepath.Join(tempDir, "infra", defaultConfigFile))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if got := config.Replace["git::https://github.com/org/networking.git"]; got != filepath.Join(tempDir, "networking") {
+		t.Errorf("expected relative replacement to resolve against the config directory, got %s", got)
+	}
+	if got := config.Replace["terraform-aws-modules/vpc/aws"]; got != "/opt/vpc" {
+		t.Errorf("expected absolute replacement to be kept, got %s", got)
+	}
+
+	if got := config.Owners[filepath.Join(tempDir, "infra", "modules", "network")]; len(got) != 1 || got[0] != "@org/network" {
+		t.Errorf("expected owners keyed by the resolved directory, got %v", config.Owners)
+	}
+	if got := config.Dependencies[filepath.Join(tempDir, "infra", "envs", "app")]; len(got) != 1 || got[0] != filepath.Join(tempDir, "infra", "envs", "network") {
+		t.Errorf("expected dependencies resolved against the config directory, got %v", config.Dependencies)
+	}
+	if got := config.Workspaces[filepath.Join(tempDir, "infra", "envs", "app")]; len(got) != 2 || got[0].TFC != "acme/app" || got[1].Spacelift != "app" {
+		t.Errorf("expected workspaces keyed by the resolved directory, got %v", config.Workspaces)
+	}
+
+	writeTestFiles(t, tempDir, map[string]string{"bad.json": `{"replace": {"./modules/x": "../x"}}`})
+	if _, err := LoadConfig(filepath.Join(tempDir, "bad.json")); err == nil {
+		t.Error("expected an error when replacing a local source")
+	}
+}
+
+func TestLoadConfigFlag_MissingDefault(t *testing.T) {
+	t.Chdir(t.TempDir())
+	config, err := loadConfigFlag("")
+	if err != nil {
+		t.Fatalf("expected a missing default config to be ignored, got %v", err)
+	}
+	if len(config.Replace) != 0 {
+		t.Errorf("expected an empty config, got %+v", config)
+	}
+	if _, err := loadConfigFlag("missing.json"); !os.IsNotExist(err) {
+		t.Errorf("expected an explicit missing config to fail, got %v", err)
+	}
+}
+
+func TestAnalyze_Replace(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"app/main.tf": `
+module "vpc" {
+  source = "git::https://github.com/org/networking.git//modules/vpc?ref=v1.2.0"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+		"networking/modules/vpc/main.tf": `
+module "subnets" {
+  source = "../subnets"
+}
+`,
+		"networking/modules/subnets/main.tf": `variable "cidr" {}`,
+	})
+
+	replace := map[string]string{"git::https://github.com/org/networking.git": filepath.Join(tempDir, "networking")}
+	output, err := AnalyzeWithOptions(filepath.Join(tempDir, "app"), AnalyzeOptions{Replace: replace})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	if len(output.LocalModules) != 2 {
+		t.Fatalf("expected the replaced module and its local call, got %+v", output.LocalModules)
+	}
+	vpc := output.LocalModules[0]
+	if vpc.ResolvedPath != filepath.Join(tempDir, "networking", "modules", "vpc") || !vpc.Replaced {
+		t.Errorf("expected vpc to be replaced by the local subdirectory, got %+v", vpc)
+	}
+	if output.LocalModules[1].Name != "subnets" || output.LocalModules[1].Replaced {
+		t.Errorf("expected subnets as a plain local module, got %+v", output.LocalModules[1])
+	}
+	if len(output.RemoteModules) != 1 || output.RemoteModules[0].Name != "label" {
+		t.Errorf("expected only label to stay remote, got %+v", output.RemoteModules)
+	}
+
+	changed := []string{filepath.Join(tempDir, "networking", "modules", "subnets", "main.tf")}
+	if !IsAffected(changed, output) {
+		t.Error("expected a change in the local checkout to affect the root")
+	}
+}
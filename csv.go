@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// renderCSV writes one row per module: the root module, every local module
+// call and every remote module call.
+func renderCSV(w io.Writer, output *Output, opts renderOptions) error {
+	cw := csv.NewWriter(w)
+	rows := [][]string{
+		{"name", "kind", "source", "version", "resolved_path", "caller", "file_count"},
+		{"(root)", kindRoot, "", "", output.RootModule.ResolvedPath, "", strconv.Itoa(len(output.RootModule.Files))},
+	}
+	for _, m := range output.LocalModules {
+		rows = append(rows, []string{m.Name, kindLocal, m.Source, "", m.ResolvedPath, m.CalledFrom, strconv.Itoa(len(m.Files))})
+	}
+	for _, r := range output.RemoteModules {
+		rows = append(rows, []string{r.Name, kindRemote, r.Source, r.Version, "", r.CalledFrom, ""})
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestRenderCSV(t *testing.T) {
+	output := &Output{
+		RootModule: ModuleDetail{ResolvedPath: "/repo/root", Files: []string{"/repo/root/main.tf"}},
+		LocalModules: []ModuleDetail{
+			{Name: "vpc", Source: "../modules/vpc", ResolvedPath: "/repo/modules/vpc", Files: []string{"/repo/modules/vpc/main.tf", "/repo/modules/vpc/outputs.tf"}, CalledFrom: "(root)"},
+		},
+		RemoteModules: []RemoteModule{
+			{Name: "eks", Source: "terraform-aws-modules/eks/aws", Version: "~> 19.0", CalledFrom: "(root)"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := renderCSV(&buf, output, renderOptions{}); err != nil {
+		t.Fatalf("renderCSV failed: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+
+	expected := [][]string{
+		{"name", "kind", "source", "version", "resolved_path", "caller", "file_count"},
+		{"(root)", "root", "", "", "/repo/root", "", "1"},
+		{"vpc", "local", "../modules/vpc", "", "/repo/modules/vpc", "(root)", "2"},
+		{"eks", "remote", "terraform-aws-modules/eks/aws", "~> 19.0", "", "(root)", ""},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d rows, got %d: %v", len(expected), len(records), records)
+	}
+	for i := range expected {
+		for j := range expected[i] {
+			if records[i][j] != expected[i][j] {
+				t.Errorf("row %d column %d: expected %q, got %q", i, j, expected[i][j], records[i][j])
+			}
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// analysisMemo keeps the analyses and discoveries computed by a daemon
+// until reset, which the daemon calls whenever a file under the served
+// directory, or watched for a kept analysis, changes. A nil memo computes
+// every result.
+type analysisMemo struct {
+	mu          sync.Mutex
+	generation  int
+	outputs     map[string]*Output
+	discoveries map[string]*Discovery
+
+	// watch, when set, is called with the directories of the modules of
+	// every analysis before it is kept, as returned by watchTargets.
+	watch func(dirs []string)
+}
+
+func newAnalysisMemo() *analysisMemo {
+	return &analysisMemo{outputs: make(map[string]*Output), discoveries: make(map[string]*Discovery)}
+}
+
+// reset forgets every result, including those still being computed.
+func (m *analysisMemo) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generation++
+	clear(m.outputs)
+	clear(m.discoveries)
+}
+
+// output returns the kept analysis of dir, or calls analyze and keeps its
+// result unless it failed or a file changed meanwhile.
+func (m *analysisMemo) output(dir string, analyze func() (*Output, error)) (*Output, error) {
+	if m == nil {
+		return analyze()
+	}
+	return memoize(m, m.outputs, dir, func() (*Output, error) {
+		output, err := analyze()
+		if err == nil {
+			m.watchOutput(output)
+		}
+		return output, err
+	})
+}
+
+// discovery returns the kept discovery of dir, or calls discover and keeps
+// its result unless it failed or a file changed meanwhile.
+func (m *analysisMemo) discovery(dir string, discover func() (*Discovery, error)) (*Discovery, error) {
+	if m == nil {
+		return discover()
+	}
+	return memoize(m, m.discoveries, dir, func() (*Discovery, error) {
+		discovery, err := discover()
+		if err == nil {
+			for _, root := range discovery.Roots {
+				if root.Analysis != nil {
+					m.watchOutput(root.Analysis)
+				}
+			}
+		}
+		return discovery, err
+	})
+}
+
+// watchOutput passes the directories that changes to the modules of output
+// happen in to watch.
+func (m *analysisMemo) watchOutput(output *Output) {
+	if m.watch != nil {
+		dirs, _ := watchTargets(output)
+		m.watch(dirs)
+	}
+}
+
+func memoize[T any](m *analysisMemo, results map[string]*T, dir string, compute func() (*T, error)) (*T, error) {
+	m.mu.Lock()
+	result, ok := results[dir]
+	generation := m.generation
+	m.mu.Unlock()
+	if ok {
+		return result, nil
+	}
+
+	result, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	if m.generation == generation {
+		results[dir] = result
+	}
+	m.mu.Unlock()
+	return result, nil
+}
+
+// skipWatchDir reports whether the daemon ignores changes in the directory
+// named name: git metadata and the working directories of terraform init.
+func skipWatchDir(name string) bool {
+	return name == ".git" || name == ".terraform"
+}
+
+// watchTree adds dir and every directory below it to watcher.
+func watchTree(watcher *fsnotify.Watcher, dir string) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != dir && skipWatchDir(d.Name()) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot watch %s: %v\n", path, err)
+		}
+		return nil
+	})
+}
+
+// watchOutside returns a function that adds to watcher the directories
+// given to it that are not below baseDir, which watchTree already watches,
+// such as local modules beside the served directory or the directories of
+// files matched by include globs and linked from outside modules. As with
+// --watch, only the directories themselves are watched.
+func watchOutside(watcher *fsnotify.Watcher, baseDir string) func(dirs []string) {
+	var mu sync.Mutex
+	watched := make(map[string]bool)
+	return func(dirs []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, dir := range dirs {
+			if watched[dir] || isInDirectory(dir, baseDir) {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: cannot watch %s: %v\n", dir, err)
+				continue
+			}
+			watched[dir] = true
+		}
+	}
+}
+
+// invalidateOnChange resets memo whenever a file or directory under the
+// directories watched by watcher changes, watching directories as they
+// are created, until ctx is done.
+func invalidateOnChange(ctx context.Context, watcher *fsnotify.Watcher, memo *analysisMemo) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if skipWatchDir(filepath.Base(event.Name)) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					watchTree(watcher, event.Name)
+				}
+			}
+			memo.reset()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			// Events may have been dropped, such as on an inotify queue
+			// overflow, so nothing kept can be trusted.
+			fmt.Fprintf(os.Stderr, "Warning: watch error: %v\n", err)
+			memo.reset()
+		}
+	}
+}
+
+// listenDaemon listens on the unix socket at socket, replacing a stale
+// socket file left by a daemon that did not shut down, or else on the TCP
+// address listen.
+func listenDaemon(socket, listen string) (net.Listener, error) {
+	if socket == "" {
+		return net.Listen("tcp", listen)
+	}
+	if info, err := os.Lstat(socket); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another daemon is listening on %s", socket)
+		}
+		os.Remove(socket)
+	}
+	return net.Listen("unix", socket)
+}
+
+func runDaemon(args []string) int {
+	flags := newFlagSet("daemon")
+	socket := flags.String("socket", "", "listen on this unix socket instead of --listen")
+	listen := flags.String("listen", "127.0.0.1:8080", "TCP address to listen on when no --socket is given")
+	concurrency := flags.Int("concurrency", runtime.NumCPU(), "number of module directories to load in parallel per request")
+	timeout := flags.Duration("timeout", time.Minute, "abort a request's analysis after this duration (0 means no limit)")
+	cachePath := flags.String("cache", "", "load parsed module calls from this cache file at startup and save them on shutdown")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s daemon [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Serve the endpoints of serve, keeping every analysis in memory until a file\n")
+		fmt.Fprintf(flags.Output(), "under the directory, or of a module outside it, changes, so repeated\n")
+		fmt.Fprintf(flags.Output(), "queries are answered without analyzing again.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\nExamples:\n")
+		fmt.Fprintf(flags.Output(), "  %s daemon --socket /tmp/tfmr.sock ./infra &\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  git diff --name-only main | curl -s --unix-socket /tmp/tfmr.sock --data-binary @- 'http://daemon/affected?dir=.'\n")
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	baseDir, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	defer watcher.Close()
+	watchTree(watcher, baseDir)
+
+	listener, err := listenDaemon(*socket, *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	cache := NewCache()
+	if *cachePath != "" {
+		cache = loadCacheOrWarn(*cachePath)
+	}
+	s := &server{
+		baseDir: baseDir,
+		opts:    AnalyzeOptions{Cache: cache, Concurrency: *concurrency},
+		timeout: *timeout,
+		metrics: newServerMetrics(cache),
+		memo:    newAnalysisMemo(),
+	}
+	s.memo.watch = watchOutside(watcher, baseDir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go invalidateOnChange(ctx, watcher, s.memo)
+
+	httpServer := &http.Server{Handler: s.handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving %s on %s\n", baseDir, listener.Addr())
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	if *cachePath != "" {
+		if err := cache.Save(*cachePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing cache: %v\n", err)
+			return exitError
+		}
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestAnalysisMemo(t *testing.T) {
+	memo := newAnalysisMemo()
+	calls := 0
+	analyze := func() (*Output, error) {
+		calls++
+		return &Output{}, nil
+	}
+
+	first, _ := memo.output("/a", analyze)
+	second, _ := memo.output("/a", analyze)
+	if calls != 1 || first != second {
+		t.Errorf("expected the second analysis to be kept, got %d analyses", calls)
+	}
+	memo.reset()
+	memo.output("/a", analyze)
+	if calls != 2 {
+		t.Errorf("expected a reset to drop the kept analysis, got %d analyses", calls)
+	}
+
+	if _, err := memo.output("/b", func() (*Output, error) { return nil, errors.New("failed") }); err == nil {
+		t.Error("expected the error to be returned")
+	}
+	memo.output("/c", func() (*Output, error) {
+		memo.reset()
+		return &Output{}, nil
+	})
+	if len(memo.outputs) != 0 {
+		t.Errorf("expected failed analyses and analyses overlapping a change not to be kept, got %v", memo.outputs)
+	}
+
+	var nilMemo *analysisMemo
+	nilMemo.output("/a", analyze)
+	nilMemo.output("/a", analyze)
+	if calls != 4 {
+		t.Errorf("expected a nil memo to analyze every time, got %d analyses", calls)
+	}
+}
+
+func TestInvalidateOnChange(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf":           `variable "name" {}`,
+		".terraform/mod.tf": `variable "name" {}`,
+	})
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	watchTree(watcher, tempDir)
+	memo := newAnalysisMemo()
+	go invalidateOnChange(t.Context(), watcher, memo)
+
+	waitForReset := func(change func()) {
+		t.Helper()
+		memo.output("/root", func() (*Output, error) { return &Output{}, nil })
+		change()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			memo.mu.Lock()
+			n := len(memo.outputs)
+			memo.mu.Unlock()
+			if n == 0 {
+				return
+			}
+		}
+		t.Fatal("expected the change to reset the memo")
+	}
+	waitForReset(func() { os.Mkdir(filepath.Join(tempDir, "modules"), 0755) })
+	waitForReset(func() { os.WriteFile(filepath.Join(tempDir, "modules", "main.tf"), []byte("\n"), 0644) })
+
+	if watched := watcher.WatchList(); len(watched) != 2 {
+		t.Errorf("expected the root and the new directory to be watched, got %v", watched)
+	}
+}
+
+func TestInvalidateOnChange_ModulesOutsideTree(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"infra/main.tf":                 `module "shared" { source = "../shared" }`,
+		"shared/main.tf":                `variable "name" {}`,
+		"shared/templates/user.tpl":     "",
+		"infra/.terraform/modules/x.tf": "",
+	})
+	baseDir := filepath.Join(tempDir, "infra")
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	watchTree(watcher, baseDir)
+	memo := newAnalysisMemo()
+	memo.watch = watchOutside(watcher, baseDir)
+	go invalidateOnChange(t.Context(), watcher, memo)
+
+	analyze := func() (*Output, error) {
+		return AnalyzeWithOptions(baseDir, AnalyzeOptions{IncludeGlobs: []string{"templates/*"}})
+	}
+	for _, change := range []string{"shared/main.tf", "shared/templates/user.tpl"} {
+		if _, err := memo.output(baseDir, analyze); err != nil {
+			t.Fatalf("Analyze failed: %v", err)
+		}
+		writeTestFiles(t, tempDir, map[string]string{change: "# changed\n"})
+		reset := false
+		for deadline := time.Now().Add(5 * time.Second); !reset && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			memo.mu.Lock()
+			reset = len(memo.outputs) == 0
+			memo.mu.Unlock()
+		}
+		if !reset {
+			t.Fatalf("expected a change to %s to reset the memo", change)
+		}
+	}
+}
+
+func TestListenDaemon(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "d.sock")
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listenDaemon(socket, "")
+	if err != nil {
+		t.Fatalf("expected the stale socket to be replaced, got %v", err)
+	}
+	defer listener.Close()
+	if _, err := listenDaemon(socket, ""); err == nil {
+		t.Error("expected an error for a socket another daemon listens on")
+	}
+}
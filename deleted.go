@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// addDeletedModules records the local modules of base, an analysis of the
+// same root before the changes, whose directories no longer exist, so that
+// files deleted with them still affect the modules that called them.
+func (o *Output) addDeletedModules(base *Output) {
+	live := map[string]bool{o.RootModule.ResolvedPath: true}
+	for _, m := range o.LocalModules {
+		live[m.ResolvedPath] = true
+	}
+	for _, m := range o.deletedModules {
+		live[m.ResolvedPath] = true
+	}
+	for _, m := range base.LocalModules {
+		if live[m.ResolvedPath] {
+			continue
+		}
+		if _, err := os.Stat(m.ResolvedPath); !os.IsNotExist(err) {
+			// Still there but no longer called: its changes affect
+			// nothing.
+			continue
+		}
+		live[m.ResolvedPath] = true
+		o.deletedModules = append(o.deletedModules, m)
+	}
+}
+
+// deletedModuleCaller returns the innermost deleted module directory
+// containing absPath, which is either the directory of a module call that
+// cannot be read or, with addDeletedModules, of a module of the base that
+// no longer exists, and the directory of the existing module that calls
+// it, following callers that were deleted too.
+func (o *Output) deletedModuleCaller(absPath string) (ModuleDetail, string, bool) {
+	var deleted ModuleDetail
+	for _, m := range o.deletedModules {
+		if isInDirectory(absPath, m.ResolvedPath) && len(m.ResolvedPath) > len(deleted.ResolvedPath) {
+			deleted = m
+		}
+	}
+	if deleted.ResolvedPath == "" {
+		return ModuleDetail{}, "", false
+	}
+
+	caller := deleted.CallerPath
+	seen := map[string]bool{deleted.ResolvedPath: true}
+	for !seen[caller] {
+		seen[caller] = true
+		next := ""
+		for _, m := range o.deletedModules {
+			if m.ResolvedPath == caller {
+				next = m.CallerPath
+				break
+			}
+		}
+		if next == "" {
+			return deleted, caller, true
+		}
+		caller = next
+	}
+	return ModuleDetail{}, "", false
+}
+
+// addBaseModules analyzes the root module of output again in base, the
+// files of a git ref such as origin/main read by gitRefFS, and records the
+// modules deleted since. A root that did not exist in base has none.
+func (o *Output) addBaseModules(base *MappedFS, opts AnalyzeOptions) error {
+	dir := o.RootModule.ResolvedPath
+	if _, err := base.readDir(dir); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	opts.FS = base
+	opts.Graph = nil
+	opts.Progress = nil
+	opts.FailOnMissingModule = false
+	baseOutput, err := AnalyzeWithOptions(dir, opts)
+	if err != nil {
+		return fmt.Errorf("cannot analyze %s at the base ref: %w", dir, err)
+	}
+	o.addDeletedModules(baseOutput)
+	return nil
+}
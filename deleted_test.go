@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAffected_MissingModule(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+
+module "dns" {
+  source = "../../modules/dns"
+}
+`,
+		"modules/app/main.tf": `
+module "vpc" {
+  source = "../vpc"
+}
+`,
+	})
+	root := filepath.Join(tempDir, "envs", "prod")
+	app := filepath.Join(tempDir, "modules", "app")
+	output, err := Analyze(root)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	deletedVPC := filepath.Join(tempDir, "modules", "vpc", "main.tf")
+	deletedDNS := filepath.Join(tempDir, "modules", "dns", "main.tf")
+
+	if !IsAffected([]string{deletedDNS}, output) {
+		t.Error("expected a file of a deleted module called by the root to affect the root")
+	}
+	// The caller only calls the changed module, so it is affected
+	// transitively and the file is not one of its changed files.
+	dependency := []Trigger{{File: deletedVPC, Kind: triggerDependencyFile}}
+	expectedAffected := []AffectedModule{{Name: "app", Kind: kindLocal, ResolvedPath: app, Impact: impactTransitive, Triggers: dependency}}
+	if affected := AffectedModules([]string{deletedVPC}, output); !reflect.DeepEqual(affected, expectedAffected) {
+		t.Errorf("expected the file of the deleted module to be attributed to its caller, got %+v", affected)
+	}
+	expectedImpacted := append([]AffectedModule{{Kind: kindRoot, ResolvedPath: root, Impact: impactTransitive, Triggers: dependency}}, expectedAffected...)
+	if impacted := ImpactedModules([]string{deletedVPC}, output); !reflect.DeepEqual(impacted, expectedImpacted) {
+		t.Errorf("expected the callers of the deleted module to be transitively affected, got %+v", impacted)
+	}
+	if IsAffected([]string{filepath.Join(tempDir, "modules", "other", "main.tf")}, output) {
+		t.Error("expected a file outside the module tree not to affect the root")
+	}
+
+	if targets, full := PlanTargets([]string{deletedVPC}, output); full || !reflect.DeepEqual(targets, []string{"module.app"}) {
+		t.Errorf("expected the caller of the deleted module as target, got %v, full %v", targets, full)
+	}
+	if _, full := PlanTargets([]string{deletedDNS}, output); !full {
+		t.Error("expected a deleted module called by the root to require a full plan")
+	}
+
+	explanations := ExplainAffected([]string{deletedVPC}, output)
+	expected := []ExplanationMatch{{Kind: kindLocal, ResolvedPath: app, Addresses: []string{"module.app"}, Deleted: filepath.Join(tempDir, "modules", "vpc")}}
+	if !reflect.DeepEqual(explanations[0].Matches, expected) {
+		t.Errorf("expected %+v, got %+v", expected, explanations[0].Matches)
+	}
+}
+
+func TestAffected_BaseRef(t *testing.T) {
+	repo := t.TempDir()
+	initGitRepo(t, repo, map[string]string{
+		"envs/prod/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+`,
+		"modules/app/main.tf": `
+module "vpc" {
+  source = "../vpc"
+}
+
+module "subnets" {
+  source = "../subnets"
+}
+`,
+		"modules/vpc/main.tf":     `resource "aws_vpc" "this" {}`,
+		"modules/subnets/main.tf": `variable "cidrs" {}`,
+		"modules/kept/main.tf":    `variable "name" {}`,
+	}, "base")
+	// The pull request deletes the vpc module and its call.
+	if err := os.RemoveAll(filepath.Join(repo, "modules", "vpc")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, repo, map[string]string{
+		"modules/app/main.tf": `
+module "subnets" {
+  source = "../subnets"
+}
+`,
+	})
+
+	root := filepath.Join(repo, "envs", "prod")
+	output, err := Analyze(root)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	deleted := []string{filepath.Join(repo, "modules", "vpc", "main.tf")}
+	if IsAffected(deleted, output) {
+		t.Fatal("expected the deleted file not to match without the base ref")
+	}
+
+	base, err := gitRefFS(root, "base")
+	if err != nil {
+		t.Fatalf("gitRefFS failed: %v", err)
+	}
+	if err := output.addBaseModules(base, AnalyzeOptions{}); err != nil {
+		t.Fatalf("addBaseModules failed: %v", err)
+	}
+	affected := AffectedModules(deleted, output)
+	if len(affected) != 1 || affected[0].ResolvedPath != filepath.Join(repo, "modules", "app") {
+		t.Errorf("expected the deleted file to be attributed to the module that called it, got %+v", affected)
+	}
+	if IsAffected([]string{filepath.Join(repo, "modules", "kept", "main.tf")}, output) {
+		t.Error("expected a module that was never called not to affect the root")
+	}
+
+	// A root added since the base ref has no deleted modules.
+	writeTestFiles(t, repo, map[string]string{"envs/dev/main.tf": `variable "name" {}`})
+	dev, err := Analyze(filepath.Join(repo, "envs", "dev"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if err := dev.addBaseModules(base, AnalyzeOptions{}); err != nil || len(dev.deletedModules) != 0 {
+		t.Errorf("expected a new root to have no deleted modules, got %+v, %v", dev.deletedModules, err)
+	}
+}
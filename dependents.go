@@ -0,0 +1,61 @@
+package main
+
+// DependentModules answers "who breaks if I change dir?" for a single root:
+// it returns every local module call in output whose directory calls the
+// module directory dir, directly or transitively, and the root module when
+// it does. Calls of dir itself are not included.
+func DependentModules(dir string, output *Output) []AffectedModule {
+	target := toAbsPath(dir)
+	dependents := dependentDirs(target, output)
+
+	var result []AffectedModule
+	if dependents[output.RootModule.ResolvedPath] {
+		result = append(result, AffectedModule{Kind: kindRoot, ResolvedPath: output.RootModule.ResolvedPath})
+	}
+	for _, m := range output.LocalModules {
+		if dependents[m.ResolvedPath] {
+			result = append(result, AffectedModule{Name: m.Name, Kind: kindLocal, ResolvedPath: m.ResolvedPath})
+		}
+	}
+	return result
+}
+
+// FindDependentRoots returns the discovered applications and roots whose
+// module tree includes the module directory dir.
+func FindDependentRoots(discovery *Discovery, dir string) AffectedRoots {
+	target := toAbsPath(dir)
+	affected := make([]bool, len(discovery.Roots))
+	for i, root := range discovery.Roots {
+		affected[i] = root.Path == target || dependentDirs(target, root.Analysis)[root.Path]
+	}
+	return groupAffectedRoots(discovery, affected)
+}
+
+// dependentDirs walks the local and downloaded remote module calls of
+// output backwards from target and returns the set of directories that
+// reach it.
+func dependentDirs(target string, output *Output) map[string]bool {
+	callers := make(map[string][]string)
+	for _, m := range output.LocalModules {
+		callers[m.ResolvedPath] = append(callers[m.ResolvedPath], m.CallerPath)
+	}
+	for _, m := range output.RemoteModules {
+		if m.ResolvedPath != "" {
+			callers[m.ResolvedPath] = append(callers[m.ResolvedPath], m.CallerPath)
+		}
+	}
+
+	dependents := make(map[string]bool)
+	queue := []string{target}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		for _, caller := range callers[dir] {
+			if caller != target && !dependents[caller] {
+				dependents[caller] = true
+				queue = append(queue, caller)
+			}
+		}
+	}
+	return dependents
+}
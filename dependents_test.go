@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDependentModules(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+
+module "dns" {
+  source = "../../modules/dns"
+}
+`,
+		"envs/dev/main.tf": `
+module "dns" {
+  source = "../../modules/dns"
+}
+`,
+		"modules/app/main.tf": `
+module "network" {
+  source = "../networking"
+}
+`,
+		"modules/networking/main.tf": `
+module "subnets" {
+  source = "./subnets"
+}
+`,
+		"modules/networking/subnets/main.tf": `variable "cidr" {}`,
+		"modules/dns/main.tf":                `variable "zone" {}`,
+	})
+	networking := filepath.Join(tempDir, "modules", "networking")
+
+	output, err := Analyze(filepath.Join(tempDir, "envs", "prod"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	var got []string
+	for _, m := range DependentModules(networking, output) {
+		got = append(got, m.Kind+":"+m.Name)
+	}
+	expected := []string{"root:", "local:app"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if dependents := DependentModules(filepath.Join(tempDir, "modules", "dns"), output); len(dependents) != 1 || dependents[0].Kind != kindRoot {
+		t.Errorf("expected only the root to depend on dns, got %+v", dependents)
+	}
+
+	discovery, err := Discover(tempDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	roots := FindDependentRoots(discovery, networking)
+	if len(roots.Roots) != 1 || roots.Roots[0] != filepath.Join(tempDir, "envs", "prod") {
+		t.Errorf("expected only envs/prod to depend on networking, got %+v", roots)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DiggerProject is a project of the projects section of digger.yml, the
+// configuration of the Digger (OpenTaco) orchestrator. Dir and
+// IncludePatterns are relative to the repository root.
+type DiggerProject struct {
+	Name            string
+	Dir             string
+	Workspace       string
+	IncludePatterns []string
+	DependsOn       []string
+}
+
+// BuildDiggerProjects returns one project per discovered root, or per
+// project, named as by BuildPathsFilters. Include patterns match the local
+// module directories the root calls, directly or transitively, and the
+// project's variable files and inputs outside the root, so that Digger
+// plans the project when any of them changes; Digger already watches the
+// root directory itself. Projects depend on the projects of the roots in
+// dependencies. Paths are relative to dir, which should be the repository
+// root holding digger.yml; roots outside it are skipped with a warning.
+func BuildDiggerProjects(discovery *Discovery, dependencies map[string][]string, baseDir, dir string) []DiggerProject {
+	names := make(map[string][]string)
+	for _, root := range discovery.Roots {
+		names[root.Path] = append(names[root.Path], generatedRootName(root, baseDir))
+	}
+
+	var projects []DiggerProject
+	for _, root := range discovery.Roots {
+		rel, err := filepath.Rel(dir, root.Path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			fmt.Fprintf(os.Stderr, "Warning: %s is outside %s and cannot be a Digger project\n", root.Path, dir)
+			continue
+		}
+		project := DiggerProject{
+			Name:      generatedRootName(root, baseDir),
+			Dir:       filepath.ToSlash(rel),
+			Workspace: root.Workspace,
+		}
+		own := project.Dir + "/**"
+		if rel == "." {
+			own = "**"
+		}
+		for _, glob := range rootGlobs(root, dir, "Digger") {
+			if glob != own {
+				project.IncludePatterns = append(project.IncludePatterns, glob)
+			}
+		}
+		for _, dep := range dependencies[root.Path] {
+			project.DependsOn = append(project.DependsOn, names[dep]...)
+		}
+		projects = append(projects, project)
+	}
+	return projects
+}
+
+// writeDiggerProjects writes projects as digger.yml, to be used as is or
+// merged into an existing configuration.
+func writeDiggerProjects(w io.Writer, projects []DiggerProject) {
+	fmt.Fprintf(w, "# Generated by %s discover --format digger.\n", programName)
+	if len(projects) == 0 {
+		fmt.Fprintf(w, "projects: []\n")
+		return
+	}
+	fmt.Fprintf(w, "projects:\n")
+	for _, p := range projects {
+		fmt.Fprintf(w, "  - name: %s\n", yamlQuote(p.Name))
+		fmt.Fprintf(w, "    dir: %s\n", yamlQuote(p.Dir))
+		if p.Workspace != "" {
+			fmt.Fprintf(w, "    workspace: %s\n", yamlQuote(p.Workspace))
+		}
+		if len(p.IncludePatterns) > 0 {
+			fmt.Fprintf(w, "    include_patterns:\n")
+			for _, glob := range p.IncludePatterns {
+				fmt.Fprintf(w, "      - %s\n", yamlQuote(glob))
+			}
+		}
+		if len(p.DependsOn) > 0 {
+			fmt.Fprintf(w, "    depends_on:\n")
+			for _, name := range p.DependsOn {
+				fmt.Fprintf(w, "      - %s\n", yamlQuote(name))
+			}
+		}
+	}
+}
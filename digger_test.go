@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildDiggerProjects(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"infra/envs/prod/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+`,
+		"infra/modules/app/main.tf": `
+module "vpc" {
+  source = "../vpc"
+}
+`,
+		"infra/modules/vpc/main.tf": `variable "cidr" {}`,
+		"infra/global/main.tf":      `variable "name" {}`,
+		"infra/shared/prod.tfvars":  `name = "prod"`,
+	})
+	baseDir := filepath.Join(tempDir, "infra")
+
+	discovery, err := Discover(baseDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	global := filepath.Join(baseDir, "global")
+	ApplyProjects(discovery, []Project{
+		{Name: "global-prod", Dir: global, VarFiles: []string{filepath.Join(baseDir, "shared", "prod.tfvars")}, Workspace: "prod"},
+	}, baseDir)
+	dependencies := map[string][]string{filepath.Join(baseDir, "envs", "prod"): {global}}
+	projects := BuildDiggerProjects(discovery, dependencies, baseDir, tempDir)
+
+	expected := []DiggerProject{
+		{Name: "envs/prod", Dir: "infra/envs/prod", IncludePatterns: []string{"infra/modules/app/**", "infra/modules/vpc/**"}, DependsOn: []string{"global-prod"}},
+		{Name: "global-prod", Dir: "infra/global", Workspace: "prod", IncludePatterns: []string{"infra/shared/prod.tfvars"}},
+	}
+	if !reflect.DeepEqual(projects, expected) {
+		t.Errorf("expected %+v, got %+v", expected, projects)
+	}
+
+	var b strings.Builder
+	writeDiggerProjects(&b, projects)
+	expectedYAML := `projects:
+  - name: 'envs/prod'
+    dir: 'infra/envs/prod'
+    include_patterns:
+      - 'infra/modules/app/**'
+      - 'infra/modules/vpc/**'
+    depends_on:
+      - 'global-prod'
+  - name: 'global-prod'
+    dir: 'infra/global'
+    workspace: 'prod'
+    include_patterns:
+      - 'infra/shared/prod.tfvars'
+`
+	if !strings.HasSuffix(b.String(), expectedYAML) {
+		t.Errorf("unexpected YAML:\n%s", b.String())
+	}
+
+	b.Reset()
+	writeDiggerProjects(&b, nil)
+	if !strings.HasSuffix(b.String(), "projects: []\n") {
+		t.Errorf("expected an empty project list, got:\n%s", b.String())
+	}
+}
@@ -0,0 +1,708 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Discovery is the result of scanning a directory tree for root modules.
+type Discovery struct {
+	Roots        []Root        `json:"roots"`
+	Applications []Application `json:"applications,omitempty"`
+	Overlaps     []Overlap     `json:"overlaps,omitempty"`
+}
+
+// Root is a module directory that no other discovered module calls, or a
+// project deploying one with its own variable files, inputs and workspace.
+type Root struct {
+	Path        string   `json:"path"`
+	Application string   `json:"application,omitempty"`
+	Project     string   `json:"project,omitempty"`
+	VarFiles    []string `json:"var_files,omitempty"`
+	Inputs      []string `json:"inputs,omitempty"`
+	Workspace   string   `json:"workspace,omitempty"`
+
+	// Stack is the Terramate stack declared in the root directory, if any.
+	Stack    *TerramateStack `json:"stack,omitempty"`
+	Analysis *Output         `json:"analysis"`
+}
+
+// Application groups sibling roots (typically one per environment) that
+// instantiate exactly the same set of local modules.
+type Application struct {
+	Name         string   `json:"name"`
+	Environments []string `json:"environments"`
+	Roots        []string `json:"roots"`
+	Modules      []string `json:"modules"`
+}
+
+// Overlap records a root directory nested inside another root directory.
+type Overlap struct {
+	Outer string `json:"outer"`
+	Inner string `json:"inner"`
+}
+
+// Precedence rules deciding which of two overlapping roots a changed file
+// inside the nested root's directory is attributed to.
+const (
+	precedenceNearest   = "nearest"
+	precedenceOutermost = "outermost"
+	precedenceAll       = "all"
+)
+
+func runDiscover(args []string) (code int) {
+	flags := newFlagSet("discover")
+	affected := flags.Bool("affected", false, "report affected applications and roots for changed files from stdin (exit 0=affected, 1=not affected)")
+	affectedBy := flags.String("affected-by", "", "report applications and roots whose module tree includes this local module directory (exit 0=found, 1=none)")
+	query := flags.String("query", "", "print only the values this jq-like expression selects from the JSON output, such as '.roots[] | select(.affected) | .path' with --affected, strings raw and one per line")
+	format := flags.String("format", "text", "--affected output format: text, or json for a per-root affected flag with matched files; or paths-filter for dorny/paths-filter filters of every root, or digger for the projects of a Digger digger.yml with every root, or buildkite for a pipeline with a step per root (per affected root with --affected), or targets for the -target arguments of each affected root with --affected, or terramate for the root directories (affected ones with --affected) one per line like terramate list --changed, with paths relative to the working directory")
+	stepCommand := flags.String("step-command", defaultStepCommand, "command run in the root directory by each step of --format buildkite")
+	notify := flags.String("notify-webhook", "", "with --affected, post a JSON summary of the affected roots, changed modules and files to this URL, such as a Slack incoming webhook, when any root is affected (default $"+notifyWebhookEnv+")")
+	githubOutputs := flags.Bool("github-output", false, "with --affected, also write affected, roots and matrix step outputs to $GITHUB_OUTPUT")
+	baseRef := flags.String("base-ref", "", "with --affected, also analyze each root at this git ref, such as origin/main, so that changed files of module directories deleted since then affect the roots that called them")
+	precedence := flags.String("overlap-precedence", precedenceNearest, "root that owns files of a nested root: nearest, outermost or all")
+	cachePath := flags.String("cache", "", "reuse and update parsed module calls in this cache file")
+	concurrency := flags.Int("concurrency", runtime.NumCPU(), "number of module directories to load in parallel")
+	timeout := flags.Duration("timeout", 0, "abort discovery after this duration (0 means no limit)")
+	configPath := flags.String("config", "", "configuration file (default "+defaultConfigFile+" in the working directory, if present)")
+	progress := flags.Bool("progress", false, "report the directories scanned and roots analyzed on stderr")
+	outputPath := flags.String("output", "", "write the output to this file, atomically replacing it, instead of stdout")
+	var includeGlobs stringsFlag
+	flags.Var(&includeGlobs, "include-glob", "also list files matching this glob, relative to each module directory, such as 'templates/**', as module files that affect the module (may be repeated)")
+	stdinFormat := addStdinFormatFlag(flags)
+	var ignoreChanged stringsFlag
+	flags.Var(&ignoreChanged, "ignore-changed", "ignore changed files from stdin matching this glob, such as '**/*.md' (** matches any number of directories; may be repeated)")
+	addNetworkFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s discover [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Find root modules under a directory and group environment roots into applications.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+	switch *precedence {
+	case precedenceNearest, precedenceOutermost, precedenceAll:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --overlap-precedence %q\n", *precedence)
+		return exitError
+	}
+	if *githubOutputs && !*affected {
+		fmt.Fprintf(os.Stderr, "Error: --github-output requires --affected\n")
+		return exitError
+	}
+	if *notify != "" && !*affected {
+		fmt.Fprintf(os.Stderr, "Error: --notify-webhook requires --affected\n")
+		return exitError
+	}
+	if *baseRef != "" && !*affected {
+		fmt.Fprintf(os.Stderr, "Error: --base-ref requires --affected\n")
+		return exitError
+	}
+	if *notify != "" && offline {
+		fmt.Fprintf(os.Stderr, "Error: --notify-webhook cannot be combined with --offline\n")
+		return exitError
+	}
+	if *affected && !offline {
+		*notify = webhookURL(*notify)
+	}
+	var jq jsonQuery
+	if *query != "" {
+		if *format != "text" && *format != "json" || *affectedBy != "" {
+			fmt.Fprintf(os.Stderr, "Error: --query requires JSON output and cannot be combined with --format %s or --affected-by\n", *format)
+			return exitError
+		}
+		*format = "json"
+		var err error
+		if jq, err = parseJSONQuery(*query); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+	switch *format {
+	case "text", "json":
+	case "buildkite":
+		if *affectedBy != "" {
+			fmt.Fprintf(os.Stderr, "Error: --format buildkite cannot be combined with --affected-by\n")
+			return exitError
+		}
+	case "targets":
+		if !*affected {
+			fmt.Fprintf(os.Stderr, "Error: --format targets requires --affected\n")
+			return exitError
+		}
+	case "terramate":
+		if *affectedBy != "" {
+			fmt.Fprintf(os.Stderr, "Error: --format terramate cannot be combined with --affected-by\n")
+			return exitError
+		}
+	case "paths-filter", "digger":
+		if *affected || *affectedBy != "" {
+			fmt.Fprintf(os.Stderr, "Error: --format %s cannot be combined with --affected or --affected-by\n", *format)
+			return exitError
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	opts := config.analyzeOptions()
+	opts.Concurrency = *concurrency
+	opts.IncludeGlobs = includeGlobs
+	if *cachePath != "" {
+		opts.Cache = loadCacheOrWarn(*cachePath)
+	}
+	if *progress {
+		opts.Progress = NewProgress(os.Stderr)
+	}
+
+	ctx, cancel := analysisContext(*timeout)
+	discovery, err := DiscoverContext(ctx, flags.Arg(0), opts)
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	opts.Progress.Done("discovered %d roots", len(discovery.Roots))
+	if *baseRef != "" {
+		base, err := gitRefFS(flags.Arg(0), *baseRef)
+		for i := 0; err == nil && i < len(discovery.Roots); i++ {
+			if analysis := discovery.Roots[i].Analysis; analysis != nil {
+				err = analysis.addBaseModules(base, opts)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+	absBaseDir, _ := filepath.Abs(flags.Arg(0))
+	ApplyProjects(discovery, config.Projects, absBaseDir)
+
+	if opts.Cache != nil {
+		if err := opts.Cache.Save(*cachePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing cache: %v\n", err)
+			return exitError
+		}
+	}
+
+	stdout, outputFile := newOutput(*outputPath)
+	defer func() { code = outputFile.close(code) }()
+	stdout, queried := newQueryOutput(stdout, jq)
+	defer func() { code = queried.close(code) }()
+
+	if *affectedBy != "" {
+		if writeAffectedRoots(stdout, FindDependentRoots(discovery, *affectedBy)) {
+			return exitAffected
+		}
+		return exitNotAffected
+	}
+
+	if *affected {
+		changedFiles, err := readChangedFiles(*stdinFormat, ignoreChanged)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+			return exitError
+		}
+		warned := make(map[ModuleRename]bool)
+		for _, root := range discovery.Roots {
+			if root.Analysis == nil {
+				continue
+			}
+			for _, r := range DetectModuleRenames(changedFiles, root.Analysis) {
+				if !warned[r] {
+					warned[r] = true
+					fmt.Fprintf(os.Stderr, "Warning: %s\n", renameDiagnostic(r).Message)
+				}
+			}
+		}
+		if *notify != "" {
+			var roots []NotifyRoot
+			for i, r := range RootAffectedResults(discovery, changedFiles, *precedence) {
+				if r.Affected {
+					root := newNotifyRoot(discovery.Roots[i].Analysis, r.Application, r.MatchedFiles)
+					root.Project = r.Project
+					for _, f := range r.MatchedFiles {
+						if isProjectInput(discovery.Roots[i], toAbsPath(f)) {
+							root.Files = append(root.Files, f)
+						}
+					}
+					roots = append(roots, root)
+				}
+			}
+			notifyWebhook(*notify, changedFiles, roots)
+		}
+		if *githubOutputs {
+			if err := appendGitHubOutputs(affectedRootsOutputs(RootAffectedResults(discovery, changedFiles, *precedence))); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitError
+			}
+		}
+		if *format == "buildkite" {
+			var roots []Root
+			for i, r := range RootAffectedResults(discovery, changedFiles, *precedence) {
+				if r.Affected {
+					roots = append(roots, discovery.Roots[i])
+				}
+			}
+			cwd, _ := os.Getwd()
+			writeBuildkitePipeline(stdout, BuildkiteSteps(roots, RootDependencies(discovery, config.Dependencies), cwd, *stepCommand))
+			if len(roots) > 0 {
+				return exitAffected
+			}
+			return exitNotAffected
+		}
+		if *format == "targets" {
+			results := RootAffectedResults(discovery, changedFiles, *precedence)
+			writeRootPlanTargets(stdout, discovery, results)
+			for _, r := range results {
+				if r.Affected {
+					return exitAffected
+				}
+			}
+			return exitNotAffected
+		}
+		if *format == "terramate" {
+			results := RootAffectedResults(discovery, changedFiles, *precedence)
+			writeTerramateChanged(stdout, discovery, results, false)
+			for _, r := range results {
+				if r.Affected {
+					return exitAffected
+				}
+			}
+			return exitNotAffected
+		}
+		if *format == "json" {
+			results := RootAffectedResults(discovery, changedFiles, *precedence)
+			jsonOutput, _ := json.MarshalIndent(map[string][]RootResult{"roots": results}, "", "  ")
+			fmt.Fprintln(stdout, string(jsonOutput))
+			for _, r := range results {
+				if r.Affected {
+					return exitAffected
+				}
+			}
+			return exitNotAffected
+		}
+		if writeAffectedApplications(stdout, discovery, changedFiles, *precedence) {
+			return exitAffected
+		}
+		return exitNotAffected
+	}
+
+	if *format == "buildkite" {
+		cwd, _ := os.Getwd()
+		writeBuildkitePipeline(stdout, BuildkiteSteps(discovery.Roots, RootDependencies(discovery, config.Dependencies), cwd, *stepCommand))
+		return 0
+	}
+
+	if *format == "terramate" {
+		writeTerramateChanged(stdout, discovery, nil, true)
+		return 0
+	}
+
+	if *format == "paths-filter" {
+		cwd, _ := os.Getwd()
+		writePathsFilters(stdout, BuildPathsFilters(discovery, absBaseDir, cwd))
+		return 0
+	}
+
+	if *format == "digger" {
+		cwd, _ := os.Getwd()
+		writeDiggerProjects(stdout, BuildDiggerProjects(discovery, RootDependencies(discovery, config.Dependencies), absBaseDir, cwd))
+		return 0
+	}
+
+	jsonOutput, _ := json.MarshalIndent(discovery, "", "  ")
+	fmt.Fprintln(stdout, string(jsonOutput))
+	return 0
+}
+
+// Discover finds every directory under dir containing Terraform files that
+// is not called as a local module by another such directory, analyzes each
+// of those roots and groups them into applications.
+func Discover(dir string) (*Discovery, error) {
+	return DiscoverWithOptions(dir, AnalyzeOptions{})
+}
+
+// DiscoverWithOptions is Discover with every root analyzed using opts.
+func DiscoverWithOptions(dir string, opts AnalyzeOptions) (*Discovery, error) {
+	return DiscoverContext(context.Background(), dir, opts)
+}
+
+// DiscoverContext is DiscoverWithOptions with cancellation.
+func DiscoverContext(ctx context.Context, dir string, opts AnalyzeOptions) (*Discovery, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	candidates, terramateDirs, err := findModuleDirs(ctx, absDir, opts.Progress)
+	if err != nil {
+		return nil, err
+	}
+	// Terramate stacks are roots even when they are called as modules or
+	// only hold Terramate configuration that generates Terraform files.
+	stacks := make(map[string]*TerramateStack)
+	for dir := range terramateDirs {
+		stack, err := loadTerramateStack(dir, absDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if stack != nil {
+			stacks[dir] = stack
+		}
+	}
+	candidates = slices.DeleteFunc(candidates, func(dir string) bool {
+		if !terramateDirs[dir] || stacks[dir] != nil {
+			return false
+		}
+		files, _ := listTerraformFiles(dir)
+		return len(files) == 0
+	})
+
+	called := make(map[string]bool)
+	for _, candidate := range candidates {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		calls, err := opts.Cache.moduleCalls(candidate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			continue
+		}
+		for _, call := range calls {
+			if target, _, ok := resolveModuleDir(candidate, call.Source, opts.Replace); ok {
+				called[target] = true
+			}
+		}
+	}
+
+	for dir := range stacks {
+		delete(called, dir)
+	}
+	roots := 0
+	for _, candidate := range candidates {
+		if !called[candidate] {
+			roots++
+		}
+	}
+
+	discovery := &Discovery{Roots: []Root{}}
+	for _, candidate := range candidates {
+		if called[candidate] {
+			continue
+		}
+		opts.Progress.Update("analyzing root %d of %d: %s", len(discovery.Roots)+1, roots, candidate)
+		output, err := AnalyzeContext(ctx, candidate, opts)
+		if err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to analyze %s: %v\n", candidate, err)
+			continue
+		}
+		root := Root{Path: candidate, Stack: stacks[candidate], Analysis: output}
+		if root.Stack != nil {
+			root.Inputs = root.Stack.Watch
+		}
+		discovery.Roots = append(discovery.Roots, root)
+	}
+
+	groupApplications(absDir, discovery)
+	discovery.Overlaps = findOverlaps(discovery.Roots)
+	for _, o := range discovery.Overlaps {
+		fmt.Fprintf(os.Stderr, "Warning: root %s is nested inside root %s\n", o.Inner, o.Outer)
+	}
+	return discovery, nil
+}
+
+// findOverlaps returns every pair of roots where one root directory lies
+// inside the other.
+func findOverlaps(roots []Root) []Overlap {
+	var overlaps []Overlap
+	for _, outer := range roots {
+		for _, inner := range roots {
+			if inner.Path != outer.Path && isInDirectory(inner.Path, outer.Path) {
+				overlaps = append(overlaps, Overlap{Outer: outer.Path, Inner: inner.Path})
+			}
+		}
+	}
+	return overlaps
+}
+
+// attributedFiles returns the changed files that count towards root i under
+// the given precedence rule. Files inside a nested root's directory belong
+// to the nested root with "nearest" and to the enclosing root with
+// "outermost"; "all" attributes them to both. Variable files and inputs of
+// projects only count towards the projects using them, even when they are
+// inside a root directory shared by other projects.
+func attributedFiles(discovery *Discovery, i int, changedFiles []string, precedence string) []string {
+	if hasProjectInputs(discovery.Roots) {
+		var own []string
+		for _, f := range changedFiles {
+			absPath := toAbsPath(f)
+			isInput := func(root Root) bool { return isProjectInput(root, absPath) }
+			if isInput(discovery.Roots[i]) || !slices.ContainsFunc(discovery.Roots, isInput) {
+				own = append(own, f)
+			}
+		}
+		changedFiles = own
+	}
+	if precedence == precedenceAll || len(discovery.Overlaps) == 0 {
+		return changedFiles
+	}
+
+	root := discovery.Roots[i].Path
+	var result []string
+	for _, f := range changedFiles {
+		absPath := toAbsPath(f)
+		claimed := false
+		for _, o := range discovery.Overlaps {
+			switch {
+			case precedence == precedenceNearest && o.Outer == root:
+				claimed = isInDirectory(absPath, o.Inner)
+			case precedence == precedenceOutermost && o.Inner == root:
+				claimed = isInDirectory(absPath, o.Inner)
+			}
+			if claimed {
+				break
+			}
+		}
+		if !claimed {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// findModuleDirs returns every directory under dir that contains Terraform
+// or Terramate files, skipping hidden directories such as .git and
+// .terraform, and the set of those containing Terramate files.
+func findModuleDirs(ctx context.Context, dir string, progress *Progress) ([]string, map[string]bool, error) {
+	var dirs []string
+	terramateDirs := make(map[string]bool)
+	scanned := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		scanned++
+		progress.Update("scanned %d directories, %d with Terraform files: %s", scanned, len(dirs), path)
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		hasTerraform := false
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			hasTerraform = hasTerraform || isTerraformFile(entry.Name())
+			if isTerramateFile(entry.Name()) {
+				terramateDirs[path] = true
+			}
+		}
+		if hasTerraform || terramateDirs[path] {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+	return dirs, terramateDirs, nil
+}
+
+// groupApplications groups sibling roots with identical, non-empty local
+// module sets into applications named after their parent directory.
+func groupApplications(baseDir string, discovery *Discovery) {
+	groups := make(map[string][]int)
+	var keys []string
+	for i, root := range discovery.Roots {
+		modules := localModulePaths(root.Analysis)
+		if len(modules) == 0 {
+			continue
+		}
+		key := filepath.Dir(root.Path) + "\x00" + strings.Join(modules, "\x00")
+		if _, exists := groups[key]; !exists {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	for _, key := range keys {
+		members := groups[key]
+		if len(members) < 2 {
+			continue
+		}
+
+		parent := filepath.Dir(discovery.Roots[members[0]].Path)
+		name, err := filepath.Rel(baseDir, parent)
+		if err != nil || name == "." {
+			name = filepath.Base(parent)
+		}
+
+		app := Application{
+			Name:    filepath.ToSlash(name),
+			Modules: localModulePaths(discovery.Roots[members[0]].Analysis),
+		}
+		for _, i := range members {
+			discovery.Roots[i].Application = app.Name
+			app.Environments = append(app.Environments, filepath.Base(discovery.Roots[i].Path))
+			app.Roots = append(app.Roots, discovery.Roots[i].Path)
+		}
+		discovery.Applications = append(discovery.Applications, app)
+	}
+}
+
+// localModulePaths returns the sorted, de-duplicated resolved paths of the
+// local modules in output.
+func localModulePaths(output *Output) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, m := range output.LocalModules {
+		if !seen[m.ResolvedPath] {
+			seen[m.ResolvedPath] = true
+			paths = append(paths, m.ResolvedPath)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// AffectedRoots lists the applications, standalone roots and projects
+// affected by a set of changed files.
+type AffectedRoots struct {
+	Applications []AffectedApplication `json:"applications"`
+	Roots        []string              `json:"roots"`
+	Projects     []string              `json:"projects,omitempty"`
+}
+
+// AffectedApplication is an application and its affected environments.
+type AffectedApplication struct {
+	Name         string   `json:"name"`
+	Environments []string `json:"environments"`
+}
+
+// RootResult is the affected decision for one discovered root or project,
+// with the changed files that matched its root or local module directories
+// or its variable files.
+type RootResult struct {
+	Path         string   `json:"path"`
+	Application  string   `json:"application,omitempty"`
+	Project      string   `json:"project,omitempty"`
+	Workspace    string   `json:"workspace,omitempty"`
+	VarFiles     []string `json:"var_files,omitempty"`
+	Affected     bool     `json:"affected"`
+	MatchedFiles []string `json:"matched_files"`
+}
+
+// RootAffectedResults returns one result per discovered root, in discovery
+// order, so that a single run can drive per-stack decisions.
+func RootAffectedResults(discovery *Discovery, changedFiles []string, precedence string) []RootResult {
+	results := []RootResult{}
+	for i, root := range discovery.Roots {
+		matched := []string{}
+		for _, f := range attributedFiles(discovery, i, changedFiles, precedence) {
+			if isRootAffected(root, []string{f}) {
+				matched = append(matched, f)
+			}
+		}
+		results = append(results, RootResult{
+			Path:         root.Path,
+			Application:  root.Application,
+			Project:      root.Project,
+			Workspace:    root.Workspace,
+			VarFiles:     root.VarFiles,
+			Affected:     len(matched) > 0,
+			MatchedFiles: matched,
+		})
+	}
+	return results
+}
+
+// FindAffectedRoots returns the applications (with their affected
+// environments) and standalone roots affected by changedFiles.
+func FindAffectedRoots(discovery *Discovery, changedFiles []string, precedence string) AffectedRoots {
+	affected := make([]bool, len(discovery.Roots))
+	for i, root := range discovery.Roots {
+		affected[i] = isRootAffected(root, attributedFiles(discovery, i, changedFiles, precedence))
+	}
+	return groupAffectedRoots(discovery, affected)
+}
+
+// groupAffectedRoots reports the roots flagged in affected, grouping those
+// belonging to an application by environment.
+func groupAffectedRoots(discovery *Discovery, affected []bool) AffectedRoots {
+	result := AffectedRoots{Applications: []AffectedApplication{}, Roots: []string{}}
+	for _, app := range discovery.Applications {
+		var envs []string
+		for i, root := range discovery.Roots {
+			if root.Application == app.Name && affected[i] {
+				envs = append(envs, filepath.Base(root.Path))
+			}
+		}
+		if len(envs) > 0 {
+			result.Applications = append(result.Applications, AffectedApplication{Name: app.Name, Environments: envs})
+		}
+	}
+
+	for i, root := range discovery.Roots {
+		switch {
+		case !affected[i] || root.Application != "":
+		case root.Project != "":
+			result.Projects = append(result.Projects, root.Project)
+		default:
+			result.Roots = append(result.Roots, root.Path)
+		}
+	}
+	return result
+}
+
+// writeAffectedApplications prints one line per affected application (with
+// its affected environments) and per affected standalone root, and reports
+// whether anything was affected.
+func writeAffectedApplications(w io.Writer, discovery *Discovery, changedFiles []string, precedence string) bool {
+	return writeAffectedRoots(w, FindAffectedRoots(discovery, changedFiles, precedence))
+}
+
+func writeAffectedRoots(w io.Writer, result AffectedRoots) bool {
+	for _, app := range result.Applications {
+		fmt.Fprintf(w, "app %s: %s affected\n", app.Name, strings.Join(app.Environments, ", "))
+	}
+	for _, root := range result.Roots {
+		fmt.Fprintf(w, "root %s affected\n", root)
+	}
+	for _, project := range result.Projects {
+		fmt.Fprintf(w, "project %s affected\n", project)
+	}
+	return len(result.Applications) > 0 || len(result.Roots) > 0 || len(result.Projects) > 0
+}
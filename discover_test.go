@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	tempDir := t.TempDir()
+
+	envMain := `
+module "api" {
+  source = "../../modules/api"
+}
+
+module "db" {
+  source = "../../modules/db"
+}
+`
+	writeTestFiles(t, tempDir, map[string]string{
+		"payments/dev/main.tf":   envMain,
+		"payments/stage/main.tf": envMain,
+		"payments/prod/main.tf":  envMain,
+		"billing/main.tf": `
+module "api" {
+  source = "../modules/api"
+}
+`,
+		"modules/api/main.tf":          "",
+		"modules/db/main.tf":           "",
+		".terraform/modules/x/main.tf": "",
+	})
+
+	discovery, err := Discover(tempDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	if len(discovery.Roots) != 4 {
+		t.Fatalf("expected 4 roots, got %d: %+v", len(discovery.Roots), discovery.Roots)
+	}
+
+	if len(discovery.Applications) != 1 {
+		t.Fatalf("expected 1 application, got %d: %+v", len(discovery.Applications), discovery.Applications)
+	}
+
+	app := discovery.Applications[0]
+	if app.Name != "payments" {
+		t.Errorf("expected application payments, got %s", app.Name)
+	}
+	if strings.Join(app.Environments, ",") != "dev,prod,stage" {
+		t.Errorf("unexpected environments %v", app.Environments)
+	}
+	if len(app.Modules) != 2 {
+		t.Errorf("expected 2 shared modules, got %v", app.Modules)
+	}
+
+	t.Run("affected report groups environments", func(t *testing.T) {
+		var buf bytes.Buffer
+		changed := []string{filepath.Join(tempDir, "modules", "db", "main.tf")}
+		if !writeAffectedApplications(&buf, discovery, changed, precedenceNearest) {
+			t.Fatal("expected affected=true")
+		}
+		if buf.String() != "app payments: dev, prod, stage affected\n" {
+			t.Errorf("unexpected report %q", buf.String())
+		}
+	})
+
+	t.Run("standalone root reported by path", func(t *testing.T) {
+		var buf bytes.Buffer
+		changed := []string{filepath.Join(tempDir, "billing", "main.tf")}
+		if !writeAffectedApplications(&buf, discovery, changed, precedenceNearest) {
+			t.Fatal("expected affected=true")
+		}
+		if !strings.HasPrefix(buf.String(), "root "+filepath.Join(tempDir, "billing")) {
+			t.Errorf("unexpected report %q", buf.String())
+		}
+	})
+}
+
+func TestDiscover_OverlappingRoots(t *testing.T) {
+	tempDir := t.TempDir()
+	outerDir := filepath.Join(tempDir, "envs")
+	innerDir := filepath.Join(tempDir, "envs", "prod")
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/main.tf":      "",
+		"envs/prod/main.tf": "",
+	})
+
+	discovery, err := Discover(tempDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	if len(discovery.Overlaps) != 1 {
+		t.Fatalf("expected 1 overlap, got %+v", discovery.Overlaps)
+	}
+	if discovery.Overlaps[0].Outer != outerDir || discovery.Overlaps[0].Inner != innerDir {
+		t.Errorf("unexpected overlap %+v", discovery.Overlaps[0])
+	}
+
+	changed := []string{filepath.Join(innerDir, "main.tf")}
+	tests := []struct {
+		precedence string
+		expected   []string
+	}{
+		{precedenceNearest, []string{innerDir}},
+		{precedenceOutermost, []string{outerDir}},
+		{precedenceAll, []string{outerDir, innerDir}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.precedence, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeAffectedApplications(&buf, discovery, changed, tt.precedence)
+
+			var expected string
+			for _, dir := range tt.expected {
+				expected += "root " + dir + " affected\n"
+			}
+			if buf.String() != expected {
+				t.Errorf("expected %q, got %q", expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestDiscoverContext_Cancelled(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `variable "region" {}`,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := DiscoverContext(ctx, tempDir, AnalyzeOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRootAffectedResults(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"payments/dev/main.tf": `
+module "api" {
+  source = "../../modules/api"
+}
+`,
+		"payments/prod/main.tf": `
+module "api" {
+  source = "../../modules/api"
+}
+`,
+		"billing/main.tf":     `variable "name" {}`,
+		"modules/api/main.tf": `variable "name" {}`,
+	})
+
+	discovery, err := Discover(tempDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	apiFile := filepath.Join(tempDir, "modules", "api", "main.tf")
+	results := RootAffectedResults(discovery, []string{apiFile, filepath.Join(tempDir, "README.md")}, precedenceNearest)
+	if len(results) != 3 {
+		t.Fatalf("expected a result per root, got %+v", results)
+	}
+
+	for _, r := range results {
+		switch filepath.Base(r.Path) {
+		case "billing":
+			if r.Affected || len(r.MatchedFiles) != 0 {
+				t.Errorf("expected billing to be unaffected, got %+v", r)
+			}
+		default:
+			if !r.Affected || r.Application != "payments" {
+				t.Errorf("expected %s to be affected as part of payments, got %+v", r.Path, r)
+			}
+			if len(r.MatchedFiles) != 1 || r.MatchedFiles[0] != apiFile {
+				t.Errorf("expected only the module file to match, got %v", r.MatchedFiles)
+			}
+		}
+	}
+}
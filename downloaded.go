@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+// downloadedModulesManifest is where terraform init records the modules it
+// installed, relative to the root module.
+const downloadedModulesManifest = ".terraform/modules/modules.json"
+
+// modulesManifest is the part of .terraform/modules/modules.json used to
+// find downloaded module directories.
+type modulesManifest struct {
+	Modules []struct {
+		Key     string `json:"Key"`
+		Source  string `json:"Source"`
+		Version string `json:"Version"`
+		Dir     string `json:"Dir"`
+	} `json:"Modules"`
+}
+
+// downloadedModule is a module installed by terraform init, with the
+// registry version that was selected.
+type downloadedModule struct {
+	dir     string
+	version string
+}
+
+// readDownloadedModules maps the key of every module installed for the root
+// module at rootDir, such as "app.vpc" for module "vpc" called by module
+// "app", to its absolute directory and installed version.
+func readDownloadedModules(fsys fileSystem, rootDir string) (map[string]downloadedModule, error) {
+	data, err := fsys.readFile(filepath.Join(rootDir, filepath.FromSlash(downloadedModulesManifest)))
+	if err != nil {
+		return nil, err
+	}
+	var manifest modulesManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", downloadedModulesManifest, err)
+	}
+
+	modules := make(map[string]downloadedModule)
+	for _, m := range manifest.Modules {
+		if m.Key == "" {
+			continue
+		}
+		dir := filepath.FromSlash(m.Dir)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(rootDir, dir)
+		}
+		modules[m.Key] = downloadedModule{dir: filepath.Clean(dir), version: m.Version}
+	}
+	return modules, nil
+}
+
+// moduleKey returns the key Terraform uses for the call name made from the
+// module with key parent.
+func moduleKey(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
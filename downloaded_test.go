@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze_IncludeDownloaded(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "5.0.0"
+}
+
+module "app" {
+  source = "./modules/app"
+}
+`,
+		"modules/app/main.tf": `
+module "label" {
+  source = "git::https://example.com/label.git?ref=v1.0.0"
+}
+`,
+		".terraform/modules/modules.json": `{"Modules":[
+  {"Key":"","Source":"","Dir":"."},
+  {"Key":"vpc","Source":"registry.terraform.io/terraform-aws-modules/vpc/aws","Version":"5.0.0","Dir":".terraform/modules/vpc"},
+  {"Key":"app","Source":"./modules/app","Dir":"modules/app"},
+  {"Key":"app.label","Source":"git::https://example.com/label.git?ref=v1.0.0","Dir":".terraform/modules/app.label"}
+]}`,
+		".terraform/modules/vpc/main.tf":       `resource "aws_vpc" "this" {}`,
+		".terraform/modules/vpc/variables.tf":  `variable "cidr" {}`,
+		".terraform/modules/app.label/main.tf": `output "id" { value = "x" }`,
+	})
+
+	output, err := AnalyzeWithOptions(tempDir, AnalyzeOptions{IncludeDownloaded: true})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(output.RemoteModules) != 2 {
+		t.Fatalf("expected 2 remote modules, got %+v", output.RemoteModules)
+	}
+
+	vpc, label := output.RemoteModules[0], output.RemoteModules[1]
+	vpcDir := filepath.Join(tempDir, ".terraform", "modules", "vpc")
+	if vpc.ResolvedPath != vpcDir {
+		t.Errorf("expected vpc to resolve to %s, got %s", vpcDir, vpc.ResolvedPath)
+	}
+	wantFiles := []string{filepath.Join(vpcDir, "main.tf"), filepath.Join(vpcDir, "variables.tf")}
+	if !reflect.DeepEqual(vpc.Files, wantFiles) {
+		t.Errorf("expected vpc files %v, got %v", wantFiles, vpc.Files)
+	}
+	if vpc.Hash == "" {
+		t.Error("expected downloaded module to have a hash")
+	}
+	if vpc.InstalledVersion != "5.0.0" || label.InstalledVersion != "" {
+		t.Errorf("expected the installed registry version 5.0.0, got %q and %q", vpc.InstalledVersion, label.InstalledVersion)
+	}
+	if label.ResolvedPath != filepath.Join(tempDir, ".terraform", "modules", "app.label") {
+		t.Errorf("expected nested module key app.label to resolve, got %q", label.ResolvedPath)
+	}
+
+	changed := filepath.Join(vpcDir, "main.tf")
+	affected := AffectedModules([]string{changed}, output)
+	if len(affected) != 2 || affected[1].Kind != kindRemote || affected[1].Name != "vpc" {
+		t.Errorf("expected root and remote vpc to be affected, got %+v", affected)
+	}
+	related := FilterRelatedFiles(CollectAllFiles(output), []string{changed}, output)
+	if !reflect.DeepEqual(related[len(related)-2:], wantFiles) {
+		t.Errorf("expected related files to end with the vpc files, got %v", related)
+	}
+
+	before := NewManifest(output)
+	if err := os.WriteFile(changed, []byte(`resource "aws_vpc" "main" {}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = AnalyzeWithOptions(tempDir, AnalyzeOptions{IncludeDownloaded: true})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	changes := DiffManifests(before, NewManifest(output))
+	want := []ModuleChange{{Change: changeModified, Path: ".terraform/modules/vpc"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("expected %+v, got %+v", want, changes)
+	}
+}
+
+func TestAnalyze_IncludeDownloadedDisabled(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source = "terraform-aws-modules/vpc/aws"
+}
+`,
+		".terraform/modules/modules.json": `{"Modules":[{"Key":"vpc","Dir":".terraform/modules/vpc"}]}`,
+		".terraform/modules/vpc/main.tf":  "",
+	})
+
+	output, err := Analyze(tempDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if remote := output.RemoteModules[0]; remote.ResolvedPath != "" || remote.Files != nil {
+		t.Errorf("expected downloaded files to be ignored by default, got %+v", remote)
+	}
+	if files := CollectAllFiles(output); len(files) != 1 {
+		t.Errorf("expected only the root file, got %v", files)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// DefaultDrift reports a variable of a shared module that most callers
+// override with the same value, suggesting the declared default is stale.
+type DefaultDrift struct {
+	ModulePath  string `json:"module_path"`
+	Variable    string `json:"variable"`
+	Default     string `json:"default"`
+	CommonValue string `json:"common_value"`
+	Overrides   int    `json:"overrides"`
+	Callers     int    `json:"callers"`
+}
+
+// moduleMetaArguments are module block arguments that are not input variables.
+var moduleMetaArguments = map[string]bool{
+	"source":     true,
+	"version":    true,
+	"count":      true,
+	"for_each":   true,
+	"providers":  true,
+	"depends_on": true,
+}
+
+func runDefaultDrift(args []string) int {
+	flags := newFlagSet("default-drift")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s default-drift <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Report shared module variables that most callers override with the same value.\n")
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	output, err := Analyze(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	drifts, err := DetectDefaultDrift(output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	writeDefaultDrift(os.Stdout, drifts)
+	return 0
+}
+
+// DetectDefaultDrift inspects every local module call in output and reports
+// variables where a strict majority of a module's callers pass the same
+// literal value and that value differs from the declared default.
+func DetectDefaultDrift(output *Output) ([]DefaultDrift, error) {
+	dirs := []string{output.RootModule.ResolvedPath}
+	seen := map[string]bool{output.RootModule.ResolvedPath: true}
+	for _, m := range output.LocalModules {
+		if !seen[m.ResolvedPath] {
+			seen[m.ResolvedPath] = true
+			dirs = append(dirs, m.ResolvedPath)
+		}
+	}
+
+	// calls maps a module directory to the literal arguments of each call to it.
+	calls := make(map[string][]map[string]string)
+	for _, dir := range dirs {
+		blocks, err := loadModuleBlocks(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range blocks {
+			attrs, _ := block.Body.JustAttributes()
+			source, ok := literalString(attrs["source"])
+			if !ok || !isLocalPath(source) {
+				continue
+			}
+			target, _ := filepath.Abs(filepath.Join(dir, source))
+			calls[target] = append(calls[target], literalArguments(attrs))
+		}
+	}
+
+	var drifts []DefaultDrift
+	for target, callArgs := range calls {
+		if len(callArgs) < 2 {
+			continue
+		}
+		module, diags := tfconfig.LoadModule(target)
+		if diags.HasErrors() {
+			continue
+		}
+		for name, v := range module.Variables {
+			if v.Required {
+				continue
+			}
+			def, err := canonicalJSON(v.Default)
+			if err != nil {
+				continue
+			}
+
+			counts := make(map[string]int)
+			for _, args := range callArgs {
+				if value, ok := args[name]; ok {
+					counts[value]++
+				}
+			}
+			common, count := mostCommon(counts)
+			if count*2 > len(callArgs) && common != def {
+				drifts = append(drifts, DefaultDrift{
+					ModulePath:  target,
+					Variable:    name,
+					Default:     def,
+					CommonValue: common,
+					Overrides:   count,
+					Callers:     len(callArgs),
+				})
+			}
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].ModulePath != drifts[j].ModulePath {
+			return drifts[i].ModulePath < drifts[j].ModulePath
+		}
+		return drifts[i].Variable < drifts[j].Variable
+	})
+	return drifts, nil
+}
+
+func writeDefaultDrift(w io.Writer, drifts []DefaultDrift) {
+	for _, d := range drifts {
+		fmt.Fprintf(w, "%s: variable %q defaults to %s, but %d of %d callers set %s\n",
+			d.ModulePath, d.Variable, d.Default, d.Overrides, d.Callers, d.CommonValue)
+	}
+}
+
+// literalArguments returns the canonical JSON encoding of every input
+// variable argument whose value is a constant expression.
+func literalArguments(attrs hcl.Attributes) map[string]string {
+	args := make(map[string]string)
+	for name, attr := range attrs {
+		if moduleMetaArguments[name] {
+			continue
+		}
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() || !val.IsWhollyKnown() {
+			continue
+		}
+		raw, err := ctyjson.Marshal(val, val.Type())
+		if err != nil {
+			continue
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			continue
+		}
+		if value, err := canonicalJSON(decoded); err == nil {
+			args[name] = value
+		}
+	}
+	return args
+}
+
+func canonicalJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func mostCommon(counts map[string]int) (string, int) {
+	var best string
+	bestCount := 0
+	for value, count := range counts {
+		if count > bestCount || (count == bestCount && value < best) {
+			best, bestCount = value, count
+		}
+	}
+	return best, bestCount
+}
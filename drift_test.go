@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectDefaultDrift(t *testing.T) {
+	tempDir := t.TempDir()
+	rootDir := filepath.Join(tempDir, "root")
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "a" {
+  source        = "../modules/bucket"
+  versioning    = true
+  force_destroy = true
+}
+
+module "b" {
+  source     = "../modules/bucket"
+  versioning = true
+}
+
+module "c" {
+  source        = "../modules/bucket"
+  versioning    = var.versioning
+  force_destroy = false
+}
+`,
+		"modules/bucket/variables.tf": `
+variable "versioning" {
+  default = false
+}
+
+variable "force_destroy" {
+  default = false
+}
+
+variable "name" {
+  type = string
+}
+`,
+	})
+
+	output, err := Analyze(rootDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	drifts, err := DetectDefaultDrift(output)
+	if err != nil {
+		t.Fatalf("DetectDefaultDrift failed: %v", err)
+	}
+
+	if len(drifts) != 1 {
+		t.Fatalf("expected 1 drift, got %d: %+v", len(drifts), drifts)
+	}
+
+	d := drifts[0]
+	if d.Variable != "versioning" || d.Default != "false" || d.CommonValue != "true" {
+		t.Errorf("unexpected drift: %+v", d)
+	}
+	if d.Overrides != 2 || d.Callers != 3 {
+		t.Errorf("expected 2 of 3 callers, got %d of %d", d.Overrides, d.Callers)
+	}
+	if d.ModulePath != filepath.Join(tempDir, "modules", "bucket") {
+		t.Errorf("unexpected module path %s", d.ModulePath)
+	}
+}
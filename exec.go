@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	exitPassed = 0
+	exitFailed = 1
+)
+
+// ExecRoot is a root module directory a command runs in, or a project
+// running it with its own variable files and workspace.
+type ExecRoot struct {
+	Path        string
+	Application string
+	Project     string
+	VarFiles    []string
+	Workspace   string
+}
+
+// newExecRoot returns the ExecRoot of a discovered root or project.
+func newExecRoot(root Root) ExecRoot {
+	return ExecRoot{
+		Path:        root.Path,
+		Application: root.Application,
+		Project:     root.Project,
+		VarFiles:    root.VarFiles,
+		Workspace:   root.Workspace,
+	}
+}
+
+// name returns the name the root is reported under.
+func (r ExecRoot) name() string {
+	return rootName(r.Path, r.Project)
+}
+
+// ExecOptions configures ExecRoots.
+type ExecOptions struct {
+	// Parallel bounds the number of roots the command runs in at once
+	// within a wave. Zero or less means one.
+	Parallel int
+
+	// Dependencies maps root directories to the roots they depend on, as
+	// returned by RootDependencies. A root runs in a later wave than the
+	// roots it depends on, directly or through roots that are not run, and
+	// is skipped when one of them did not pass.
+	Dependencies map[string][]string
+
+	// LogDir, if set, receives the combined output of each root in a file
+	// named after the root's directory.
+	LogDir string
+
+	// Output receives the output of each root as a block once it finishes,
+	// so that the output of roots running in parallel does not interleave.
+	Output io.Writer
+}
+
+// ExecResult is the outcome of running the command in a root.
+type ExecResult struct {
+	Root     ExecRoot
+	ExitCode int
+	Err      error
+	Duration time.Duration
+	LogFile  string
+
+	// Output is the combined stdout and stderr of the command.
+	Output string
+
+	// BlockedBy is the root directory, or the project, the command was
+	// skipped for because it did not pass.
+	BlockedBy string
+}
+
+// Failed reports whether the command did not run or exited non-zero.
+func (r ExecResult) Failed() bool {
+	return r.Err != nil || r.ExitCode != 0
+}
+
+// Skipped reports whether the command was not run because a root this one
+// depends on did not pass.
+func (r ExecResult) Skipped() bool {
+	return r.BlockedBy != ""
+}
+
+// execLogName returns the log file name of a root directory relative to the
+// working directory. Characters unsafe in file names are replaced, and the
+// name of such a root ends in a hash of the root, so that infra/prod and
+// infra_prod do not write to the same log.
+func execLogName(rel string) string {
+	name := strings.Trim(buildkiteKeyUnsafe.ReplaceAllString(rel, "_"), "_")
+	if name == "" {
+		name = "root"
+	}
+	if name != rel {
+		sum := sha256.Sum256([]byte(rel))
+		name += "-" + hex.EncodeToString(sum[:4])
+	}
+	return name + ".log"
+}
+
+// execDependencies returns, for each root, the indexes of the roots it
+// depends on among roots, following dependencies through directories that
+// are not in roots. Every project of a directory counts as a root of it.
+func execDependencies(roots []ExecRoot, dependencies map[string][]string) [][]int {
+	index := make(map[string][]int, len(roots))
+	for i, root := range roots {
+		index[root.Path] = append(index[root.Path], i)
+	}
+	deps := make([][]int, len(roots))
+	for i, root := range roots {
+		seen := map[string]bool{root.Path: true}
+		stack := slices.Clone(dependencies[root.Path])
+		for len(stack) > 0 {
+			dir := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			if js, ok := index[dir]; ok {
+				deps[i] = append(deps[i], js...)
+				continue
+			}
+			stack = append(stack, dependencies[dir]...)
+		}
+		sort.Ints(deps[i])
+	}
+	return deps
+}
+
+// execOrder returns deps with every project also ordered after the earlier
+// projects of its directory, so that projects sharing a working directory
+// and its .terraform directory do not run at once. Unlike dependencies,
+// these edges only order projects and do not skip them on failure.
+func execOrder(roots []ExecRoot, deps [][]int) [][]int {
+	order := make([][]int, len(deps))
+	last := make(map[string]int)
+	for i, root := range roots {
+		order[i] = deps[i]
+		if j, ok := last[root.Path]; ok && !slices.Contains(deps[i], j) {
+			order[i] = append(slices.Clone(deps[i]), j)
+		}
+		last[root.Path] = i
+	}
+	return order
+}
+
+// execWaves groups the indexes of roots into waves, each running after the
+// roots of earlier waves it depends on. It fails on a dependency cycle.
+func execWaves(roots []ExecRoot, deps [][]int) ([][]int, error) {
+	wave := make([]int, len(deps))
+	for i := range wave {
+		wave[i] = -1
+	}
+	var waves [][]int
+	for placed := 0; placed < len(deps); {
+		var next []int
+		for i, ds := range deps {
+			if wave[i] >= 0 {
+				continue
+			}
+			ready := true
+			for _, j := range ds {
+				ready = ready && wave[j] >= 0 && wave[j] < len(waves)
+			}
+			if ready {
+				next = append(next, i)
+			}
+		}
+		if len(next) == 0 {
+			var cycle []string
+			for i, root := range roots {
+				if wave[i] < 0 {
+					cycle = append(cycle, root.name())
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between roots %s", strings.Join(cycle, ", "))
+		}
+		for _, i := range next {
+			wave[i] = len(waves)
+		}
+		waves = append(waves, next)
+		placed += len(next)
+	}
+	return waves, nil
+}
+
+// ExecRoots runs argv in every root directory, in waves ordered by the
+// dependencies between roots, and returns the results in the order of
+// roots. The command sees the root in TFMR_MODULE_PATH, its path relative
+// to the working directory in TFMR_ROOT and its application, if any, in
+// TFMR_APPLICATION. Projects also see their name in TFMR_PROJECT, their
+// -var-file arguments in TFMR_VAR_FILES and their workspace in
+// TF_WORKSPACE; projects of the same directory never run at once.
+func ExecRoots(ctx context.Context, roots []ExecRoot, argv []string, opts ExecOptions) ([]ExecResult, error) {
+	deps := execDependencies(roots, opts.Dependencies)
+	waves, err := execWaves(roots, execOrder(roots, deps))
+	if err != nil {
+		return nil, err
+	}
+
+	parallel := max(opts.Parallel, 1)
+	results := make([]ExecResult, len(roots))
+	var mu sync.Mutex
+	sem := make(chan struct{}, parallel)
+	for _, wave := range waves {
+		var wg sync.WaitGroup
+		for _, i := range wave {
+			root := roots[i]
+			if blocked := slices.IndexFunc(deps[i], func(j int) bool {
+				return results[j].Failed() || results[j].Skipped()
+			}); blocked >= 0 {
+				blocker := roots[deps[i][blocked]]
+				results[i] = ExecResult{Root: root, BlockedBy: blocker.Path}
+				if blocker.Project != "" {
+					results[i].BlockedBy = blocker.Project
+				}
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				var out bytes.Buffer
+				results[i] = execRoot(ctx, root, argv, &out, opts.LogDir)
+				if opts.Output != nil {
+					mu.Lock()
+					fmt.Fprintf(opts.Output, "==> %s <==\n", root.name())
+					opts.Output.Write(out.Bytes())
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	return results, nil
+}
+
+func execRoot(ctx context.Context, root ExecRoot, argv []string, out *bytes.Buffer, logDir string) ExecResult {
+	result := ExecResult{Root: root}
+	rel := workingDirRel(root.Path)
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = root.Path
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Env = append(os.Environ(),
+		"TFMR_MODULE_PATH="+root.Path,
+		"TFMR_ROOT="+rel,
+		"TFMR_APPLICATION="+root.Application,
+		"TFMR_PROJECT="+root.Project,
+		"TFMR_VAR_FILES="+varFilesEnv(root.Path, root.VarFiles),
+	)
+	if root.Workspace != "" {
+		cmd.Env = append(cmd.Env, "TF_WORKSPACE="+root.Workspace)
+	}
+	err := cmd.Run()
+	result.Duration = time.Since(start)
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		result.Err = err
+		fmt.Fprintf(out, "Error: %v\n", err)
+	}
+
+	result.Output = out.String()
+	if logDir != "" {
+		result.LogFile = filepath.Join(logDir, execLogName(root.name()))
+		if err := os.WriteFile(result.LogFile, out.Bytes(), 0644); err != nil && result.Err == nil {
+			result.Err = err
+		}
+	}
+	return result
+}
+
+// writeExecSummary writes a line per result and a pass/fail count.
+func writeExecSummary(w io.Writer, results []ExecResult) {
+	passed, failed, skipped := 0, 0, 0
+	for _, r := range results {
+		if r.Skipped() {
+			skipped++
+			fmt.Fprintf(w, "SKIP\t%s\t%s did not pass\n", r.Root.name(), workingDirRel(r.BlockedBy))
+			continue
+		}
+		status := "PASS"
+		if r.Failed() {
+			status = "FAIL"
+			failed++
+		} else {
+			passed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s", status, r.Root.name(), r.Duration.Round(time.Millisecond))
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(w, "\t%v", r.Err)
+		case r.ExitCode != 0:
+			fmt.Fprintf(w, "\texit code %d", r.ExitCode)
+		}
+		if r.LogFile != "" {
+			fmt.Fprintf(w, "\tlog %s", r.LogFile)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%d passed, %d failed", passed, failed)
+	if skipped > 0 {
+		fmt.Fprintf(w, ", %d skipped", skipped)
+	}
+	fmt.Fprintln(w)
+}
+
+func runExec(args []string) int {
+	flags := newFlagSet("exec")
+	all := flags.Bool("all", false, "run in every discovered root instead of the roots affected by changed files from stdin")
+	parallel := flags.Int("parallel", runtime.NumCPU(), "number of roots to run the command in at once within a wave of roots that do not depend on each other")
+	ignoreDependencies := flags.Bool("ignore-dependencies", false, "run all roots at once instead of in dependency order")
+	logDir := flags.String("log-dir", "", "also write the output of each root to a file in this directory")
+	junit := flags.String("junit", "", "write a JUnit XML report with a test case per root to this file")
+	precedence := flags.String("overlap-precedence", precedenceNearest, "root that owns files of a nested root: nearest, outermost or all")
+	configPath := flags.String("config", "", "configuration file (default "+defaultConfigFile+" in the working directory, if present)")
+	var includeGlobs stringsFlag
+	flags.Var(&includeGlobs, "include-glob", "also list files matching this glob, relative to each module directory, such as 'templates/**', as module files that affect the module (may be repeated)")
+	stdinFormat := addStdinFormatFlag(flags)
+	var ignoreChanged stringsFlag
+	flags.Var(&ignoreChanged, "ignore-changed", "ignore changed files from stdin matching this glob, such as '**/*.md' (** matches any number of directories; may be repeated)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s exec [options] <directory> -- <command> [args...]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Run a command in every root under a directory affected by the changed files\n")
+		fmt.Fprintf(flags.Output(), "read from stdin. The command sees the root in TFMR_MODULE_PATH, its path\n")
+		fmt.Fprintf(flags.Output(), "relative to the working directory in TFMR_ROOT and its application in\n")
+		fmt.Fprintf(flags.Output(), "TFMR_APPLICATION. Configured projects run once each with TFMR_PROJECT,\n")
+		fmt.Fprintf(flags.Output(), "TF_WORKSPACE and their -var-file arguments in TFMR_VAR_FILES. The output of\n")
+		fmt.Fprintf(flags.Output(), "each root is printed when it finishes, followed by a summary on stderr\n")
+		fmt.Fprintf(flags.Output(), "(exit 0=all passed, 1=any failed).\n\n")
+		fmt.Fprintf(flags.Output(), "Roots run in waves: a root runs after the roots whose state it reads through\n")
+		fmt.Fprintf(flags.Output(), "terraform_remote_state and those configured as its dependencies, and is\n")
+		fmt.Fprintf(flags.Output(), "skipped when one of them fails.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\nExamples:\n")
+		fmt.Fprintf(flags.Output(), "  git diff --name-only origin/main | %s exec infra -- terraform plan -input=false\n", os.Args[0])
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	rest := flags.Args()
+	if len(rest) >= 2 && rest[1] == "--" {
+		rest = append(rest[:1:1], rest[2:]...)
+	}
+	if len(rest) < 2 {
+		flags.Usage()
+		return exitError
+	}
+	dir, argv := rest[0], rest[1:]
+	switch *precedence {
+	case precedenceNearest, precedenceOutermost, precedenceAll:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --overlap-precedence %q\n", *precedence)
+		return exitError
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	analyzeOpts := config.analyzeOptions()
+	analyzeOpts.IncludeGlobs = includeGlobs
+	discovery, err := DiscoverWithOptions(dir, analyzeOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	absDir, _ := filepath.Abs(dir)
+	ApplyProjects(discovery, config.Projects, absDir)
+
+	var roots []ExecRoot
+	if *all {
+		for _, root := range discovery.Roots {
+			roots = append(roots, newExecRoot(root))
+		}
+	} else {
+		changedFiles, err := readChangedFiles(*stdinFormat, ignoreChanged)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+			return exitError
+		}
+		for i, r := range RootAffectedResults(discovery, changedFiles, *precedence) {
+			if r.Affected {
+				roots = append(roots, newExecRoot(discovery.Roots[i]))
+			}
+		}
+	}
+	if len(roots) == 0 {
+		fmt.Fprintf(os.Stderr, "No affected roots\n")
+		if *junit != "" {
+			// An empty report tells CI that nothing had to run.
+			if err := writeJUnitReport(*junit, argv, time.Now(), nil); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing JUnit report: %v\n", err)
+				return exitError
+			}
+		}
+		return exitPassed
+	}
+	if *logDir != "" {
+		if err := os.MkdirAll(*logDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := ExecOptions{Parallel: *parallel, LogDir: *logDir, Output: os.Stdout}
+	if !*ignoreDependencies {
+		opts.Dependencies = RootDependencies(discovery, config.Dependencies)
+	}
+	start := time.Now()
+	results, err := ExecRoots(ctx, roots, argv, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	writeExecSummary(os.Stderr, results)
+	if *junit != "" {
+		if err := writeJUnitReport(*junit, argv, start, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JUnit report: %v\n", err)
+			return exitError
+		}
+	}
+	for _, r := range results {
+		if r.Failed() || r.Skipped() {
+			return exitFailed
+		}
+	}
+	return exitPassed
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExecRoots(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"prod/main.tf": `variable "x" {}`,
+		"dev/main.tf":  `variable "x" {}`,
+	})
+	t.Chdir(tempDir)
+	roots := []ExecRoot{
+		{Path: filepath.Join(tempDir, "prod"), Application: "app"},
+		{Path: filepath.Join(tempDir, "dev"), Application: "app"},
+	}
+	logDir := filepath.Join(tempDir, "logs")
+	if err := os.Mkdir(logDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	script := `echo "$TFMR_ROOT $TFMR_APPLICATION $(basename "$TFMR_MODULE_PATH") $(basename "$PWD")"; test "$TFMR_ROOT" = prod`
+	results, err := ExecRoots(t.Context(), roots, []string{"sh", "-c", script}, ExecOptions{Parallel: 2, LogDir: logDir, Output: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 || !reflect.DeepEqual(results[0].Root, roots[0]) || !reflect.DeepEqual(results[1].Root, roots[1]) {
+		t.Fatalf("expected results in the order of roots, got %+v", results)
+	}
+	if results[0].Failed() || !results[1].Failed() || results[1].ExitCode != 1 {
+		t.Errorf("expected prod to pass and dev to fail, got %+v", results)
+	}
+	if !strings.Contains(out.String(), "==> prod <==\nprod app prod prod\n") {
+		t.Errorf("expected a block per root, got:\n%s", out.String())
+	}
+	log, err := os.ReadFile(filepath.Join(logDir, "dev.log"))
+	if err != nil || string(log) != "dev app dev dev\n" {
+		t.Errorf("expected the dev log, got %q (%v)", log, err)
+	}
+
+	missing, _ := ExecRoots(t.Context(), roots[:1], []string{"no-such-command-tfmr"}, ExecOptions{})
+	if missing[0].Err == nil || !missing[0].Failed() {
+		t.Errorf("expected an error for a missing command, got %+v", missing[0])
+	}
+
+	var summary bytes.Buffer
+	writeExecSummary(&summary, results)
+	for _, want := range []string{"PASS\tprod\t", "FAIL\tdev\t", "\texit code 1\tlog " + filepath.Join(logDir, "dev.log") + "\n", "1 passed, 1 failed\n"} {
+		if !strings.Contains(summary.String(), want) {
+			t.Errorf("expected the summary to contain %q, got:\n%s", want, summary.String())
+		}
+	}
+}
+
+func TestExecRoots_DependencyOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"network/main.tf": `variable "x" {}`,
+		"app/main.tf":     `variable "x" {}`,
+		"batch/main.tf":   `variable "x" {}`,
+	})
+	t.Chdir(tempDir)
+	dir := func(name string) string { return filepath.Join(tempDir, name) }
+	roots := []ExecRoot{{Path: dir("batch")}, {Path: dir("app")}, {Path: dir("network")}}
+	dependencies := map[string][]string{
+		dir("app"):   {dir("network")},
+		dir("batch"): {dir("queue")},
+		dir("queue"): {dir("app")},
+	}
+
+	order := filepath.Join(tempDir, "order")
+	script := `echo "$TFMR_ROOT" >> ` + order + `; test "$TFMR_ROOT" != "$FAIL"`
+	t.Setenv("FAIL", "")
+	results, err := ExecRoots(t.Context(), roots, []string{"sh", "-c", script}, ExecOptions{Parallel: 4, Dependencies: dependencies})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(order)
+	if string(data) != "network\napp\nbatch\n" {
+		t.Errorf("expected producers before consumers, got %q", data)
+	}
+
+	t.Setenv("FAIL", "network")
+	results, _ = ExecRoots(t.Context(), roots, []string{"sh", "-c", script}, ExecOptions{Parallel: 4, Dependencies: dependencies})
+	if !results[2].Failed() || results[1].BlockedBy != dir("network") || results[0].BlockedBy != dir("app") {
+		t.Errorf("expected consumers of a failed root to be skipped, got %+v", results)
+	}
+	var summary bytes.Buffer
+	writeExecSummary(&summary, results)
+	if !strings.Contains(summary.String(), "SKIP\tapp\tnetwork did not pass\n") || !strings.HasSuffix(summary.String(), "0 passed, 1 failed, 2 skipped\n") {
+		t.Errorf("unexpected summary:\n%s", summary.String())
+	}
+
+	dependencies[dir("network")] = []string{dir("batch")}
+	if _, err := ExecRoots(t.Context(), roots, []string{"true"}, ExecOptions{Dependencies: dependencies}); err == nil {
+		t.Error("expected an error for a dependency cycle")
+	}
+}
+
+func TestExecLogName(t *testing.T) {
+	for rel, expected := range map[string]string{
+		"prod":      "prod.log",
+		"infra_dev": "infra_dev.log",
+	} {
+		if name := execLogName(rel); name != expected {
+			t.Errorf("expected %s for %s, got %s", expected, rel, name)
+		}
+	}
+	names := make(map[string]string)
+	for _, rel := range []string{"infra/dev", "infra_dev", "infra dev", "."} {
+		name := execLogName(rel)
+		if other, ok := names[name]; ok {
+			t.Errorf("expected different logs for %s and %s, got %s", other, rel, name)
+		}
+		names[name] = rel
+	}
+}
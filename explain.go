@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Explanation records why a changed file does or does not affect a root
+// module: every module directory containing it, with the Terraform
+// addresses of the calls that reach that directory. Ignored tells why a
+// file of a root file class, such as a lock file, affects none of them.
+type Explanation struct {
+	File    string             `json:"file"`
+	Matches []ExplanationMatch `json:"matches"`
+	Ignored string             `json:"ignored,omitempty"`
+}
+
+// ExplanationMatch is a module directory containing a changed file, or
+// calling the Deleted module directory containing it. The root module has
+// no addresses.
+type ExplanationMatch struct {
+	Kind         string   `json:"kind"`
+	ResolvedPath string   `json:"resolved_path"`
+	Addresses    []string `json:"addresses,omitempty"`
+	Deleted      string   `json:"deleted,omitempty"`
+}
+
+// ExplainAffected explains the affected decision for each changed file.
+func ExplainAffected(changedFiles []string, output *Output) []Explanation {
+	var explanations []Explanation
+	for _, f := range changedFiles {
+		absPath := toAbsPath(f)
+		e := Explanation{File: f, Matches: []ExplanationMatch{}}
+		inRoot := isInDirectory(absPath, output.RootModule.ResolvedPath)
+		if class := rootFileClass(absPath); class != "" {
+			switch {
+			case inRoot && !output.rootFileEnabled(class):
+				e.Ignored = fmt.Sprintf("%s files are disabled by root_files", class)
+			case !inRoot:
+				e.Ignored = fmt.Sprintf("%s files only affect the root module", class)
+			}
+		}
+
+		if inRoot && output.classAffects(absPath, true) {
+			e.Matches = append(e.Matches, ExplanationMatch{Kind: kindRoot, ResolvedPath: output.RootModule.ResolvedPath})
+		}
+
+		index := make(map[string]int)
+		for _, m := range output.LocalModules {
+			if !isInDirectory(absPath, m.ResolvedPath) || !output.classAffects(absPath, false) {
+				continue
+			}
+			i, ok := index[m.ResolvedPath]
+			if !ok {
+				i = len(e.Matches)
+				index[m.ResolvedPath] = i
+				e.Matches = append(e.Matches, ExplanationMatch{Kind: kindLocal, ResolvedPath: m.ResolvedPath})
+			}
+			e.Matches[i].Addresses = append(e.Matches[i].Addresses, moduleAddress(m, output))
+		}
+
+		if deleted, caller, ok := output.deletedModuleCaller(absPath); ok && output.classAffects(absPath, caller == output.RootModule.ResolvedPath) {
+			match := ExplanationMatch{Kind: kindRoot, ResolvedPath: caller, Deleted: deleted.ResolvedPath}
+			if caller != output.RootModule.ResolvedPath {
+				match.Kind = kindLocal
+				for _, m := range output.LocalModules {
+					if m.ResolvedPath == caller {
+						match.Addresses = append(match.Addresses, moduleAddress(m, output))
+					}
+				}
+			}
+			e.Matches = append(e.Matches, match)
+		}
+		explanations = append(explanations, e)
+	}
+	return explanations
+}
+
+// moduleAddress returns the Terraform address of a local module call, such
+// as module.app.module.vpc, following the first call of each caller back
+// to the root.
+func moduleAddress(m ModuleDetail, output *Output) string {
+	parts := []string{"module." + m.Name}
+	seen := map[string]bool{m.ResolvedPath: true}
+	caller := m.CallerPath
+	for caller != output.RootModule.ResolvedPath && !seen[caller] {
+		seen[caller] = true
+		found := false
+		for _, c := range output.LocalModules {
+			if c.ResolvedPath == caller {
+				parts = append([]string{"module." + c.Name}, parts...)
+				caller = c.CallerPath
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func writeExplanations(w io.Writer, explanations []Explanation) {
+	for _, e := range explanations {
+		if len(e.Matches) == 0 && e.Ignored != "" {
+			fmt.Fprintf(w, "%s: ignored, %s\n", e.File, e.Ignored)
+			continue
+		}
+		if len(e.Matches) == 0 {
+			fmt.Fprintf(w, "%s: not in any module directory\n", e.File)
+			continue
+		}
+		for _, m := range e.Matches {
+			switch {
+			case m.Deleted != "" && m.Kind == kindRoot:
+				fmt.Fprintf(w, "%s: in deleted module %s, called by root module %s\n", e.File, m.Deleted, m.ResolvedPath)
+			case m.Deleted != "":
+				fmt.Fprintf(w, "%s: in deleted module %s, called by %s as %s\n", e.File, m.Deleted, m.ResolvedPath, strings.Join(m.Addresses, ", "))
+			case m.Kind == kindRoot:
+				fmt.Fprintf(w, "%s: in root module %s\n", e.File, m.ResolvedPath)
+			default:
+				fmt.Fprintf(w, "%s: in %s, called as %s\n", e.File, m.ResolvedPath, strings.Join(m.Addresses, ", "))
+			}
+		}
+	}
+}
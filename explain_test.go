@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExplainAffected(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "app" {
+  source = "../modules/app"
+}
+
+module "vpc" {
+  source = "../modules/vpc"
+}
+`,
+		"modules/app/main.tf": `
+module "network" {
+  source = "../vpc"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+
+	output, err := Analyze(filepath.Join(tempDir, "root"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	vpcFile := filepath.Join(tempDir, "modules", "vpc", "main.tf")
+	rootFile := filepath.Join(tempDir, "root", "main.tf")
+	otherFile := filepath.Join(tempDir, "README.md")
+	explanations := ExplainAffected([]string{vpcFile, rootFile, otherFile}, output)
+
+	if len(explanations) != 3 {
+		t.Fatalf("expected 3 explanations, got %d", len(explanations))
+	}
+
+	vpc := explanations[0]
+	if len(vpc.Matches) != 1 || vpc.Matches[0].ResolvedPath != filepath.Join(tempDir, "modules", "vpc") {
+		t.Fatalf("expected a single match on modules/vpc, got %+v", vpc.Matches)
+	}
+	addresses := strings.Join(vpc.Matches[0].Addresses, ",")
+	if addresses != "module.app.module.network,module.vpc" {
+		t.Errorf("expected both call chains, got %s", addresses)
+	}
+
+	if len(explanations[1].Matches) != 1 || explanations[1].Matches[0].Kind != kindRoot {
+		t.Errorf("expected root match, got %+v", explanations[1].Matches)
+	}
+	if len(explanations[2].Matches) != 0 {
+		t.Errorf("expected no match, got %+v", explanations[2].Matches)
+	}
+
+	var buf bytes.Buffer
+	writeExplanations(&buf, explanations)
+	for _, want := range []string{
+		vpcFile + ": in " + filepath.Join(tempDir, "modules", "vpc") + ", called as module.app.module.network, module.vpc",
+		rootFile + ": in root module " + filepath.Join(tempDir, "root"),
+		otherFile + ": not in any module directory",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
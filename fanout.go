@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ModuleFanOut is the number of distinct call sites, module blocks in a
+// calling directory, that reference a module across the analyzed roots,
+// and the number of roots whose module tree includes it. Local modules are
+// identified by their directory relative to the working directory, remote
+// modules by their registry address or package URL, with any subdirectory
+// and without the version or ref.
+type ModuleFanOut struct {
+	Module    string `json:"module"`
+	Kind      string `json:"kind"`
+	CallSites int    `json:"call_sites"`
+	Roots     int    `json:"roots"`
+}
+
+// remoteModuleKey identifies the module of a remote call regardless of the
+// version or ref it selects.
+func remoteModuleKey(m RemoteModule) string {
+	key := m.URL
+	if m.Registry != nil {
+		key = m.Registry.Address
+	}
+	if key == "" {
+		key = m.Source
+	} else if m.Subdir != "" {
+		key += "//" + m.Subdir
+	}
+	return key
+}
+
+// ComputeFanOut counts the call sites and roots of every local and remote
+// module called by the discovered roots, sorted by call sites and roots,
+// most first. A call site shared by several roots, such as a call inside a
+// shared local module, is counted once.
+func ComputeFanOut(discovery *Discovery) []ModuleFanOut {
+	type module struct{ kind, key string }
+	type callSite struct{ caller, name string }
+	sites := make(map[module]map[callSite]bool)
+	roots := make(map[module]map[string]bool)
+	add := func(m module, site callSite, root string) {
+		if sites[m] == nil {
+			sites[m] = make(map[callSite]bool)
+			roots[m] = make(map[string]bool)
+		}
+		sites[m][site] = true
+		roots[m][root] = true
+	}
+	for _, root := range discovery.Roots {
+		for _, m := range root.Analysis.LocalModules {
+			add(module{kindLocal, workingDirRel(m.ResolvedPath)}, callSite{m.CallerPath, m.Name}, root.Path)
+		}
+		for _, m := range root.Analysis.RemoteModules {
+			add(module{kindRemote, remoteModuleKey(m)}, callSite{m.CallerPath, m.Name}, root.Path)
+		}
+	}
+
+	fanOut := []ModuleFanOut{}
+	for m, s := range sites {
+		fanOut = append(fanOut, ModuleFanOut{Module: m.key, Kind: m.kind, CallSites: len(s), Roots: len(roots[m])})
+	}
+	sort.Slice(fanOut, func(i, j int) bool {
+		a, b := fanOut[i], fanOut[j]
+		if a.CallSites != b.CallSites {
+			return a.CallSites > b.CallSites
+		}
+		if a.Roots != b.Roots {
+			return a.Roots > b.Roots
+		}
+		if a.Module != b.Module {
+			return a.Module < b.Module
+		}
+		return a.Kind < b.Kind
+	})
+	return fanOut
+}
+
+func writeFanOut(w io.Writer, fanOut []ModuleFanOut) {
+	fmt.Fprintf(w, "%5s  %5s  %-6s  %s\n", "CALLS", "ROOTS", "KIND", "MODULE")
+	for _, f := range fanOut {
+		fmt.Fprintf(w, "%5d  %5d  %-6s  %s\n", f.CallSites, f.Roots, f.Kind, f.Module)
+	}
+}
+
+func runFanOut(args []string) (code int) {
+	flags := newFlagSet("fanout")
+	format := flags.String("format", "text", "output format: text or json")
+	configPath := flags.String("config", "", "configuration file (default "+defaultConfigFile+" in the working directory, if present)")
+	outputPath := flags.String("output", "", "write the report to this file, atomically replacing it, instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s fanout [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Report, for every local and remote module called by the roots under a\n")
+		fmt.Fprintf(flags.Output(), "directory, how many distinct call sites reference it and how many roots use\n")
+		fmt.Fprintf(flags.Output(), "it, most referenced first.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	discovery, err := DiscoverWithOptions(flags.Arg(0), config.analyzeOptions())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	stdout, outputFile := newOutput(*outputPath)
+	defer func() { code = outputFile.close(code) }()
+	fanOut := ComputeFanOut(discovery)
+	if *format == "json" {
+		jsonOutput, _ := json.MarshalIndent(fanOut, "", "  ")
+		fmt.Fprintln(stdout, string(jsonOutput))
+		return 0
+	}
+	writeFanOut(stdout, fanOut)
+	return 0
+}
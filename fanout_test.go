@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComputeFanOut(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+
+module "network" {
+  source = "../../modules/vpc"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+		"envs/dev/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.24.0"
+}
+`,
+		"modules/app/main.tf": `
+module "vpc" {
+  source = "../vpc"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+	t.Chdir(tempDir)
+
+	discovery, err := Discover("envs")
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	fanOut := ComputeFanOut(discovery)
+
+	expected := []ModuleFanOut{
+		{Module: "modules/app", Kind: kindLocal, CallSites: 2, Roots: 2},
+		{Module: "modules/vpc", Kind: kindLocal, CallSites: 2, Roots: 2},
+		{Module: "registry.terraform.io/cloudposse/label/null", Kind: kindRemote, CallSites: 2, Roots: 2},
+	}
+	if !reflect.DeepEqual(fanOut, expected) {
+		t.Errorf("expected %+v, got %+v", expected, fanOut)
+	}
+
+	var b strings.Builder
+	writeFanOut(&b, fanOut)
+	if !strings.Contains(b.String(), "    2      2  local   modules/app\n") {
+		t.Errorf("unexpected report:\n%s", b.String())
+	}
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// moduleFetcher downloads remote module sources: registry modules through
+// the configured mirrors or the module registry protocol, git sources with
+// the git command, and HTTP, S3 and GCS archives. It is not safe for
+// concurrent use.
+type moduleFetcher struct {
+	client       *http.Client
+	installation ModuleInstallation
+
+	// moduleAPIs caches the modules.v1 endpoint of each registry host.
+	moduleAPIs map[string]*url.URL
+
+	// gitCache, when set, keeps the repositories of git sources between
+	// fetches.
+	gitCache *gitCache
+}
+
+func newModuleFetcher(client *http.Client, installation ModuleInstallation) *moduleFetcher {
+	if client == nil {
+		client = networkClient()
+	}
+	return &moduleFetcher{client: client, installation: installation, moduleAPIs: make(map[string]*url.URL)}
+}
+
+// fetch downloads the package of source into dest, which must not exist,
+// and returns the version that was selected for registry sources and the
+// checksum the downloaded archive was verified against, if its address
+// had one. The subdirectory part of source is not applied.
+func (f *moduleFetcher) fetch(ctx context.Context, source, version, dest string) (string, string, error) {
+	pkg, _ := splitSourceSubdir(source)
+	if isRegistrySource(source) {
+		return f.fetchRegistry(ctx, pkg, version, dest)
+	}
+	checksum, err := f.fetchPackage(ctx, pkg, dest)
+	return "", checksum, err
+}
+
+func (f *moduleFetcher) fetchRegistry(ctx context.Context, pkg, constraint, dest string) (string, string, error) {
+	source, version, _, err := f.resolveRegistry(ctx, pkg, constraint)
+	if err != nil {
+		return "", "", err
+	}
+	// resolveRegistry has validated the address.
+	addr, _ := parseRegistrySource(pkg)
+	checksum, err := source.download(ctx, addr.Host, addr.path(), version, dest)
+	if err != nil {
+		return "", "", fmt.Errorf("%s %s: %w", pkg, version, err)
+	}
+	return version, checksum, nil
+}
+
+// registryAPI serves registry modules through the module registry
+// protocol, either from each host's own registry or, when mirror is set,
+// from a network mirror implementing the protocol below mirror/<host>/.
+type registryAPI struct {
+	fetcher *moduleFetcher
+	mirror  *url.URL
+}
+
+func (r registryAPI) String() string {
+	if r.mirror != nil {
+		return "network mirror " + r.mirror.String()
+	}
+	return "registry"
+}
+
+func (r registryAPI) base(ctx context.Context, host string) (*url.URL, error) {
+	if r.mirror != nil {
+		return r.mirror.JoinPath(host), nil
+	}
+	return r.fetcher.moduleAPI(ctx, host)
+}
+
+func (r registryAPI) versions(ctx context.Context, host, path string) (*registryModule, error) {
+	api, err := r.base(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var versions struct {
+		Modules []struct {
+			Deprecation *registryDeprecation `json:"deprecation"`
+			Versions    []struct {
+				Version     string               `json:"version"`
+				Deprecation *registryDeprecation `json:"deprecation"`
+			} `json:"versions"`
+		} `json:"modules"`
+	}
+	if err := r.fetcher.getJSON(ctx, api.JoinPath(path, "versions").String(), &versions); err != nil {
+		return nil, err
+	}
+	module := &registryModule{}
+	for _, m := range versions.Modules {
+		if m.Deprecation != nil {
+			module.Deprecation = m.Deprecation
+		}
+		for _, v := range m.Versions {
+			module.Versions = append(module.Versions, registryVersion{Version: v.Version, Deprecation: v.Deprecation})
+		}
+	}
+	return module, nil
+}
+
+// download fetches the package at the download location that the
+// registry returns. An archive location with a checksum parameter is
+// verified against it, and the checksum is returned.
+func (r registryAPI) download(ctx context.Context, host, path, version, dest string) (string, error) {
+	api, err := r.base(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	downloadURL := api.JoinPath(path, version, "download")
+	resp, err := r.fetcher.get(ctx, downloadURL.String())
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	location := resp.Header.Get("X-Terraform-Get")
+	if location == "" {
+		return "", fmt.Errorf("%s returned no download location", r)
+	}
+	if strings.HasPrefix(location, "/") || strings.HasPrefix(location, "./") || strings.HasPrefix(location, "../") {
+		// Relative locations are resolved against the download URL.
+		u, err := downloadURL.Parse(location)
+		if err != nil {
+			return "", fmt.Errorf("invalid download location %q: %w", location, err)
+		}
+		location = u.String()
+	}
+
+	// The download location may itself select a subdirectory, such as the
+	// single top-level directory of a GitHub archive.
+	locationPkg, subdir := splitSourceSubdir(location)
+	if subdir == "" {
+		return r.fetcher.fetchPackage(ctx, locationPkg, dest)
+	}
+	staging := dest + ".download"
+	defer os.RemoveAll(staging)
+	checksum, err := r.fetcher.fetchPackage(ctx, locationPkg, staging)
+	if err != nil {
+		return "", err
+	}
+	dir, err := resolveSubdir(staging, subdir)
+	if err != nil {
+		return "", err
+	}
+	return checksum, os.Rename(dir, dest)
+}
+
+// moduleAPI returns the base URL of the module registry API of host, as
+// advertised by its service discovery document.
+func (f *moduleFetcher) moduleAPI(ctx context.Context, host string) (*url.URL, error) {
+	if api, ok := f.moduleAPIs[host]; ok {
+		return api, nil
+	}
+	base := &url.URL{Scheme: "https", Host: host, Path: "/"}
+	var services map[string]any
+	if err := f.getJSON(ctx, base.JoinPath(".well-known", "terraform.json").String(), &services); err != nil {
+		return nil, fmt.Errorf("service discovery for %s: %w", host, err)
+	}
+	endpoint, ok := services["modules.v1"].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s does not provide a module registry", host)
+	}
+	api, err := base.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modules.v1 endpoint %q of %s: %w", endpoint, host, err)
+	}
+	f.moduleAPIs[host] = api
+	return api, nil
+}
+
+func (f *moduleFetcher) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f.do(req)
+}
+
+// do sends req and fails unless it succeeds.
+func (f *moduleFetcher) do(req *http.Request) (*http.Response, error) {
+	if err := checkOnline("GET " + req.URL.String()); err != nil {
+		return nil, err
+	}
+	resp, err := doHTTP(f.client, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %w", req.URL, errNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+	}
+	return resp, nil
+}
+
+// maxRegistryResponseSize bounds the JSON responses read from a registry.
+const maxRegistryResponseSize = 16 << 20
+
+func (f *moduleFetcher) getJSON(ctx context.Context, rawURL string, v any) error {
+	resp, err := f.get(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Registry responses are small; a larger one is cut short and fails
+	// to decode rather than exhausting memory.
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxRegistryResponseSize)).Decode(v); err != nil {
+		return fmt.Errorf("GET %s: %w", rawURL, err)
+	}
+	return nil
+}
+
+// archiveFormat returns the archive format of an HTTP package address,
+// given by its archive query parameter or its file extension.
+func archiveFormat(u *url.URL) string {
+	if format := u.Query().Get("archive"); format != "" {
+		return format
+	}
+	for _, ext := range []string{"tar.gz", "tgz", "zip"} {
+		if strings.HasSuffix(u.Path, "."+ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// fetchPackage downloads a git package address, or an HTTP, S3 or GCS
+// archive address, into dest. Archives are verified against the checksum
+// parameter of their address, as go-getter does, and the verified checksum
+// is returned; it is empty for addresses without one.
+func (f *moduleFetcher) fetchPackage(ctx context.Context, pkg, dest string) (string, error) {
+	if isGitSource(pkg) {
+		if f.gitCache != nil {
+			return "", f.gitCache.checkout(ctx, pkg, dest)
+		}
+		return "", fetchGit(ctx, pkg, dest)
+	}
+
+	getter, raw := "", pkg
+	if i := strings.Index(pkg, "::"); i >= 0 && forcedGetterPattern.MatchString(pkg) {
+		getter, raw = pkg[:i], pkg[i+2:]
+	}
+	if getter == "" {
+		getter = objectStoreGetter(raw)
+	}
+	if getter != "" && getter != "http" && !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("unsupported module source %q", pkg)
+	}
+	format := archiveFormat(u)
+	if format == "" {
+		return "", fmt.Errorf("unsupported module source %q: not a git repository or archive", pkg)
+	}
+	query := u.Query()
+	var checksum *packageChecksum
+	if value := query.Get("checksum"); value != "" {
+		c, err := parseChecksum(value)
+		if err != nil {
+			return "", fmt.Errorf("module source %q: %w", pkg, err)
+		}
+		checksum = &c
+	}
+	query.Del("archive")
+	query.Del("checksum")
+	u.RawQuery = query.Encode()
+
+	var req *http.Request
+	switch getter {
+	case "", "http":
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	case "s3":
+		req, err = s3Request(ctx, u)
+	case "gcs":
+		req, err = gcsRequest(ctx, u)
+	default:
+		return "", fmt.Errorf("unsupported module source %q: unknown getter %s", pkg, getter)
+	}
+	if err != nil {
+		return "", err
+	}
+	resp, err := f.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxArchiveSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxArchiveSize {
+		return "", fmt.Errorf("GET %s: archive is larger than %d bytes", req.URL, maxArchiveSize)
+	}
+	verified := ""
+	if checksum != nil {
+		if err := checksum.verify(data); err != nil {
+			return "", fmt.Errorf("GET %s: %w", req.URL, err)
+		}
+		verified = checksum.String()
+	}
+
+	switch format {
+	case "tar.gz", "tgz":
+		return verified, extractTarGz(data, dest)
+	case "zip":
+		return verified, extractZip(data, dest)
+	}
+	return "", fmt.Errorf("unsupported archive format %q", format)
+}
+
+// fetchGit checks out the ref of a git source, or the default branch, into
+// dest without repository metadata.
+func fetchGit(ctx context.Context, pkg, dest string) error {
+	repo := remoteSourceURL(pkg, "")
+	ref := gitRef(pkg)
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := checkGitArgs(repo, ref); err != nil {
+		return err
+	}
+	if err := checkOnline("git fetch " + repo); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"fetch", "-q", "--depth", "1", "--", repo, ref},
+		{"checkout", "-q", "FETCH_HEAD"},
+	} {
+		run := func() error {
+			cmd := exec.CommandContext(ctx, "git", args...)
+			cmd.Dir = dest
+			cmd.Env = append(os.Environ(), gitEnv()...)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+			}
+			return nil
+		}
+		var err error
+		if args[0] == "fetch" {
+			err = withRetries(ctx, func() error { return temporaryUnlessDone(ctx, run()) })
+		} else {
+			err = run()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(filepath.Join(dest, ".git"))
+}
+
+// checkGitArgs rejects a repository URL or ref of a git source that git
+// would read as an option, such as ?ref=--upload-pack=..., which would run
+// a command of the source's choosing. They are also passed after --, but
+// a ref is a refspec there, which git does not check for options.
+func checkGitArgs(repo, ref string) error {
+	if strings.HasPrefix(repo, "-") {
+		return fmt.Errorf("invalid git repository %q: must not start with -", repo)
+	}
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid git ref %q: must not start with -", ref)
+	}
+	return nil
+}
+
+// resolveSubdir returns the directory selected by subdir below dir. As in
+// go-getter, subdir may contain glob patterns that must match exactly one
+// directory.
+func resolveSubdir(dir, subdir string) (string, error) {
+	path := filepath.Join(dir, filepath.FromSlash(subdir))
+	if !isInDirectory(path, dir) {
+		return "", fmt.Errorf("subdirectory %q is outside the module package", subdir)
+	}
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return "", err
+	}
+	if len(matches) != 1 {
+		return "", fmt.Errorf("subdirectory %q matches %d directories", subdir, len(matches))
+	}
+	return matches[0], nil
+}
+
+// archivePath returns where an archive entry is extracted to, rejecting
+// entries that would escape dest.
+func archivePath(dest, name string) (string, error) {
+	path := filepath.Join(dest, filepath.FromSlash(name))
+	if !isInDirectory(path, dest) {
+		return "", fmt.Errorf("archive entry %q is outside the destination", name)
+	}
+	return path, nil
+}
+
+// errArchiveTooLarge is returned when an archive expands to more than
+// maxArchiveSize bytes.
+var errArchiveTooLarge = fmt.Errorf("archive expands to more than %d bytes", maxArchiveSize)
+
+// extractedReader reads an archive entry, counting its bytes against the
+// bytes that may still be extracted from the archive, so that an entry
+// larger than it claims cannot fill the disk either.
+type extractedReader struct {
+	r         io.Reader
+	remaining *int64
+}
+
+func (e *extractedReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if *e.remaining -= int64(n); *e.remaining < 0 {
+		return n, errArchiveTooLarge
+	}
+	return n, err
+}
+
+// extractTarGz extracts the directories and regular files of a .tar.gz
+// archive into dest, up to maxArchiveSize bytes in total.
+func extractTarGz(data []byte, dest string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	remaining := int64(maxArchiveSize)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path, err := archivePath(dest, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0755)
+		case tar.TypeReg:
+			if header.Size > remaining {
+				return errArchiveTooLarge
+			}
+			err = writeExtractedFile(path, &extractedReader{r: tr, remaining: &remaining}, header.FileInfo().Mode())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractZip extracts the files of a .zip archive into dest, up to
+// maxArchiveSize bytes in total.
+func extractZip(data []byte, dest string) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	remaining := int64(maxArchiveSize)
+	for _, file := range zr.File {
+		path, err := archivePath(dest, file.Name)
+		if err != nil {
+			return err
+		}
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if file.UncompressedSize64 > uint64(remaining) {
+			return errArchiveTooLarge
+		}
+		r, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeExtractedFile(path, &extractedReader{r: r, remaining: &remaining}, file.Mode())
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeExtractedFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initGitRepo creates a git repository in dir containing files, committed
+// and tagged with tag.
+func initGitRepo(t *testing.T, dir string, files map[string]string, tag string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	writeTestFiles(t, dir, files)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+		{"tag", tag},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+	}
+}
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestFetch_Registry(t *testing.T) {
+	archive := tarGz(t, map[string]string{"terraform-aws-vpc-1.2.0/main.tf": `resource "aws_vpc" "this" {}`})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/terraform.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"modules.v1": "/api/modules/v1/"}`))
+	})
+	mux.HandleFunc("/api/modules/v1/org/vpc/aws/versions", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"modules":[{"versions":[{"version":"1.0.0"},{"version":"1.2.0"},{"version":"2.0.0"}]}]}`))
+	})
+	mux.HandleFunc("/api/modules/v1/org/vpc/aws/1.2.0/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Terraform-Get", "/archives/vpc.tar.gz//*?archive=tar.gz")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/archives/vpc.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	dest := filepath.Join(t.TempDir(), "vpc")
+	fetcher := newModuleFetcher(server.Client(), ModuleInstallation{})
+	version, _, err := fetcher.fetch(context.Background(), host+"/org/vpc/aws", "~> 1.0", dest)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if version != "1.2.0" {
+		t.Errorf("expected version 1.2.0, got %s", version)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "main.tf")); err != nil {
+		t.Errorf("expected the archive's top-level directory to be extracted to dest: %v", err)
+	}
+}
+
+func TestFetch_Git(t *testing.T) {
+	repo := t.TempDir()
+	initGitRepo(t, repo, map[string]string{"main.tf": `variable "name" {}`}, "v1.0.0")
+
+	dest := filepath.Join(t.TempDir(), "label")
+	fetcher := newModuleFetcher(nil, ModuleInstallation{})
+	if _, _, err := fetcher.fetch(context.Background(), "git::file://"+repo+"?ref=v1.0.0", "", dest); err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "main.tf")); err != nil {
+		t.Errorf("expected main.tf to be checked out: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, ".git")); !os.IsNotExist(err) {
+		t.Errorf("expected repository metadata to be removed, got %v", err)
+	}
+}
+
+func TestFetch_GitRejectsOptions(t *testing.T) {
+	repo := t.TempDir()
+	initGitRepo(t, repo, map[string]string{"main.tf": ""}, "v1.0.0")
+	marker := filepath.Join(t.TempDir(), "pwned")
+
+	source := "git::file://" + repo + "?ref=--upload-pack=touch%20" + marker + "%0Agit-upload-pack"
+	dest := filepath.Join(t.TempDir(), "module")
+	fetcher := newModuleFetcher(nil, ModuleInstallation{})
+	if _, _, err := fetcher.fetch(context.Background(), source, "", dest); err == nil {
+		t.Error("expected an error for a ref starting with -")
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("expected no command to run, got %v", err)
+	}
+
+	if err := checkGitArgs("-oProxyCommand=touch "+marker, "HEAD"); err == nil {
+		t.Error("expected an error for a repository starting with -")
+	}
+}
+
+func TestExtractTarGz_RejectsTraversal(t *testing.T) {
+	archive := tarGz(t, map[string]string{"../evil.tf": ""})
+	if err := extractTarGz(archive, t.TempDir()); err == nil {
+		t.Error("expected an error for an entry outside the destination")
+	}
+}
+
+func TestExtract_RejectsOversizedEntries(t *testing.T) {
+	var tarBuf bytes.Buffer
+	gz := gzip.NewWriter(&tarBuf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "huge.tf", Mode: 0644, Size: maxArchiveSize + 1, Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Flush()
+	gz.Close()
+	if err := extractTarGz(tarBuf.Bytes(), t.TempDir()); !errors.Is(err, errArchiveTooLarge) {
+		t.Errorf("expected an error for an entry larger than the limit, got %v", err)
+	}
+
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	if _, err := zw.CreateRaw(&zip.FileHeader{Name: "huge.tf", Method: zip.Store, UncompressedSize64: maxArchiveSize + 1}); err != nil {
+		t.Fatal(err)
+	}
+	zw.Close()
+	if err := extractZip(zipBuf.Bytes(), t.TempDir()); !errors.Is(err, errArchiveTooLarge) {
+		t.Errorf("expected an error for an entry larger than the limit, got %v", err)
+	}
+
+	remaining := int64(4)
+	r := &extractedReader{r: strings.NewReader("12345"), remaining: &remaining}
+	if _, err := io.ReadAll(r); !errors.Is(err, errArchiveTooLarge) {
+		t.Errorf("expected an error for content beyond the limit, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/template"
+)
+
+// renderOptions carries the optional inputs of an output format.
+type renderOptions struct {
+	// Affected lists the modules hit by the changed files when HasChanges
+	// is set.
+	Affected   []AffectedModule
+	HasChanges bool
+
+	// Template is the parsed --template of --format template.
+	Template *template.Template
+}
+
+type formatter func(w io.Writer, output *Output, opts renderOptions) error
+
+// formatters maps --format values to their renderers.
+var formatters = map[string]formatter{
+	"csv":        renderCSV,
+	"cyclonedx":  renderCycloneDX,
+	"graph-json": renderGraphJSON,
+	"html":       renderHTML,
+	"json":       renderJSON,
+	"markdown":   renderMarkdown,
+	"sarif":      renderSARIF,
+	"spdx":       renderSPDX,
+	"template":   renderTemplate,
+	"tree":       renderTree,
+}
+
+func formatNames() []string {
+	var names []string
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func renderJSON(w io.Writer, output *Output, opts renderOptions) error {
+	jsonOutput, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(jsonOutput))
+	return err
+}
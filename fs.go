@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+)
+
+// fileSystem is what the analyzer reads module directories from. All paths
+// are absolute operating system paths, so analysis results look the same
+// whichever implementation produced them.
+type fileSystem interface {
+	abs(path string) (string, error)
+	readDir(dir string) ([]fs.DirEntry, error)
+	readFile(name string) ([]byte, error)
+	readLink(name string) (string, error)
+	loadModule(dir string) (*tfconfig.Module, tfconfig.Diagnostics)
+}
+
+// localFS reads from the operating system's filesystem.
+type localFS struct{}
+
+func (localFS) abs(path string) (string, error)           { return filepath.Abs(path) }
+func (localFS) readDir(dir string) ([]fs.DirEntry, error) { return os.ReadDir(dir) }
+func (localFS) readFile(name string) ([]byte, error)      { return os.ReadFile(name) }
+func (localFS) readLink(name string) (string, error)      { return os.Readlink(name) }
+
+func (localFS) loadModule(dir string) (*tfconfig.Module, tfconfig.Diagnostics) {
+	return tfconfig.LoadModule(dir)
+}
+
+// MappedFS presents an fs.FS, such as an in-memory tree, a test fixture or
+// an archive, as a directory tree rooted at the absolute path Root: the
+// name "." in FS is Root, and every path reported by the analysis lies
+// under it.
+type MappedFS struct {
+	FS   fs.FS
+	Root string
+}
+
+// name maps an absolute path under Root to a name in FS.
+func (m *MappedFS) name(op, path string) (string, error) {
+	rel, err := filepath.Rel(m.Root, path)
+	if err != nil || !fs.ValidPath(filepath.ToSlash(rel)) {
+		return "", &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func (m *MappedFS) abs(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
+	return filepath.Join(m.Root, path), nil
+}
+
+func (m *MappedFS) readDir(dir string) ([]fs.DirEntry, error) {
+	name, err := m.name("readdir", dir)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(m.FS, name)
+}
+
+func (m *MappedFS) readFile(path string) ([]byte, error) {
+	name, err := m.name("open", path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(m.FS, name)
+}
+
+// readLink returns the destination of a symbolic link in FS, which fails
+// unless FS implements fs.ReadLinkFS. Absolute destinations are names in
+// FS and are mapped below Root.
+func (m *MappedFS) readLink(path string) (string, error) {
+	name, err := m.name("readlink", path)
+	if err != nil {
+		return "", err
+	}
+	dest, err := fs.ReadLink(m.FS, name)
+	if err != nil {
+		return "", err
+	}
+	if dest = filepath.FromSlash(dest); filepath.IsAbs(dest) {
+		return filepath.Join(m.Root, dest), nil
+	}
+	return dest, nil
+}
+
+// loadModule parses dir from FS and maps the file names recorded in module
+// call positions back to absolute paths.
+func (m *MappedFS) loadModule(dir string) (*tfconfig.Module, tfconfig.Diagnostics) {
+	name, err := m.name("open", dir)
+	if err != nil {
+		return nil, tfconfig.Diagnostics{{Severity: tfconfig.DiagError, Summary: err.Error()}}
+	}
+	module, diags := tfconfig.LoadModuleFromFilesystem(tfconfig.WrapFS(m.FS), name)
+	for _, call := range module.ModuleCalls {
+		call.Pos.Filename = filepath.Join(m.Root, filepath.FromSlash(call.Pos.Filename))
+	}
+	return module, diags
+}
+
+// AnalyzeFS analyzes the module at dir, a name within fsys, without
+// touching the local disk. Reported paths are fsys names rooted at the
+// filesystem root, for example /envs/prod/main.tf.
+func AnalyzeFS(fsys fs.FS, dir string) (*Output, error) {
+	root := string(filepath.Separator)
+	return AnalyzeWithOptions(filepath.Join(root, filepath.FromSlash(dir)), AnalyzeOptions{
+		FS: &MappedFS{FS: fsys, Root: root},
+	})
+}
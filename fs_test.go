@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestAnalyzeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"envs/prod/main.tf": {Data: []byte(`
+module "vpc" {
+  source = "../../modules/vpc"
+}
+
+module "missing" {
+  source = "../../modules/missing"
+}
+`)},
+		"modules/vpc/main.tf": {Data: []byte(`
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`)},
+	}
+
+	output, err := AnalyzeFS(fsys, "envs/prod")
+	if err != nil {
+		t.Fatalf("AnalyzeFS failed: %v", err)
+	}
+
+	if output.RootModule.ResolvedPath != "/envs/prod" {
+		t.Errorf("expected root /envs/prod, got %s", output.RootModule.ResolvedPath)
+	}
+	if len(output.RootModule.Files) != 1 || output.RootModule.Files[0] != "/envs/prod/main.tf" {
+		t.Errorf("expected root files to be mapped, got %v", output.RootModule.Files)
+	}
+	if output.RootModule.Hash == "" {
+		t.Error("expected root hash")
+	}
+
+	if len(output.LocalModules) != 1 || output.LocalModules[0].ResolvedPath != "/modules/vpc" {
+		t.Fatalf("expected local module /modules/vpc, got %+v", output.LocalModules)
+	}
+	if len(output.RemoteModules) != 1 || output.RemoteModules[0].CallerPath != "/modules/vpc" {
+		t.Errorf("expected remote module called from /modules/vpc, got %+v", output.RemoteModules)
+	}
+
+	if len(output.Diagnostics) != 1 || output.Diagnostics[0].Code != codeMissingModule {
+		t.Fatalf("expected a missing module diagnostic, got %+v", output.Diagnostics)
+	}
+	if output.Diagnostics[0].Filename != "/envs/prod/main.tf" || output.Diagnostics[0].Line != 6 {
+		t.Errorf("expected diagnostic at /envs/prod/main.tf:6, got %s:%d", output.Diagnostics[0].Filename, output.Diagnostics[0].Line)
+	}
+}
+
+func TestMappedFS_PathsOutsideRoot(t *testing.T) {
+	m := &MappedFS{FS: fstest.MapFS{}, Root: "/repo"}
+	if _, err := m.readDir("/elsewhere"); err == nil {
+		t.Error("expected an error for a path outside the root")
+	}
+}
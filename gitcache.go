@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultGitCacheTTL is how long a fetched branch or tag is reused before
+// it is fetched again.
+const defaultGitCacheTTL = time.Hour
+
+// gitCache keeps a bare repository for each git repository that module
+// sources are fetched from, keyed by its URL, below dir/git. Refs are
+// fetched into it shallowly and checked out from it, so that other refs
+// and subdirectories of a repository fetched before, by this or an earlier
+// run, do not clone it again. A branch or tag is fetched again once it is
+// older than ttl; commits never change and are fetched once.
+type gitCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// repoDir returns the bare repository caching repo.
+func (c *gitCache) repoDir(repo string) string {
+	sum := sha256.Sum256([]byte(repo))
+	return filepath.Join(c.dir, "git", hex.EncodeToString(sum[:8])+".git")
+}
+
+// checkout checks out the ref of a git source, or the default branch, into
+// dest without repository metadata, fetching it into the cache first
+// unless a fresh copy is cached.
+func (c *gitCache) checkout(ctx context.Context, pkg, dest string) error {
+	repo := remoteSourceURL(pkg, "")
+	ref := gitRef(pkg)
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := checkGitArgs(repo, ref); err != nil {
+		return err
+	}
+	gitDir := c.repoDir(repo)
+	if _, err := os.Stat(gitDir); err != nil {
+		if err := runGit(ctx, nil, "init", "-q", "--bare", gitDir); err != nil {
+			return err
+		}
+	}
+
+	sum := sha256.Sum256([]byte(ref))
+	key := hex.EncodeToString(sum[:8])
+	cachedRef := "refs/tfmr/" + key
+	stamp := filepath.Join(gitDir, "tfmr-fetched", key)
+	env := []string{"GIT_DIR=" + gitDir}
+	if !c.fresh(ref, stamp) {
+		if err := checkOnline("git fetch " + repo); err != nil {
+			return err
+		}
+		err := withRetries(ctx, func() error {
+			return temporaryUnlessDone(ctx, runGit(ctx, append(env, gitEnv()...), "fetch", "-q", "--depth", "1", "--", repo, "+"+ref+":"+cachedRef))
+		})
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(stamp), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(stamp, []byte(ref+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	// A private index keeps checkouts from touching the cached repository,
+	// which other runs may be using.
+	index := dest + ".index"
+	defer os.Remove(index)
+	env = append(env, "GIT_WORK_TREE="+dest, "GIT_INDEX_FILE="+index)
+	return runGit(ctx, env, "checkout", "-q", "-f", cachedRef, "--", ".")
+}
+
+// fresh reports whether ref was fetched, according to its stamp file, and
+// can be reused without fetching it again.
+func (c *gitCache) fresh(ref, stamp string) bool {
+	info, err := os.Stat(stamp)
+	if err != nil {
+		return false
+	}
+	return commitSHAPattern.MatchString(ref) || time.Since(info.ModTime()) < c.ttl
+}
+
+// runGit runs the git command with args and env added to the environment.
+func runGit(ctx context.Context, env []string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), env...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitCache_Checkout(t *testing.T) {
+	repo := t.TempDir()
+	initGitRepo(t, repo, map[string]string{"modules/label/main.tf": `variable "name" {}`}, "v1.0.0")
+	pkg := "git::file://" + repo + "?ref=v1.0.0"
+
+	cache := &gitCache{dir: t.TempDir(), ttl: defaultGitCacheTTL}
+	dest := filepath.Join(t.TempDir(), "first")
+	if err := cache.checkout(context.Background(), pkg, dest); err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "modules", "label", "main.tf")); err != nil {
+		t.Errorf("expected main.tf to be checked out: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, ".git")); !os.IsNotExist(err) {
+		t.Errorf("expected no repository metadata in the checkout, got %v", err)
+	}
+
+	// The cached tag is checked out again without the repository.
+	if err := os.RemoveAll(repo); err != nil {
+		t.Fatal(err)
+	}
+	dest = filepath.Join(t.TempDir(), "second")
+	if err := cache.checkout(context.Background(), pkg, dest); err != nil {
+		t.Fatalf("expected the cached tag to be reused, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "modules", "label", "main.tf")); err != nil {
+		t.Errorf("expected main.tf to be checked out from the cache: %v", err)
+	}
+
+	// An expired tag is fetched again, failing without the repository.
+	retries := networkRetries
+	networkRetries = 0
+	t.Cleanup(func() { networkRetries = retries })
+	cache.ttl = 0
+	if err := cache.checkout(context.Background(), pkg, filepath.Join(t.TempDir(), "third")); err == nil {
+		t.Error("expected an expired tag to be fetched again")
+	}
+}
+
+func TestGitCache_CheckoutRejectsOptions(t *testing.T) {
+	repo := t.TempDir()
+	initGitRepo(t, repo, map[string]string{"main.tf": ""}, "v1.0.0")
+	marker := filepath.Join(t.TempDir(), "pwned")
+
+	cache := &gitCache{dir: t.TempDir(), ttl: defaultGitCacheTTL}
+	pkg := "git::file://" + repo + "?ref=--upload-pack=touch%20" + marker + "%0Agit-upload-pack"
+	if err := cache.checkout(context.Background(), pkg, filepath.Join(t.TempDir(), "module")); err == nil {
+		t.Error("expected an error for a ref starting with -")
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("expected no command to run, got %v", err)
+	}
+}
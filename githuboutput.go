@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// githubOutput is a step output of a GitHub Actions job.
+type githubOutput struct {
+	Name  string
+	Value string
+}
+
+// githubOutputDelimiter returns a heredoc delimiter that does not occur in
+// value.
+func githubOutputDelimiter(value string) string {
+	for {
+		var b [8]byte
+		_, _ = rand.Read(b[:])
+		delimiter := "ghadelimiter_" + hex.EncodeToString(b[:])
+		if !strings.Contains(value, delimiter) {
+			return delimiter
+		}
+	}
+}
+
+// writeGitHubOutputs writes outputs in the format of the $GITHUB_OUTPUT
+// file. Values spanning several lines are written as heredocs.
+func writeGitHubOutputs(w io.Writer, outputs []githubOutput) error {
+	for _, o := range outputs {
+		var err error
+		if strings.ContainsAny(o.Value, "\r\n") {
+			delimiter := githubOutputDelimiter(o.Value)
+			_, err = fmt.Fprintf(w, "%s<<%s\n%s\n%s\n", o.Name, delimiter, o.Value, delimiter)
+		} else {
+			_, err = fmt.Fprintf(w, "%s=%s\n", o.Name, o.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendGitHubOutputs appends outputs to the file named by GITHUB_OUTPUT,
+// which GitHub Actions sets for every step.
+func appendGitHubOutputs(outputs []githubOutput) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return errors.New("GITHUB_OUTPUT is not set; --github-output must run in a GitHub Actions step")
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := writeGitHubOutputs(f, outputs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// workingDirRel returns path relative to the working directory with forward
+// slashes, or path itself when it is not below it.
+func workingDirRel(path string) string {
+	cwd, _ := os.Getwd()
+	rel, err := filepath.Rel(cwd, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// compactJSON encodes v on a single line for a step output.
+func compactJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// affectedModulesOutputs returns the step outputs of the default command's
+// --affected: whether the root is affected, the affected modules and a
+// matrix with one job per affected module.
+func affectedModulesOutputs(isAffected bool, modules []AffectedModule) []githubOutput {
+	type job struct {
+		Kind string `json:"kind"`
+		Name string `json:"name,omitempty"`
+		Path string `json:"path"`
+	}
+	jobs := []job{}
+	for _, m := range modules {
+		jobs = append(jobs, job{Kind: m.Kind, Name: m.Name, Path: workingDirRel(m.ResolvedPath)})
+	}
+	if modules == nil {
+		modules = []AffectedModule{}
+	}
+	return []githubOutput{
+		{Name: "affected", Value: strconv.FormatBool(isAffected)},
+		{Name: "modules", Value: compactJSON(modules)},
+		{Name: "matrix", Value: compactJSON(map[string]any{"include": jobs})},
+	}
+}
+
+// affectedRootsOutputs returns the step outputs of discover --affected:
+// whether any root is affected, the affected roots and a matrix with one
+// job per affected root or project. Project jobs carry the workspace and
+// the -var-file arguments to plan them with.
+func affectedRootsOutputs(results []RootResult) []githubOutput {
+	type job struct {
+		Root        string `json:"root"`
+		Application string `json:"application,omitempty"`
+		Project     string `json:"project,omitempty"`
+		Workspace   string `json:"workspace,omitempty"`
+		VarFiles    string `json:"var_files,omitempty"`
+	}
+	roots := []string{}
+	jobs := []job{}
+	for _, r := range results {
+		if r.Affected {
+			rel := workingDirRel(r.Path)
+			if !slices.Contains(roots, rel) {
+				roots = append(roots, rel)
+			}
+			jobs = append(jobs, job{
+				Root:        rel,
+				Application: r.Application,
+				Project:     r.Project,
+				Workspace:   r.Workspace,
+				VarFiles:    varFilesEnv(r.Path, r.VarFiles),
+			})
+		}
+	}
+	return []githubOutput{
+		{Name: "affected", Value: strconv.FormatBool(len(roots) > 0)},
+		{Name: "roots", Value: compactJSON(roots)},
+		{Name: "matrix", Value: compactJSON(map[string]any{"include": jobs})},
+	}
+}
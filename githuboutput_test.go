@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWriteGitHubOutputs(t *testing.T) {
+	var b strings.Builder
+	err := writeGitHubOutputs(&b, []githubOutput{
+		{Name: "affected", Value: "true"},
+		{Name: "files", Value: "a.tf\nb.tf"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile(`^affected=true\nfiles<<(ghadelimiter_[0-9a-f]+)\na\.tf\nb\.tf\n(ghadelimiter_[0-9a-f]+)\n$`)
+	m := re.FindStringSubmatch(b.String())
+	if m == nil || m[1] != m[2] {
+		t.Errorf("unexpected outputs:\n%s", b.String())
+	}
+}
+
+func TestAppendGitHubOutputs(t *testing.T) {
+	t.Setenv("GITHUB_OUTPUT", "")
+	if err := appendGitHubOutputs(nil); err == nil {
+		t.Error("expected an error without GITHUB_OUTPUT")
+	}
+
+	path := filepath.Join(t.TempDir(), "output")
+	t.Setenv("GITHUB_OUTPUT", path)
+	writeTestFiles(t, filepath.Dir(path), map[string]string{"output": "previous=1\n"})
+	if err := appendGitHubOutputs([]githubOutput{{Name: "affected", Value: "false"}}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "previous=1\naffected=false\n" {
+		t.Errorf("expected outputs to be appended, got %q", data)
+	}
+}
+
+func TestAffectedRootsOutputs(t *testing.T) {
+	cwd, _ := os.Getwd()
+	outputs := affectedRootsOutputs([]RootResult{
+		{Path: filepath.Join(cwd, "infra", "prod"), Application: "network", Affected: true},
+		{Path: filepath.Join(cwd, "infra", "dev"), Application: "network"},
+	})
+	expected := []githubOutput{
+		{Name: "affected", Value: "true"},
+		{Name: "roots", Value: `["infra/prod"]`},
+		{Name: "matrix", Value: `{"include":[{"root":"infra/prod","application":"network"}]}`},
+	}
+	if len(outputs) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, outputs)
+	}
+	for i := range expected {
+		if outputs[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], outputs[i])
+		}
+	}
+
+	if outputs := affectedRootsOutputs(nil); outputs[0].Value != "false" || outputs[2].Value != `{"include":[]}` {
+		t.Errorf("expected an empty matrix, got %v", outputs)
+	}
+}
+
+func TestAffectedModulesOutputs(t *testing.T) {
+	cwd, _ := os.Getwd()
+	outputs := affectedModulesOutputs(true, []AffectedModule{
+		{Name: "vpc", Kind: kindLocal, ResolvedPath: filepath.Join(cwd, "modules", "vpc")},
+	})
+	if got := outputs[2].Value; got != `{"include":[{"kind":"local","name":"vpc","path":"modules/vpc"}]}` {
+		t.Errorf("unexpected matrix %s", got)
+	}
+	if got := outputs[1].Value; !strings.HasPrefix(got, `[{"name":"vpc","kind":"local"`) {
+		t.Errorf("unexpected modules %s", got)
+	}
+}
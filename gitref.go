@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// gitRefFS returns the tree of the commit that ref, such as origin/main, a
+// tag or a commit hash, names in the git repository containing dir, read
+// from the repository's objects without a checkout. The tree is mapped at
+// the root of the repository's working tree, so paths reported for the
+// ref are the paths of the same files in the checkout.
+func gitRefFS(dir, ref string) (*MappedFS, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	repo, err := git.PlainOpenWithOptions(absDir, &git.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the git repository of %s: %w", absDir, err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the git repository of %s: %w", absDir, err)
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve git ref %s: %w", ref, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read commit %s of git ref %s: %w", hash, ref, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the tree of git ref %s: %w", ref, err)
+	}
+	return &MappedFS{FS: &gitTreeFS{root: tree}, Root: worktree.Filesystem.Root()}, nil
+}
+
+// gitTreeFS is an fs.FS, with fs.ReadLinkFS, over a git tree. Submodules
+// are empty directories, as in a checkout without them. Trees cache their
+// subtrees without synchronization, so every access is serialized.
+type gitTreeFS struct {
+	mu   sync.Mutex
+	root *object.Tree
+}
+
+// entry returns the tree entry named name, following symbolic links in
+// its directories and, with follow, in its last element, or nil for the
+// root.
+func (g *gitTreeFS) entry(op, name string, follow bool) (string, *object.TreeEntry, error) {
+	if !fs.ValidPath(name) {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	resolved := "."
+	pending := strings.Split(name, "/")
+	hops := 0
+	var entry *object.TreeEntry
+	for len(pending) > 0 {
+		elem := pending[0]
+		pending = pending[1:]
+		switch elem {
+		case ".":
+			continue
+		case "..":
+			// Only reachable through link targets, which are checked to
+			// stay inside the tree.
+			resolved, entry = path.Dir(resolved), nil
+			if resolved != "." {
+				_, entry, _ = g.entry(op, resolved, false)
+			}
+			continue
+		}
+		if entry != nil && entry.Mode != filemode.Dir {
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		next := path.Join(resolved, elem)
+		e, err := g.root.FindEntry(next)
+		if err != nil {
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if e.Mode == filemode.Symlink && (follow || len(pending) > 0) {
+			if hops++; hops > maxSymlinkHops {
+				return "", nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+			}
+			target, err := g.blob(e)
+			if err != nil {
+				return "", nil, &fs.PathError{Op: op, Path: name, Err: err}
+			}
+			dest := string(target)
+			if path.IsAbs(dest) || !fs.ValidPath(path.Join(resolved, dest)) {
+				return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+			pending = append(strings.Split(dest, "/"), pending...)
+			continue
+		}
+		resolved, entry = next, e
+	}
+	return resolved, entry, nil
+}
+
+func (g *gitTreeFS) blob(e *object.TreeEntry) ([]byte, error) {
+	file, err := g.root.TreeEntryFile(e)
+	if err != nil {
+		return nil, err
+	}
+	r, err := file.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// info returns the file info of an entry at resolved, or of the root for
+// a nil entry.
+func (g *gitTreeFS) info(resolved string, e *object.TreeEntry) (fs.FileInfo, error) {
+	info := &gitFileInfo{name: path.Base(resolved), mode: fs.ModeDir | 0755}
+	if e == nil {
+		return info, nil
+	}
+	switch e.Mode {
+	case filemode.Dir, filemode.Submodule:
+	case filemode.Symlink:
+		info.mode = fs.ModeSymlink | 0777
+	case filemode.Executable:
+		info.mode = 0755
+	default:
+		info.mode = 0644
+	}
+	if !info.mode.IsDir() {
+		size, err := g.root.Size(resolved)
+		if err != nil {
+			return nil, err
+		}
+		info.size = size
+	}
+	return info, nil
+}
+
+// tree returns the directory at resolved, or nil for a submodule.
+func (g *gitTreeFS) tree(resolved string, e *object.TreeEntry) (*object.Tree, error) {
+	switch {
+	case e == nil:
+		return g.root, nil
+	case e.Mode == filemode.Submodule:
+		return nil, nil
+	}
+	return g.root.Tree(resolved)
+}
+
+func (g *gitTreeFS) Open(name string) (fs.File, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	resolved, e, err := g.entry("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	info, err := g.info(resolved, e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if info.IsDir() {
+		entries, err := g.readDir(resolved, e)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &gitDir{info: info, entries: entries}, nil
+	}
+	data, err := g.blob(e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &gitFile{info: info, Reader: bytes.NewReader(data)}, nil
+}
+
+func (g *gitTreeFS) ReadFile(name string) ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, e, err := g.entry("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil || e.Mode == filemode.Dir || e.Mode == filemode.Submodule {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	return g.blob(e)
+}
+
+func (g *gitTreeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	resolved, e, err := g.entry("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil && e.Mode != filemode.Dir && e.Mode != filemode.Submodule {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, err := g.readDir(resolved, e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// readDir lists the directory at resolved, sorted by name.
+func (g *gitTreeFS) readDir(resolved string, e *object.TreeEntry) ([]fs.DirEntry, error) {
+	tree, err := g.tree(resolved, e)
+	if err != nil || tree == nil {
+		return nil, err
+	}
+	var entries []fs.DirEntry
+	for i := range tree.Entries {
+		child := &tree.Entries[i]
+		info, err := g.info(path.Join(resolved, child.Name), child)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+func (g *gitTreeFS) ReadLink(name string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, e, err := g.entry("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if e == nil || e.Mode != filemode.Symlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := g.blob(e)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return string(target), nil
+}
+
+func (g *gitTreeFS) Lstat(name string) (fs.FileInfo, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	resolved, e, err := g.entry("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return g.info(resolved, e)
+}
+
+type gitFileInfo struct {
+	name string
+	mode fs.FileMode
+	size int64
+}
+
+func (i *gitFileInfo) Name() string       { return i.name }
+func (i *gitFileInfo) Size() int64        { return i.size }
+func (i *gitFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *gitFileInfo) ModTime() time.Time { return time.Time{} }
+func (i *gitFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *gitFileInfo) Sys() any           { return nil }
+
+type gitFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *gitFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *gitFile) Close() error               { return nil }
+
+type gitDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+func (d *gitDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *gitDir) Close() error               { return nil }
+
+func (d *gitDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *gitDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGitRefFS(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, "envs", "prod"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../shared/providers.tf", filepath.Join(repo, "envs", "prod", "providers.tf")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	initGitRepo(t, repo, map[string]string{
+		"envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`,
+		"shared/providers.tf": `provider "aws" {}`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	}, "v1")
+
+	// Later changes in the working tree are not seen at the ref.
+	writeTestFiles(t, repo, map[string]string{
+		"envs/prod/main.tf": `
+module "dns" {
+  source = "../../modules/dns"
+}
+`,
+		"modules/dns/main.tf": `variable "zone" {}`,
+	})
+	if err := os.RemoveAll(filepath.Join(repo, "modules", "vpc")); err != nil {
+		t.Fatal(err)
+	}
+
+	mapped, err := gitRefFS(filepath.Join(repo, "envs", "prod"), "v1")
+	if err != nil {
+		t.Fatalf("gitRefFS failed: %v", err)
+	}
+	if err := fstest.TestFS(mapped.FS, "envs/prod/main.tf", "envs/prod/providers.tf", "modules/vpc/main.tf", "shared/providers.tf"); err != nil {
+		t.Errorf("the git tree is not a valid fs.FS: %v", err)
+	}
+
+	root := filepath.Join(mapped.Root, "envs", "prod")
+	output, err := AnalyzeWithOptions(root, AnalyzeOptions{FS: mapped})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(output.LocalModules) != 1 || output.LocalModules[0].Name != "vpc" {
+		t.Fatalf("expected the vpc module of the ref, got %+v", output.LocalModules)
+	}
+	if vpc := output.LocalModules[0].ResolvedPath; vpc != filepath.Join(mapped.Root, "modules", "vpc") {
+		t.Errorf("expected the checkout path of the vpc module, got %s", vpc)
+	}
+	if shared := filepath.Join(mapped.Root, "shared", "providers.tf"); !IsAffected([]string{shared}, output) {
+		t.Errorf("expected the symlinked %s to affect the root", shared)
+	}
+
+	if _, err := gitRefFS(repo, "missing"); err == nil {
+		t.Error("expected an error for an unknown ref")
+	}
+	if _, err := gitRefFS(t.TempDir(), "v1"); err == nil {
+		t.Error("expected an error outside a git repository")
+	}
+}
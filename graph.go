@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+)
+
+// graphVersion is bumped whenever the Graph encoding changes incompatibly.
+const graphVersion = 3
+
+// Graph is the exportable form of every module directory visited during an
+// analysis. Paths are relative to the analyzed root so that a graph saved
+// in one checkout can be loaded in another.
+type Graph struct {
+	Version int         `json:"version"`
+	Nodes   []GraphNode `json:"nodes"`
+}
+
+// GraphNode is a module directory with its content hash and module calls.
+type GraphNode struct {
+	Path  string            `json:"path"`
+	Hash  string            `json:"hash"`
+	Files map[string]string `json:"files"`
+	Calls []GraphCall       `json:"calls"`
+}
+
+// GraphCall is an edge from a module directory to a called module. Target
+// is set for local sources and names the called directory.
+type GraphCall struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Version string `json:"version,omitempty"`
+	Target  string `json:"target,omitempty"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+
+	Repetition       string            `json:"repetition,omitempty"`
+	Providers        map[string]string `json:"providers,omitempty"`
+	SourceExpression string            `json:"source_expression,omitempty"`
+	Overrides        []ModuleOverride  `json:"overrides,omitempty"`
+}
+
+// newGraphCall returns the serialized form of a module call. Like File,
+// the file names of its overrides are relative to the module directory.
+func newGraphCall(call *moduleCall) GraphCall {
+	var overrides []ModuleOverride
+	for _, o := range call.Overrides {
+		o.Filename = filepath.Base(o.Filename)
+		overrides = append(overrides, o)
+	}
+	return GraphCall{
+		Name:             call.Name,
+		Source:           call.Source,
+		Version:          call.Version,
+		File:             filepath.Base(call.Pos.Filename),
+		Line:             call.Pos.Line,
+		Repetition:       call.Repetition,
+		Providers:        call.Providers,
+		SourceExpression: call.SourceExpression,
+		Overrides:        overrides,
+	}
+}
+
+func newGraphNode(rootDir, dir, hash string, fileHashes map[string]string, calls []*moduleCall) GraphNode {
+	node := GraphNode{
+		Path:  relativeGraphPath(rootDir, dir),
+		Hash:  hash,
+		Files: fileHashes,
+		Calls: []GraphCall{},
+	}
+	for _, call := range calls {
+		edge := newGraphCall(call)
+		if isLocalPath(call.Source) {
+			target, _ := filepath.Abs(filepath.Join(dir, call.Source))
+			edge.Target = relativeGraphPath(rootDir, target)
+		}
+		node.Calls = append(node.Calls, edge)
+	}
+	sort.Slice(node.Calls, func(i, j int) bool { return node.Calls[i].Name < node.Calls[j].Name })
+	return node
+}
+
+// moduleCalls rebuilds the tfconfig module calls of a node located at dir.
+func (n *GraphNode) moduleCalls(dir string) []*moduleCall {
+	return moduleCallsFromGraph(n.Calls, dir)
+}
+
+// moduleCallsFromGraph rebuilds tfconfig module calls declared in dir from
+// their serialized form.
+func moduleCallsFromGraph(graphCalls []GraphCall, dir string) []*moduleCall {
+	var calls []*moduleCall
+	for _, c := range graphCalls {
+		var overrides []ModuleOverride
+		for _, o := range c.Overrides {
+			o.Filename = filepath.Join(dir, o.Filename)
+			overrides = append(overrides, o)
+		}
+		calls = append(calls, &moduleCall{
+			ModuleCall: &tfconfig.ModuleCall{
+				Name:    c.Name,
+				Source:  c.Source,
+				Version: c.Version,
+				Pos: tfconfig.SourcePos{
+					Filename: filepath.Join(dir, c.File),
+					Line:     c.Line,
+				},
+			},
+			Repetition:       c.Repetition,
+			Providers:        c.Providers,
+			SourceExpression: c.SourceExpression,
+			Overrides:        overrides,
+		})
+	}
+	return calls
+}
+
+// nodesByPath indexes the nodes of g by absolute path, resolving their
+// relative paths against rootDir. It is safe to call on a nil graph.
+func (g *Graph) nodesByPath(rootDir string) map[string]*GraphNode {
+	nodes := make(map[string]*GraphNode)
+	if g == nil {
+		return nodes
+	}
+	for i := range g.Nodes {
+		path := filepath.Join(rootDir, filepath.FromSlash(g.Nodes[i].Path))
+		nodes[path] = &g.Nodes[i]
+	}
+	return nodes
+}
+
+func relativeGraphPath(rootDir, path string) string {
+	rel, err := filepath.Rel(rootDir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// hashModuleDir returns a digest of the Terraform files in dir together
+// with the digest of each file, keyed by file name.
+func hashModuleDir(dir string) (string, map[string]string, error) {
+	return hashModuleDirIn(localFS{}, dir)
+}
+
+func hashModuleDirIn(fsys fileSystem, dir string) (string, map[string]string, error) {
+	files, err := listTerraformFilesIn(fsys, dir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	fileHashes := make(map[string]string, len(files))
+	var names []string
+	for _, f := range files {
+		data, err := fsys.readFile(f)
+		if err != nil {
+			return "", nil, err
+		}
+		sum := sha256.Sum256(data)
+		name := filepath.Base(f)
+		fileHashes[name] = hex.EncodeToString(sum[:])
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%s\n", name, fileHashes[name])
+	}
+	return hex.EncodeToString(h.Sum(nil)), fileHashes, nil
+}
+
+// ReadGraph loads a graph written by WriteGraph.
+func ReadGraph(path string) (*Graph, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var g Graph
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("failed to parse graph %s: %w", path, err)
+	}
+	if g.Version != graphVersion {
+		return nil, fmt.Errorf("graph %s has version %d, expected %d", path, g.Version, graphVersion)
+	}
+	return &g, nil
+}
+
+// WriteGraph saves the module graph recorded while analyzing output.
+func WriteGraph(path string, output *Output) error {
+	g := output.graph
+	if g == nil {
+		g = &Graph{Version: graphVersion}
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Path < g.Nodes[j].Path })
+	data, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
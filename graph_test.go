@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGraph_RoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	rootDir := filepath.Join(tempDir, "root")
+	graphPath := filepath.Join(tempDir, "graph.json")
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+  count   = 1
+}
+`,
+	})
+
+	output, err := Analyze(rootDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if err := WriteGraph(graphPath, output); err != nil {
+		t.Fatalf("WriteGraph failed: %v", err)
+	}
+
+	graph, err := ReadGraph(graphPath)
+	if err != nil {
+		t.Fatalf("ReadGraph failed: %v", err)
+	}
+
+	if len(graph.Nodes) != 2 {
+		t.Fatalf("expected 2 nodes, got %+v", graph.Nodes)
+	}
+	if graph.Nodes[0].Path != "." || graph.Nodes[1].Path != "../modules/vpc" {
+		t.Errorf("expected relative node paths, got %s and %s", graph.Nodes[0].Path, graph.Nodes[1].Path)
+	}
+	if graph.Nodes[0].Calls[0].Target != "../modules/vpc" {
+		t.Errorf("expected edge to ../modules/vpc, got %+v", graph.Nodes[0].Calls[0])
+	}
+	if graph.Nodes[1].Files["main.tf"] == "" {
+		t.Errorf("expected file hash for main.tf, got %v", graph.Nodes[1].Files)
+	}
+
+	t.Run("unchanged directories reuse cached calls", func(t *testing.T) {
+		graph.Nodes[1].Calls[0].Version = "cached"
+
+		cachedOutput, err := AnalyzeWithOptions(rootDir, AnalyzeOptions{Graph: graph})
+		if err != nil {
+			t.Fatalf("Analyze failed: %v", err)
+		}
+		if cachedOutput.RemoteModules[0].Version != "cached" {
+			t.Errorf("expected cached call to be reused, got version %s", cachedOutput.RemoteModules[0].Version)
+		}
+		if cachedOutput.RemoteModules[0].Repetition != "count" {
+			t.Errorf("expected cached call to keep count, got %q", cachedOutput.RemoteModules[0].Repetition)
+		}
+	})
+
+	t.Run("changed directories are parsed again", func(t *testing.T) {
+		vpcMain := `
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.26.0"
+}
+`
+		if err := os.WriteFile(filepath.Join(tempDir, "modules", "vpc", "main.tf"), []byte(vpcMain), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		freshOutput, err := AnalyzeWithOptions(rootDir, AnalyzeOptions{Graph: graph})
+		if err != nil {
+			t.Fatalf("Analyze failed: %v", err)
+		}
+		if freshOutput.RemoteModules[0].Version != "0.26.0" {
+			t.Errorf("expected changed module to be parsed, got version %s", freshOutput.RemoteModules[0].Version)
+		}
+	})
+}
+
+func TestReadGraph_VersionMismatch(t *testing.T) {
+	graphPath := filepath.Join(t.TempDir(), "graph.json")
+	if err := os.WriteFile(graphPath, []byte(`{"version":999,"nodes":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadGraph(graphPath); err == nil {
+		t.Error("expected error for unsupported graph version")
+	}
+}
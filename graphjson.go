@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// GraphJSON is the module call graph of a root as an adjacency list, for
+// graph databases and visualizers. Nodes are module directories, by
+// absolute path, and remote modules, by registry address or package URL
+// regardless of version. Edges maps the ID of every calling node to its
+// module calls; a directory called several times through different module
+// instances has each of its calls once.
+type GraphJSON struct {
+	Nodes []GraphJSONNode            `json:"nodes"`
+	Edges map[string][]GraphJSONEdge `json:"edges"`
+}
+
+// GraphJSONNode is a node of GraphJSON.
+type GraphJSONNode struct {
+	ID    string   `json:"id"`
+	Kind  string   `json:"kind"`
+	Files []string `json:"files,omitempty"`
+}
+
+// GraphJSONEdge is a module call, with its name, declared source and
+// version constraint. Repetition is "count" or "for_each" when the call
+// creates a module instance per element, and Providers maps provider
+// configurations of the called module to those passed by the caller.
+type GraphJSONEdge struct {
+	To         string            `json:"to"`
+	Name       string            `json:"name"`
+	Source     string            `json:"source"`
+	Version    string            `json:"version,omitempty"`
+	Repetition string            `json:"repetition,omitempty"`
+	Providers  map[string]string `json:"providers,omitempty"`
+}
+
+// BuildGraphJSON returns the call graph of output. Nodes are the root
+// followed by the other nodes sorted by ID, and the edges of each node are
+// sorted by call name.
+func BuildGraphJSON(output *Output) *GraphJSON {
+	g := &GraphJSON{Nodes: []GraphJSONNode{}, Edges: make(map[string][]GraphJSONEdge)}
+	root := output.RootModule.ResolvedPath
+	nodes := map[string]GraphJSONNode{root: {ID: root, Kind: kindRoot, Files: output.RootModule.Files}}
+	calls := make(map[[2]string]bool)
+	addEdge := func(from string, edge GraphJSONEdge) {
+		key := [2]string{from, edge.Name}
+		if calls[key] {
+			return
+		}
+		calls[key] = true
+		g.Edges[from] = append(g.Edges[from], edge)
+	}
+	for _, m := range output.LocalModules {
+		if _, ok := nodes[m.ResolvedPath]; !ok {
+			nodes[m.ResolvedPath] = GraphJSONNode{ID: m.ResolvedPath, Kind: kindLocal, Files: m.Files}
+		}
+		addEdge(m.CallerPath, GraphJSONEdge{To: m.ResolvedPath, Name: m.Name, Source: m.Source, Repetition: m.Repetition, Providers: m.Providers})
+	}
+	for _, m := range output.RemoteModules {
+		id := remoteModuleKey(m)
+		if _, ok := nodes[id]; !ok {
+			nodes[id] = GraphJSONNode{ID: id, Kind: kindRemote, Files: m.Files}
+		}
+		addEdge(m.CallerPath, GraphJSONEdge{To: id, Name: m.Name, Source: m.Source, Version: m.Version, Repetition: m.Repetition, Providers: m.Providers})
+	}
+
+	g.Nodes = append(g.Nodes, nodes[root])
+	delete(nodes, root)
+	var ids []string
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		g.Nodes = append(g.Nodes, nodes[id])
+	}
+	for _, edges := range g.Edges {
+		sort.Slice(edges, func(i, j int) bool { return edges[i].Name < edges[j].Name })
+	}
+	return g
+}
+
+func renderGraphJSON(w io.Writer, output *Output, opts renderOptions) error {
+	jsonOutput, err := json.MarshalIndent(BuildGraphJSON(output), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(jsonOutput))
+	return err
+}
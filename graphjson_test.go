@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildGraphJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "blue" {
+  source = "../modules/app"
+}
+
+module "green" {
+  source   = "../modules/app"
+  for_each = toset(["a", "b"])
+  providers = {
+    aws      = aws.west
+    aws.peer = aws
+  }
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+		"modules/app/main.tf": `
+module "vpc" {
+  source = "../vpc"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+
+	output, err := Analyze(filepath.Join(tempDir, "root"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	g := BuildGraphJSON(output)
+
+	root := filepath.Join(tempDir, "root")
+	app := filepath.Join(tempDir, "modules", "app")
+	vpc := filepath.Join(tempDir, "modules", "vpc")
+	label := "registry.terraform.io/cloudposse/label/null"
+	var ids []string
+	for _, n := range g.Nodes {
+		ids = append(ids, n.ID)
+	}
+	if expected := []string{root, app, vpc, label}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected nodes %v, got %v", expected, ids)
+	}
+	if g.Nodes[0].Kind != kindRoot || g.Nodes[3].Kind != kindRemote || len(g.Nodes[1].Files) != 1 {
+		t.Errorf("unexpected node details %+v", g.Nodes)
+	}
+
+	rootEdges := g.Edges[root]
+	if len(rootEdges) != 3 || rootEdges[0].Name != "blue" || rootEdges[0].To != app || rootEdges[0].Source != "../modules/app" {
+		t.Errorf("unexpected root edges %+v", rootEdges)
+	}
+	if e := rootEdges[2]; e.To != label || e.Version != "0.25.0" || e.Source != "cloudposse/label/null" {
+		t.Errorf("expected the label call with its version, got %+v", e)
+	}
+	if e := rootEdges[1]; e.Repetition != "for_each" || !reflect.DeepEqual(e.Providers, map[string]string{"aws": "aws.west", "aws.peer": "aws"}) {
+		t.Errorf("expected the green call with for_each and providers, got %+v", e)
+	}
+	if e := rootEdges[0]; e.Repetition != "" || e.Providers != nil {
+		t.Errorf("expected the blue call without meta-arguments, got %+v", e)
+	}
+	if edges := g.Edges[app]; len(edges) != 1 || edges[0].To != vpc {
+		t.Errorf("expected one vpc call from app across both instances, got %+v", edges)
+	}
+
+	var buf bytes.Buffer
+	if err := renderGraphJSON(&buf, output, renderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var decoded GraphJSON
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Nodes) != 4 {
+		t.Errorf("expected valid JSON with 4 nodes, got %v\n%s", err, buf.String())
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var moduleBlockSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "module", LabelNames: []string{"name"}},
+	},
+}
+
+// parseConfigFiles parses every Terraform configuration file in dir with
+// the HCL parser, for details that tfconfig does not expose.
+func parseConfigFiles(dir string) ([]*hcl.File, error) {
+	paths, err := listTerraformFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := hclparse.NewParser()
+	var files []*hcl.File
+	for _, path := range paths {
+		var file *hcl.File
+		var diags hcl.Diagnostics
+		if strings.HasSuffix(path, ".tf.json") {
+			file, diags = parser.ParseJSONFile(path)
+		} else {
+			file, diags = parser.ParseHCLFile(path)
+		}
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse %s: %s", path, diags.Error())
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// loadModuleBlocks returns every module block declared in dir.
+func loadModuleBlocks(dir string) ([]*hcl.Block, error) {
+	files, err := parseConfigFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*hcl.Block
+	for _, file := range files {
+		content, _, _ := file.Body.PartialContent(moduleBlockSchema)
+		blocks = append(blocks, content.Blocks...)
+	}
+	return blocks, nil
+}
+
+// findModuleBlock returns the block of the module call named name in dir.
+func findModuleBlock(dir, name string) (*hcl.Block, error) {
+	blocks, err := loadModuleBlocks(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		if block.Labels[0] == name {
+			return block, nil
+		}
+	}
+	return nil, fmt.Errorf("module %q not found in %s", name, dir)
+}
+
+// literalString returns the value of attr if it is a constant string.
+func literalString(attr *hcl.Attribute) (string, bool) {
+	if attr == nil {
+		return "", false
+	}
+	val, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || !val.IsKnown() || val.IsNull() || !val.Type().Equals(cty.String) {
+		return "", false
+	}
+	return val.AsString(), true
+}
+
+// moduleCall is a module call with the arguments that tfconfig does not
+// expose.
+type moduleCall struct {
+	*tfconfig.ModuleCall
+
+	// Repetition is "count" or "for_each" when the call creates a module
+	// instance per element.
+	Repetition string
+
+	// Providers maps the provider configurations of the called module to
+	// those of the caller passed in the providers argument, such as aws to
+	// aws.west.
+	Providers map[string]string
+
+	// SourceExpression is the text of the source argument when it is an
+	// expression, such as var.source or "${local.base}/vpc", rather than
+	// a literal string. Source is empty then.
+	SourceExpression string
+
+	// Overrides are the blocks of override files that changed arguments
+	// of the call, in the order Terraform applies them.
+	Overrides []ModuleOverride
+}
+
+var moduleCallArgsSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "source"}, {Name: "version"}, {Name: "count"}, {Name: "for_each"}, {Name: "providers"}},
+}
+
+// isOverrideFile reports whether the Terraform file at path is an override
+// file, whose blocks are merged into those of the other files.
+func isOverrideFile(path string) bool {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".json"), ".tf")
+	return name == "override" || strings.HasSuffix(name, "_override")
+}
+
+// loadModuleCalls returns the module calls declared in dir, with the
+// arguments of override files merged in as Terraform does. The errors
+// tfconfig reports for source arguments that are not literal strings are
+// dropped; those calls have a SourceExpression instead.
+func loadModuleCalls(fsys fileSystem, dir string) ([]*moduleCall, error) {
+	module, diags := fsys.loadModule(dir)
+	args, sourceExprs, err := moduleCallArgs(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var errs tfconfig.Diagnostics
+	for _, diag := range diags {
+		if diag.Severity == tfconfig.DiagError && !inRanges(diag, sourceExprs) {
+			errs = append(errs, diag)
+		}
+	}
+	if errs.HasErrors() {
+		return nil, fmt.Errorf("failed to load module %s: %s", dir, errs.Error())
+	}
+	var calls []*moduleCall
+	for name, call := range module.ModuleCalls {
+		c := &moduleCall{ModuleCall: call}
+		if a, ok := args[name]; ok {
+			// tfconfig places a call at its last override and drops the
+			// version of the original block when only the source is
+			// overridden; the merged arguments are authoritative.
+			c.Source, c.Version, c.Pos = a.Source, a.Version, a.Pos
+			c.Repetition, c.Providers = a.Repetition, a.Providers
+			c.SourceExpression, c.Overrides = a.SourceExpression, a.Overrides
+		}
+		calls = append(calls, c)
+	}
+	return calls, nil
+}
+
+// inRanges reports whether diag is located in one of ranges.
+func inRanges(diag tfconfig.Diagnostic, ranges []hcl.Range) bool {
+	if diag.Pos == nil {
+		return false
+	}
+	for _, r := range ranges {
+		if filepath.Base(r.Filename) == filepath.Base(diag.Pos.Filename) &&
+			diag.Pos.Line >= r.Start.Line && diag.Pos.Line <= r.End.Line {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleCallArgs returns the module calls of the module blocks in dir by
+// name, with their source, version, count, for_each and providers
+// arguments. Blocks in override files are applied after the others and
+// replace only the arguments they set. It also returns the ranges of
+// source arguments that are not literal strings.
+func moduleCallArgs(fsys fileSystem, dir string) (map[string]moduleCall, []hcl.Range, error) {
+	paths, err := listTerraformFilesIn(fsys, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		return !isOverrideFile(paths[i]) && isOverrideFile(paths[j])
+	})
+	parser := hclparse.NewParser()
+	args := make(map[string]moduleCall)
+	var sourceExprs []hcl.Range
+	for _, path := range paths {
+		src, err := fsys.readFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		var file *hcl.File
+		if strings.HasSuffix(path, ".tf.json") {
+			file, _ = parser.ParseJSON(src, path)
+		} else {
+			file, _ = parser.ParseHCL(src, path)
+		}
+		if file == nil {
+			continue
+		}
+		override := isOverrideFile(path)
+		content, _, _ := file.Body.PartialContent(moduleBlockSchema)
+		for _, block := range content.Blocks {
+			name := block.Labels[0]
+			call, ok := args[name]
+			if !ok || !override {
+				call = moduleCall{ModuleCall: &tfconfig.ModuleCall{
+					Name: name,
+					Pos:  tfconfig.SourcePos{Filename: path, Line: block.DefRange.Start.Line},
+				}}
+			} else {
+				// Copy the call so that the block's arguments replace
+				// those of earlier blocks only.
+				merged := *call.ModuleCall
+				call.ModuleCall = &merged
+			}
+
+			attrs, _, _ := block.Body.PartialContent(moduleCallArgsSchema)
+			var set []string
+			for _, schema := range moduleCallArgsSchema.Attributes {
+				if attrs.Attributes[schema.Name] != nil {
+					set = append(set, schema.Name)
+				}
+			}
+			if attr := attrs.Attributes["source"]; attr != nil {
+				if isLiteralString(attr.Expr) {
+					v, _ := attr.Expr.Value(nil)
+					call.Source, call.SourceExpression = v.AsString(), ""
+				} else {
+					call.Source, call.SourceExpression = "", string(attr.Expr.Range().SliceBytes(src))
+					sourceExprs = append(sourceExprs, attr.Expr.Range())
+				}
+			}
+			if attr := attrs.Attributes["version"]; attr != nil && isLiteralString(attr.Expr) {
+				v, _ := attr.Expr.Value(nil)
+				call.Version = v.AsString()
+			}
+			switch {
+			case attrs.Attributes["count"] != nil:
+				call.Repetition = "count"
+			case attrs.Attributes["for_each"] != nil:
+				call.Repetition = "for_each"
+			}
+			if attr := attrs.Attributes["providers"]; attr != nil {
+				call.Providers = providerMap(attr.Expr)
+			}
+			if ok && override && len(set) > 0 {
+				call.Overrides = append(slices.Clip(call.Overrides), ModuleOverride{Filename: path, Line: block.DefRange.Start.Line, Arguments: set})
+			}
+			args[name] = call
+		}
+	}
+	return args, sourceExprs, nil
+}
+
+// isLiteralString reports whether expr is a string that can be evaluated
+// without variables or functions, as Terraform requires of module sources.
+func isLiteralString(expr hcl.Expression) bool {
+	v, diags := expr.Value(nil)
+	return !diags.HasErrors() && v.Type() == cty.String && v.IsKnown() && !v.IsNull()
+}
+
+// providerMap reads the providers argument of a module block, a map from
+// provider configurations of the called module to those of the caller.
+func providerMap(expr hcl.Expression) map[string]string {
+	pairs, diags := hcl.ExprMap(expr)
+	if diags.HasErrors() {
+		return nil
+	}
+	providers := make(map[string]string)
+	for _, pair := range pairs {
+		key, diags := hcl.AbsTraversalForExpr(pair.Key)
+		if diags.HasErrors() {
+			continue
+		}
+		value, diags := hcl.AbsTraversalForExpr(pair.Value)
+		if diags.HasErrors() {
+			continue
+		}
+		providers[traversalString(key)] = traversalString(value)
+	}
+	if len(providers) == 0 {
+		return nil
+	}
+	return providers
+}
+
+// traversalString formats a provider reference such as aws.west.
+func traversalString(t hcl.Traversal) string {
+	parts := []string{t.RootName()}
+	for _, step := range t[1:] {
+		if attr, ok := step.(hcl.TraverseAttr); ok {
+			parts = append(parts, attr.Name)
+		}
+	}
+	return strings.Join(parts, ".")
+}
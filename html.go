@@ -0,0 +1,244 @@
+package main
+
+import (
+	"html/template"
+	"io"
+)
+
+// htmlGraphNode and htmlGraphEdge are the dependency graph embedded in the
+// HTML report for the interactive view.
+type htmlGraphNode struct {
+	ID     string `json:"id"`
+	Label  string `json:"label"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+type htmlGraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Label string `json:"label"`
+}
+
+type htmlGraph struct {
+	Nodes []htmlGraphNode `json:"nodes"`
+	Edges []htmlGraphEdge `json:"edges"`
+}
+
+type htmlReport struct {
+	Output     *Output
+	Tree       *moduleNode
+	Graph      htmlGraph
+	Affected   []AffectedModule
+	HasChanges bool
+}
+
+// renderHTML writes a single-file HTML report with a collapsible module
+// tree and an interactive dependency graph. All styles and scripts are
+// inlined so the file can be shared without network access.
+func renderHTML(w io.Writer, output *Output, opts renderOptions) error {
+	return htmlTemplate.Execute(w, htmlReport{
+		Output:     output,
+		Tree:       buildModuleTree(output),
+		Graph:      buildHTMLGraph(output),
+		Affected:   opts.Affected,
+		HasChanges: opts.HasChanges,
+	})
+}
+
+// buildHTMLGraph turns the module calls of output into nodes keyed by
+// directory (root and local modules) or by source address (remote modules).
+func buildHTMLGraph(output *Output) htmlGraph {
+	g := htmlGraph{Nodes: []htmlGraphNode{}, Edges: []htmlGraphEdge{}}
+	seen := make(map[string]bool)
+	addNode := func(n htmlGraphNode) {
+		if !seen[n.ID] {
+			seen[n.ID] = true
+			g.Nodes = append(g.Nodes, n)
+		}
+	}
+
+	addNode(htmlGraphNode{ID: output.RootModule.ResolvedPath, Label: "(root)", Kind: kindRoot, Detail: output.RootModule.ResolvedPath})
+	for _, m := range output.LocalModules {
+		addNode(htmlGraphNode{ID: m.ResolvedPath, Label: m.Name, Kind: kindLocal, Detail: m.ResolvedPath})
+		g.Edges = append(g.Edges, htmlGraphEdge{From: m.CallerPath, To: m.ResolvedPath, Label: m.Name})
+	}
+	for _, r := range output.RemoteModules {
+		detail := r.Source
+		if r.Version != "" {
+			detail += " " + r.Version
+		}
+		addNode(htmlGraphNode{ID: r.Source, Label: r.Name, Kind: kindRemote, Detail: detail})
+		g.Edges = append(g.Edges, htmlGraphEdge{From: r.CallerPath, To: r.Source, Label: r.Name})
+	}
+	return g
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"triggerLabel": triggerLabel}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Terraform modules: {{.Output.RootModule.ResolvedPath}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 2em; color: #1f2328; }
+code { background: #f6f8fa; padding: 0.1em 0.3em; border-radius: 4px; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #d0d7de; padding: 0.3em 0.6em; text-align: left; }
+details { margin-left: 1.2em; }
+summary { cursor: pointer; }
+.remote { color: #8250df; }
+.files { color: #57606a; font-size: 0.9em; margin-left: 1.2em; }
+#graph { border: 1px solid #d0d7de; width: 100%; height: 600px; }
+#graph text { font-size: 12px; pointer-events: none; }
+#graph line { stroke: #8c959f; }
+#graph circle { cursor: grab; stroke: #fff; stroke-width: 1.5px; }
+#graph .faded { opacity: 0.15; }
+</style>
+</head>
+<body>
+<h1>Terraform modules</h1>
+<p>Root module: <code>{{.Output.RootModule.ResolvedPath}}</code>,
+{{len .Output.LocalModules}} local module calls, {{len .Output.RemoteModules}} remote module calls.</p>
+
+<h2>Module tree</h2>
+{{template "node" .Tree}}
+
+<h2>Dependency graph</h2>
+<p>Drag nodes to rearrange them. Hover a node to highlight its direct dependencies.</p>
+<svg id="graph"></svg>
+
+<h2>Remote modules</h2>
+{{if .Output.RemoteModules}}
+<table>
+<tr><th>Module</th><th>Source</th><th>Version</th><th>Called from</th></tr>
+{{range .Output.RemoteModules}}<tr><td>{{.Name}}</td><td><code>{{.Source}}</code></td><td>{{.Version}}</td><td>{{.CalledFrom}}</td></tr>
+{{end}}</table>
+{{else}}<p>No remote modules.</p>{{end}}
+
+{{if .HasChanges}}
+<h2>Affected modules</h2>
+{{if .Affected}}
+<table>
+<tr><th>Module</th><th>Path</th><th>Impact</th><th>Triggered by</th></tr>
+{{range .Affected}}<tr><td>{{if eq .Kind "root"}}(root){{else}}{{.Name}}{{end}}</td><td><code>{{.ResolvedPath}}</code></td><td>{{.Impact}}</td><td>{{range .Triggers}}<code>{{.File}}</code> ({{triggerLabel .Kind}})<br>{{end}}</td></tr>
+{{end}}</table>
+{{else}}<p>No modules affected.</p>{{end}}
+{{end}}
+
+<script>
+(function () {
+  const graph = {{.Graph}};
+  const svg = document.getElementById("graph");
+  const ns = "http://www.w3.org/2000/svg";
+  const width = svg.clientWidth || 960, height = svg.clientHeight || 600;
+  const colors = { root: "#cf222e", local: "#0969da", remote: "#8250df" };
+  const byId = {};
+  graph.nodes.forEach(function (n, i) {
+    const angle = 2 * Math.PI * i / graph.nodes.length;
+    n.x = width / 2 + Math.cos(angle) * width / 3;
+    n.y = height / 2 + Math.sin(angle) * height / 3;
+    n.vx = 0; n.vy = 0;
+    byId[n.id] = n;
+  });
+  const edges = graph.edges.filter(function (e) { return byId[e.from] && byId[e.to]; });
+
+  const lines = edges.map(function (e) {
+    const l = document.createElementNS(ns, "line");
+    svg.appendChild(l);
+    return l;
+  });
+  const groups = graph.nodes.map(function (n) {
+    const g = document.createElementNS(ns, "g");
+    const c = document.createElementNS(ns, "circle");
+    c.setAttribute("r", n.kind === "root" ? 10 : 7);
+    c.setAttribute("fill", colors[n.kind]);
+    const title = document.createElementNS(ns, "title");
+    title.textContent = n.detail;
+    c.appendChild(title);
+    const t = document.createElementNS(ns, "text");
+    t.setAttribute("x", 12);
+    t.setAttribute("y", 4);
+    t.textContent = n.label;
+    g.appendChild(c);
+    g.appendChild(t);
+    svg.appendChild(g);
+    c.addEventListener("mousedown", function (ev) { dragging = n; ev.preventDefault(); });
+    c.addEventListener("mouseenter", function () { highlight(n); });
+    c.addEventListener("mouseleave", function () { highlight(null); });
+    return g;
+  });
+
+  let dragging = null;
+  svg.addEventListener("mousemove", function (ev) {
+    if (!dragging) return;
+    const r = svg.getBoundingClientRect();
+    dragging.x = ev.clientX - r.left;
+    dragging.y = ev.clientY - r.top;
+    dragging.vx = 0; dragging.vy = 0;
+  });
+  window.addEventListener("mouseup", function () { dragging = null; });
+
+  function highlight(node) {
+    const related = {};
+    if (node) {
+      related[node.id] = true;
+      edges.forEach(function (e) {
+        if (e.from === node.id) related[e.to] = true;
+        if (e.to === node.id) related[e.from] = true;
+      });
+    }
+    graph.nodes.forEach(function (n, i) {
+      groups[i].classList.toggle("faded", node !== null && !related[n.id]);
+    });
+    edges.forEach(function (e, i) {
+      lines[i].classList.toggle("faded", node !== null && e.from !== node.id && e.to !== node.id);
+    });
+  }
+
+  function step() {
+    graph.nodes.forEach(function (a) {
+      graph.nodes.forEach(function (b) {
+        if (a === b) return;
+        const dx = a.x - b.x, dy = a.y - b.y;
+        const d2 = Math.max(dx * dx + dy * dy, 1);
+        a.vx += dx * 400 / d2;
+        a.vy += dy * 400 / d2;
+      });
+      a.vx += (width / 2 - a.x) * 0.002;
+      a.vy += (height / 2 - a.y) * 0.002;
+    });
+    edges.forEach(function (e) {
+      const a = byId[e.from], b = byId[e.to];
+      const dx = b.x - a.x, dy = b.y - a.y;
+      const d = Math.sqrt(dx * dx + dy * dy) || 1;
+      const f = (d - 90) * 0.01;
+      a.vx += dx / d * f; a.vy += dy / d * f;
+      b.vx -= dx / d * f; b.vy -= dy / d * f;
+    });
+    graph.nodes.forEach(function (n, i) {
+      if (n !== dragging) {
+        n.vx *= 0.85; n.vy *= 0.85;
+        n.x = Math.min(width - 20, Math.max(20, n.x + n.vx));
+        n.y = Math.min(height - 20, Math.max(20, n.y + n.vy));
+      }
+      groups[i].setAttribute("transform", "translate(" + n.x + "," + n.y + ")");
+    });
+    edges.forEach(function (e, i) {
+      lines[i].setAttribute("x1", byId[e.from].x);
+      lines[i].setAttribute("y1", byId[e.from].y);
+      lines[i].setAttribute("x2", byId[e.to].x);
+      lines[i].setAttribute("y2", byId[e.to].y);
+    });
+    requestAnimationFrame(step);
+  }
+  step();
+})();
+</script>
+</body>
+</html>
+{{define "node"}}<details open>
+<summary>{{if .Remote}}<span class="remote"><strong>{{.Name}}</strong> <code>{{.Source}}</code>{{with .Version}} <code>{{.}}</code>{{end}}</span>{{else}}<strong>{{.Name}}</strong> <code>{{if .Source}}{{.Source}}{{else}}{{.Path}}{{end}}</code>{{end}}</summary>
+{{if .Files}}<div class="files">{{range .Files}}{{.}}<br>{{end}}</div>{{end}}
+{{range .Children}}{{template "node" .}}{{end}}
+</details>
+{{end}}`))
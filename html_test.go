@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderHTML(t *testing.T) {
+	tempDir := t.TempDir()
+	rootDir := filepath.Join(tempDir, "root")
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+
+module "eks" {
+  source  = "terraform-aws-modules/eks/aws"
+  version = "~> 19.0"
+}
+`,
+		"modules/vpc/main.tf": "",
+	})
+
+	output, err := Analyze(rootDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := renderHTML(&buf, output, renderOptions{}); err != nil {
+		t.Fatalf("renderHTML failed: %v", err)
+	}
+	html := buf.String()
+
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		"<strong>vpc</strong> <code>../modules/vpc</code>",
+		"<td><code>terraform-aws-modules/eks/aws</code></td><td>~&gt; 19.0</td>",
+		`"label":"eks"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected HTML to contain %q", want)
+		}
+	}
+	if strings.Contains(html, "<script src=") || strings.Contains(html, "<link ") {
+		t.Error("expected report to be self-contained")
+	}
+	if strings.Contains(html, "Affected modules") {
+		t.Error("did not expect affected section without changes")
+	}
+}
+
+func TestBuildHTMLGraph(t *testing.T) {
+	output := &Output{
+		RootModule: ModuleDetail{ResolvedPath: "/repo/root"},
+		LocalModules: []ModuleDetail{
+			{Name: "vpc", ResolvedPath: "/repo/modules/vpc", CallerPath: "/repo/root"},
+			{Name: "network", ResolvedPath: "/repo/modules/vpc", CallerPath: "/repo/root"},
+		},
+		RemoteModules: []RemoteModule{
+			{Name: "label", Source: "cloudposse/label/null", Version: "0.25.0", CallerPath: "/repo/modules/vpc"},
+		},
+	}
+
+	g := buildHTMLGraph(output)
+
+	if len(g.Nodes) != 3 {
+		t.Errorf("expected 3 nodes (root, vpc, label), got %+v", g.Nodes)
+	}
+	if len(g.Edges) != 3 {
+		t.Errorf("expected 3 edges, got %+v", g.Edges)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// stringsFlag is a flag that may be given several times, collecting its
+// values in order.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// globRegexp compiles a glob over slash-separated paths: * and ? match
+// within one path segment, and ** matches any number of segments, so that
+// **/*.md matches Markdown files in every directory, including the top.
+func globRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// ignoreChangedFiles returns changedFiles without the files matching one of
+// patterns, matched against their path relative to the working directory.
+func ignoreChangedFiles(changedFiles, patterns []string) []string {
+	if len(patterns) == 0 {
+		return changedFiles
+	}
+	var globs []*regexp.Regexp
+	for _, pattern := range patterns {
+		globs = append(globs, globRegexp(filepath.ToSlash(pattern)))
+	}
+	var kept []string
+	for _, f := range changedFiles {
+		rel := workingDirRel(toAbsPath(f))
+		ignored := false
+		for _, glob := range globs {
+			ignored = ignored || glob.MatchString(rel)
+		}
+		if !ignored {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// readChangedFiles reads the changed files from stdin in the --stdin-format
+// format, without those matching the --ignore-changed patterns ignore.
+func readChangedFiles(format string, ignore []string) ([]string, error) {
+	changedFiles, err := changedFilesParsers[format](os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	return ignoreChangedFiles(changedFiles, ignore), nil
+}
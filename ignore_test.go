@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIgnoreChangedFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	changed := []string{
+		"README.md",
+		"modules/vpc/README.md",
+		"modules/vpc/docs/usage.md",
+		"modules/vpc/main.tf",
+		"./modules/vpc/README-old.txt",
+		"modules/vpc/md",
+	}
+	kept := ignoreChangedFiles(changed, []string{"**/*.md", "**/README*"})
+	if expected := []string{"modules/vpc/main.tf", "modules/vpc/md"}; !reflect.DeepEqual(kept, expected) {
+		t.Errorf("expected %v, got %v", expected, kept)
+	}
+
+	if kept := ignoreChangedFiles(changed, []string{"modules/*/docs/**"}); len(kept) != len(changed)-1 {
+		t.Errorf("expected only the docs directory to be ignored, got %v", kept)
+	}
+	if kept := ignoreChangedFiles(changed, nil); !reflect.DeepEqual(kept, changed) {
+		t.Errorf("expected no files to be ignored without patterns, got %v", kept)
+	}
+}
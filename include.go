@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// includedFiles returns the files matched by globs relative to dir, sorted
+// by name. A glob may start with ../ to include files beside the module.
+// The .terraform and .git directories are never searched.
+func includedFiles(fsys fileSystem, dir string, globs []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, glob := range globs {
+		// Walk from the part of the glob without wildcards, and only as
+		// deep as the glob reaches unless it contains **.
+		segments := strings.Split(path.Clean(filepath.ToSlash(glob)), "/")
+		static := 0
+		for static < len(segments)-1 && !strings.ContainsAny(segments[static], "*?") {
+			static++
+		}
+		base := filepath.Join(dir, filepath.FromSlash(path.Join(segments[:static]...)))
+		pattern := globRegexp(path.Join(segments[static:]...))
+		maxDepth := len(segments) - static
+		if strings.Contains(glob, "**") {
+			maxDepth = -1
+		}
+
+		var walk func(sub string, depth int) error
+		walk = func(sub string, depth int) error {
+			entries, err := fsys.readDir(filepath.Join(base, filepath.FromSlash(sub)))
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			for _, entry := range entries {
+				rel := path.Join(sub, entry.Name())
+				if entry.IsDir() {
+					if entry.Name() == ".terraform" || entry.Name() == ".git" || depth == maxDepth {
+						continue
+					}
+					if err := walk(rel, depth+1); err != nil {
+						return err
+					}
+					continue
+				}
+				name := filepath.Join(base, filepath.FromSlash(rel))
+				if pattern.MatchString(rel) && !seen[name] {
+					seen[name] = true
+					files = append(files, name)
+				}
+			}
+			return nil
+		}
+		if err := walk("", 1); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// hashIncludedFiles returns the content hash of a module directory whose
+// Terraform files hash to hash, combined with the files matched by its
+// include globs, named relative to dir, so that changing a template
+// changes the module like changing its Terraform files. Without included
+// files it is hash.
+func hashIncludedFiles(fsys fileSystem, dir, hash string, included []string) (string, error) {
+	if len(included) == 0 {
+		return hash, nil
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", hash)
+	for _, f := range included {
+		data, err := fsys.readFile(f)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%x\n", filepath.ToSlash(rel), sha256.Sum256(data))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// moduleContains reports whether absPath is in the module directory dir or
+// is one of its files, which include the files matched by include globs
+// outside of it.
+func moduleContains(dir string, files []string, absPath string) bool {
+	return isInDirectory(absPath, dir) || slices.Contains(files, absPath)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze_IncludeGlobs(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf":                   `module "app" { source = "../modules/app" }`,
+		"root/templates/user_data.tpl":   `#!/bin/sh`,
+		"modules/app/main.tf":            `variable "x" {}`,
+		"modules/app/scripts/init.sh":    `#!/bin/sh`,
+		"modules/app/scripts/lib/x.sh":   `#!/bin/sh`,
+		"modules/app/scripts/README.md":  `docs`,
+		"modules/shared/policy.json":     `{}`,
+		"modules/app/.terraform/x/t.tpl": `cached`,
+	})
+	t.Chdir(tempDir)
+
+	opts := AnalyzeOptions{
+		IncludeGlobs:       []string{"templates/**", "scripts/*.sh"},
+		ModuleIncludeGlobs: map[string][]string{filepath.Join(tempDir, "modules", "app"): {"../shared/*.json"}},
+	}
+	output, err := AnalyzeWithOptions("root", opts)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if expected := []string{filepath.Join(tempDir, "root", "main.tf"), filepath.Join(tempDir, "root", "templates", "user_data.tpl")}; !reflect.DeepEqual(output.RootModule.Files, expected) {
+		t.Errorf("expected root files %v, got %v", expected, output.RootModule.Files)
+	}
+	app := filepath.Join(tempDir, "modules", "app")
+	expected := []string{
+		filepath.Join(app, "main.tf"),
+		filepath.Join(app, "scripts", "init.sh"),
+		filepath.Join(tempDir, "modules", "shared", "policy.json"),
+	}
+	if !reflect.DeepEqual(output.LocalModules[0].Files, expected) {
+		t.Errorf("expected module files %v, got %v", expected, output.LocalModules[0].Files)
+	}
+
+	plain, err := Analyze("root")
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if plain.LocalModules[0].Hash == output.LocalModules[0].Hash {
+		t.Error("expected included files to change the module hash")
+	}
+	writeTestFiles(t, tempDir, map[string]string{"modules/app/scripts/init.sh": `#!/bin/bash`})
+	edited, err := AnalyzeWithOptions("root", opts)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if edited.LocalModules[0].Hash == output.LocalModules[0].Hash {
+		t.Error("expected an edited included file to change the module hash")
+	}
+
+	var buf bytes.Buffer
+	writeFilesByModule(&buf, output.LocalModules[0].Files, []*Output{output})
+	expectedGroups := app + "\t" + filepath.Join(app, "main.tf") + "\n" +
+		app + "\t" + filepath.Join(app, "scripts", "init.sh") + "\n" +
+		app + "\t" + filepath.Join(tempDir, "modules", "shared", "policy.json") + "\n"
+	if buf.String() != expectedGroups {
+		t.Errorf("expected included files grouped under their module:\n%s\ngot:\n%s", expectedGroups, buf.String())
+	}
+
+	if !IsAffected([]string{"modules/shared/policy.json"}, output) {
+		t.Error("expected an included file outside the module directory to affect it")
+	}
+	if IsAffected([]string{"modules/shared/other.json"}, output) {
+		t.Error("expected files that are not included to leave the module unaffected")
+	}
+	if affected := AffectedModules([]string{"modules/shared/policy.json"}, output); len(affected) != 1 || affected[0].Name != "app" {
+		t.Errorf("expected the app module to be affected, got %+v", affected)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonQuery is a parsed --query expression: a jq-like pipeline of filters
+// separated by |, each a path such as .roots[].path or a
+// select(path), select(path == value) or select(path != value) test.
+type jsonQuery []queryFilter
+
+// queryFilter is one stage of a jsonQuery. Without select it replaces each
+// value with the values at path; with select it keeps the values for which
+// path yields a truthy value, or one equal (or not) to value.
+type queryFilter struct {
+	path    []queryStep
+	selects bool
+	op      string
+	value   any
+}
+
+// queryStep is one step of a path: an object key, an array index
+// (negative from the end) or, with iterate, every element. Keys and
+// indexes of null are null, and iterating null yields nothing.
+type queryStep struct {
+	key     string
+	index   *int
+	iterate bool
+}
+
+// parseJSONQuery parses a --query expression.
+func parseJSONQuery(expr string) (jsonQuery, error) {
+	var query jsonQuery
+	for _, stage := range strings.Split(expr, "|") {
+		stage = strings.TrimSpace(stage)
+		var filter queryFilter
+		if inner, ok := strings.CutPrefix(stage, "select("); ok {
+			inner, ok = strings.CutSuffix(inner, ")")
+			if !ok {
+				return nil, fmt.Errorf("invalid query %q: unclosed select(", expr)
+			}
+			filter.selects = true
+			stage = strings.TrimSpace(inner)
+			for _, op := range []string{"==", "!="} {
+				if path, literal, found := strings.Cut(stage, op); found {
+					if err := decodeJSON([]byte(strings.TrimSpace(literal)), &filter.value); err != nil {
+						return nil, fmt.Errorf("invalid query %q: %s must be compared with a JSON value: %v", expr, op, err)
+					}
+					filter.op, stage = op, strings.TrimSpace(path)
+					break
+				}
+			}
+		}
+		path, err := parseQueryPath(stage)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query %q: %v", expr, err)
+		}
+		filter.path = path
+		query = append(query, filter)
+	}
+	return query, nil
+}
+
+// parseQueryPath parses a path such as ., .name, .roots[0] or .roots[].path.
+func parseQueryPath(s string) ([]queryStep, error) {
+	if !strings.HasPrefix(s, ".") {
+		return nil, fmt.Errorf("path %q must start with .", s)
+	}
+	var steps []queryStep
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in %q", s)
+			}
+			inner := s[i+1 : i+end]
+			if inner == "" {
+				steps = append(steps, queryStep{iterate: true})
+			} else {
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid array index %q", inner)
+				}
+				steps = append(steps, queryStep{index: &n})
+			}
+			i += end + 1
+		case s[i] == '.':
+			i++
+			start := i
+			for i < len(s) && (s[i] == '_' || s[i] == '-' || 'a' <= s[i] && s[i] <= 'z' || 'A' <= s[i] && s[i] <= 'Z' || '0' <= s[i] && s[i] <= '9') {
+				i++
+			}
+			if i > start {
+				steps = append(steps, queryStep{key: s[start:i]})
+			} else if i < len(s) && s[i] != '[' {
+				return nil, fmt.Errorf("unexpected %q in %q", s[i:], s)
+			} else if i == len(s) && s != "." {
+				return nil, fmt.Errorf("missing key after . in %q", s)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", s[i:], s)
+		}
+	}
+	return steps, nil
+}
+
+// eval returns the values the query yields for the JSON value v.
+func (q jsonQuery) eval(v any) ([]any, error) {
+	values := []any{v}
+	for _, filter := range q {
+		var next []any
+		for _, value := range values {
+			results, err := evalQueryPath(filter.path, value)
+			if err != nil {
+				return nil, err
+			}
+			if !filter.selects {
+				next = append(next, results...)
+				continue
+			}
+			for _, r := range results {
+				if filter.matches(r) {
+					next = append(next, value)
+					break
+				}
+			}
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// matches reports whether the result of a select filter's path selects
+// its value.
+func (f queryFilter) matches(result any) bool {
+	switch f.op {
+	case "==":
+		return reflect.DeepEqual(result, f.value)
+	case "!=":
+		return !reflect.DeepEqual(result, f.value)
+	}
+	return result != nil && result != false
+}
+
+func evalQueryPath(steps []queryStep, v any) ([]any, error) {
+	values := []any{v}
+	for _, step := range steps {
+		var next []any
+		for _, value := range values {
+			switch {
+			case step.iterate:
+				switch value := value.(type) {
+				case []any:
+					next = append(next, value...)
+				case map[string]any:
+					keys := make([]string, 0, len(value))
+					for key := range value {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						next = append(next, value[key])
+					}
+				case nil:
+					// Empty lists are often null in the output.
+				default:
+					return nil, fmt.Errorf("cannot iterate over %s", jsonTypeName(value))
+				}
+			case step.index != nil:
+				switch value := value.(type) {
+				case []any:
+					i := *step.index
+					if i < 0 {
+						i += len(value)
+					}
+					if i >= 0 && i < len(value) {
+						next = append(next, value[i])
+					} else {
+						next = append(next, nil)
+					}
+				case nil:
+					next = append(next, nil)
+				default:
+					return nil, fmt.Errorf("cannot index %s with a number", jsonTypeName(value))
+				}
+			default:
+				switch value := value.(type) {
+				case map[string]any:
+					next = append(next, value[step.key])
+				case nil:
+					next = append(next, nil)
+				default:
+					return nil, fmt.Errorf("cannot index %s with %q", jsonTypeName(value), step.key)
+				}
+			}
+		}
+		values = next
+	}
+	return values, nil
+}
+
+func jsonTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "object"
+}
+
+// decodeJSON decodes data into v, keeping numbers as written.
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// queryOutput collects the JSON output of a command and, when the command
+// finishes, writes the values --query selects from it to w, one per line:
+// strings as raw text and other values as compact JSON, like jq -r.
+type queryOutput struct {
+	w     io.Writer
+	query jsonQuery
+	buf   bytes.Buffer
+}
+
+// newQueryOutput returns the writer the command writes to, and the
+// queryOutput to close when it finishes, which is nil without a query.
+func newQueryOutput(w io.Writer, query jsonQuery) (io.Writer, *queryOutput) {
+	if query == nil {
+		return w, nil
+	}
+	q := &queryOutput{w: w, query: query}
+	return &q.buf, q
+}
+
+// close applies the query to the collected output unless the command
+// failed with exit code code, and returns the exit code of the command. A
+// nil queryOutput does nothing.
+func (q *queryOutput) close(code int) int {
+	if q == nil || code == exitError || q.buf.Len() == 0 {
+		return code
+	}
+	var v any
+	if err := decodeJSON(q.buf.Bytes(), &v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --query needs JSON output: %v\n", err)
+		return exitError
+	}
+	results, err := q.query.eval(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --query: %v\n", err)
+		return exitError
+	}
+	for _, r := range results {
+		if s, ok := r.(string); ok {
+			fmt.Fprintln(q.w, s)
+			continue
+		}
+		data, _ := json.Marshal(r)
+		fmt.Fprintln(q.w, string(data))
+	}
+	return code
+}
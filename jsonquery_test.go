@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestJSONQuery(t *testing.T) {
+	input := `{
+  "roots": [
+    {"path": "env/prod", "affected": true, "matched_files": ["env/prod/main.tf"], "count": 2},
+    {"path": "env/dev", "affected": false, "matched_files": null, "count": 1},
+    {"path": "env/stage", "affected": true, "matched_files": [], "count": 1}
+  ],
+  "meta": {"b": "second", "a": "first"}
+}`
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{".", `{"meta":{"a":"first","b":"second"},"roots":[{"affected":true,"count":2,"matched_files":["env/prod/main.tf"],"path":"env/prod"},{"affected":false,"count":1,"matched_files":null,"path":"env/dev"},{"affected":true,"count":1,"matched_files":[],"path":"env/stage"}]}` + "\n"},
+		{".roots[].path", "env/prod\nenv/dev\nenv/stage\n"},
+		{".roots[] | select(.affected) | .path", "env/prod\nenv/stage\n"},
+		{".roots[] | select(.count == 1) | .path", "env/dev\nenv/stage\n"},
+		{`.roots[] | select(.path != "env/prod") | .affected`, "false\ntrue\n"},
+		{".roots[0].matched_files", `["env/prod/main.tf"]` + "\n"},
+		{".roots[-1].path", "env/stage\n"},
+		{".roots[5].path", "null\n"},
+		{".missing.field", "null\n"},
+		{".meta[]", "first\nsecond\n"},
+		{".roots[].matched_files[]", "env/prod/main.tf\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := parseJSONQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parseJSONQuery failed: %v", err)
+			}
+			var buf bytes.Buffer
+			w, q := newQueryOutput(&buf, query)
+			fmt.Fprint(w, input)
+			if code := q.close(exitAffected); code != exitAffected {
+				t.Fatalf("expected exit code %d, got %d", exitAffected, code)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestJSONQueryErrors(t *testing.T) {
+	for _, query := range []string{"", "roots", ".roots[", ".roots[x]", ".roots.", "select(.affected", "select(.path == env/prod)"} {
+		if _, err := parseJSONQuery(query); err == nil {
+			t.Errorf("expected an error for %q", query)
+		}
+	}
+
+	query, err := parseJSONQuery(".roots.path")
+	if err != nil {
+		t.Fatalf("parseJSONQuery failed: %v", err)
+	}
+	var buf bytes.Buffer
+	w, q := newQueryOutput(&buf, query)
+	fmt.Fprint(w, `{"roots": [{"path": "env/prod"}]}`)
+	if code := q.close(exitAffected); code != exitError {
+		t.Errorf("expected exit code %d indexing an array with a key, got %d", exitError, code)
+	}
+
+	// A failed command's output is left alone.
+	buf.Reset()
+	w, q = newQueryOutput(&buf, query)
+	fmt.Fprint(w, "not JSON")
+	if code := q.close(exitError); code != exitError || buf.Len() != 0 {
+		t.Errorf("expected the failed command's output to be dropped, got %d and %q", code, buf.String())
+	}
+
+	if w, q := newQueryOutput(&buf, nil); w != &buf || q.close(exitNotAffected) != exitNotAffected {
+		t.Error("expected the writer to be returned unchanged without a query")
+	}
+}
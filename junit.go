@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// junitTestSuites is the root element of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Error     *junitMessage `xml:"error"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// JUnitReport returns a JUnit XML report of exec results with one test case
+// per root, named after its directory relative to the working directory
+// or its project and classed by its application. The captured output of roots that did
+// not pass is attached to their failure or error.
+func JUnitReport(argv []string, start time.Time, results []ExecResult) ([]byte, error) {
+	suite := junitTestSuite{
+		Name:      strings.Join(argv, " "),
+		Tests:     len(results),
+		Timestamp: start.UTC().Format("2006-01-02T15:04:05"),
+		Time:      junitSeconds(time.Since(start)),
+	}
+	for _, r := range results {
+		c := junitTestCase{
+			Name:      r.Root.name(),
+			Classname: r.Root.Application,
+			Time:      junitSeconds(r.Duration),
+		}
+		if c.Classname == "" {
+			c.Classname = programName
+		}
+		switch {
+		case r.Skipped():
+			suite.Skipped++
+			c.Skipped = &junitMessage{Message: workingDirRel(r.BlockedBy) + " did not pass"}
+		case r.Err != nil:
+			suite.Errors++
+			c.Error = &junitMessage{Message: r.Err.Error(), Text: r.Output}
+		case r.ExitCode != 0:
+			suite.Failures++
+			c.Failure = &junitMessage{Message: fmt.Sprintf("exit code %d", r.ExitCode), Text: r.Output}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+func writeJUnitReport(path string, argv []string, start time.Time, results []ExecResult) error {
+	report, err := JUnitReport(argv, start, results)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, report, 0644)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJUnitReport(t *testing.T) {
+	cwd, _ := os.Getwd()
+	dir := func(name string) string { return filepath.Join(cwd, "infra", name) }
+	results := []ExecResult{
+		{Root: ExecRoot{Path: dir("network"), Application: "core"}, Duration: 1500 * time.Millisecond, Output: "No changes.\n"},
+		{Root: ExecRoot{Path: dir("app")}, ExitCode: 1, Duration: time.Second, Output: "Error: <invalid> & broken\n"},
+		{Root: ExecRoot{Path: dir("batch")}, BlockedBy: dir("app")},
+		{Root: ExecRoot{Path: dir("dns")}, Err: errors.New("terraform: not found")},
+	}
+	data, err := JUnitReport([]string{"terraform", "plan"}, time.Now(), results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, data)
+	}
+	suite := report.Suites[0]
+	if suite.Name != "terraform plan" || suite.Tests != 4 || suite.Failures != 1 || suite.Errors != 1 || suite.Skipped != 1 {
+		t.Errorf("unexpected suite %+v", suite)
+	}
+	passed, failed, skipped := suite.Cases[0], suite.Cases[1], suite.Cases[2]
+	if passed.Name != "infra/network" || passed.Classname != "core" || passed.Time != "1.500" || passed.Failure != nil {
+		t.Errorf("unexpected passing case %+v", passed)
+	}
+	if failed.Failure == nil || failed.Failure.Message != "exit code 1" || failed.Failure.Text != "Error: <invalid> & broken\n" {
+		t.Errorf("expected the failure with its output, got %+v", failed)
+	}
+	if skipped.Skipped == nil || skipped.Skipped.Message != "infra/app did not pass" {
+		t.Errorf("expected a skipped case, got %+v", skipped)
+	}
+	if !strings.HasPrefix(string(data), xml.Header) {
+		t.Errorf("expected an XML declaration, got:\n%s", data)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// licenseFilePrefixes are the names of license files, matched
+// case-insensitively with any extension or suffix, such as LICENSE.md or
+// COPYING.txt.
+var licenseFilePrefixes = []string{"license", "licence", "copying"}
+
+// licensePatterns identifies licenses by phrases of their text, normalized
+// to lowercase single-spaced words. All phrases of a pattern must occur,
+// and the first matching pattern wins, so licenses that quote others come
+// first.
+var licensePatterns = []struct {
+	id      string
+	phrases []string
+}{
+	{"AGPL-3.0", []string{"gnu affero general public license", "version 3"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"LGPL-2.0", []string{"gnu library general public license", "version 2"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"MIT", []string{"permission is hereby granted, free of charge, to any person obtaining a copy"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose with or without fee is hereby granted"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "endorse or promote products derived from this software"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+	{"CC0-1.0", []string{"cc0 1.0 universal"}},
+}
+
+// detectLicense returns the SPDX identifier of the license of a module,
+// read from the first license file found in dirs in order, such as the
+// module directory and then the root of the package it is a subdirectory
+// of. It returns NOASSERTION for a license file whose license is not
+// recognized, and "" when there is no license file.
+func detectLicense(fsys fileSystem, dirs ...string) string {
+	for _, dir := range dirs {
+		path := licenseFile(fsys, dir)
+		if path == "" {
+			continue
+		}
+		data, err := fsys.readFile(path)
+		if err != nil {
+			return spdxNoAssertion
+		}
+		return identifyLicense(string(data))
+	}
+	return ""
+}
+
+// licenseFile returns the license file in dir, preferring the file named
+// exactly LICENSE, or "" if there is none.
+func licenseFile(fsys fileSystem, dir string) string {
+	entries, err := fsys.readDir(dir)
+	if err != nil {
+		return ""
+	}
+	found := ""
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := strings.ToLower(entry.Name())
+		for _, prefix := range licenseFilePrefixes {
+			if name == prefix {
+				return filepath.Join(dir, entry.Name())
+			}
+			if found == "" && strings.HasPrefix(name, prefix) {
+				found = filepath.Join(dir, entry.Name())
+			}
+		}
+	}
+	return found
+}
+
+// identifyLicense returns the SPDX identifier of the license text, or
+// NOASSERTION when it is not recognized.
+func identifyLicense(text string) string {
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	for _, pattern := range licensePatterns {
+		matched := true
+		for _, phrase := range pattern.phrases {
+			matched = matched && strings.Contains(text, phrase)
+		}
+		if matched {
+			return pattern.id
+		}
+	}
+	return spdxNoAssertion
+}
+
+// packageRoot returns the root of the package a module in dir was
+// installed from, given the subdirectory its source selects.
+func packageRoot(dir, subdir string) string {
+	if subdir == "" {
+		return dir
+	}
+	if root, ok := strings.CutSuffix(dir, string(filepath.Separator)+filepath.FromSlash(strings.Trim(subdir, "/"))); ok {
+		return root
+	}
+	return dir
+}
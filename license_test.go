@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIdentifyLicense(t *testing.T) {
+	tests := map[string]string{
+		"                                 Apache License\n                           Version 2.0, January 2004": "Apache-2.0",
+		"MIT License\n\nPermission is hereby granted, free of charge, to any person\nobtaining a copy":          "MIT",
+		"Mozilla Public License Version 2.0\n==================================":                                "MPL-2.0",
+		"GNU LESSER GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007 ... GNU General Public License":             "LGPL-3.0",
+		"Redistribution and use in source and binary forms, with or without modification, are permitted":        "BSD-2-Clause",
+		"Copyright (c) Example Corp. All rights reserved.":                                                      spdxNoAssertion,
+	}
+	for text, expected := range tests {
+		if id := identifyLicense(text); id != expected {
+			t.Errorf("expected %s for %q, got %s", expected, text, id)
+		}
+	}
+}
+
+func TestAnalyze_DownloadedLicenses(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws//modules/endpoints"
+  version = "5.0.0"
+}
+
+module "label" {
+  source = "git::https://example.com/label.git?ref=v1.0.0"
+}
+
+module "bare" {
+  source = "git::https://example.com/bare.git?ref=v1.0.0"
+}
+`,
+		".terraform/modules/modules.json": `{"Modules":[
+  {"Key":"","Source":"","Dir":"."},
+  {"Key":"vpc","Source":"registry.terraform.io/terraform-aws-modules/vpc/aws//modules/endpoints","Version":"5.0.0","Dir":".terraform/modules/vpc/modules/endpoints"},
+  {"Key":"label","Source":"git::https://example.com/label.git?ref=v1.0.0","Dir":".terraform/modules/label"},
+  {"Key":"bare","Source":"git::https://example.com/bare.git?ref=v1.0.0","Dir":".terraform/modules/bare"}
+]}`,
+		".terraform/modules/vpc/LICENSE":                   "Apache License\nVersion 2.0, January 2004",
+		".terraform/modules/vpc/modules/endpoints/main.tf": "",
+		".terraform/modules/label/LICENSE.md":              "All rights reserved.",
+		".terraform/modules/label/main.tf":                 "",
+		".terraform/modules/bare/main.tf":                  "",
+	})
+
+	output, err := AnalyzeWithOptions(tempDir, AnalyzeOptions{IncludeDownloaded: true})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	licenses := make(map[string]string)
+	for _, remote := range output.RemoteModules {
+		licenses[remote.Name] = remote.License
+	}
+	expected := map[string]string{"vpc": "Apache-2.0", "label": spdxNoAssertion, "bare": ""}
+	for name, license := range expected {
+		if licenses[name] != license {
+			t.Errorf("expected %s to have license %q, got %q", name, license, licenses[name])
+		}
+	}
+}
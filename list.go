@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// ListFilter selects the module calls printed by list. Empty globs match
+// every call.
+type ListFilter struct {
+	// NameGlob matches the name of the module block.
+	NameGlob string
+
+	// SourceGlob matches the source as written, with ** matching across
+	// slashes.
+	SourceGlob string
+
+	// MinDepth is the fewest levels below the root a call must be made at:
+	// calls in the root module are at depth 1.
+	MinDepth int
+}
+
+// listMatcher is a compiled ListFilter.
+type listMatcher struct {
+	name, source *regexp.Regexp
+	minDepth     int
+	depths       map[string]int
+}
+
+func newListMatcher(filter ListFilter, output *Output) *listMatcher {
+	m := &listMatcher{minDepth: filter.MinDepth, depths: callDepths(output)}
+	if filter.NameGlob != "" {
+		m.name = globRegexp(filter.NameGlob)
+	}
+	if filter.SourceGlob != "" {
+		m.source = globRegexp(filter.SourceGlob)
+	}
+	return m
+}
+
+// match reports whether a call named name with source, made by the module
+// in callerPath, passes the filter.
+func (m *listMatcher) match(name, source, callerPath string) bool {
+	return (m.name == nil || m.name.MatchString(name)) &&
+		(m.source == nil || m.source.MatchString(source)) &&
+		m.depths[callerPath]+1 >= m.minDepth
+}
+
+// callDepths returns the depth of the root and of every local module
+// directory of output: the fewest module calls it is reached through from
+// the root.
+func callDepths(output *Output) map[string]int {
+	depths := map[string]int{output.RootModule.ResolvedPath: 0}
+	callees := make(map[string][]string)
+	for _, m := range output.LocalModules {
+		callees[m.CallerPath] = append(callees[m.CallerPath], m.ResolvedPath)
+	}
+	queue := []string{output.RootModule.ResolvedPath}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		for _, callee := range callees[dir] {
+			if _, ok := depths[callee]; !ok {
+				depths[callee] = depths[dir] + 1
+				queue = append(queue, callee)
+			}
+		}
+	}
+	return depths
+}
+
+// ListLocalModules returns the local module calls of output that pass
+// filter, in output order.
+func ListLocalModules(output *Output, filter ListFilter) []ModuleDetail {
+	m := newListMatcher(filter, output)
+	modules := []ModuleDetail{}
+	for _, module := range output.LocalModules {
+		if m.match(module.Name, module.Source, module.CallerPath) {
+			modules = append(modules, module)
+		}
+	}
+	return modules
+}
+
+// ListRemoteModules returns the remote module calls of output that pass
+// filter, in output order.
+func ListRemoteModules(output *Output, filter ListFilter) []RemoteModule {
+	m := newListMatcher(filter, output)
+	modules := []RemoteModule{}
+	for _, module := range output.RemoteModules {
+		if m.match(module.Name, module.Source, module.CallerPath) {
+			modules = append(modules, module)
+		}
+	}
+	return modules
+}
+
+func runList(args []string) int {
+	flags := newFlagSet("list")
+	nameGlob := flags.String("name-glob", "", "only list module calls whose name matches this glob, such as 'vpc*'")
+	sourceGlob := flags.String("source-glob", "", "only list module calls whose source matches this glob, such as 'terraform-aws-modules/**' (** matches across slashes)")
+	minDepth := flags.Int("min-depth", 0, "only list module calls made at least this many levels below the root (calls in the root are at depth 1)")
+	format := flags.String("format", "text", "output format: text (tab-separated name, source, and resolved path or version) or json")
+	configPath := flags.String("config", "", "configuration file (default "+defaultConfigFile+" in the working directory, if present)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s list local|remote [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "List the local or remote module calls of a root module that match the filters\n")
+		fmt.Fprintf(flags.Output(), "(exit 0=calls listed, 1=none).\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\nExamples:\n")
+		fmt.Fprintf(flags.Output(), "  %s list remote --source-glob 'terraform-aws-modules/**' ./terraform/prod\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  %s list local --min-depth 2 ./terraform/prod\n", os.Args[0])
+	}
+	kind := ""
+	if len(args) > 0 && (args[0] == "local" || args[0] == "remote") {
+		kind, args = args[0], args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if kind == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	output, err := AnalyzeWithOptions(flags.Arg(0), config.analyzeOptions())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	filter := ListFilter{NameGlob: *nameGlob, SourceGlob: *sourceGlob, MinDepth: *minDepth}
+	var modules any
+	count := 0
+	if kind == "local" {
+		local := ListLocalModules(output, filter)
+		modules, count = local, len(local)
+		if *format == "text" {
+			writeLocalModuleList(os.Stdout, local)
+		}
+	} else {
+		remote := ListRemoteModules(output, filter)
+		modules, count = remote, len(remote)
+		if *format == "text" {
+			writeRemoteModuleList(os.Stdout, remote)
+		}
+	}
+	if *format == "json" {
+		jsonOutput, _ := json.MarshalIndent(modules, "", "  ")
+		fmt.Println(string(jsonOutput))
+	}
+	if count == 0 {
+		return exitNotAffected
+	}
+	return exitAffected
+}
+
+func writeLocalModuleList(w io.Writer, modules []ModuleDetail) {
+	for _, m := range modules {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", m.Name, m.Source, workingDirRel(m.ResolvedPath))
+	}
+}
+
+func writeRemoteModuleList(w io.Writer, modules []RemoteModule) {
+	for _, m := range modules {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", m.Name, m.Source, m.Version)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestListModules(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source = "./modules/vpc"
+}
+
+module "vpc_endpoints" {
+  source  = "terraform-aws-modules/vpc/aws//modules/vpc-endpoints"
+  version = "5.0.0"
+}
+
+module "label" {
+  source = "git::https://example.com/label.git?ref=v1.0.0"
+}
+`,
+		"modules/vpc/main.tf": `
+module "subnets" {
+  source = "../subnets"
+}
+
+module "vpc_flow_logs" {
+  source  = "terraform-aws-modules/vpc/aws//modules/flow-logs"
+  version = "5.0.0"
+}
+`,
+		"modules/subnets/main.tf": `variable "cidr" {}`,
+	})
+	output, err := Analyze(tempDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	names := func(filter ListFilter) []string {
+		var names []string
+		for _, m := range ListRemoteModules(output, filter) {
+			names = append(names, m.Name)
+		}
+		return names
+	}
+	tests := []struct {
+		filter   ListFilter
+		expected []string
+	}{
+		{ListFilter{}, []string{"label", "vpc_endpoints", "vpc_flow_logs"}},
+		{ListFilter{NameGlob: "vpc_*"}, []string{"vpc_endpoints", "vpc_flow_logs"}},
+		{ListFilter{SourceGlob: "terraform-aws-modules/**"}, []string{"vpc_endpoints", "vpc_flow_logs"}},
+		{ListFilter{SourceGlob: "git::*"}, nil},
+		{ListFilter{SourceGlob: "git::**"}, []string{"label"}},
+		{ListFilter{MinDepth: 2}, []string{"vpc_flow_logs"}},
+	}
+	for _, tt := range tests {
+		got := names(tt.filter)
+		slices.Sort(got)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%+v: expected %v, got %v", tt.filter, tt.expected, got)
+		}
+	}
+
+	local := ListLocalModules(output, ListFilter{MinDepth: 2})
+	if len(local) != 1 || local[0].Name != "subnets" {
+		t.Errorf("expected only subnets at depth 2, got %+v", local)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultLockFile is where the lock subcommand writes the lockfile,
+// relative to the root module.
+const defaultLockFile = ".terraform-module-resolve.lock.json"
+
+// lockVersion is bumped whenever the Lock encoding changes incompatibly.
+const lockVersion = 1
+
+// Lock records the content hash of the root module, of every local module
+// it calls and of every remote module installed by terraform init, so that
+// CI can verify the module tree has not changed unexpectedly. Paths are
+// relative to the root module so that the lockfile can be committed.
+type Lock struct {
+	Version int            `json:"version"`
+	Modules []LockedModule `json:"modules"`
+}
+
+// LockedModule is a module directory of a Lock. Remote modules also record
+// their source, the registry version terraform init selected and, for git
+// sources, the commit their ref pointed to.
+type LockedModule struct {
+	Path    string `json:"path"`
+	Source  string `json:"source,omitempty"`
+	Version string `json:"version,omitempty"`
+	Commit  string `json:"commit,omitempty"`
+	Hash    string `json:"hash"`
+}
+
+// LockMismatch is a difference between a lockfile and the module tree.
+type LockMismatch struct {
+	Change string `json:"change"`
+	Path   string `json:"path"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// NewLock builds the lock of output, which must have been analyzed with
+// AnalyzeOptions.IncludeDownloaded. Remote modules that are not installed
+// are reported as an error. With resolveRefs, the branch and tag refs of
+// git sources are resolved to commits with git ls-remote; otherwise only
+// refs that are already commit SHAs are recorded.
+func NewLock(ctx context.Context, output *Output, resolveRefs bool) (*Lock, error) {
+	root := output.RootModule.ResolvedPath
+	lock := &Lock{
+		Version: lockVersion,
+		Modules: []LockedModule{{Path: ".", Hash: output.RootModule.Hash}},
+	}
+
+	seen := map[string]bool{root: true}
+	for _, local := range output.LocalModules {
+		if seen[local.ResolvedPath] {
+			continue
+		}
+		seen[local.ResolvedPath] = true
+		lock.Modules = append(lock.Modules, LockedModule{
+			Path: relativeGraphPath(root, local.ResolvedPath),
+			Hash: local.Hash,
+		})
+	}
+	commits := make(map[[2]string]string)
+	for _, remote := range output.RemoteModules {
+		if remote.ResolvedPath == "" {
+			return nil, fmt.Errorf("module %q called from %s is not installed (run terraform init)", remote.Name, remote.CallerPath)
+		}
+		if seen[remote.ResolvedPath] {
+			continue
+		}
+		seen[remote.ResolvedPath] = true
+
+		locked := LockedModule{
+			Path:    relativeGraphPath(root, remote.ResolvedPath),
+			Source:  remote.Source,
+			Version: remote.InstalledVersion,
+			Hash:    remote.Hash,
+		}
+		if isGitSource(remote.Source) {
+			switch {
+			case commitSHAPattern.MatchString(remote.Ref):
+				locked.Commit = remote.Ref
+			case resolveRefs:
+				repo := remoteSourceURL(remote.Source, "")
+				key := [2]string{repo, remote.Ref}
+				commit, ok := commits[key]
+				if !ok {
+					var err error
+					commit, err = lsRemote(ctx, repo, remote.Ref)
+					if err != nil {
+						return nil, fmt.Errorf("module %q: %w", remote.Name, err)
+					}
+					commits[key] = commit
+				}
+				locked.Commit = commit
+			}
+		}
+		lock.Modules = append(lock.Modules, locked)
+	}
+
+	sort.Slice(lock.Modules, func(i, j int) bool { return lock.Modules[i].Path < lock.Modules[j].Path })
+	return lock, nil
+}
+
+// ReadLock loads a lockfile written by the lock subcommand.
+func ReadLock(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %w", path, err)
+	}
+	if lock.Version != lockVersion {
+		return nil, fmt.Errorf("lockfile %s has version %d, expected %d", path, lock.Version, lockVersion)
+	}
+	return &lock, nil
+}
+
+// VerifyLock returns the modules added, removed or modified in current
+// compared with locked, sorted by path. Commits are only compared when
+// both record one.
+func VerifyLock(locked, current *Lock) []LockMismatch {
+	lockedModules := make(map[string]LockedModule)
+	for _, m := range locked.Modules {
+		lockedModules[m.Path] = m
+	}
+	currentModules := make(map[string]LockedModule)
+	for _, m := range current.Modules {
+		currentModules[m.Path] = m
+	}
+
+	var mismatches []LockMismatch
+	for path, cur := range currentModules {
+		prev, ok := lockedModules[path]
+		if !ok {
+			mismatches = append(mismatches, LockMismatch{Change: changeAdded, Path: path})
+			continue
+		}
+		var details []string
+		if prev.Source != cur.Source {
+			details = append(details, fmt.Sprintf("source %s => %s", prev.Source, cur.Source))
+		}
+		if prev.Version != cur.Version {
+			details = append(details, fmt.Sprintf("version %s => %s", prev.Version, cur.Version))
+		}
+		if prev.Commit != "" && cur.Commit != "" && prev.Commit != cur.Commit {
+			details = append(details, fmt.Sprintf("commit %s => %s", prev.Commit, cur.Commit))
+		}
+		if prev.Hash != cur.Hash {
+			details = append(details, "content changed")
+		}
+		if len(details) > 0 {
+			mismatches = append(mismatches, LockMismatch{Change: changeModified, Path: path, Detail: strings.Join(details, ", ")})
+		}
+	}
+	for path := range lockedModules {
+		if _, ok := currentModules[path]; !ok {
+			mismatches = append(mismatches, LockMismatch{Change: changeRemoved, Path: path})
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Path < mismatches[j].Path })
+	return mismatches
+}
+
+func writeLockMismatches(w io.Writer, mismatches []LockMismatch) {
+	for _, m := range mismatches {
+		if m.Detail == "" {
+			fmt.Fprintf(w, "%s\t%s\n", m.Change, m.Path)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", m.Change, m.Path, m.Detail)
+	}
+}
+
+// lockTree analyzes the root module at dir with its installed remote
+// modules and builds its lock.
+func lockTree(dir string, offline bool, timeout time.Duration) (*Lock, error) {
+	ctx, cancel := analysisContext(timeout)
+	defer cancel()
+	output, err := AnalyzeContext(ctx, dir, AnalyzeOptions{IncludeDownloaded: true})
+	if err != nil {
+		return nil, err
+	}
+	return NewLock(ctx, output, !offline)
+}
+
+// lockFilePath returns the lockfile of the root module at dir: path if
+// set, or the default lockfile in dir.
+func lockFilePath(dir, path string) string {
+	if path != "" {
+		return path
+	}
+	return filepath.Join(dir, defaultLockFile)
+}
+
+func runLock(args []string) int {
+	flags := newFlagSet("lock")
+	lockfile := flags.String("lockfile", "", "write the lockfile to this path (default "+defaultLockFile+" in the root module)")
+	offline := flags.Bool("offline", false, "do not resolve git branch and tag refs to commits with git ls-remote")
+	timeout := flags.Duration("timeout", 5*time.Minute, "abort after this duration (0 means no limit)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s lock [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Record the content hashes of the root module, its local modules and the remote\n")
+		fmt.Fprintf(flags.Output(), "modules installed by terraform init, with their installed versions and git\n")
+		fmt.Fprintf(flags.Output(), "commits, in a lockfile that verify checks the tree against.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	lock, err := lockTree(flags.Arg(0), *offline, *timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	data, _ := json.MarshalIndent(lock, "", "  ")
+	data = append(data, '\n')
+	if err := writeFileAtomic(lockFilePath(flags.Arg(0), *lockfile), data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return 0
+}
+
+func runVerify(args []string) int {
+	flags := newFlagSet("verify")
+	lockfile := flags.String("lockfile", "", "lockfile to verify against (default "+defaultLockFile+" in the root module)")
+	offline := flags.Bool("offline", false, "do not resolve git branch and tag refs to compare their commits")
+	timeout := flags.Duration("timeout", 5*time.Minute, "abort after this duration (0 means no limit)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s verify [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Check that the root module, its local modules and the remote modules installed\n")
+		fmt.Fprintf(flags.Output(), "by terraform init match the lockfile written by lock.\n")
+		fmt.Fprintf(flags.Output(), "Exit codes: 0=matches, 1=modules added, removed or modified, 2=error\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	locked, err := ReadLock(lockFilePath(flags.Arg(0), *lockfile))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	current, err := lockTree(flags.Arg(0), *offline, *timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	mismatches := VerifyLock(locked, current)
+	writeLockMismatches(os.Stdout, mismatches)
+	if len(mismatches) > 0 {
+		return exitInvalid
+	}
+	return exitValid
+}
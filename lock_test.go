@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLockAndVerify(t *testing.T) {
+	tempDir := t.TempDir()
+	sha := strings.Repeat("a", 40)
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "~> 5.0"
+}
+
+module "app" {
+  source = "./modules/app"
+}
+`,
+		"modules/app/main.tf": `
+module "label" {
+  source = "git::https://example.com/label.git?ref=` + sha + `"
+}
+`,
+		".terraform/modules/modules.json": `{"Modules":[
+  {"Key":"","Source":"","Dir":"."},
+  {"Key":"vpc","Source":"registry.terraform.io/terraform-aws-modules/vpc/aws","Version":"5.0.0","Dir":".terraform/modules/vpc"},
+  {"Key":"app","Source":"./modules/app","Dir":"modules/app"},
+  {"Key":"app.label","Source":"git::https://example.com/label.git?ref=` + sha + `","Dir":".terraform/modules/app.label"}
+]}`,
+		".terraform/modules/vpc/main.tf":       `resource "aws_vpc" "this" {}`,
+		".terraform/modules/app.label/main.tf": `output "id" { value = "x" }`,
+	})
+
+	if code := runLock([]string{"--offline", tempDir}); code != 0 {
+		t.Fatalf("lock exited %d", code)
+	}
+	lock, err := ReadLock(filepath.Join(tempDir, defaultLockFile))
+	if err != nil {
+		t.Fatalf("ReadLock failed: %v", err)
+	}
+	var paths []string
+	for _, m := range lock.Modules {
+		paths = append(paths, m.Path)
+	}
+	if expected := []string{".", ".terraform/modules/app.label", ".terraform/modules/vpc", "modules/app"}; !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("expected locked paths %v, got %v", expected, paths)
+	}
+	if label, vpc := lock.Modules[1], lock.Modules[2]; label.Commit != sha || vpc.Version != "5.0.0" || vpc.Source != "terraform-aws-modules/vpc/aws" || vpc.Hash == "" {
+		t.Errorf("unexpected remote entries %+v and %+v", label, vpc)
+	}
+
+	if code := runVerify([]string{"--offline", tempDir}); code != exitValid {
+		t.Errorf("expected an unchanged tree to verify, got exit %d", code)
+	}
+
+	writeTestFiles(t, tempDir, map[string]string{
+		".terraform/modules/vpc/main.tf": `resource "aws_vpc" "main" {}`,
+		".terraform/modules/modules.json": `{"Modules":[
+  {"Key":"vpc","Source":"registry.terraform.io/terraform-aws-modules/vpc/aws","Version":"5.1.0","Dir":".terraform/modules/vpc"},
+  {"Key":"app.label","Source":"git::https://example.com/label.git?ref=` + sha + `","Dir":".terraform/modules/app.label"}
+]}`,
+		"modules/extra/main.tf": `variable "x" {}`,
+		"modules/app/main.tf": `
+module "label" {
+  source = "git::https://example.com/label.git?ref=` + sha + `"
+}
+
+module "extra" {
+  source = "../extra"
+}
+`,
+	})
+	current, err := lockTree(tempDir, true, 0)
+	if err != nil {
+		t.Fatalf("lockTree failed: %v", err)
+	}
+	expected := []LockMismatch{
+		{Change: changeModified, Path: ".terraform/modules/vpc", Detail: "version 5.0.0 => 5.1.0, content changed"},
+		{Change: changeModified, Path: "modules/app", Detail: "content changed"},
+		{Change: changeAdded, Path: "modules/extra"},
+	}
+	if mismatches := VerifyLock(lock, current); !reflect.DeepEqual(mismatches, expected) {
+		t.Errorf("expected %+v, got %+v", expected, mismatches)
+	}
+	if code := runVerify([]string{"--offline", tempDir}); code != exitInvalid {
+		t.Errorf("expected a changed tree to fail verification, got exit %d", code)
+	}
+}
+
+func TestNewLock_RequiresInstalledModules(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "~> 5.0"
+}
+`,
+	})
+	output, err := AnalyzeWithOptions(tempDir, AnalyzeOptions{IncludeDownloaded: true})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if _, err := NewLock(context.Background(), output, false); err == nil || !strings.Contains(err.Error(), "terraform init") {
+		t.Errorf("expected an error for a module that is not installed, got %v", err)
+	}
+}
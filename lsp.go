@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lspDependentsMethod is the request editors send for the dependents of a
+// file, and lspShowDependentsCommand the command of the code lens showing
+// them, which an extension implements by sending that request.
+const (
+	lspDependentsMethod      = "terraformModuleResolve/dependents"
+	lspShowDependentsCommand = "terraformModuleResolve.showDependents"
+)
+
+// maxLSPMessageSize bounds the Content-Length of a message read by the
+// language server, so that a broken client cannot exhaust memory.
+const maxLSPMessageSize = 64 << 20
+
+// FileDependents are the roots that a file takes part in, with the module
+// calls in each root's tree that a change to the file affects.
+type FileDependents struct {
+	File  string          `json:"file"`
+	Roots []DependentRoot `json:"roots"`
+}
+
+// DependentRoot is a root module depending on a file.
+type DependentRoot struct {
+	Path        string           `json:"path"`
+	Application string           `json:"application,omitempty"`
+	Project     string           `json:"project,omitempty"`
+	Modules     []AffectedModule `json:"modules"`
+}
+
+// FindFileDependents returns the discovered roots that a change to file
+// would affect, as discover --affected would report them, and the module
+// calls it affects in each.
+func FindFileDependents(discovery *Discovery, file, precedence string) FileDependents {
+	file = toAbsPath(file)
+	result := FileDependents{File: file, Roots: []DependentRoot{}}
+	for i, r := range RootAffectedResults(discovery, []string{file}, precedence) {
+		if !r.Affected {
+			continue
+		}
+		modules := ImpactedModules([]string{file}, discovery.Roots[i].Analysis)
+		if modules == nil {
+			modules = []AffectedModule{}
+		}
+		result.Roots = append(result.Roots, DependentRoot{Path: r.Path, Application: r.Application, Project: r.Project, Modules: modules})
+	}
+	return result
+}
+
+// languageServer answers editors over the Language Server Protocol. It
+// discovers the roots under dir on the first request and reuses the
+// discovery until the editor reports saved or changed files.
+type languageServer struct {
+	dir        string
+	config     *Config
+	opts       AnalyzeOptions
+	precedence string
+
+	discovery *Discovery
+	shutdown  bool
+}
+
+func runLSP(args []string) int {
+	flags := newFlagSet("lsp")
+	precedence := flags.String("overlap-precedence", precedenceNearest, "root that owns files of a nested root: nearest, outermost or all")
+	configPath := flags.String("config", "", "configuration file (default "+defaultConfigFile+" in the working directory, if present)")
+	cachePath := flags.String("cache", "", "load parsed module calls from this cache file at startup and save them on exit")
+	var includeGlobs stringsFlag
+	flags.Var(&includeGlobs, "include-glob", "also list files matching this glob, relative to each module directory, such as 'templates/**', as module files that affect the module (may be repeated)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s lsp [options] [directory]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Serve the roots and modules depending on a file to editors as a language\n")
+		fmt.Fprintf(flags.Output(), "server on stdin and stdout. Roots are discovered under the directory, or the\n")
+		fmt.Fprintf(flags.Output(), "workspace root the editor opens.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return exitError
+	}
+	switch *precedence {
+	case precedenceNearest, precedenceOutermost, precedenceAll:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --overlap-precedence %q\n", *precedence)
+		return exitError
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	s := &languageServer{dir: flags.Arg(0), config: config, opts: config.analyzeOptions(), precedence: *precedence}
+	s.opts.IncludeGlobs = includeGlobs
+	s.opts.Cache = NewCache()
+	if *cachePath != "" {
+		s.opts.Cache = loadCacheOrWarn(*cachePath)
+	}
+
+	if err := s.serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if *cachePath != "" {
+		if err := s.opts.Cache.Save(*cachePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing cache: %v\n", err)
+			return exitError
+		}
+	}
+	return 0
+}
+
+// serve answers the JSON-RPC messages read from r, framed with
+// Content-Length headers as in the LSP base protocol, until the exit
+// notification or the end of r.
+func (s *languageServer) serve(r io.Reader, w io.Writer) error {
+	reader := textproto.NewReader(bufio.NewReader(r))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil || length < 0 {
+			return fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+		}
+		if length > maxLSPMessageSize {
+			return fmt.Errorf("message of %d bytes is larger than %d bytes", length, maxLSPMessageSize)
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			return err
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := writeLSPMessage(w, rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.ID == nil {
+			if req.Method == "exit" {
+				return nil
+			}
+			s.notify(req)
+			continue
+		}
+		result, rpcErr := s.handle(req)
+		if result == nil && rpcErr == nil {
+			result = json.RawMessage("null")
+		}
+		if err := writeLSPMessage(w, rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}); err != nil {
+			return err
+		}
+	}
+}
+
+func writeLSPMessage(w io.Writer, msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// notify handles a notification. Saved and changed files may change the
+// module trees, so they drop the discovery; the cache keeps rediscovering
+// unchanged module directories cheap.
+func (s *languageServer) notify(req rpcRequest) {
+	switch req.Method {
+	case "textDocument/didSave", "workspace/didChangeWatchedFiles":
+		s.discovery = nil
+	}
+}
+
+func (s *languageServer) handle(req rpcRequest) (any, *rpcError) {
+	if req.JSONRPC != "2.0" {
+		return nil, &rpcError{Code: rpcInvalidRequest, Message: "jsonrpc must be \"2.0\""}
+	}
+	if s.shutdown {
+		return nil, &rpcError{Code: rpcInvalidRequest, Message: "server is shutting down"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			RootURI string `json:"rootUri"`
+		}
+		if err := decodeToolArguments(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		if s.dir == "" && params.RootURI != "" {
+			dir, err := fileURIPath(params.RootURI)
+			if err != nil {
+				return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+			}
+			s.dir = dir
+		}
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{"openClose": false, "change": 0, "save": map[string]any{}},
+				"codeLensProvider": map[string]any{},
+			},
+			"serverInfo": map[string]any{"name": "terraform-module-resolve", "version": toolVersion()},
+		}, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case lspDependentsMethod, "textDocument/codeLens":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := decodeToolArguments(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		file, err := fileURIPath(params.TextDocument.URI)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		dependents, err := s.dependents(file)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInternalError, Message: err.Error()}
+		}
+		if req.Method == lspDependentsMethod {
+			return dependents, nil
+		}
+		return dependentsCodeLenses(params.TextDocument.URI, dependents, s.baseDir()), nil
+
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+	}
+}
+
+// dependents returns the dependents of file, discovering the roots first
+// when the last discovery was dropped.
+func (s *languageServer) dependents(file string) (FileDependents, error) {
+	if s.discovery == nil {
+		discovery, err := DiscoverContext(context.Background(), s.baseDir(), s.opts)
+		if err != nil {
+			return FileDependents{}, err
+		}
+		ApplyProjects(discovery, s.config.Projects, s.baseDir())
+		s.discovery = discovery
+	}
+	return FindFileDependents(s.discovery, file, s.precedence), nil
+}
+
+// baseDir returns the absolute directory roots are discovered under.
+func (s *languageServer) baseDir() string {
+	dir, _ := filepath.Abs(s.dir)
+	return dir
+}
+
+// dependentsCodeLenses returns a code lens on the first line of the
+// document at uri naming its dependent roots relative to baseDir, or none
+// when nothing depends on it.
+func dependentsCodeLenses(uri string, dependents FileDependents, baseDir string) []map[string]any {
+	if len(dependents.Roots) == 0 {
+		return []map[string]any{}
+	}
+	names := make([]string, len(dependents.Roots))
+	for i, root := range dependents.Roots {
+		names[i] = root.Path
+		if rel, err := filepath.Rel(baseDir, root.Path); err == nil {
+			names[i] = filepath.ToSlash(rel)
+		}
+	}
+	title := "Affects 1 root: " + names[0]
+	if len(names) > 1 {
+		title = fmt.Sprintf("Affects %d roots: %s", len(names), strings.Join(names, ", "))
+	}
+	position := map[string]int{"line": 0, "character": 0}
+	return []map[string]any{{
+		"range":   map[string]any{"start": position, "end": position},
+		"command": map[string]any{"title": title, "command": lspShowDependentsCommand, "arguments": []string{uri}},
+	}}
+}
+
+// fileURIPath returns the path of a file URI.
+func fileURIPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported URI %q: expected a file URI", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLanguageServer(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+`,
+		"envs/dev/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+`,
+		"modules/app/main.tf": `
+module "vpc" {
+  source = "../vpc"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+		"unused/main.tf":      `variable "name" {}`,
+	})
+	vpcURI := "file://" + filepath.ToSlash(filepath.Join(tempDir, "modules", "vpc", "main.tf"))
+
+	var input bytes.Buffer
+	send := func(msg string) {
+		fmt.Fprintf(&input, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	send(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootUri":%q,"capabilities":{}}}`, "file://"+filepath.ToSlash(tempDir)))
+	send(`{"jsonrpc":"2.0","method":"initialized","params":{}}`)
+	send(fmt.Sprintf(`{"jsonrpc":"2.0","id":2,"method":"terraformModuleResolve/dependents","params":{"textDocument":{"uri":%q}}}`, vpcURI))
+	send(fmt.Sprintf(`{"jsonrpc":"2.0","id":3,"method":"textDocument/codeLens","params":{"textDocument":{"uri":%q}}}`, vpcURI))
+	send(fmt.Sprintf(`{"jsonrpc":"2.0","id":4,"method":"textDocument/codeLens","params":{"textDocument":{"uri":%q}}}`, "file://"+filepath.ToSlash(filepath.Join(tempDir, "README.md"))))
+	send(`{"jsonrpc":"2.0","id":5,"method":"textDocument/hover","params":{}}`)
+	send(`{"jsonrpc":"2.0","id":6,"method":"terraformModuleResolve/dependents","params":{"textDocument":{"uri":"https://example.com/main.tf"}}}`)
+	send(`{"jsonrpc":"2.0","id":7,"method":"shutdown"}`)
+	send(`{"jsonrpc":"2.0","method":"exit"}`)
+	send(`{"jsonrpc":"2.0","id":8,"method":"shutdown"}`)
+
+	s := &languageServer{config: &Config{}, opts: AnalyzeOptions{Cache: NewCache()}, precedence: precedenceNearest}
+	var out bytes.Buffer
+	if err := s.serve(&input, &out); err != nil {
+		t.Fatalf("serve failed: %v", err)
+	}
+
+	type response struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	var responses []response
+	reader := textproto.NewReader(bufio.NewReader(&out))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid response header: %v", err)
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			t.Fatalf("truncated response: %v", err)
+		}
+		var resp response
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("invalid response %s: %v", body, err)
+		}
+		responses = append(responses, resp)
+	}
+	if len(responses) != 7 {
+		t.Fatalf("expected 7 responses before exit, got %d", len(responses))
+	}
+
+	if !strings.Contains(string(responses[0].Result), `"codeLensProvider"`) {
+		t.Errorf("expected code lens capability, got %s", responses[0].Result)
+	}
+
+	var dependents FileDependents
+	if err := json.Unmarshal(responses[1].Result, &dependents); err != nil {
+		t.Fatalf("invalid dependents: %v", err)
+	}
+	var roots []string
+	for _, root := range dependents.Roots {
+		roots = append(roots, root.Path)
+		if len(root.Modules) != 3 {
+			t.Errorf("expected the root, app and vpc to be affected in %s, got %+v", root.Path, root.Modules)
+		}
+	}
+	expected := []string{filepath.Join(tempDir, "envs", "dev"), filepath.Join(tempDir, "envs", "prod")}
+	if strings.Join(roots, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected roots %v, got %v", expected, roots)
+	}
+
+	var lenses []struct {
+		Command struct {
+			Title     string   `json:"title"`
+			Arguments []string `json:"arguments"`
+		} `json:"command"`
+	}
+	if err := json.Unmarshal(responses[2].Result, &lenses); err != nil {
+		t.Fatalf("invalid code lenses: %v", err)
+	}
+	if len(lenses) != 1 || lenses[0].Command.Title != "Affects 2 roots: envs/dev, envs/prod" || lenses[0].Command.Arguments[0] != vpcURI {
+		t.Errorf("unexpected code lenses: %s", responses[2].Result)
+	}
+	if string(responses[3].Result) != "[]" {
+		t.Errorf("expected no code lenses for an unused file, got %s", responses[3].Result)
+	}
+
+	if responses[4].Error == nil || responses[4].Error.Code != rpcMethodNotFound {
+		t.Errorf("expected method not found, got %+v", responses[4])
+	}
+	if responses[5].Error == nil || responses[5].Error.Code != rpcInvalidParams {
+		t.Errorf("expected invalid params for a non-file URI, got %+v", responses[5])
+	}
+	if responses[6].Error != nil || string(responses[6].Result) != "null" {
+		t.Errorf("expected a null shutdown result, got %+v", responses[6])
+	}
+}
+
+func TestLanguageServer_InvalidContentLength(t *testing.T) {
+	for _, length := range []string{"-1", "abc", strconv.Itoa(maxLSPMessageSize + 1)} {
+		s := &languageServer{config: &Config{}, precedence: precedenceNearest}
+		input := strings.NewReader("Content-Length: " + length + "\r\n\r\n{}")
+		if err := s.serve(input, io.Discard); err == nil {
+			t.Errorf("expected an error for Content-Length %s", length)
+		}
+	}
+}
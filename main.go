@@ -1,21 +1,42 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/terraform-config-inspect/tfconfig"
 )
 
+// Output is the result of analyzing a root module. Its order is stable so
+// that outputs can be diffed and snapshot-tested: module calls are listed
+// depth-first, the calls of each module in source order (by file name, then
+// line, then module name), and files are sorted by name.
 type Output struct {
+	SchemaVersion int            `json:"schema_version"`
 	RootModule    ModuleDetail   `json:"root_module"`
+	Backend       *Backend       `json:"backend,omitempty"`
 	LocalModules  []ModuleDetail `json:"local_modules"`
 	RemoteModules []RemoteModule `json:"remote_modules"`
+	Unresolvable  []Unresolvable `json:"unresolvable_modules,omitempty"`
+	Moved         []Moved        `json:"moved,omitempty"`
+	Diagnostics   []Diagnostic   `json:"diagnostics,omitempty"`
+
+	graph          *Graph
+	rootFiles      map[string]bool
+	deletedModules []ModuleDetail
 }
 
 type ModuleDetail struct {
@@ -23,60 +44,554 @@ type ModuleDetail struct {
 	Source       string   `json:"source,omitempty"`
 	ResolvedPath string   `json:"resolved_path"`
 	Files        []string `json:"files"`
+	Hash         string   `json:"hash,omitempty"`
+	CalledFrom   string   `json:"called_from,omitempty"`
+	CallerPath   string   `json:"caller_path,omitempty"`
+	Replaced     bool     `json:"replaced,omitempty"`
+
+	Repetition string            `json:"repetition,omitempty"`
+	Providers  map[string]string `json:"providers,omitempty"`
+	Overrides  []ModuleOverride  `json:"overrides,omitempty"`
 }
 
+// RemoteModule is a registry, git or HTTP module call. URL and Ref are the
+// package URL and git ref parsed from non-registry sources, Registry is the
+// normalized address of valid registry sources, and Subdir is the
+// subdirectory selected with //. ResolvedPath, Files, Hash and
+// InstalledVersion, the registry version that was selected, describe the
+// copy installed by terraform init and are only set when
+// AnalyzeOptions.IncludeDownloaded is enabled and the module was found, as
+// is License, the SPDX identifier of the license file of the copy.
+// Metadata is only set by EnrichRegistryMetadata.
 type RemoteModule struct {
+	Name             string            `json:"name"`
+	Source           string            `json:"source"`
+	Version          string            `json:"version,omitempty"`
+	CalledFrom       string            `json:"called_from"`
+	CallerPath       string            `json:"caller_path"`
+	URL              string            `json:"url,omitempty"`
+	Subdir           string            `json:"subdir,omitempty"`
+	Ref              string            `json:"ref,omitempty"`
+	Registry         *RegistryAddress  `json:"registry,omitempty"`
+	ResolvedPath     string            `json:"resolved_path,omitempty"`
+	Files            []string          `json:"files,omitempty"`
+	Hash             string            `json:"hash,omitempty"`
+	InstalledVersion string            `json:"installed_version,omitempty"`
+	License          string            `json:"license,omitempty"`
+	Metadata         *RegistryMetadata `json:"registry_metadata,omitempty"`
+
+	Repetition string            `json:"repetition,omitempty"`
+	Providers  map[string]string `json:"providers,omitempty"`
+	Overrides  []ModuleOverride  `json:"overrides,omitempty"`
+}
+
+// Unresolvable is a module call whose source is an expression, such as
+// var.source or "${local.base}/vpc", rather than a literal string. Its
+// source cannot be resolved without evaluating the configuration, which
+// Terraform rejects too, so the call is not followed.
+type Unresolvable struct {
 	Name       string `json:"name"`
-	Source     string `json:"source"`
-	Version    string `json:"version,omitempty"`
+	Expression string `json:"expression"`
 	CalledFrom string `json:"called_from"`
+	CallerPath string `json:"caller_path"`
+	Filename   string `json:"filename"`
+	Line       int    `json:"line"`
 }
 
+// ModuleOverride is a module block in an override file, override.tf or a
+// file ending in _override.tf, that replaced arguments of a module call
+// declared elsewhere. Arguments lists the replaced arguments that affect
+// how the call is resolved: source, version, count, for_each and
+// providers.
+type ModuleOverride struct {
+	Filename  string   `json:"filename"`
+	Line      int      `json:"line"`
+	Arguments []string `json:"arguments"`
+}
+
+// Diagnostic describes a problem with a module call found during analysis.
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Module   string `json:"module,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+const (
+	codeMissingModule = "missing_module"
+	codeEmptyModule   = "empty_module"
+	codeInvalidSource = "invalid_source"
+	codeUnpinned      = "unpinned_module"
+	codeMaxDepth      = "max_depth_reached"
+	codeUnresolved    = "unresolved_version"
+	codeDeprecated    = "deprecated_module"
+	codeUnresolvable  = "unresolvable_source"
+	codeModuleRenamed = "module_renamed"
+)
+
 const (
 	exitAffected    = 0
 	exitNotAffected = 1
 	exitError       = 2
 )
 
+// subcommands maps a leading command-line argument to its handler. Each
+// handler parses its own flags and returns the process exit code.
+var subcommands = map[string]func(args []string) int{
+	"validate":      runValidate,
+	"default-drift": runDefaultDrift,
+	"discover":      runDiscover,
+	"snapshot":      runSnapshot,
+	"diff":          runDiff,
+	"mcp":           runMCP,
+	"lsp":           runLSP,
+	"serve":         runServe,
+	"tui":           runTUI,
+	"stats":         runStats,
+	"vendor":        runVendor,
+	"schema":        runSchema,
+	"codeowners":    runCodeowners,
+	"workspaces":    runWorkspaces,
+	"exec":          runExec,
+	"fanout":        runFanOut,
+	"graph":         runGraph,
+	"list":          runList,
+	"versions":      runVersions,
+	"pin":           runPin,
+	"lock":          runLock,
+	"verify":        runVerify,
+	"state-map":     runStateMap,
+	"daemon":        runDaemon,
+}
+
 func main() {
-	filesOnly := flag.Bool("files-only", false, "output only file paths, one per line")
-	filterStdin := flag.Bool("filter-stdin", false, "filter output to only files matching stdin (use with --files-only)")
-	affected := flag.Bool("affected", false, "check if module is affected by changed files from stdin (exit 0=affected, 1=not affected)")
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] <directory>\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nExamples:\n")
-		fmt.Fprintf(os.Stderr, "  %s /path/to/terraform\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s --files-only /path/to/terraform\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  git diff --name-only | %s --files-only --filter-stdin /path/to/terraform\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  git diff --name-only | %s --affected /path/to/terraform && terraform plan\n", os.Args[0])
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+	os.Exit(runAnalyze(os.Args[1:]))
+}
+
+// runAnalyze is the default command, analyzing a single root module.
+func runAnalyze(args []string) (code int) {
+	flags := newFlagSet(programName)
+	filesOnly := flags.Bool("files-only", false, "output only file paths, one per line")
+	filterStdin := flags.Bool("filter-stdin", false, "filter output to only files matching stdin (use with --files-only)")
+	groupByModule := flags.Bool("group-by-module", false, "prefix each file with its module directory and a tab (use with --files-only)")
+	affected := flags.Bool("affected", false, "check if module is affected by changed files from stdin (exit 0=affected, 1=not affected)")
+	listAffected := flags.Bool("list-affected", false, "with --affected, print the affected modules as tab-separated kind, name, path and impact, direct or transitive (or a JSON array with --format json)")
+	affectedBy := flags.String("affected-by", "", "list the modules and root that depend, directly or transitively, on this local module directory (exit 0=has dependents, 1=none)")
+	planTargets := flags.Bool("plan-targets", false, "with --affected, print the -target arguments that plan only the module calls containing changed files, one per line (none when the root module itself changed)")
+	notify := flags.String("notify-webhook", "", "with --affected, post a JSON summary of the changed modules and files to this URL, such as a Slack incoming webhook, when the root is affected (default $"+notifyWebhookEnv+")")
+	githubOutputs := flags.Bool("github-output", false, "with --affected, also write affected, modules and matrix step outputs to $GITHUB_OUTPUT")
+	explain := flags.Bool("explain", false, "with --affected, print to stderr which module directory and call chain each changed file matched")
+	format := flags.String("format", "json", "output format: "+strings.Join(formatNames(), ", ")+" (tree when stdout is a terminal and no format is given)")
+	query := flags.String("query", "", "print only the values this jq-like expression selects from the JSON output, such as '.remote_modules[].source', strings raw and one per line")
+	templateText := flags.String("template", "", "with --format template, a Go text/template executed with the JSON output's fields, such as '{{range .RemoteModules}}{{.Source}}@{{.Version}}{{\"\\n\"}}{{end}}'")
+	loadGraph := flags.String("load-graph", "", "reuse module calls from a graph saved by --save-graph for unchanged directories")
+	saveGraph := flags.String("save-graph", "", "write the resolved module graph with file hashes to this path")
+	cachePath := flags.String("cache", "", "reuse and update parsed module calls in this cache file")
+	concurrency := flags.Int("concurrency", runtime.NumCPU(), "number of module directories to load in parallel")
+	timeout := flags.Duration("timeout", 0, "abort the analysis after this duration (0 means no limit)")
+	includeDownloaded := flags.Bool("include-downloaded", false, "include the files and hashes of remote modules installed under .terraform/modules by terraform init")
+	configPath := flags.String("config", "", "configuration file (default "+defaultConfigFile+" in the working directory, if present)")
+	failOnMissing := flags.Bool("fail-on-missing-module", false, "fail with an error naming the module call when a local module source cannot be read, instead of skipping it with a warning")
+	maxDepth := flags.Int("max-depth", 0, "do not follow module calls nested deeper than this many levels below the root (0 means no limit)")
+	progress := flags.Bool("progress", false, "report the module directories discovered and loaded on stderr")
+	watch := flags.Bool("watch", false, "re-run the analysis whenever Terraform files in the root or its local modules change")
+	watchExec := flags.String("watch-exec", "", "shell command to run after each analysis in --watch mode, with the analyzed directory in TFMR_MODULE_PATH")
+	outputPath := flags.String("output", "", "write the output to this file, atomically replacing it, instead of stdout")
+	ref := flags.String("ref", "", "analyze the files of this git ref, such as origin/main, read from the repository's objects instead of the working directory")
+	baseRef := flags.String("base-ref", "", "with --affected, also analyze the root at this git ref, such as origin/main, so that changed files of module directories deleted since then affect the modules that called them")
+	repo := flags.String("repo", "", "shallowly clone this git repository, such as https://github.com/org/infra?ref=main, and analyze it; the directory names the root within the repository, such as //stacks/prod")
+	repoCacheDir := flags.String("repo-cache-dir", "", "with --repo, keep cloned repositories in this directory between runs (default: the user cache directory)")
+	repoCacheTTL := flags.Duration("repo-cache-ttl", defaultGitCacheTTL, "with --repo, fetch cached branches and tags again after this duration")
+	archive := flags.String("archive", "", "analyze the files of this .tar.gz or .zip archive (- for stdin) in memory; the directory names the root within the archive")
+	var includeGlobs stringsFlag
+	flags.Var(&includeGlobs, "include-glob", "also list files matching this glob, relative to each module directory, such as 'templates/**', as module files that affect the module (may be repeated)")
+	stdinFormat := addStdinFormatFlag(flags)
+	var ignoreChanged stringsFlag
+	flags.Var(&ignoreChanged, "ignore-changed", "ignore changed files from stdin matching this glob, such as '**/*.md' (** matches any number of directories; may be repeated)")
+	dirsFromStdin := flags.Bool("dirs-from-stdin", false, "analyze every root module directory read from stdin, one per line, sharing parsed modules between them, and print a JSON array of their outputs (or their files with --files-only)")
+	registryMetadata := flags.Bool("registry-metadata", false, "add the description, publication date and verified status of each registry module, fetched from its registry, to the JSON output")
+	addNetworkFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s --dirs-from-stdin [options]\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s validate [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s default-drift <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s discover [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s snapshot [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s diff <manifest|directory> <manifest|directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s mcp\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s lsp [options] [directory]\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s serve [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s daemon [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s tui <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s stats [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s vendor [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s schema\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s codeowners [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s workspaces [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s exec [options] <directory> -- <command> [args...]\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s fanout [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s graph query [options] <directory> <expression>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s list local|remote [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s versions [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s pin [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s lock [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s verify [options] <directory>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s state-map [options] <directory> [state.json]\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s completion bash|zsh|fish\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s man\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Resolve the local and remote modules called by a Terraform root module and list their files.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\nExamples:\n")
+		fmt.Fprintf(flags.Output(), "  %s /path/to/terraform\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  %s --files-only /path/to/terraform\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  git diff --name-only | %s --files-only --filter-stdin /path/to/terraform\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  git diff --name-only | %s --affected /path/to/terraform && terraform plan\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  git diff --name-only | %s --affected --format markdown /path/to/terraform\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  %s --watch --watch-exec 'terraform validate' /path/to/terraform\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  %s --repo https://github.com/org/infra //stacks/prod\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  find . -name terragrunt.hcl -printf '%%h\\n' | %s --dirs-from-stdin\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  %s validate /path/to/terraform\n", os.Args[0])
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return exitError
+	}
+
+	if *dirsFromStdin {
+		if flags.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "Error: --dirs-from-stdin reads directories from stdin and takes no directory argument\n")
+			return exitError
+		}
+		if *affected || *affectedBy != "" || *filterStdin || *watch || *loadGraph != "" || *saveGraph != "" || *ref != "" || *archive != "" || *repo != "" {
+			fmt.Fprintf(os.Stderr, "Error: --dirs-from-stdin cannot be combined with --affected, --affected-by, --filter-stdin, --watch, --load-graph, --save-graph, --ref, --archive or --repo\n")
+			return exitError
+		}
+		if *format != "json" {
+			fmt.Fprintf(os.Stderr, "Error: --dirs-from-stdin only writes --format json\n")
+			return exitError
+		}
+	} else if flags.NArg() < 1 && *repo == "" {
+		flags.Usage()
+		return exitError
+	}
+	if *githubOutputs && !*affected {
+		fmt.Fprintf(os.Stderr, "Error: --github-output requires --affected\n")
+		return exitError
+	}
+	if *notify != "" && !*affected {
+		fmt.Fprintf(os.Stderr, "Error: --notify-webhook requires --affected\n")
+		return exitError
+	}
+	if *notify != "" && offline {
+		fmt.Fprintf(os.Stderr, "Error: --notify-webhook cannot be combined with --offline\n")
+		return exitError
+	}
+	if *affected && !offline {
+		*notify = webhookURL(*notify)
+	}
+	if *registryMetadata && (*watch || *dirsFromStdin || offline) {
+		fmt.Fprintf(os.Stderr, "Error: --registry-metadata cannot be combined with --watch, --dirs-from-stdin or --offline\n")
+		return exitError
+	}
+	if *ref != "" && *watch {
+		fmt.Fprintf(os.Stderr, "Error: --ref cannot be combined with --watch\n")
+		return exitError
+	}
+	if *archive != "" && (*watch || *ref != "") {
+		fmt.Fprintf(os.Stderr, "Error: --archive cannot be combined with --watch or --ref\n")
+		return exitError
+	}
+	if *archive == "-" && (*affected || *filterStdin) {
+		fmt.Fprintf(os.Stderr, "Error: --archive - reads the archive from stdin and cannot be combined with --affected or --filter-stdin\n")
+		return exitError
+	}
+	if *repo != "" && (*watch || *ref != "" || *archive != "") {
+		fmt.Fprintf(os.Stderr, "Error: --repo cannot be combined with --watch, --ref or --archive\n")
+		return exitError
+	}
+	if *baseRef != "" && (!*affected || *ref != "" || *archive != "" || *repo != "") {
+		fmt.Fprintf(os.Stderr, "Error: --base-ref requires --affected and cannot be combined with --ref, --archive or --repo\n")
+		return exitError
+	}
+	if *planTargets && (!*affected || *listAffected) {
+		fmt.Fprintf(os.Stderr, "Error: --plan-targets requires --affected and cannot be combined with --list-affected\n")
+		return exitError
+	}
+
+	render, ok := formatters[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+	if *templateText != "" && *format != "template" {
+		fmt.Fprintf(os.Stderr, "Error: --template requires --format template\n")
+		return exitError
+	}
+	if *format == "template" {
+		tmpl, err := parseOutputTemplate(*templateText)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		render = func(w io.Writer, output *Output, opts renderOptions) error {
+			opts.Template = tmpl
+			return renderTemplate(w, output, opts)
+		}
 	}
-	flag.Parse()
+	var jq jsonQuery
+	if *query != "" {
+		if *format != "json" {
+			fmt.Fprintf(os.Stderr, "Error: --query requires --format json\n")
+			return exitError
+		}
+		if *filesOnly || *planTargets || *watch || *dirsFromStdin {
+			fmt.Fprintf(os.Stderr, "Error: --query cannot be combined with --files-only, --plan-targets, --watch or --dirs-from-stdin\n")
+			return exitError
+		}
+		var err error
+		if jq, err = parseJSONQuery(*query); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+	formatSet := *query != ""
+	flags.Visit(func(f *flag.Flag) {
+		formatSet = formatSet || f.Name == "format"
+	})
+	if !formatSet && *outputPath == "" && isTerminal(os.Stdout) {
+		// JSON is for machines; show people the module hierarchy.
+		render = renderTree
+	}
+
+	dir := flags.Arg(0)
 
-	if flag.NArg() < 1 {
-		flag.Usage()
-		os.Exit(exitError)
+	opts := AnalyzeOptions{Concurrency: *concurrency, MaxDepth: *maxDepth, IncludeDownloaded: *includeDownloaded, FailOnMissingModule: *failOnMissing}
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	opts.Replace = config.Replace
+	opts.IncludeGlobs = includeGlobs
+	opts.ModuleIncludeGlobs = config.IncludeGlobs
+	opts.RootFiles = config.RootFiles
+	if *progress {
+		opts.Progress = NewProgress(os.Stderr)
+	}
+	if *loadGraph != "" {
+		graph, err := ReadGraph(*loadGraph)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring graph: %v\n", err)
+		}
+		opts.Graph = graph
+	}
+	if *cachePath != "" {
+		opts.Cache = loadCacheOrWarn(*cachePath)
+	}
+	if *ref != "" {
+		if opts.FS, err = gitRefFS(dir, *ref); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		// The tree is mapped at the repository root, not the working
+		// directory.
+		dir = toAbsPath(dir)
+	}
+	if *archive != "" {
+		if opts.FS, err = loadArchive(*archive); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		dir = filepath.Join(archiveRoot, filepath.FromSlash(dir))
+	}
+	if *repo != "" {
+		ctx, cancel := analysisContext(*timeout)
+		fsys, subdir, cleanup, err := cloneRepo(ctx, *repo, *repoCacheDir, *repoCacheTTL)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		defer cleanup()
+		opts.FS = fsys
+		dir = filepath.Join(archiveRoot, filepath.FromSlash(subdir), filepath.FromSlash(dir))
 	}
 
-	dir := flag.Arg(0)
+	if *dirsFromStdin {
+		stdout, outputFile := newOutput(*outputPath)
+		defer func() { code = outputFile.close(code) }()
+		if opts.Cache == nil {
+			opts.Cache = NewCache()
+		}
+		ctx, cancel := analysisContext(*timeout)
+		defer cancel()
+		result := runBatch(ctx, stdout, opts, *filesOnly, *groupByModule)
+		if *cachePath != "" {
+			if err := opts.Cache.Save(*cachePath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing cache: %v\n", err)
+				return exitError
+			}
+		}
+		return result
+	}
 
-	output, err := Analyze(dir)
+	if *watch {
+		if *outputPath != "" {
+			render = renderToFile(*outputPath, render)
+		}
+		err := runWatch(dir, opts, render, *watchExec)
+		if opts.Cache != nil {
+			if err := opts.Cache.Save(*cachePath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing cache: %v\n", err)
+				return exitError
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		return 0
+	}
+
+	stdout, outputFile := newOutput(*outputPath)
+	defer func() { code = outputFile.close(code) }()
+	stdout, queried := newQueryOutput(stdout, jq)
+	defer func() { code = queried.close(code) }()
+
+	ctx, cancel := analysisContext(*timeout)
+	output, err := AnalyzeContext(ctx, dir, opts)
+	cancel()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(exitError)
+		return exitError
+	}
+	opts.Progress.Done("analyzed %d module calls", len(output.LocalModules)+len(output.RemoteModules))
+
+	if *baseRef != "" {
+		base, err := gitRefFS(dir, *baseRef)
+		if err == nil {
+			err = output.addBaseModules(base, opts)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	if *registryMetadata {
+		ctx, cancel := analysisContext(*timeout)
+		err := EnrichRegistryMetadata(ctx, output, nil)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	if opts.Cache != nil {
+		if err := opts.Cache.Save(*cachePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing cache: %v\n", err)
+			return exitError
+		}
+	}
+
+	if *saveGraph != "" {
+		if err := WriteGraph(*saveGraph, output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing graph: %v\n", err)
+			return exitError
+		}
+	}
+
+	if *affectedBy != "" {
+		dependents := DependentModules(*affectedBy, output)
+		if formatSet && *format == "json" {
+			err = writeAffectedModulesJSON(stdout, dependents)
+		} else {
+			writeAffectedModules(stdout, dependents)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		if len(dependents) > 0 {
+			return exitAffected
+		}
+		return exitNotAffected
 	}
 
 	if *affected {
-		changedFiles, err := readStdin()
+		changedFiles, err := readChangedFiles(*stdinFormat, ignoreChanged)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
-			os.Exit(exitError)
+			return exitError
+		}
+		if opts.FS == nil {
+			for _, r := range DetectModuleRenames(changedFiles, output) {
+				diagnostic := renameDiagnostic(r)
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", diagnostic.Message)
+				output.Diagnostics = append(output.Diagnostics, diagnostic)
+			}
+		}
+		if *explain {
+			writeExplanations(os.Stderr, ExplainAffected(changedFiles, output))
+		}
+		if *notify != "" && IsAffected(changedFiles, output) {
+			notifyWebhook(*notify, changedFiles, []NotifyRoot{newNotifyRoot(output, "", changedFiles)})
+		}
+		if *githubOutputs {
+			outputs := affectedModulesOutputs(IsAffected(changedFiles, output), AffectedModules(changedFiles, output))
+			if err := appendGitHubOutputs(outputs); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitError
+			}
+		}
+		if *planTargets {
+			targets, full := PlanTargets(changedFiles, output)
+			if full {
+				fmt.Fprintf(os.Stderr, "Warning: the root module itself changed; plan without -target\n")
+			}
+			for _, arg := range targetArgs(targets) {
+				fmt.Fprintln(stdout, arg)
+			}
+		} else if *listAffected {
+			affectedModules := ImpactedModules(changedFiles, output)
+			if formatSet && *format == "json" {
+				err = writeAffectedModulesJSON(stdout, affectedModules)
+			} else {
+				writeAffectedModules(stdout, affectedModules)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitError
+			}
+		} else if formatSet {
+			affectedModules := ImpactedModules(changedFiles, output)
+			if err := render(stdout, output, renderOptions{Affected: affectedModules, HasChanges: true}); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitError
+			}
 		}
 		if IsAffected(changedFiles, output) {
-			os.Exit(exitAffected)
+			return exitAffected
 		} else {
-			os.Exit(exitNotAffected)
+			return exitNotAffected
 		}
 	}
 
@@ -84,33 +599,46 @@ func main() {
 		files := CollectAllFiles(output)
 
 		if *filterStdin {
-			changedFiles, err := readStdin()
+			changedFiles, err := readChangedFiles(*stdinFormat, ignoreChanged)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
-				os.Exit(exitError)
+				return exitError
 			}
 			files = FilterRelatedFiles(files, changedFiles, output)
 		}
 
-		for _, f := range files {
-			fmt.Println(f)
+		if *groupByModule {
+			writeFilesByModule(stdout, files, []*Output{output})
+		} else {
+			for _, f := range files {
+				fmt.Fprintln(stdout, f)
+			}
 		}
 	} else {
-		jsonOutput, _ := json.MarshalIndent(output, "", "  ")
-		fmt.Println(string(jsonOutput))
+		if err := render(stdout, output, renderOptions{}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
 	}
+	return 0
 }
 
-func readStdin() ([]string, error) {
-	var lines []string
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			lines = append(lines, line)
-		}
+// analysisContext returns a context that is cancelled on interrupt and,
+// when timeout is positive, after timeout has elapsed.
+func analysisContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
 	}
-	return lines, scanner.Err()
+}
+
+func readStdin() ([]string, error) {
+	return readPaths(os.Stdin)
 }
 
 func IsAffected(changedFiles []string, output *Output) bool {
@@ -123,12 +651,18 @@ func IsAffected(changedFiles []string, output *Output) bool {
 		}
 		absPath, _ = filepath.Abs(absPath)
 
-		if isInDirectory(absPath, output.RootModule.ResolvedPath) {
+		if output.changeAffects(output.RootModule.ResolvedPath, output.RootModule.Files, absPath, true) {
 			return true
 		}
 
 		for _, localMod := range output.LocalModules {
-			if isInDirectory(absPath, localMod.ResolvedPath) {
+			if output.changeAffects(localMod.ResolvedPath, localMod.Files, absPath, false) {
+				return true
+			}
+		}
+
+		for _, remoteMod := range output.RemoteModules {
+			if remoteMod.ResolvedPath != "" && output.changeAffects(remoteMod.ResolvedPath, remoteMod.Files, absPath, false) {
 				return true
 			}
 		}
@@ -137,6 +671,197 @@ func IsAffected(changedFiles []string, output *Output) bool {
 	return false
 }
 
+// AffectedModule is the root, a local or a downloaded remote module
+// containing changed files. Impact is "direct" for a module containing
+// changed files, which are its ChangedFiles, and "transitive" for a module
+// that only calls one, including a deleted module whose files changed.
+// Triggers are the changed files that affect the module, its own files
+// listed in ChangedFiles first, each with the kind of its trigger.
+type AffectedModule struct {
+	Name         string    `json:"name,omitempty"`
+	Kind         string    `json:"kind"`
+	ResolvedPath string    `json:"resolved_path"`
+	Impact       string    `json:"impact,omitempty"`
+	ChangedFiles []string  `json:"changed_files,omitempty"`
+	Triggers     []Trigger `json:"triggers,omitempty"`
+}
+
+// Trigger is a changed file affecting a module. Kind is "own_file" for a
+// file of the module, "tfvars" or "lockfile" for a variable definitions
+// file or the dependency lock file of the module, and "dependency_file"
+// for a file of a module it calls, directly or transitively, including
+// one that was deleted.
+type Trigger struct {
+	File string `json:"file"`
+	Kind string `json:"kind"`
+}
+
+const (
+	impactDirect     = "direct"
+	impactTransitive = "transitive"
+)
+
+const (
+	triggerOwnFile        = "own_file"
+	triggerTfvars         = "tfvars"
+	triggerLockfile       = "lockfile"
+	triggerDependencyFile = "dependency_file"
+)
+
+// ownTriggerKind returns the kind of trigger of absPath, a changed file of
+// a module.
+func ownTriggerKind(absPath string) string {
+	name := filepath.Base(absPath)
+	switch {
+	case rootFileClass(absPath) == rootFileLock:
+		return triggerLockfile
+	case strings.HasSuffix(name, ".tfvars"), strings.HasSuffix(name, ".tfvars.json"):
+		return triggerTfvars
+	}
+	return triggerOwnFile
+}
+
+const (
+	kindRoot   = "root"
+	kindLocal  = "local"
+	kindRemote = "remote"
+)
+
+// writeAffectedModules prints one tab-separated kind, name and path line
+// per affected module, followed by its impact when it is known.
+func writeAffectedModules(w io.Writer, affected []AffectedModule) {
+	for _, m := range affected {
+		if m.Impact == "" {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", m.Kind, m.Name, m.ResolvedPath)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Kind, m.Name, m.ResolvedPath, m.Impact)
+	}
+}
+
+func writeAffectedModulesJSON(w io.Writer, affected []AffectedModule) error {
+	if affected == nil {
+		affected = []AffectedModule{}
+	}
+	data, err := json.MarshalIndent(affected, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// AffectedModules returns the root, local and downloaded remote modules
+// whose directory contains at least one of changedFiles, in output order.
+func AffectedModules(changedFiles []string, output *Output) []AffectedModule {
+	return affectedModules(changedFiles, output, false)
+}
+
+// ImpactedModules is AffectedModules with the modules that call an
+// affected module, directly or transitively, added as transitive impact.
+func ImpactedModules(changedFiles []string, output *Output) []AffectedModule {
+	return affectedModules(changedFiles, output, true)
+}
+
+func affectedModules(changedFiles []string, output *Output, transitive bool) []AffectedModule {
+	var absPaths []string
+	for _, f := range changedFiles {
+		absPaths = append(absPaths, toAbsPath(f))
+	}
+
+	// matched holds the changed files of each module, and deleted those
+	// of the deleted modules it calls, which affect it like the files of
+	// any module it calls.
+	matched := make(map[string][]string)
+	deleted := make(map[string][]string)
+	triggers := make(map[string][]Trigger)
+	add := func(dir string, files []string, root bool) {
+		if _, ok := matched[dir]; ok {
+			return
+		}
+		var m []string
+		for _, p := range absPaths {
+			if !output.changeAffects(dir, files, p, root) {
+				continue
+			}
+			if !moduleContains(dir, files, p) {
+				deleted[dir] = append(deleted[dir], p)
+				continue
+			}
+			m = append(m, p)
+			triggers[dir] = append(triggers[dir], Trigger{File: p, Kind: ownTriggerKind(p)})
+		}
+		matched[dir] = m
+	}
+	add(output.RootModule.ResolvedPath, output.RootModule.Files, true)
+	for _, m := range output.LocalModules {
+		add(m.ResolvedPath, m.Files, false)
+	}
+	for _, m := range output.RemoteModules {
+		if m.ResolvedPath != "" {
+			add(m.ResolvedPath, m.Files, false)
+		}
+	}
+
+	// dependencyFiles holds, for each module calling an affected module,
+	// the changed files of the modules it calls.
+	dependencyFiles := make(map[string]map[string]bool)
+	addDependencyFiles := func(dir string, files []string) {
+		if dependencyFiles[dir] == nil {
+			dependencyFiles[dir] = make(map[string]bool)
+		}
+		for _, f := range files {
+			dependencyFiles[dir][f] = true
+		}
+	}
+	for dir, files := range deleted {
+		addDependencyFiles(dir, files)
+	}
+	if transitive {
+		for dir := range matched {
+			files := slices.Concat(matched[dir], deleted[dir])
+			if len(files) == 0 {
+				continue
+			}
+			for caller := range dependentDirs(dir, output) {
+				addDependencyFiles(caller, files)
+			}
+		}
+	}
+
+	var affected []AffectedModule
+	appendModule := func(name, kind, dir string) {
+		module := AffectedModule{Name: name, Kind: kind, ResolvedPath: dir, Triggers: slices.Clone(triggers[dir])}
+		switch {
+		case len(matched[dir]) > 0:
+			module.Impact, module.ChangedFiles = impactDirect, matched[dir]
+		case dependencyFiles[dir] != nil:
+			module.Impact = impactTransitive
+		default:
+			return
+		}
+		// In the order of changedFiles, skipping the module's own files.
+		seen := make(map[string]bool)
+		for _, p := range absPaths {
+			if dependencyFiles[dir][p] && !seen[p] && !slices.Contains(matched[dir], p) {
+				seen[p] = true
+				module.Triggers = append(module.Triggers, Trigger{File: p, Kind: triggerDependencyFile})
+			}
+		}
+		affected = append(affected, module)
+	}
+	appendModule("", kindRoot, output.RootModule.ResolvedPath)
+	for _, m := range output.LocalModules {
+		appendModule(m.Name, kindLocal, m.ResolvedPath)
+	}
+	for _, m := range output.RemoteModules {
+		if m.ResolvedPath != "" {
+			appendModule(m.Name, kindRemote, m.ResolvedPath)
+		}
+	}
+	return affected
+}
+
 func FilterRelatedFiles(allFiles []string, changedFiles []string, output *Output) []string {
 	cwd, _ := os.Getwd()
 
@@ -153,15 +878,21 @@ func FilterRelatedFiles(allFiles []string, changedFiles []string, output *Output
 	affectedModulePaths := make(map[string]bool)
 
 	for changedPath := range changedAbsPaths {
-		if isInDirectory(changedPath, output.RootModule.ResolvedPath) {
+		if output.changeAffects(output.RootModule.ResolvedPath, output.RootModule.Files, changedPath, true) {
 			affectedModulePaths[output.RootModule.ResolvedPath] = true
 		}
 
 		for _, localMod := range output.LocalModules {
-			if isInDirectory(changedPath, localMod.ResolvedPath) {
+			if output.changeAffects(localMod.ResolvedPath, localMod.Files, changedPath, false) {
 				affectedModulePaths[localMod.ResolvedPath] = true
 			}
 		}
+
+		for _, remoteMod := range output.RemoteModules {
+			if remoteMod.ResolvedPath != "" && output.changeAffects(remoteMod.ResolvedPath, remoteMod.Files, changedPath, false) {
+				affectedModulePaths[remoteMod.ResolvedPath] = true
+			}
+		}
 	}
 
 	var result []string
@@ -187,9 +918,30 @@ func FilterRelatedFiles(allFiles []string, changedFiles []string, output *Output
 		}
 	}
 
+	for _, remoteMod := range output.RemoteModules {
+		if remoteMod.ResolvedPath != "" && affectedModulePaths[remoteMod.ResolvedPath] {
+			for _, f := range remoteMod.Files {
+				if !seen[f] {
+					seen[f] = true
+					result = append(result, f)
+				}
+			}
+		}
+	}
+
 	return result
 }
 
+// toAbsPath resolves a changed-file path relative to the working directory.
+func toAbsPath(f string) string {
+	if !filepath.IsAbs(f) {
+		cwd, _ := os.Getwd()
+		f = filepath.Join(cwd, f)
+	}
+	absPath, _ := filepath.Abs(f)
+	return absPath
+}
+
 func isInDirectory(filePath, dirPath string) bool {
 	rel, err := filepath.Rel(dirPath, filePath)
 	if err != nil {
@@ -198,6 +950,40 @@ func isInDirectory(filePath, dirPath string) bool {
 	return !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && rel != ".."
 }
 
+// writeFilesByModule prints each file as module_path<TAB>file, where the
+// module is the module of outputs whose files include it. Files matched by
+// include globs or linked from outside a module may be in a subdirectory
+// of it or beside it, so the owner is not the parent directory; a file of
+// several modules is printed once for each of them.
+func writeFilesByModule(w io.Writer, files []string, outputs []*Output) {
+	owners := make(map[string][]string)
+	addOwner := func(dir string, files []string) {
+		for _, f := range files {
+			if !slices.Contains(owners[f], dir) {
+				owners[f] = append(owners[f], dir)
+			}
+		}
+	}
+	for _, output := range outputs {
+		addOwner(output.RootModule.ResolvedPath, output.RootModule.Files)
+		for _, m := range output.LocalModules {
+			addOwner(m.ResolvedPath, m.Files)
+		}
+		for _, m := range output.RemoteModules {
+			addOwner(m.ResolvedPath, m.Files)
+		}
+	}
+	for _, f := range files {
+		dirs := owners[f]
+		if len(dirs) == 0 {
+			dirs = []string{filepath.Dir(f)}
+		}
+		for _, dir := range dirs {
+			fmt.Fprintf(w, "%s\t%s\n", dir, f)
+		}
+	}
+}
+
 func CollectAllFiles(output *Output) []string {
 	seen := make(map[string]bool)
 	var files []string
@@ -218,106 +1004,524 @@ func CollectAllFiles(output *Output) []string {
 		}
 	}
 
+	for _, m := range output.RemoteModules {
+		for _, f := range m.Files {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+
 	return files
 }
 
+// AnalyzeOptions controls optional behaviour of AnalyzeWithOptions.
+type AnalyzeOptions struct {
+	// Graph is a previously exported module graph. Directories whose
+	// content hash matches a node in it reuse the node's module calls
+	// instead of being parsed again.
+	Graph *Graph
+
+	// Cache, when set, supplies and records parsed module calls keyed by
+	// directory content hash.
+	Cache *Cache
+
+	// FS, when set, is read instead of the local disk.
+	FS *MappedFS
+
+	// Concurrency is the number of module directories loaded in parallel.
+	// Values below 2 load directories one at a time while walking.
+	Concurrency int
+
+	// MaxDepth, when positive, is the deepest level of nested module calls
+	// that is followed; the root module's calls are level 1. Calls below it
+	// are not listed and are reported as max_depth_reached diagnostics.
+	MaxDepth int
+
+	// IncludeDownloaded resolves remote module calls to the copies that
+	// terraform init installed under the root's .terraform/modules, so
+	// their files and hashes are reported like those of local modules.
+	// Modules called by a downloaded module are not followed.
+	IncludeDownloaded bool
+
+	// Replace maps remote module sources to local directories that are
+	// analyzed in their place, as loaded from Config.Replace.
+	Replace map[string]string
+
+	// IncludeGlobs are globs, relative to each module directory, of files
+	// other than Terraform files that belong to every module, such as
+	// templates/** for templatefile templates. Matching files are listed
+	// in the module's files, and changes to them affect the module even
+	// outside its directory. They do not change the module's hash.
+	IncludeGlobs []string
+
+	// ModuleIncludeGlobs maps module directories to include globs of that
+	// module only, as loaded from Config.IncludeGlobs.
+	ModuleIncludeGlobs map[string][]string
+
+	// RootFiles enables or disables the classes of files that only affect
+	// the root module, such as lock, as loaded from Config.RootFiles.
+	// Classes that are not listed are enabled.
+	RootFiles map[string]bool
+
+	// FailOnMissingModule makes a local module source that cannot be read
+	// fail the analysis with an error wrapping errMissingModule, instead of
+	// being skipped with a missing_module diagnostic.
+	FailOnMissingModule bool
+
+	// Progress, when set, receives the number of module directories
+	// discovered and loaded so far.
+	Progress *Progress
+}
+
+// errMissingModule reports a local module source that cannot be read when
+// AnalyzeOptions.FailOnMissingModule is set.
+var errMissingModule = errors.New("local module cannot be read")
+
+// analyzer holds the state of a single analysis run.
+type analyzer struct {
+	ctx           context.Context
+	opts          AnalyzeOptions
+	fs            fileSystem
+	rootDir       string
+	cached        map[string]*GraphNode
+	visited       map[string]bool
+	truncated     map[string]bool
+	downloaded    map[string]downloadedModule
+	localModules  []ModuleDetail
+	remoteModules []RemoteModule
+	unresolvable  []Unresolvable
+	moved         []Moved
+	missing       []ModuleDetail
+	diagnostics   []Diagnostic
+	nodes         []GraphNode
+
+	mu     sync.Mutex
+	dirs   map[string]*loadedDir
+	loaded int
+}
+
+// loadedDir is everything read from disk for one module directory. It is
+// filled at most once per analysis, possibly by a prefetch worker.
+type loadedDir struct {
+	once     sync.Once
+	files    []string
+	filesErr error
+	included []string
+	hash     dirHash
+	hashErr  error
+	calls    []*moduleCall
+	callsErr error
+}
+
+// allFiles returns the Terraform files of the directory, the files matched
+// by include globs and the files outside the directory that links among
+// them point to, sorted by name.
+func (d *loadedDir) allFiles() []string {
+	if len(d.included) == 0 {
+		return d.files
+	}
+	files := slices.Concat(d.files, d.included)
+	sort.Strings(files)
+	return slices.Compact(files)
+}
+
+// dirHash is the content hash of a module directory. hash and files cover
+// its Terraform files, which determine its module calls, and content also
+// covers the files matched by include globs; it is the module's Hash.
+type dirHash struct {
+	hash    string
+	files   map[string]string
+	content string
+}
+
 func Analyze(dir string) (*Output, error) {
-	absDir, err := filepath.Abs(dir)
+	return AnalyzeWithOptions(dir, AnalyzeOptions{})
+}
+
+func AnalyzeWithOptions(dir string, opts AnalyzeOptions) (*Output, error) {
+	return AnalyzeContext(context.Background(), dir, opts)
+}
+
+// AnalyzeContext is AnalyzeWithOptions with cancellation: once ctx is done
+// no further directories are read and ctx's error is returned.
+func AnalyzeContext(ctx context.Context, dir string, opts AnalyzeOptions) (*Output, error) {
+	var fsys fileSystem = localFS{}
+	if opts.FS != nil {
+		fsys = opts.FS
+	}
+
+	absDir, err := fsys.abs(dir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	visited := make(map[string]bool)
-	localModules := []ModuleDetail{}
-	remoteModules := []RemoteModule{}
+	a := &analyzer{
+		ctx:           ctx,
+		opts:          opts,
+		fs:            fsys,
+		rootDir:       absDir,
+		cached:        opts.Graph.nodesByPath(absDir),
+		visited:       make(map[string]bool),
+		truncated:     make(map[string]bool),
+		dirs:          make(map[string]*loadedDir),
+		localModules:  []ModuleDetail{},
+		remoteModules: []RemoteModule{},
+	}
 
-	rootFiles, err := listTerraformFiles(absDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list terraform files in root: %w", err)
+	root := a.loadDir(absDir)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if root.filesErr != nil {
+		return nil, fmt.Errorf("failed to list terraform files in root: %w", root.filesErr)
+	}
+	if root.hashErr != nil {
+		return nil, fmt.Errorf("failed to hash terraform files in root: %w", root.hashErr)
 	}
 
 	rootModule := ModuleDetail{
 		ResolvedPath: absDir,
-		Files:        rootFiles,
+		Files:        root.allFiles(),
+		Hash:         root.hash.content,
 	}
 
-	err = analyzeRecursive(absDir, "", visited, &localModules, &remoteModules)
+	if opts.IncludeDownloaded {
+		a.downloaded, err = readDownloadedModules(fsys, absDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot read downloaded modules (run terraform init): %v\n", err)
+		}
+	}
+
+	a.prefetch(absDir)
+
+	err = a.analyzeRecursive(absDir, "", 0)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Output{
-		RootModule:    rootModule,
-		LocalModules:  localModules,
-		RemoteModules: remoteModules,
+		SchemaVersion:  outputSchemaVersion,
+		RootModule:     rootModule,
+		Backend:        loadBackend(fsys, absDir),
+		LocalModules:   a.localModules,
+		RemoteModules:  a.remoteModules,
+		Unresolvable:   a.unresolvable,
+		Moved:          a.moved,
+		Diagnostics:    a.diagnostics,
+		graph:          &Graph{Version: graphVersion, Nodes: a.nodes},
+		rootFiles:      opts.RootFiles,
+		deletedModules: a.missing,
 	}, nil
 }
 
-func analyzeRecursive(
-	dir string,
-	calledFrom string,
-	visited map[string]bool,
-	localModules *[]ModuleDetail,
-	remoteModules *[]RemoteModule,
-) error {
+// analyzeRecursive records the module calls of dir, which is depth levels
+// below the root module and has the module key key (empty for the root),
+// and follows its local calls.
+func (a *analyzer) analyzeRecursive(dir string, key string, depth int) error {
 	absDir, err := filepath.Abs(dir)
 	if err != nil {
 		return err
 	}
 
-	if visited[absDir] {
+	if a.visited[absDir] {
 		return nil
 	}
-	visited[absDir] = true
 
-	module, diags := tfconfig.LoadModule(absDir)
-	if diags.HasErrors() {
-		return fmt.Errorf("failed to load module %s: %s", absDir, diags.Error())
+	if err := a.ctx.Err(); err != nil {
+		return err
+	}
+
+	loaded := a.loadDir(absDir)
+	if loaded.callsErr != nil {
+		return loaded.callsErr
 	}
+	calls := loaded.calls
 
-	for name, call := range module.ModuleCalls {
-		if isLocalPath(call.Source) {
-			resolvedPath := filepath.Join(absDir, call.Source)
-			resolvedPath, _ = filepath.Abs(resolvedPath)
+	if a.opts.MaxDepth > 0 && depth >= a.opts.MaxDepth {
+		// The directory may still be reached at a shallower depth later, so
+		// it is not marked visited; truncated only avoids repeating the
+		// diagnostics.
+		if !a.truncated[absDir] {
+			a.truncated[absDir] = true
+			for _, call := range calls {
+				a.diagnostics = append(a.diagnostics, callDiagnostic(call.ModuleCall, severityWarning, codeMaxDepth,
+					fmt.Sprintf("module call not followed: maximum depth %d reached", a.opts.MaxDepth)))
+			}
+		}
+		return nil
+	}
+	a.visited[absDir] = true
+	a.moved = append(a.moved, loadMoved(a.fs, absDir, key)...)
+	a.nodes = append(a.nodes, newGraphNode(a.rootDir, absDir, loaded.hash.hash, loaded.hash.files, calls))
+
+	caller := key[strings.LastIndex(key, ".")+1:]
+	if caller == "" {
+		caller = "(root)"
+	}
+
+	for _, call := range calls {
+		if err := a.ctx.Err(); err != nil {
+			return err
+		}
 
-			files, err := listTerraformFiles(resolvedPath)
+		name := call.Name
+		if call.SourceExpression != "" {
+			a.unresolvable = append(a.unresolvable, Unresolvable{
+				Name:       name,
+				Expression: call.SourceExpression,
+				CalledFrom: caller,
+				CallerPath: absDir,
+				Filename:   call.Pos.Filename,
+				Line:       call.Pos.Line,
+			})
+			a.diagnostics = append(a.diagnostics, callDiagnostic(call.ModuleCall, severityError, codeUnresolvable,
+				fmt.Sprintf("module source %s is not a literal string and cannot be resolved", call.SourceExpression)))
+			continue
+		}
+		if resolvedPath, replaced, ok := resolveModuleDir(absDir, call.Source, a.opts.Replace); ok {
+			module := a.loadDir(resolvedPath)
+			files, err := module.files, module.filesErr
 			if err != nil {
+				if a.opts.FailOnMissingModule {
+					return fmt.Errorf("%s:%d: module %q: %w: %s: %v", call.Pos.Filename, call.Pos.Line, name, errMissingModule, resolvedPath, err)
+				}
 				fmt.Fprintf(os.Stderr, "Warning: cannot read %s: %v\n", resolvedPath, err)
+				a.diagnostics = append(a.diagnostics, callDiagnostic(call.ModuleCall, severityError, codeMissingModule,
+					fmt.Sprintf("local module path %s cannot be read: %v", resolvedPath, err)))
+				a.missing = append(a.missing, ModuleDetail{Name: name, Source: call.Source, ResolvedPath: resolvedPath, CalledFrom: caller, CallerPath: absDir})
 				continue
 			}
+			if len(files) == 0 {
+				a.diagnostics = append(a.diagnostics, callDiagnostic(call.ModuleCall, severityError, codeEmptyModule,
+					fmt.Sprintf("local module path %s contains no Terraform files", resolvedPath)))
+			}
 
-			*localModules = append(*localModules, ModuleDetail{
+			a.localModules = append(a.localModules, ModuleDetail{
 				Name:         name,
 				Source:       call.Source,
 				ResolvedPath: resolvedPath,
-				Files:        files,
+				Files:        module.allFiles(),
+				Hash:         module.hash.content,
+				CalledFrom:   caller,
+				CallerPath:   absDir,
+				Replaced:     replaced,
+				Repetition:   call.Repetition,
+				Providers:    call.Providers,
+				Overrides:    call.Overrides,
 			})
 
-			err = analyzeRecursive(resolvedPath, name, visited, localModules, remoteModules)
+			err = a.analyzeRecursive(resolvedPath, moduleKey(key, name), depth+1)
+			if err != nil && (a.ctx.Err() != nil || errors.Is(err, errMissingModule)) {
+				return err
+			}
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: failed to analyze %s: %v\n", resolvedPath, err)
 			}
 		} else {
-			caller := calledFrom
-			if caller == "" {
-				caller = "(root)"
+			if isRegistrySource(call.Source) {
+				if err := validateRegistrySource(call.Source); err != nil {
+					a.diagnostics = append(a.diagnostics, callDiagnostic(call.ModuleCall, severityError, codeInvalidSource,
+						fmt.Sprintf("malformed registry source %q: %v", call.Source, err)))
+				} else if call.Version == "" {
+					a.diagnostics = append(a.diagnostics, callDiagnostic(call.ModuleCall, severityWarning, codeUnpinned,
+						"registry module has no version constraint"))
+				}
+			} else if isGitSource(call.Source) && gitRef(call.Source) == "" {
+				a.diagnostics = append(a.diagnostics, callDiagnostic(call.ModuleCall, severityWarning, codeUnpinned,
+					"git module source has no ref"))
 			}
-			*remoteModules = append(*remoteModules, RemoteModule{
+
+			remote := RemoteModule{
 				Name:       name,
 				Source:     call.Source,
 				Version:    call.Version,
 				CalledFrom: caller,
-			})
+				CallerPath: absDir,
+				Repetition: call.Repetition,
+				Providers:  call.Providers,
+				Overrides:  call.Overrides,
+			}
+			if isRegistrySource(call.Source) {
+				_, remote.Subdir = splitSourceSubdir(call.Source)
+				remote.Registry, _ = parseRegistrySource(call.Source)
+			} else {
+				remote.URL, remote.Subdir, remote.Ref = parseRemoteSource(call.Source)
+			}
+			if downloaded, ok := a.downloaded[moduleKey(key, name)]; ok {
+				module := a.loadDir(downloaded.dir)
+				if module.filesErr != nil {
+					fmt.Fprintf(os.Stderr, "Warning: cannot read %s: %v\n", downloaded.dir, module.filesErr)
+				} else {
+					remote.ResolvedPath = downloaded.dir
+					remote.Files = module.allFiles()
+					remote.Hash = module.hash.content
+					remote.InstalledVersion = downloaded.version
+					remote.License = detectLicense(a.fs, downloaded.dir, packageRoot(downloaded.dir, remote.Subdir))
+				}
+			}
+			a.remoteModules = append(a.remoteModules, remote)
 		}
 	}
 
 	return nil
 }
 
+// prefetch loads every local module directory reachable from dir using up
+// to opts.Concurrency workers, so that the sequential walk in
+// analyzeRecursive only reads memoized results and keeps its output order.
+func (a *analyzer) prefetch(dir string) {
+	if a.opts.Concurrency < 2 {
+		return
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = map[string]bool{dir: true}
+		sem  = make(chan struct{}, a.opts.Concurrency)
+	)
+	var visit func(dir string, depth int)
+	visit = func(dir string, depth int) {
+		defer wg.Done()
+		sem <- struct{}{}
+		loaded := a.loadDir(dir)
+		<-sem
+
+		if a.opts.MaxDepth > 0 && depth >= a.opts.MaxDepth {
+			return
+		}
+		for _, call := range loaded.calls {
+			target, _, ok := resolveModuleDir(dir, call.Source, a.opts.Replace)
+			if !ok {
+				continue
+			}
+			mu.Lock()
+			if !seen[target] {
+				seen[target] = true
+				wg.Add(1)
+				go visit(target, depth+1)
+			}
+			mu.Unlock()
+		}
+	}
+
+	wg.Add(1)
+	go visit(dir, 0)
+	wg.Wait()
+}
+
+// loadDir lists, hashes and parses dir at most once per analysis. Module
+// calls are ordered by their position in the directory's files.
+func (a *analyzer) loadDir(dir string) *loadedDir {
+	a.mu.Lock()
+	d, ok := a.dirs[dir]
+	if !ok {
+		d = &loadedDir{}
+		a.dirs[dir] = d
+	}
+	a.mu.Unlock()
+
+	d.once.Do(func() {
+		defer a.reportLoaded(dir)
+		if err := a.ctx.Err(); err != nil {
+			d.filesErr, d.hashErr, d.callsErr = err, err, err
+			return
+		}
+
+		d.files, d.filesErr = listTerraformFilesIn(a.fs, dir)
+		if d.filesErr != nil {
+			d.callsErr = d.filesErr
+			return
+		}
+		if globs := slices.Concat(a.opts.IncludeGlobs, a.opts.ModuleIncludeGlobs[dir]); len(globs) > 0 {
+			d.included, d.filesErr = includedFiles(a.fs, dir, globs)
+			if d.filesErr != nil {
+				d.callsErr = d.filesErr
+				return
+			}
+		}
+		// Linked files are hashed through the links to them.
+		globbed := d.included
+		d.included = append(slices.Clip(globbed), linkedFiles(a.fs, dir, d.allFiles())...)
+
+		hash, fileHashes, err := hashModuleDirIn(a.fs, dir)
+		if err != nil {
+			d.hashErr, d.callsErr = err, err
+			return
+		}
+		content, err := hashIncludedFiles(a.fs, dir, hash, globbed)
+		if err != nil {
+			d.hashErr, d.callsErr = err, err
+			return
+		}
+		d.hash = dirHash{hash: hash, files: fileHashes, content: content}
+
+		d.calls, d.callsErr = a.parseModuleCalls(dir, hash)
+		sort.Slice(d.calls, func(i, j int) bool {
+			pi, pj := d.calls[i].Pos, d.calls[j].Pos
+			if pi.Filename != pj.Filename {
+				return pi.Filename < pj.Filename
+			}
+			if pi.Line != pj.Line {
+				return pi.Line < pj.Line
+			}
+			return d.calls[i].Name < d.calls[j].Name
+		})
+	})
+	return d
+}
+
+// reportLoaded counts dir as loaded and reports the analysis progress.
+func (a *analyzer) reportLoaded(dir string) {
+	a.mu.Lock()
+	a.loaded++
+	loaded, discovered := a.loaded, len(a.dirs)
+	a.mu.Unlock()
+	a.opts.Progress.Update("loaded %d of %d module directories: %s", loaded, discovered, dir)
+}
+
+// parseModuleCalls returns the module calls declared in dir, reusing a
+// cached graph node or cache entry when its content hash is unchanged.
+func (a *analyzer) parseModuleCalls(dir, hash string) ([]*moduleCall, error) {
+	if node, ok := a.cached[dir]; ok && node.Hash == hash {
+		return node.moduleCalls(dir), nil
+	}
+	if calls, ok := a.opts.Cache.lookup(hash, dir); ok {
+		return calls, nil
+	}
+
+	calls, err := loadModuleCalls(a.fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	if a.opts.Cache != nil {
+		a.opts.Cache.store(hash, calls)
+	}
+	return calls, nil
+}
+
+func callDiagnostic(call *tfconfig.ModuleCall, severity, code, message string) Diagnostic {
+	return Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Message:  message,
+		Module:   call.Name,
+		Source:   call.Source,
+		Filename: call.Pos.Filename,
+		Line:     call.Pos.Line,
+	}
+}
+
 func listTerraformFiles(dir string) ([]string, error) {
-	var files []string
+	return listTerraformFilesIn(localFS{}, dir)
+}
+
+func listTerraformFilesIn(fsys fileSystem, dir string) ([]string, error) {
+	files := []string{}
 
-	entries, err := os.ReadDir(dir)
+	entries, err := fsys.readDir(dir)
 	if err != nil {
 		return nil, err
 	}
@@ -326,15 +1530,22 @@ func listTerraformFiles(dir string) ([]string, error) {
 		if entry.IsDir() {
 			continue
 		}
-		name := entry.Name()
-		if strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json") {
-			files = append(files, filepath.Join(dir, name))
+		if isTerraformFile(entry.Name()) {
+			files = append(files, filepath.Join(dir, entry.Name()))
 		}
 	}
 
+	// Directory listings are usually sorted already, but not every
+	// fileSystem guarantees it.
+	sort.Strings(files)
 	return files, nil
 }
 
+// isTerraformFile reports whether name is a Terraform configuration file.
+func isTerraformFile(name string) bool {
+	return strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json")
+}
+
 func isLocalPath(source string) bool {
 	return strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")
 }
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -411,3 +418,614 @@ func TestIsLocalPath(t *testing.T) {
 		})
 	}
 }
+
+// writeTestFiles creates each file (path relative to dir) with the given
+// content, creating parent directories as needed.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAffectedModules(t *testing.T) {
+	tempDir := t.TempDir()
+	rootDir := filepath.Join(tempDir, "root")
+	moduleDir := filepath.Join(tempDir, "modules", "vpc")
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": "",
+	})
+
+	output, err := Analyze(rootDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	changed := []string{filepath.Join(moduleDir, "main.tf"), "/some/other/path/file.tf"}
+	affected := AffectedModules(changed, output)
+
+	if len(affected) != 1 {
+		t.Fatalf("expected 1 affected module, got %+v", affected)
+	}
+	if affected[0].Name != "vpc" || affected[0].Kind != kindLocal || affected[0].ResolvedPath != moduleDir {
+		t.Errorf("unexpected affected module %+v", affected[0])
+	}
+	if len(affected[0].ChangedFiles) != 1 || affected[0].ChangedFiles[0] != filepath.Join(moduleDir, "main.tf") {
+		t.Errorf("unexpected changed files %v", affected[0].ChangedFiles)
+	}
+}
+
+func TestImpactedModules(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf":        `module "app" { source = "../modules/app" }`,
+		"modules/app/main.tf": `module "vpc" { source = "../vpc" }`,
+		"modules/vpc/main.tf": "",
+		"modules/dns/main.tf": "",
+	})
+
+	output, err := Analyze(filepath.Join(tempDir, "root"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	impacted := ImpactedModules([]string{filepath.Join(tempDir, "modules", "vpc", "main.tf")}, output)
+	var got []string
+	for _, m := range impacted {
+		got = append(got, m.Kind+":"+m.Name+":"+m.Impact)
+	}
+	expected := []string{"root::transitive", "local:app:transitive", "local:vpc:direct"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	if len(impacted[0].ChangedFiles) != 0 || len(impacted[2].ChangedFiles) != 1 {
+		t.Errorf("expected changed files only on the direct module, got %+v", impacted)
+	}
+
+	var text bytes.Buffer
+	writeAffectedModules(&text, impacted[2:])
+	if want := "local\tvpc\t" + filepath.Join(tempDir, "modules", "vpc") + "\tdirect\n"; text.String() != want {
+		t.Errorf("expected %q, got %q", want, text.String())
+	}
+}
+
+func TestImpactedModules_Triggers(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "app" {
+  source = "../modules/app"
+}
+
+module "dns" {
+  source = "../modules/dns"
+}
+`,
+		"root/prod.tfvars":                 "name = \"prod\"\n",
+		"root/.terraform.lock.hcl":         "# lock\n",
+		"modules/app/main.tf":              `module "vpc" { source = "../vpc" }`,
+		"modules/app/app.auto.tfvars.json": `{}`,
+		"modules/vpc/main.tf":              "",
+	})
+	output, err := Analyze(filepath.Join(tempDir, "root"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	path := func(name string) string { return filepath.Join(tempDir, filepath.FromSlash(name)) }
+	changed := []string{
+		path("modules/vpc/main.tf"),
+		path("root/prod.tfvars"),
+		path("root/.terraform.lock.hcl"),
+		path("modules/app/main.tf"),
+		path("modules/app/app.auto.tfvars.json"),
+		path("modules/dns/main.tf"), // deleted with the dns module
+	}
+	triggers := make(map[string][]Trigger)
+	for _, m := range ImpactedModules(changed, output) {
+		triggers[m.Kind+":"+m.Name] = m.Triggers
+	}
+	expected := map[string][]Trigger{
+		"root:": {
+			{File: path("root/prod.tfvars"), Kind: triggerTfvars},
+			{File: path("root/.terraform.lock.hcl"), Kind: triggerLockfile},
+			{File: path("modules/vpc/main.tf"), Kind: triggerDependencyFile},
+			{File: path("modules/app/main.tf"), Kind: triggerDependencyFile},
+			{File: path("modules/app/app.auto.tfvars.json"), Kind: triggerDependencyFile},
+			{File: path("modules/dns/main.tf"), Kind: triggerDependencyFile},
+		},
+		"local:app": {
+			{File: path("modules/app/main.tf"), Kind: triggerOwnFile},
+			{File: path("modules/app/app.auto.tfvars.json"), Kind: triggerTfvars},
+			{File: path("modules/vpc/main.tf"), Kind: triggerDependencyFile},
+		},
+		"local:vpc": {
+			{File: path("modules/vpc/main.tf"), Kind: triggerOwnFile},
+		},
+	}
+	if !reflect.DeepEqual(triggers, expected) {
+		t.Errorf("expected triggers %+v, got %+v", expected, triggers)
+	}
+
+	// Without transitive impact, only the modules' own files trigger them.
+	for _, m := range AffectedModules(changed, output) {
+		for _, trigger := range m.Triggers {
+			if trigger.Kind == triggerDependencyFile && m.Kind != kindRoot {
+				t.Errorf("unexpected dependency trigger %+v of %s", trigger, m.ResolvedPath)
+			}
+		}
+	}
+}
+
+func TestAnalyze_ModuleHashes(t *testing.T) {
+	tempDir := t.TempDir()
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"a/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+`,
+		"b/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `resource "aws_vpc" "main" {}`,
+	})
+
+	outputA, err := Analyze(filepath.Join(tempDir, "a"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	outputB, err := Analyze(filepath.Join(tempDir, "b"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	if outputA.RootModule.Hash == "" || outputA.LocalModules[0].Hash == "" {
+		t.Fatal("expected root and local module hashes")
+	}
+	if outputA.RootModule.Hash != outputB.RootModule.Hash {
+		t.Error("expected identical content in different directories to hash the same")
+	}
+
+	vpcHash := outputA.LocalModules[0].Hash
+	if err := os.WriteFile(filepath.Join(tempDir, "modules", "vpc", "main.tf"), []byte(`resource "aws_vpc" "other" {}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := Analyze(filepath.Join(tempDir, "a"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if changed.LocalModules[0].Hash == vpcHash {
+		t.Error("expected module hash to change with its content")
+	}
+	if changed.RootModule.Hash != outputA.RootModule.Hash {
+		t.Error("expected root hash to be unaffected by a module change")
+	}
+}
+
+func TestAnalyze_ConcurrentMatchesSequential(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{}
+	rootMain := ""
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("m%d", i)
+		rootMain += fmt.Sprintf("module %q {\n  source = \"../modules/%s\"\n}\n", name, name)
+		files["modules/"+name+"/main.tf"] = `
+module "shared" {
+  source = "../shared"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`
+	}
+	files["root/main.tf"] = rootMain
+	files["modules/shared/main.tf"] = `variable "name" {}`
+	writeTestFiles(t, tempDir, files)
+
+	rootDir := filepath.Join(tempDir, "root")
+	sequential, err := Analyze(rootDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	concurrent, err := AnalyzeWithOptions(rootDir, AnalyzeOptions{Concurrency: 4})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(sequential, concurrent) {
+		t.Errorf("expected concurrent output to match sequential output\nsequential: %+v\nconcurrent: %+v", sequential, concurrent)
+	}
+	if len(concurrent.LocalModules) != 16 {
+		t.Errorf("expected 16 local module calls, got %d", len(concurrent.LocalModules))
+	}
+	if concurrent.LocalModules[0].Name != "m0" || concurrent.LocalModules[1].Name != "shared" {
+		t.Errorf("expected calls in source order, got %s, %s", concurrent.LocalModules[0].Name, concurrent.LocalModules[1].Name)
+	}
+}
+
+func TestAnalyze_DeterministicOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/z.tf": `
+module "b" {
+  source = "../modules/b"
+}
+`,
+		"root/a.tf": `
+module "remote_z" {
+  source = "git::https://example.com/z.git"
+}
+
+module "a" {
+  source = "../modules/a"
+}
+`,
+		"root/a.tf.json":         `{"module": {"remote_a": {"source": "git::https://example.com/a.git"}}}`,
+		"modules/a/variables.tf": `variable "x" {}`,
+		"modules/a/main.tf":      `variable "y" {}`,
+		"modules/b/main.tf":      `variable "z" {}`,
+	})
+	rootDir := filepath.Join(tempDir, "root")
+
+	output, err := Analyze(rootDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	var names []string
+	for _, m := range output.LocalModules {
+		names = append(names, m.Name)
+	}
+	for _, m := range output.RemoteModules {
+		names = append(names, m.Name)
+	}
+	if strings.Join(names, ",") != "a,b,remote_z,remote_a" {
+		t.Errorf("expected calls ordered by file and line, got %v", names)
+	}
+	if files := output.LocalModules[0].Files; len(files) != 2 || filepath.Base(files[0]) != "main.tf" || filepath.Base(files[1]) != "variables.tf" {
+		t.Errorf("expected sorted files, got %v", files)
+	}
+
+	graphPath := filepath.Join(tempDir, "graph.json")
+	if err := WriteGraph(graphPath, output); err != nil {
+		t.Fatalf("WriteGraph failed: %v", err)
+	}
+	graph, err := ReadGraph(graphPath)
+	if err != nil {
+		t.Fatalf("ReadGraph failed: %v", err)
+	}
+	cache := NewCache()
+
+	want, _ := json.Marshal(output)
+	for _, opts := range []AnalyzeOptions{{}, {Concurrency: 8}, {Graph: graph}, {Cache: cache}, {Cache: cache, Concurrency: 8}} {
+		output, err := AnalyzeWithOptions(rootDir, opts)
+		if err != nil {
+			t.Fatalf("Analyze failed: %v", err)
+		}
+		if got, _ := json.Marshal(output); !bytes.Equal(got, want) {
+			t.Errorf("expected identical output with %+v\nwant: %s\ngot:  %s", opts, want, got)
+		}
+	}
+}
+
+func TestAnalyze_MaxDepth(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "a" {
+  source = "./modules/a"
+}
+`,
+		"modules/a/main.tf": `
+module "b" {
+  source = "../b"
+}
+`,
+		"modules/b/main.tf": `
+module "c" {
+  source = "../c"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+		"modules/c/main.tf": `variable "name" {}`,
+	})
+
+	for _, concurrency := range []int{1, 4} {
+		output, err := AnalyzeWithOptions(tempDir, AnalyzeOptions{MaxDepth: 2, Concurrency: concurrency})
+		if err != nil {
+			t.Fatalf("Analyze failed: %v", err)
+		}
+
+		var names []string
+		for _, m := range output.LocalModules {
+			names = append(names, m.Name)
+		}
+		if !reflect.DeepEqual(names, []string{"a", "b"}) {
+			t.Errorf("expected local modules [a b], got %v", names)
+		}
+		if len(output.RemoteModules) != 0 {
+			t.Errorf("expected no remote modules below the depth limit, got %+v", output.RemoteModules)
+		}
+
+		var truncated []string
+		for _, d := range output.Diagnostics {
+			if d.Code == codeMaxDepth {
+				truncated = append(truncated, d.Module)
+			}
+		}
+		if !reflect.DeepEqual(truncated, []string{"c", "label"}) {
+			t.Errorf("expected max depth diagnostics for [c label], got %v", truncated)
+		}
+	}
+
+	output, err := Analyze(tempDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(output.LocalModules) != 3 || len(output.Diagnostics) != 0 {
+		t.Errorf("expected no limit by default, got %d local modules and %+v", len(output.LocalModules), output.Diagnostics)
+	}
+}
+
+func TestAnalyze_RemoteSourceFields(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source = "github.com/org/network//modules/vpc?ref=v1.2.0"
+}
+
+module "iam" {
+  source  = "terraform-aws-modules/iam/aws//modules/iam-user"
+  version = "5.0.0"
+}
+`,
+	})
+
+	output, err := Analyze(tempDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	vpc, iam := output.RemoteModules[0], output.RemoteModules[1]
+	if vpc.URL != "https://github.com/org/network.git" || vpc.Subdir != "modules/vpc" || vpc.Ref != "v1.2.0" {
+		t.Errorf("unexpected git source fields %+v", vpc)
+	}
+	if iam.URL != "" || iam.Subdir != "modules/iam-user" || iam.Ref != "" {
+		t.Errorf("unexpected registry source fields %+v", iam)
+	}
+	if vpc.Registry != nil || iam.Registry == nil || iam.Registry.Address != "registry.terraform.io/terraform-aws-modules/iam/aws" {
+		t.Errorf("expected only iam to have a normalized registry address, got %+v and %+v", vpc.Registry, iam.Registry)
+	}
+}
+
+func TestAnalyzeContext_Cancelled(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source = "./modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := AnalyzeContext(ctx, tempDir, AnalyzeOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := AnalyzeContext(ctx, tempDir, AnalyzeOptions{Concurrency: 4}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled with concurrency, got %v", err)
+	}
+}
+
+func TestAnalyze_FailOnMissingModule(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "app" {
+  source = "./modules/app"
+}
+`,
+		"modules/app/main.tf": `
+module "gone" {
+  source = "../gone"
+}
+`,
+	})
+
+	output, err := Analyze(tempDir)
+	if err != nil {
+		t.Fatalf("expected the missing module to be skipped, got %v", err)
+	}
+	if len(output.Diagnostics) != 1 || output.Diagnostics[0].Code != codeMissingModule {
+		t.Errorf("expected a missing module diagnostic, got %+v", output.Diagnostics)
+	}
+
+	for _, concurrency := range []int{0, 4} {
+		_, err := AnalyzeWithOptions(tempDir, AnalyzeOptions{Concurrency: concurrency, FailOnMissingModule: true})
+		if !errors.Is(err, errMissingModule) {
+			t.Fatalf("expected errMissingModule with concurrency %d, got %v", concurrency, err)
+		}
+		callSite := filepath.Join(tempDir, "modules", "app", "main.tf") + ":2"
+		if !strings.Contains(err.Error(), callSite) || !strings.Contains(err.Error(), `"gone"`) {
+			t.Errorf("expected the error to name the call at %s, got %v", callSite, err)
+		}
+	}
+}
+
+func TestAnalyze_UnresolvableSources(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+locals {
+  base = "./modules"
+}
+
+module "vpc" {
+  source = "./modules/vpc"
+}
+
+module "templated" {
+  source = "${local.base}/vpc"
+}
+
+module "variable" {
+  source = var.source
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+
+	cache := NewCache()
+	for _, opts := range []AnalyzeOptions{{}, {Cache: cache}, {Cache: cache}} {
+		output, err := AnalyzeWithOptions(tempDir, opts)
+		if err != nil {
+			t.Fatalf("Analyze failed: %v", err)
+		}
+		if len(output.LocalModules) != 1 || len(output.RemoteModules) != 0 {
+			t.Errorf("expected only the literal source to be resolved, got %+v and %+v", output.LocalModules, output.RemoteModules)
+		}
+		expected := []Unresolvable{
+			{Name: "templated", Expression: `"${local.base}/vpc"`, CalledFrom: "(root)", CallerPath: tempDir, Filename: filepath.Join(tempDir, "main.tf"), Line: 10},
+			{Name: "variable", Expression: "var.source", CalledFrom: "(root)", CallerPath: tempDir, Filename: filepath.Join(tempDir, "main.tf"), Line: 14},
+		}
+		if !reflect.DeepEqual(output.Unresolvable, expected) {
+			t.Errorf("expected %+v, got %+v", expected, output.Unresolvable)
+		}
+		if len(output.Diagnostics) != 2 || output.Diagnostics[0].Code != codeUnresolvable {
+			t.Errorf("expected unresolvable_source diagnostics, got %+v", output.Diagnostics)
+		}
+	}
+	if cache.hits == 0 {
+		t.Error("expected the cached module calls to be reused")
+	}
+}
+
+func TestAnalyze_OverrideFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "app" {
+  source   = "./modules/app"
+  for_each = toset(["a", "b"])
+}
+
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "5.0.0"
+}
+
+module "dns" {
+  source = "git::https://example.com/dns.git?ref=v1"
+}
+`,
+		"override.tf": `
+module "app" {
+  source = "./modules/app-v2"
+}
+`,
+		"vpc_override.tf.json": `{"module": {"vpc": {"version": "5.1.0"}}}`,
+		"z_override.tf": `
+module "vpc" {
+  source = "terraform-aws-modules/vpc/aws//modules/endpoints"
+  count  = 1
+}
+`,
+		"modules/app/main.tf":    `variable "name" {}`,
+		"modules/app-v2/main.tf": `variable "name" {}`,
+	})
+
+	cache := NewCache()
+	for _, opts := range []AnalyzeOptions{{Cache: cache}, {Cache: cache}} {
+		output, err := AnalyzeWithOptions(tempDir, opts)
+		if err != nil {
+			t.Fatalf("Analyze failed: %v", err)
+		}
+		if len(output.LocalModules) != 1 {
+			t.Fatalf("expected one local module, got %+v", output.LocalModules)
+		}
+		app := output.LocalModules[0]
+		if app.ResolvedPath != filepath.Join(tempDir, "modules", "app-v2") || app.Repetition != "for_each" {
+			t.Errorf("expected the overridden source and the original for_each, got %+v", app)
+		}
+		expected := []ModuleOverride{{Filename: filepath.Join(tempDir, "override.tf"), Line: 2, Arguments: []string{"source"}}}
+		if !reflect.DeepEqual(app.Overrides, expected) {
+			t.Errorf("expected overrides %+v, got %+v", expected, app.Overrides)
+		}
+
+		if len(output.RemoteModules) != 2 {
+			t.Fatalf("expected two remote modules, got %+v", output.RemoteModules)
+		}
+		vpc, dns := output.RemoteModules[0], output.RemoteModules[1]
+		if vpc.Source != "terraform-aws-modules/vpc/aws//modules/endpoints" || vpc.Version != "5.1.0" || vpc.Repetition != "count" {
+			t.Errorf("expected the source, version and count of both overrides, got %+v", vpc)
+		}
+		expected = []ModuleOverride{
+			{Filename: filepath.Join(tempDir, "vpc_override.tf.json"), Line: 1, Arguments: []string{"version"}},
+			{Filename: filepath.Join(tempDir, "z_override.tf"), Line: 2, Arguments: []string{"source", "count"}},
+		}
+		if !reflect.DeepEqual(vpc.Overrides, expected) {
+			t.Errorf("expected overrides %+v, got %+v", expected, vpc.Overrides)
+		}
+		if len(dns.Overrides) != 0 || len(output.Diagnostics) != 0 {
+			t.Errorf("expected no overrides of dns or diagnostics, got %+v and %+v", dns.Overrides, output.Diagnostics)
+		}
+	}
+}
+
+func TestWriteAffectedModules(t *testing.T) {
+	affected := []AffectedModule{
+		{Kind: kindRoot, ResolvedPath: "/repo/prod", ChangedFiles: []string{"/repo/prod/main.tf"}},
+		{Name: "vpc", Kind: kindLocal, ResolvedPath: "/repo/modules/vpc", ChangedFiles: []string{"/repo/modules/vpc/main.tf"}},
+	}
+
+	var text bytes.Buffer
+	writeAffectedModules(&text, affected)
+	expected := "root\t\t/repo/prod\nlocal\tvpc\t/repo/modules/vpc\n"
+	if text.String() != expected {
+		t.Errorf("expected %q, got %q", expected, text.String())
+	}
+
+	var jsonOutput bytes.Buffer
+	if err := writeAffectedModulesJSON(&jsonOutput, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(jsonOutput.String()) != "[]" {
+		t.Errorf("expected an empty JSON array, got %s", jsonOutput.String())
+	}
+}
+
+func TestWriteFilesByModule(t *testing.T) {
+	var buf bytes.Buffer
+	writeFilesByModule(&buf, []string{"/repo/prod/main.tf", "/repo/modules/vpc/main.tf", "/repo/modules/vpc/outputs.tf"}, nil)
+
+	expected := "/repo/prod\t/repo/prod/main.tf\n" +
+		"/repo/modules/vpc\t/repo/modules/vpc/main.tf\n" +
+		"/repo/modules/vpc\t/repo/modules/vpc/outputs.tf\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
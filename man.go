@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func runMan(args []string) int {
+	flags := newFlagSet("man")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s man\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Print the manual page of all commands in troff format.\n\n")
+		fmt.Fprintf(flags.Output(), "Examples:\n")
+		fmt.Fprintf(flags.Output(), "  %s man > %s.1 && man ./%s.1\n", os.Args[0], programName, programName)
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitError
+	}
+	writeManPage(os.Stdout, describeCommands())
+	return 0
+}
+
+// troffEscape escapes text for a troff line that starts with it.
+func troffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// writeManParagraphs writes description paragraphs. Paragraphs headed by a
+// line ending in a colon, such as examples, keep their line breaks.
+func writeManParagraphs(w io.Writer, paragraphs []string) {
+	for _, paragraph := range paragraphs {
+		lines := strings.Split(paragraph, "\n")
+		fmt.Fprintf(w, ".PP\n")
+		if len(lines) > 1 && strings.HasSuffix(lines[0], ":") {
+			fmt.Fprintf(w, "%s\n.RS\n.nf\n", troffEscape(lines[0]))
+			for _, line := range lines[1:] {
+				fmt.Fprintf(w, "%s\n", troffEscape(strings.TrimSpace(line)))
+			}
+			fmt.Fprintf(w, ".fi\n.RE\n")
+			continue
+		}
+		for _, line := range lines {
+			fmt.Fprintf(w, "%s\n", troffEscape(line))
+		}
+	}
+}
+
+func writeManFlags(w io.Writer, flags []*flag.Flag) {
+	for _, f := range flags {
+		fmt.Fprintf(w, ".TP\n\\fB\\-\\-%s\\fR", troffEscape(f.Name))
+		valueName, usage := flag.UnquoteUsage(f)
+		if !isBoolFlag(f) {
+			fmt.Fprintf(w, " \\fI%s\\fR", troffEscape(valueName))
+		}
+		fmt.Fprintf(w, "\n%s", troffEscape(usage))
+		switch f.DefValue {
+		case "", "false", "0", "0s":
+		default:
+			fmt.Fprintf(w, " (default: %s)", troffEscape(f.DefValue))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// writeManPage writes a section 1 manual page for the default command and
+// every subcommand.
+func writeManPage(w io.Writer, commands []commandInfo) {
+	root := commands[0]
+	fmt.Fprintf(w, ".TH %s 1 \"\" %q\n", strings.ToUpper(troffEscape(programName)), programName+" "+toolVersion())
+	fmt.Fprintf(w, ".SH NAME\n%s \\- %s\n", troffEscape(programName), troffEscape(strings.ToLower(root.Summary()[:1])+root.Summary()[1:]))
+	fmt.Fprintf(w, ".SH SYNOPSIS\n.nf\n")
+	for _, line := range root.Synopsis {
+		fmt.Fprintf(w, "%s\n", troffEscape(line))
+	}
+	fmt.Fprintf(w, ".fi\n.SH DESCRIPTION\n")
+	writeManParagraphs(w, root.Description)
+	fmt.Fprintf(w, ".SH OPTIONS\n")
+	writeManFlags(w, root.Flags)
+
+	fmt.Fprintf(w, ".SH COMMANDS\n")
+	for _, c := range commands[1:] {
+		fmt.Fprintf(w, ".SS %s\n.nf\n", troffEscape(c.Name))
+		for _, line := range c.Synopsis {
+			fmt.Fprintf(w, "%s\n", troffEscape(line))
+		}
+		fmt.Fprintf(w, ".fi\n")
+		writeManParagraphs(w, c.Description)
+		writeManFlags(w, c.Flags)
+	}
+}
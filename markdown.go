@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// renderMarkdown writes a compact report suitable for a pull request
+// comment: the module tree, a table of remote modules and, when changed
+// files were provided, a table of affected modules.
+func renderMarkdown(w io.Writer, output *Output, opts renderOptions) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "### Terraform modules: `%s`\n\n", output.RootModule.ResolvedPath)
+
+	b.WriteString("<details><summary>Module tree</summary>\n\n")
+	writeMarkdownTree(&b, buildModuleTree(output), 0)
+	b.WriteString("\n</details>\n\n")
+
+	b.WriteString("#### Remote modules\n\n")
+	if len(output.RemoteModules) == 0 {
+		b.WriteString("No remote modules.\n")
+	} else {
+		b.WriteString("| Module | Source | Version | Called from |\n")
+		b.WriteString("|---|---|---|---|\n")
+		for _, r := range output.RemoteModules {
+			fmt.Fprintf(&b, "| %s | `%s` | %s | %s |\n",
+				markdownCell(r.Name), markdownCell(r.Source), markdownCell(r.Version), markdownCell(r.CalledFrom))
+		}
+	}
+
+	if opts.HasChanges {
+		b.WriteString("\n#### Affected modules\n\n")
+		if len(opts.Affected) == 0 {
+			b.WriteString("No modules affected.\n")
+		} else {
+			b.WriteString("| Module | Path | Impact | Changed files | Triggered by |\n")
+			b.WriteString("|---|---|---|---|---|\n")
+			for _, a := range opts.Affected {
+				name := a.Name
+				if a.Kind == kindRoot {
+					name = "(root)"
+				}
+				var triggers []string
+				for _, t := range a.Triggers {
+					triggers = append(triggers, fmt.Sprintf("`%s` (%s)", markdownCell(t.File), triggerLabel(t.Kind)))
+				}
+				fmt.Fprintf(&b, "| %s | `%s` | %s | %d | %s |\n", markdownCell(name), markdownCell(a.ResolvedPath), a.Impact, len(a.ChangedFiles), strings.Join(triggers, "<br>"))
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownTree(b *strings.Builder, node *moduleNode, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch {
+	case depth == 0:
+		fmt.Fprintf(b, "%s- **%s** `%s`\n", indent, node.Name, node.Path)
+	case node.Remote && node.Version != "":
+		fmt.Fprintf(b, "%s- **%s** `%s` `%s`\n", indent, node.Name, node.Source, node.Version)
+	default:
+		fmt.Fprintf(b, "%s- **%s** `%s`\n", indent, node.Name, node.Source)
+	}
+	for _, child := range node.Children {
+		writeMarkdownTree(b, child, depth+1)
+	}
+}
+
+// markdownCell escapes characters that would break a Markdown table cell.
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// triggerLabel returns the kind of a trigger as words, such as own file.
+func triggerLabel(kind string) string {
+	return strings.ReplaceAll(kind, "_", " ")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tempDir := t.TempDir()
+	rootDir := filepath.Join(tempDir, "root")
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+
+module "eks" {
+  source  = "terraform-aws-modules/eks/aws"
+  version = "~> 19.0"
+}
+`,
+		"modules/vpc/main.tf": `
+module "subnets" {
+  source = "./subnets"
+}
+`,
+		"modules/vpc/subnets/main.tf": "",
+	})
+
+	output, err := Analyze(rootDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	t.Run("without changes", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := renderMarkdown(&buf, output, renderOptions{}); err != nil {
+			t.Fatalf("renderMarkdown failed: %v", err)
+		}
+		md := buf.String()
+
+		for _, want := range []string{
+			"  - **vpc** `../modules/vpc`\n    - **subnets** `./subnets`\n",
+			"| eks | `terraform-aws-modules/eks/aws` | ~> 19.0 | (root) |\n",
+		} {
+			if !strings.Contains(md, want) {
+				t.Errorf("expected markdown to contain %q, got:\n%s", want, md)
+			}
+		}
+		if strings.Contains(md, "Affected modules") {
+			t.Errorf("did not expect affected section without changes:\n%s", md)
+		}
+	})
+
+	t.Run("with changes", func(t *testing.T) {
+		changed := []string{filepath.Join(tempDir, "modules", "vpc", "subnets", "main.tf")}
+		var buf bytes.Buffer
+		opts := renderOptions{Affected: ImpactedModules(changed, output), HasChanges: true}
+		if err := renderMarkdown(&buf, output, opts); err != nil {
+			t.Fatalf("renderMarkdown failed: %v", err)
+		}
+
+		for _, want := range []string{
+			"| subnets | `" + filepath.Join(tempDir, "modules", "vpc", "subnets") + "` | direct | 1 | `" + changed[0] + "` (own file) |\n",
+			"| (root) | `" + filepath.Join(tempDir, "root") + "` | transitive | 0 | `" + changed[0] + "` (dependency file) |\n",
+		} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("expected markdown to contain %q, got:\n%s", want, buf.String())
+			}
+		}
+	})
+}
+
+func TestBuildModuleTree_Cycle(t *testing.T) {
+	tempDir := t.TempDir()
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"module_a/main.tf": `
+module "b" {
+  source = "../module_b"
+}
+`,
+		"module_b/main.tf": `
+module "a" {
+  source = "../module_a"
+}
+`,
+	})
+
+	output, err := Analyze(filepath.Join(tempDir, "module_a"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	tree := buildModuleTree(output)
+	if len(tree.Children) != 1 || tree.Children[0].Name != "b" {
+		t.Fatalf("expected root to call b, got %+v", tree.Children)
+	}
+	b := tree.Children[0]
+	if len(b.Children) != 1 || b.Children[0].Name != "a" {
+		t.Fatalf("expected b to call a, got %+v", b.Children)
+	}
+	if len(b.Children[0].Children) != 0 {
+		t.Errorf("expected the cycle back to a to be cut, got %+v", b.Children[0].Children)
+	}
+}
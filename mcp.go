@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"sync"
+)
+
+// mcpProtocolVersion is the Model Context Protocol revision the server
+// implements. Clients requesting another revision are answered with this
+// one, as the specification allows.
+const mcpProtocolVersion = "2025-06-18"
+
+// JSON-RPC 2.0 error codes used by the MCP and language servers.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpTool is a tool advertised by tools/list. Call receives the raw
+// arguments object and returns a value that is sent back as JSON text.
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+
+	call func(args json.RawMessage) (any, error)
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// mcpTools are the tools exposed by the MCP server. Relative paths in
+// arguments are resolved against the server's working directory.
+var mcpTools = []mcpTool{
+	{
+		Name:        "analyze_module",
+		Description: "Resolve the local and remote modules called, directly or transitively, by a Terraform root module.",
+		InputSchema: objectSchema(map[string]any{
+			"directory": stringSchema("Path of the root module directory"),
+		}, "directory"),
+		call: func(raw json.RawMessage) (any, error) {
+			var args struct {
+				Directory string `json:"directory"`
+			}
+			if err := decodeToolArguments(raw, &args); err != nil {
+				return nil, err
+			}
+			return Analyze(args.Directory)
+		},
+	},
+	{
+		Name:        "affected_roots",
+		Description: "Discover the root modules under a directory and report which applications, environments and roots are affected by a list of changed files.",
+		InputSchema: objectSchema(map[string]any{
+			"directory": stringSchema("Directory to search for root modules"),
+			"changed_files": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Changed file paths, for example from git diff --name-only",
+			},
+			"overlap_precedence": map[string]any{
+				"type":        "string",
+				"enum":        []string{precedenceNearest, precedenceOutermost, precedenceAll},
+				"description": "Root that owns files of a nested root (default nearest)",
+			},
+		}, "directory", "changed_files"),
+		call: func(raw json.RawMessage) (any, error) {
+			var args struct {
+				Directory         string   `json:"directory"`
+				ChangedFiles      []string `json:"changed_files"`
+				OverlapPrecedence string   `json:"overlap_precedence"`
+			}
+			if err := decodeToolArguments(raw, &args); err != nil {
+				return nil, err
+			}
+			switch args.OverlapPrecedence {
+			case "":
+				args.OverlapPrecedence = precedenceNearest
+			case precedenceNearest, precedenceOutermost, precedenceAll:
+			default:
+				return nil, fmt.Errorf("invalid overlap_precedence %q", args.OverlapPrecedence)
+			}
+			discovery, err := Discover(args.Directory)
+			if err != nil {
+				return nil, err
+			}
+			return FindAffectedRoots(discovery, args.ChangedFiles, args.OverlapPrecedence), nil
+		},
+	},
+	{
+		Name:        "module_graph",
+		Description: "Return the module dependency graph of a Terraform root module: every module directory with its file hashes and module calls.",
+		InputSchema: objectSchema(map[string]any{
+			"directory": stringSchema("Path of the root module directory"),
+		}, "directory"),
+		call: func(raw json.RawMessage) (any, error) {
+			var args struct {
+				Directory string `json:"directory"`
+			}
+			if err := decodeToolArguments(raw, &args); err != nil {
+				return nil, err
+			}
+			output, err := Analyze(args.Directory)
+			if err != nil {
+				return nil, err
+			}
+			return output.graph, nil
+		},
+	},
+}
+
+func objectSchema(properties map[string]any, required ...string) map[string]any {
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
+
+func stringSchema(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+func decodeToolArguments(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func runMCP(args []string) int {
+	flags := newFlagSet("mcp")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s mcp\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Serve the analyzer as a Model Context Protocol server on stdin and stdout.\n")
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	if err := serveMCP(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return 0
+}
+
+// serveMCP answers newline-delimited JSON-RPC messages read from r until r
+// is exhausted, as described by the MCP stdio transport.
+func serveMCP(r io.Reader, w io.Writer) error {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	send := func(resp rpcResponse) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(resp)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			send(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+			continue
+		}
+		if req.ID == nil {
+			// Notifications such as notifications/initialized need no reply.
+			continue
+		}
+
+		result, rpcErr := handleMCPRequest(req)
+		send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr})
+	}
+	return scanner.Err()
+}
+
+func handleMCPRequest(req rpcRequest) (any, *rpcError) {
+	if req.JSONRPC != "2.0" {
+		return nil, &rpcError{Code: rpcInvalidRequest, Message: "jsonrpc must be \"2.0\""}
+	}
+
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "terraform-module-resolve", "version": toolVersion()},
+		}, nil
+
+	case "ping":
+		return map[string]any{}, nil
+
+	case "tools/list":
+		return map[string]any{"tools": mcpTools}, nil
+
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		for _, tool := range mcpTools {
+			if tool.Name == params.Name {
+				return callMCPTool(tool, params.Arguments), nil
+			}
+		}
+		return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+	}
+}
+
+// callMCPTool runs tool and wraps its result, or its error, as text
+// content. Tool errors are reported in the result so the model can see them.
+func callMCPTool(tool mcpTool, args json.RawMessage) mcpToolResult {
+	value, err := tool.call(args)
+	if err != nil {
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}
+	}
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: string(data)}}}
+}
+
+// toolVersion returns the module version the binary was built from, or
+// "(devel)" for local builds.
+func toolVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
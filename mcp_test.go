@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeMCP(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+	})
+
+	call := func(id int, name string, args map[string]any) string {
+		params, _ := json.Marshal(map[string]any{"name": name, "arguments": args})
+		req, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "method": "tools/call", "params": json.RawMessage(params)})
+		return string(req)
+	}
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		call(3, "analyze_module", map[string]any{"directory": filepath.Join(tempDir, "envs", "prod")}),
+		call(4, "affected_roots", map[string]any{"directory": tempDir, "changed_files": []string{filepath.Join(tempDir, "modules", "vpc", "main.tf")}}),
+		call(5, "module_graph", map[string]any{"directory": filepath.Join(tempDir, "envs", "prod")}),
+		call(6, "analyze_module", map[string]any{"directory": filepath.Join(tempDir, "missing")}),
+		`{"jsonrpc":"2.0","id":7,"method":"resources/list"}`,
+	}, "\n")
+
+	var out bytes.Buffer
+	if err := serveMCP(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("serveMCP failed: %v", err)
+	}
+
+	type response struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	var responses []response
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var resp response
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+	if len(responses) != 7 {
+		t.Fatalf("expected 7 responses (none for the notification), got %d", len(responses))
+	}
+
+	toolText := func(i int) (string, bool) {
+		t.Helper()
+		var result mcpToolResult
+		if err := json.Unmarshal(responses[i].Result, &result); err != nil || len(result.Content) != 1 {
+			t.Fatalf("response %d is not a tool result: %s", responses[i].ID, responses[i].Result)
+		}
+		return result.Content[0].Text, result.IsError
+	}
+
+	if !strings.Contains(string(responses[0].Result), `"protocolVersion":"2025-06-18"`) {
+		t.Errorf("unexpected initialize result: %s", responses[0].Result)
+	}
+	for _, tool := range []string{"analyze_module", "affected_roots", "module_graph"} {
+		if !strings.Contains(string(responses[1].Result), `"name":"`+tool+`"`) {
+			t.Errorf("expected tools/list to include %s", tool)
+		}
+	}
+
+	if text, isError := toolText(2); isError || !strings.Contains(text, `"cloudposse/label/null"`) {
+		t.Errorf("unexpected analyze_module result: %s", text)
+	}
+	if text, isError := toolText(3); isError || !strings.Contains(text, filepath.Join(tempDir, "envs", "prod")) {
+		t.Errorf("expected affected root in affected_roots result: %s", text)
+	}
+	if text, isError := toolText(4); isError || !strings.Contains(text, `"target": "../../modules/vpc"`) {
+		t.Errorf("unexpected module_graph result: %s", text)
+	}
+	if _, isError := toolText(5); !isError {
+		t.Error("expected a tool error for a missing directory")
+	}
+	if responses[6].Error == nil || responses[6].Error.Code != rpcMethodNotFound {
+		t.Errorf("expected method not found, got %+v", responses[6].Error)
+	}
+}
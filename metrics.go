@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// metricsPrefix namespaces every metric exported by the server.
+const metricsPrefix = "terraform_module_resolve_"
+
+// durationBuckets are the upper bounds, in seconds, of the analysis
+// duration histogram.
+var durationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// serverMetrics collects the metrics exposed on /metrics in the Prometheus
+// text exposition format.
+type serverMetrics struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointMetrics
+	modules   map[string]int64
+	cache     *Cache
+}
+
+// endpointMetrics is the request count, error count and duration histogram
+// of one endpoint. buckets holds non-cumulative counts per durationBuckets
+// entry.
+type endpointMetrics struct {
+	requests int64
+	errors   int64
+	sum      float64
+	buckets  []int64
+}
+
+func newServerMetrics(cache *Cache) *serverMetrics {
+	return &serverMetrics{
+		endpoints: make(map[string]*endpointMetrics),
+		modules:   make(map[string]int64),
+		cache:     cache,
+	}
+}
+
+// observe records one request to endpoint that took d and failed if err is
+// not nil.
+func (m *serverMetrics) observe(endpoint string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.endpoints[endpoint]
+	if !ok {
+		e = &endpointMetrics{buckets: make([]int64, len(durationBuckets))}
+		m.endpoints[endpoint] = e
+	}
+	e.requests++
+	if err != nil {
+		e.errors++
+	}
+	seconds := d.Seconds()
+	e.sum += seconds
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			e.buckets[i]++
+			break
+		}
+	}
+}
+
+// countModules adds the module calls resolved by an analysis.
+func (m *serverMetrics) countModules(output *Output) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.modules[kindLocal] += int64(len(output.LocalModules))
+	m.modules[kindRemote] += int64(len(output.RemoteModules))
+}
+
+func (m *serverMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var endpoints []string
+	for name := range m.endpoints {
+		endpoints = append(endpoints, name)
+	}
+	sort.Strings(endpoints)
+
+	writeMetricHeader(w, "requests_total", "counter", "Analysis requests handled, by endpoint.")
+	for _, name := range endpoints {
+		fmt.Fprintf(w, "%srequests_total{endpoint=%q} %d\n", metricsPrefix, name, m.endpoints[name].requests)
+	}
+
+	writeMetricHeader(w, "request_errors_total", "counter", "Analysis requests that failed, by endpoint.")
+	for _, name := range endpoints {
+		fmt.Fprintf(w, "%srequest_errors_total{endpoint=%q} %d\n", metricsPrefix, name, m.endpoints[name].errors)
+	}
+
+	writeMetricHeader(w, "analysis_duration_seconds", "histogram", "Time spent serving analysis requests, by endpoint.")
+	for _, name := range endpoints {
+		e := m.endpoints[name]
+		var cumulative int64
+		for i, le := range durationBuckets {
+			cumulative += e.buckets[i]
+			fmt.Fprintf(w, "%sanalysis_duration_seconds_bucket{endpoint=%q,le=\"%g\"} %d\n", metricsPrefix, name, le, cumulative)
+		}
+		fmt.Fprintf(w, "%sanalysis_duration_seconds_bucket{endpoint=%q,le=\"+Inf\"} %d\n", metricsPrefix, name, e.requests)
+		fmt.Fprintf(w, "%sanalysis_duration_seconds_sum{endpoint=%q} %g\n", metricsPrefix, name, e.sum)
+		fmt.Fprintf(w, "%sanalysis_duration_seconds_count{endpoint=%q} %d\n", metricsPrefix, name, e.requests)
+	}
+
+	writeMetricHeader(w, "modules_resolved_total", "counter", "Module calls resolved by successful analyses, by kind.")
+	for _, kind := range []string{kindLocal, kindRemote} {
+		fmt.Fprintf(w, "%smodules_resolved_total{kind=%q} %d\n", metricsPrefix, kind, m.modules[kind])
+	}
+
+	hits, misses := m.cache.stats()
+	writeMetricHeader(w, "cache_hits_total", "counter", "Module directories whose parsed calls were served from the cache.")
+	fmt.Fprintf(w, "%scache_hits_total %d\n", metricsPrefix, hits)
+	writeMetricHeader(w, "cache_misses_total", "counter", "Module directories that had to be parsed.")
+	fmt.Fprintf(w, "%scache_misses_total %d\n", metricsPrefix, misses)
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n", metricsPrefix, name, help)
+	fmt.Fprintf(w, "# TYPE %s%s %s\n", metricsPrefix, name, kind)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errNotFound reports a module or version that a registry source does not
+// have, so that the next source can be tried.
+var errNotFound = errors.New("not found")
+
+// errUnresolved reports a registry module that no source provides in a
+// version matching its constraint.
+var errUnresolved = errors.New("no matching version")
+
+// ModuleInstallation configures where registry modules are fetched from,
+// like the provider_installation block of the Terraform CLI configuration.
+// Mirrors are tried in order: the filesystem mirror, the network mirror and,
+// when no mirror is configured or Direct is set, each module's own registry.
+type ModuleInstallation struct {
+	// FilesystemMirror is a directory holding unpacked modules as
+	// <host>/<namespace>/<name>/<provider>/<version>/.
+	FilesystemMirror string `json:"filesystem_mirror,omitempty"`
+
+	// NetworkMirror is a URL serving the module registry protocol for each
+	// host below <url>/<host>/, such as
+	// <url>/registry.terraform.io/<namespace>/<name>/<provider>/versions.
+	NetworkMirror string `json:"network_mirror,omitempty"`
+
+	// Direct also contacts the origin registries when a mirror is set.
+	Direct bool `json:"direct,omitempty"`
+}
+
+// registrySource lists and downloads the versions of registry modules.
+type registrySource interface {
+	fmt.Stringer
+	versions(ctx context.Context, host, path string) (*registryModule, error)
+	download(ctx context.Context, host, path, version, dest string) (string, error)
+}
+
+// registryModule is the version listing of a registry module. Deprecation
+// is set when the registry marks the module's namespace deprecated, and
+// deprecated versions carry their own notice.
+type registryModule struct {
+	Versions    []registryVersion
+	Deprecation *registryDeprecation
+}
+
+type registryVersion struct {
+	Version     string
+	Deprecation *registryDeprecation
+}
+
+// registryDeprecation is a deprecation notice published by a registry,
+// with an optional link to migration instructions.
+type registryDeprecation struct {
+	Reason string `json:"reason"`
+	Link   string `json:"link"`
+}
+
+// message appends the reason and link of the notice to summary.
+func (d *registryDeprecation) message(summary string) string {
+	if d.Reason != "" {
+		summary += ": " + d.Reason
+	}
+	if d.Link != "" {
+		summary += " (" + d.Link + ")"
+	}
+	return summary
+}
+
+func (m *registryModule) versionNames() []string {
+	var names []string
+	for _, v := range m.Versions {
+		names = append(names, v.Version)
+	}
+	return names
+}
+
+// versionDeprecation returns the deprecation notice of version, if any.
+func (m *registryModule) versionDeprecation(version string) *registryDeprecation {
+	for _, v := range m.Versions {
+		if v.Version == version {
+			return v.Deprecation
+		}
+	}
+	return nil
+}
+
+// registrySources returns the sources registry modules are resolved from,
+// in order of preference.
+func (f *moduleFetcher) registrySources() ([]registrySource, error) {
+	var sources []registrySource
+	if dir := f.installation.FilesystemMirror; dir != "" {
+		sources = append(sources, filesystemMirror(dir))
+	}
+	if raw := f.installation.NetworkMirror; raw != "" {
+		mirror, err := url.Parse(raw)
+		if err != nil || (mirror.Scheme != "https" && mirror.Scheme != "http") {
+			return nil, fmt.Errorf("invalid network mirror URL %q", raw)
+		}
+		sources = append(sources, registryAPI{fetcher: f, mirror: mirror})
+	}
+	if len(sources) == 0 || f.installation.Direct {
+		sources = append(sources, registryAPI{fetcher: f})
+	}
+	return sources, nil
+}
+
+// resolveRegistry returns the first source providing a version of the
+// registry package pkg allowed by constraint, that version and the
+// source's listing of the module.
+func (f *moduleFetcher) resolveRegistry(ctx context.Context, pkg, constraint string) (registrySource, string, *registryModule, error) {
+	addr, err := parseRegistrySource(pkg)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	sources, err := f.registrySources()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	host, path := addr.Host, addr.path()
+	var missing []string
+	for _, source := range sources {
+		module, err := source.versions(ctx, host, path)
+		if errors.Is(err, errNotFound) {
+			missing = append(missing, fmt.Sprintf("%s: module not found", source))
+			continue
+		}
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("%s: %s: %w", pkg, source, err)
+		}
+		version, err := latestAllowedVersion(module.versionNames(), constraint)
+		if err != nil {
+			missing = append(missing, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+		return source, version, module, nil
+	}
+	return nil, "", nil, fmt.Errorf("%s: %w (%s)", pkg, errUnresolved, strings.Join(missing, "; "))
+}
+
+// filesystemMirror is a directory of unpacked registry modules.
+type filesystemMirror string
+
+func (m filesystemMirror) String() string {
+	return "filesystem mirror " + string(m)
+}
+
+func (m filesystemMirror) moduleDir(host, path string) string {
+	return filepath.Join(string(m), host, filepath.FromSlash(path))
+}
+
+func (m filesystemMirror) versions(ctx context.Context, host, path string) (*registryModule, error) {
+	entries, err := os.ReadDir(m.moduleDir(host, path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	module := &registryModule{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			module.Versions = append(module.Versions, registryVersion{Version: entry.Name()})
+		}
+	}
+	return module, nil
+}
+
+func (m filesystemMirror) download(ctx context.Context, host, path, version, dest string) (string, error) {
+	return "", copyDir(filepath.Join(m.moduleDir(host, path), version), dest)
+}
+
+// copyDir copies the regular files and directories below src to dest.
+func copyDir(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		return writeExtractedFile(target, in, info.Mode())
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetch_FilesystemMirror(t *testing.T) {
+	mirror := t.TempDir()
+	writeTestFiles(t, mirror, map[string]string{
+		"registry.terraform.io/org/vpc/aws/1.0.0/main.tf":        `# 1.0.0`,
+		"registry.terraform.io/org/vpc/aws/1.1.0/main.tf":        `# 1.1.0`,
+		"registry.terraform.io/org/vpc/aws/1.1.0/modules/x/x.tf": "",
+		"registry.terraform.io/org/vpc/aws/2.0.0/main.tf":        `# 2.0.0`,
+		"registry.example.com/org/label/null/0.1.0/main.tf":      "",
+	})
+
+	fetcher := newModuleFetcher(nil, ModuleInstallation{FilesystemMirror: mirror})
+	dest := filepath.Join(t.TempDir(), "vpc")
+	version, _, err := fetcher.fetch(context.Background(), "org/vpc/aws", "~> 1.0", dest)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if version != "1.1.0" {
+		t.Errorf("expected version 1.1.0, got %s", version)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "main.tf"))
+	if err != nil || string(data) != "# 1.1.0" {
+		t.Errorf("expected the 1.1.0 copy, got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "modules", "x", "x.tf")); err != nil {
+		t.Errorf("expected nested directories to be copied: %v", err)
+	}
+
+	if _, _, err := fetcher.fetch(context.Background(), "registry.example.com/org/label/null", "", filepath.Join(t.TempDir(), "label")); err != nil {
+		t.Errorf("expected a module of another host to be found: %v", err)
+	}
+	if _, _, err := fetcher.fetch(context.Background(), "org/missing/aws", "", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected a module missing from the only mirror to fail without contacting the registry")
+	}
+}
+
+func TestFetch_NetworkMirrorFallback(t *testing.T) {
+	archive := tarGz(t, map[string]string{"main.tf": `# from network mirror`})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mirror/registry.terraform.io/org/vpc/aws/versions", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"modules":[{"versions":[{"version":"3.0.0"}]}]}`))
+	})
+	mux.HandleFunc("/mirror/registry.terraform.io/org/vpc/aws/3.0.0/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Terraform-Get", "./archive.tar.gz")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/mirror/registry.terraform.io/org/vpc/aws/3.0.0/archive.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// The filesystem mirror only has an older major version.
+	mirror := t.TempDir()
+	writeTestFiles(t, mirror, map[string]string{"registry.terraform.io/org/vpc/aws/2.0.0/main.tf": ""})
+
+	fetcher := newModuleFetcher(server.Client(), ModuleInstallation{
+		FilesystemMirror: mirror,
+		NetworkMirror:    server.URL + "/mirror/",
+	})
+	dest := filepath.Join(t.TempDir(), "vpc")
+	version, _, err := fetcher.fetch(context.Background(), "org/vpc/aws", ">= 3.0", dest)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if version != "3.0.0" {
+		t.Errorf("expected version 3.0.0 from the network mirror, got %s", version)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "main.tf")); string(data) != "# from network mirror" {
+		t.Errorf("expected the network mirror's archive, got %q", data)
+	}
+}
+
+func TestCheckRegistryVersions(t *testing.T) {
+	mirror := t.TempDir()
+	writeTestFiles(t, mirror, map[string]string{"registry.terraform.io/org/vpc/aws/1.2.0/main.tf": ""})
+
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source  = "org/vpc/aws"
+  version = "~> 1.0"
+}
+
+module "old_vpc" {
+  source  = "org/vpc/aws"
+  version = "~> 0.9"
+}
+
+module "label" {
+  source = "git::https://example.com/label.git?ref=v1"
+}
+`,
+	})
+	output, err := Analyze(root)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	diags, err := CheckRegistryVersions(context.Background(), output, ModuleInstallation{FilesystemMirror: mirror}, nil)
+	if err != nil {
+		t.Fatalf("CheckRegistryVersions failed: %v", err)
+	}
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %+v", diags)
+	}
+	d := diags[0]
+	if d.Code != codeUnresolved || d.Module != "old_vpc" || d.Filename != filepath.Join(root, "main.tf") || d.Line != 7 {
+		t.Errorf("unexpected diagnostic %+v", d)
+	}
+}
+
+func TestCheckRegistryVersions_Deprecated(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mirror/registry.terraform.io/org/vpc/aws/versions", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"modules":[{"versions":[
+			{"version":"1.0.0","deprecation":{"reason":"Security issue","link":"https://example.com/vpc-1.0"}},
+			{"version":"2.0.0"}
+		]}]}`))
+	})
+	mux.HandleFunc("/mirror/registry.terraform.io/legacy/label/null/versions", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"modules":[{"deprecation":{"reason":"Moved to org"},"versions":[{"version":"0.1.0"}]}]}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"main.tf": `
+module "old_vpc" {
+  source  = "org/vpc/aws"
+  version = "~> 1.0"
+}
+
+module "vpc" {
+  source  = "org/vpc/aws"
+  version = "~> 2.0"
+}
+
+module "label" {
+  source  = "legacy/label/null"
+  version = "0.1.0"
+}
+`,
+	})
+	output, err := Analyze(root)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	diags, err := CheckRegistryVersions(context.Background(), output, ModuleInstallation{NetworkMirror: server.URL + "/mirror/"}, server.Client())
+	if err != nil {
+		t.Fatalf("CheckRegistryVersions failed: %v", err)
+	}
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %+v", diags)
+	}
+	messages := map[string]string{}
+	for _, d := range diags {
+		if d.Code != codeDeprecated || d.Severity != severityWarning || d.Filename == "" {
+			t.Errorf("unexpected diagnostic %+v", d)
+		}
+		messages[d.Module] = d.Message
+	}
+	if m := messages["old_vpc"]; m != "version 1.0.0 is deprecated: Security issue (https://example.com/vpc-1.0)" {
+		t.Errorf("unexpected version deprecation %q", m)
+	}
+	if m := messages["label"]; m != "namespace legacy is deprecated: Moved to org" {
+		t.Errorf("unexpected namespace deprecation %q", m)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Moved is a moved block that relocates a module call or moves objects
+// into or out of one, such as moved { from = module.a  to = module.b }.
+// From and To are relative to the module declaring the block, which is at
+// Path and, for nested modules, has the address Module, such as
+// module.app.module.network, through the first call that reaches it.
+type Moved struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Module   string `json:"module,omitempty"`
+	Path     string `json:"path"`
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+}
+
+var movedBlockSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{{Type: "moved"}},
+}
+
+var movedArgsSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "from", Required: true}, {Name: "to", Required: true}},
+}
+
+// loadMoved returns the moved blocks of the module in dir, which has the
+// module key key, whose from or to address involves a module call. Files
+// that fail to parse and malformed blocks are skipped, as Terraform
+// reports them.
+func loadMoved(fsys fileSystem, dir, key string) []Moved {
+	paths, err := listTerraformFilesIn(fsys, dir)
+	if err != nil {
+		return nil
+	}
+	module := ""
+	if key != "" {
+		module = "module." + strings.ReplaceAll(key, ".", ".module.")
+	}
+	parser := hclparse.NewParser()
+	var moved []Moved
+	for _, path := range paths {
+		src, err := fsys.readFile(path)
+		if err != nil || !bytes.Contains(src, []byte("moved")) {
+			continue
+		}
+		var file *hcl.File
+		if strings.HasSuffix(path, ".tf.json") {
+			file, _ = parser.ParseJSON(src, path)
+		} else {
+			file, _ = parser.ParseHCL(src, path)
+		}
+		if file == nil {
+			continue
+		}
+		content, _, _ := file.Body.PartialContent(movedBlockSchema)
+		for _, block := range content.Blocks {
+			attrs, _, diags := block.Body.PartialContent(movedArgsSchema)
+			if diags.HasErrors() {
+				continue
+			}
+			from, fromOK := movedAddress(attrs.Attributes["from"].Expr)
+			to, toOK := movedAddress(attrs.Attributes["to"].Expr)
+			if !fromOK || !toOK || !strings.HasPrefix(from, "module.") && !strings.HasPrefix(to, "module.") {
+				continue
+			}
+			moved = append(moved, Moved{
+				From:     from,
+				To:       to,
+				Module:   module,
+				Path:     dir,
+				Filename: path,
+				Line:     block.DefRange.Start.Line,
+			})
+		}
+	}
+	return moved
+}
+
+// movedAddress formats the address of a moved block argument, such as
+// module.app["a"].aws_s3_bucket.this, as Terraform prints it.
+func movedAddress(expr hcl.Expression) (string, bool) {
+	traversal, diags := hcl.AbsTraversalForExpr(expr)
+	if diags.HasErrors() {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString(traversal.RootName())
+	for _, step := range traversal[1:] {
+		switch step := step.(type) {
+		case hcl.TraverseAttr:
+			b.WriteString("." + step.Name)
+		case hcl.TraverseIndex:
+			switch step.Key.Type() {
+			case cty.String:
+				fmt.Fprintf(&b, "[%q]", step.Key.AsString())
+			case cty.Number:
+				fmt.Fprintf(&b, "[%s]", step.Key.AsBigFloat().Text('f', -1))
+			default:
+				return "", false
+			}
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze_Moved(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "app" {
+  source = "../modules/app"
+}
+
+moved {
+  from = module.application
+  to   = module.app
+}
+
+moved {
+  from = aws_s3_bucket.old
+  to   = aws_s3_bucket.new
+}
+`,
+		"modules/app/main.tf": `
+module "network" {
+  source   = "../network"
+  for_each = toset(["a"])
+}
+`,
+		"modules/app/moved.tf": `
+moved {
+  from = module.network[0]
+  to   = module.network["a"]
+}
+
+moved {
+  from = aws_vpc.this
+  to   = module.network["a"].aws_vpc.this
+}
+`,
+		"modules/network/main.tf": `resource "aws_vpc" "this" {}`,
+	})
+	root := filepath.Join(tempDir, "root")
+	app := filepath.Join(tempDir, "modules", "app")
+
+	output, err := Analyze(root)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	expected := []Moved{
+		{From: "module.application", To: "module.app", Path: root, Filename: filepath.Join(root, "main.tf"), Line: 6},
+		{From: "module.network[0]", To: `module.network["a"]`, Module: "module.app", Path: app, Filename: filepath.Join(app, "moved.tf"), Line: 2},
+		{From: "aws_vpc.this", To: `module.network["a"].aws_vpc.this`, Module: "module.app", Path: app, Filename: filepath.Join(app, "moved.tf"), Line: 7},
+	}
+	if !reflect.DeepEqual(output.Moved, expected) {
+		t.Errorf("expected %+v, got %+v", expected, output.Moved)
+	}
+}
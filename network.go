@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Retries and rate limiting of network accesses, set by the flags that
+// addNetworkFlags registers. Every access to a registry, archive host, git
+// remote or webhook waits for networkLimiter and, when it fails in a way
+// that may pass, is retried networkRetries times after networkBackoff,
+// doubled for each further retry.
+var (
+	networkRetries   = 3
+	networkBackoff   = time.Second
+	networkRateLimit float64
+	networkLimiter   rateLimiter
+)
+
+// networkCABundle is the absolute path of the --ca-bundle file, and
+// caClient the HTTP client that trusts its certificates.
+var (
+	networkCABundle string
+	caClient        *http.Client
+)
+
+// maxRetryDelay bounds the delay before a retry, including delays asked
+// for by a Retry-After header.
+const maxRetryDelay = time.Minute
+
+// addNetworkFlags registers --offline, --retries, --retry-backoff,
+// --rate-limit and --ca-bundle on the flag set of a command that may access
+// the network.
+func addNetworkFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&offline, "offline", false, "fail instead of accessing the network, such as registries, git remotes or webhooks")
+	flags.IntVar(&networkRetries, "retries", networkRetries, "retry network accesses that fail with connection errors, 429 or 5xx responses or git errors this many times")
+	flags.DurationVar(&networkBackoff, "retry-backoff", networkBackoff, "delay before the first retry of a network access, doubled for each further retry")
+	flags.Float64Var(&networkRateLimit, "rate-limit", 0, "make at most this many network accesses per second (0 means no limit)")
+	flags.Func("ca-bundle", "also trust the certificate authorities in this PEM file for HTTPS and git, such as that of an intercepting proxy", setCABundle)
+}
+
+// setCABundle makes network accesses also trust the certificates of the
+// PEM file at path.
+func setCABundle(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("%s holds no PEM certificates", path)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	networkCABundle = path
+	caClient = &http.Client{Transport: transport}
+	return nil
+}
+
+// networkClient returns the HTTP client of network accesses, which trusts
+// the --ca-bundle certificates when it is set. Like http.DefaultClient, it
+// connects through the proxy that HTTPS_PROXY or HTTP_PROXY name, except
+// for the hosts in NO_PROXY.
+func networkClient() *http.Client {
+	if caClient != nil {
+		return caClient
+	}
+	return http.DefaultClient
+}
+
+// gitEnv returns the environment variables that make git commands
+// accessing a remote use the --ca-bundle certificates. git reads its proxy
+// from the same variables as networkClient.
+func gitEnv() []string {
+	if networkCABundle == "" {
+		return nil
+	}
+	return []string{"GIT_SSL_CAINFO=" + networkCABundle}
+}
+
+// temporaryError is the error of a network access that may succeed when
+// retried. retryAfter is the delay the server asked for, if any.
+type temporaryError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *temporaryError) Error() string { return e.err.Error() }
+func (e *temporaryError) Unwrap() error { return e.err }
+
+// withRetries runs op, a network access, once the rate limit allows it,
+// and runs it again while it fails with a temporaryError, at most
+// networkRetries more times.
+func withRetries(ctx context.Context, op func() error) error {
+	for attempt := 0; ; attempt++ {
+		if err := networkLimiter.wait(ctx); err != nil {
+			return err
+		}
+		err := op()
+		var temp *temporaryError
+		if !errors.As(err, &temp) {
+			return err
+		}
+		if attempt >= networkRetries || ctx.Err() != nil {
+			return temp.err
+		}
+		delay := retryDelay(attempt, temp.retryAfter)
+		fmt.Fprintf(os.Stderr, "Warning: %v; retrying in %s\n", temp.err, delay)
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// retryDelay returns the delay before retry attempt+1: networkBackoff
+// doubled attempt times, or retryAfter when it is longer, at most
+// maxRetryDelay.
+func retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	delay := networkBackoff
+	for range attempt {
+		if delay *= 2; delay >= maxRetryDelay {
+			break
+		}
+	}
+	delay = max(delay, retryAfter)
+	return min(delay, maxRetryDelay)
+}
+
+// temporaryUnlessDone marks err, the failure of a git command accessing a
+// remote, as temporary unless ctx is done: git does not tell network
+// failures from others, such as a missing ref, so all are retried.
+func temporaryUnlessDone(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	return &temporaryError{err: err}
+}
+
+// doHTTP sends req with client under the rate limit. Connection errors and
+// 5xx responses of GET and HEAD requests, and 429 responses of any
+// request, are retried; when retries run out, the last such response is
+// returned as an error naming the request and status. Other responses are
+// returned for the caller to check.
+func doHTTP(client *http.Client, req *http.Request) (*http.Response, error) {
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+	rewindable := req.Body == nil || req.GetBody != nil
+	var resp *http.Response
+	attempts := 0
+	err := withRetries(req.Context(), func() error {
+		attempt := req
+		if attempts > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			attempt = req.Clone(req.Context())
+			attempt.Body = body
+		}
+		attempts++
+
+		var err error
+		resp, err = client.Do(attempt)
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) && isSecretURL(req) {
+			err = &url.Error{Op: urlErr.Op, URL: requestURL(req), Err: urlErr.Err}
+		}
+		if err != nil {
+			if idempotent && rewindable && req.Context().Err() == nil {
+				return &temporaryError{err: err}
+			}
+			return err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && (!idempotent || resp.StatusCode < 500) {
+			return nil
+		}
+		resp.Body.Close()
+		err = fmt.Errorf("%s %s: %s", req.Method, requestURL(req), resp.Status)
+		if !rewindable {
+			return err
+		}
+		return &temporaryError{err: err, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// secretURLKey is the context key of withSecretURL.
+type secretURLKey struct{}
+
+// withSecretURL marks the requests made with ctx as going to a URL that is
+// a secret, such as a Slack incoming webhook, so that errors about them
+// only name the scheme and host of the URL.
+func withSecretURL(ctx context.Context) context.Context {
+	return context.WithValue(ctx, secretURLKey{}, true)
+}
+
+func isSecretURL(req *http.Request) bool {
+	return req.Context().Value(secretURLKey{}) != nil
+}
+
+// requestURL returns the URL of req as named in errors.
+func requestURL(req *http.Request) string {
+	if isSecretURL(req) {
+		return redactURL(req.URL)
+	}
+	return req.URL.String()
+}
+
+// redactURL returns the scheme and host of u, leaving out the user, path
+// and query that may carry a secret.
+func redactURL(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// parseRetryAfter returns the delay of a Retry-After header, given in
+// seconds or as an HTTP date, or 0 when it is missing or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// rateLimiter spaces network accesses by the interval that
+// networkRateLimit allows, across all goroutines.
+type rateLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until the next network access is allowed, or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if networkRateLimit <= 0 {
+		return ctx.Err()
+	}
+	interval := time.Duration(float64(time.Second) / networkRateLimit)
+	l.mu.Lock()
+	at := time.Now()
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(interval)
+	l.mu.Unlock()
+	return sleepContext(ctx, time.Until(at))
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
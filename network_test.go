@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setNetworkFlags sets the retry and rate limit settings for the test.
+func setNetworkFlags(t *testing.T, retries int, backoff time.Duration, rateLimit float64) {
+	t.Helper()
+	oldRetries, oldBackoff, oldRateLimit := networkRetries, networkBackoff, networkRateLimit
+	networkRetries, networkBackoff, networkRateLimit = retries, backoff, rateLimit
+	t.Cleanup(func() {
+		networkRetries, networkBackoff, networkRateLimit = oldRetries, oldBackoff, oldRateLimit
+		networkLimiter = rateLimiter{}
+	})
+}
+
+func TestDoHTTP_Retries(t *testing.T) {
+	setNetworkFlags(t, 2, time.Millisecond, 0)
+	var requests []string
+	statuses := map[string][]int{
+		"/flaky":     {http.StatusServiceUnavailable, http.StatusOK},
+		"/limited":   {http.StatusTooManyRequests, http.StatusOK},
+		"/down":      {http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+		"/missing":   {http.StatusNotFound, http.StatusOK},
+		"/post-down": {http.StatusInternalServerError, http.StatusOK},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(body))
+		status := statuses[r.URL.Path][0]
+		statuses[r.URL.Path] = statuses[r.URL.Path][1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	send := func(method, path string) (*http.Response, error) {
+		requests = nil
+		req, err := http.NewRequestWithContext(t.Context(), method, server.URL+path, bytes.NewReader([]byte("payload")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doHTTP(server.Client(), req)
+	}
+
+	if resp, err := send(http.MethodGet, "/flaky"); err != nil || resp.StatusCode != http.StatusOK || len(requests) != 2 {
+		t.Errorf("expected a 503 to be retried, got %v, %v after %v", resp, err, requests)
+	}
+	if resp, err := send(http.MethodPost, "/limited"); err != nil || resp.StatusCode != http.StatusOK || len(requests) != 2 {
+		t.Errorf("expected a 429 of a POST to be retried, got %v, %v after %v", resp, err, requests)
+	} else if requests[1] != "POST /limited payload" {
+		t.Errorf("expected the body to be sent again, got %q", requests[1])
+	}
+	if _, err := send(http.MethodGet, "/down"); err == nil || !strings.Contains(err.Error(), "502 Bad Gateway") || len(requests) != 3 {
+		t.Errorf("expected the last 502 after 2 retries, got %v after %v", err, requests)
+	}
+	if resp, err := send(http.MethodGet, "/missing"); err != nil || resp.StatusCode != http.StatusNotFound || len(requests) != 1 {
+		t.Errorf("expected a 404 to be returned without retries, got %v, %v after %v", resp, err, requests)
+	}
+	if _, err := send(http.MethodPost, "/post-down"); err != nil || len(requests) != 1 {
+		t.Errorf("expected a 500 of a POST not to be retried, got %v after %v", err, requests)
+	}
+}
+
+func TestWithRetries_Cancelled(t *testing.T) {
+	setNetworkFlags(t, 5, time.Hour, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := withRetries(ctx, func() error {
+		calls++
+		cancel()
+		return &temporaryError{err: io.ErrUnexpectedEOF}
+	})
+	if err != io.ErrUnexpectedEOF || calls != 1 {
+		t.Errorf("expected the error of the only attempt, got %v after %d calls", err, calls)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	setNetworkFlags(t, 3, time.Second, 0)
+	tests := []struct {
+		attempt    int
+		retryAfter time.Duration
+		expected   time.Duration
+	}{
+		{0, 0, time.Second},
+		{2, 0, 4 * time.Second},
+		{1, 10 * time.Second, 10 * time.Second},
+		{10, 0, maxRetryDelay},
+		{0, time.Hour, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempt, tt.retryAfter); got != tt.expected {
+			t.Errorf("retryDelay(%d, %s) = %s, expected %s", tt.attempt, tt.retryAfter, got, tt.expected)
+		}
+	}
+
+	if got := parseRetryAfter("30"); got != 30*time.Second {
+		t.Errorf("expected 30s from seconds, got %s", got)
+	}
+	if got := parseRetryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)); got != 0 {
+		t.Errorf("expected no delay from a past date, got %s", got)
+	}
+	if got := parseRetryAfter("soon"); got != 0 {
+		t.Errorf("expected no delay from an invalid value, got %s", got)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	setNetworkFlags(t, 0, time.Millisecond, 50)
+	start := time.Now()
+	for range 4 {
+		if err := networkLimiter.wait(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first access is immediate and each further one waits 20ms.
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("expected 4 accesses at 50 per second to take at least 60ms, took %s", elapsed)
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { networkCABundle, caClient = "", nil })
+
+	if _, err := networkClient().Get(server.URL); err == nil {
+		t.Fatal("expected the test server's certificate to be untrusted")
+	}
+	t.Chdir(dir)
+	if err := setCABundle("ca.pem"); err != nil {
+		t.Fatalf("setCABundle failed: %v", err)
+	}
+	resp, err := networkClient().Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected the bundle's certificate to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+	if env := gitEnv(); !slices.Contains(env, "GIT_SSL_CAINFO="+bundle) {
+		t.Errorf("expected git to use the absolute bundle path, got %v", env)
+	}
+	if networkClient().Transport.(*http.Transport).Proxy == nil {
+		t.Error("expected the proxy environment variables to be honored")
+	}
+
+	if err := os.WriteFile("empty.pem", []byte("no certificates"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setCABundle("empty.pem"); err == nil {
+		t.Error("expected an error for a file without certificates")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// notifyTimeout bounds the webhook request of --notify-webhook.
+const notifyTimeout = 30 * time.Second
+
+// notifyWebhookEnv names the environment variable holding the webhook URL
+// when --notify-webhook is not given, so that the URL, a secret for Slack
+// incoming webhooks, need not be on the command line or in workflow files.
+const notifyWebhookEnv = "TFMR_NOTIFY_WEBHOOK"
+
+// webhookURL returns the URL given to --notify-webhook, or the URL in
+// notifyWebhookEnv when none was given.
+func webhookURL(flagURL string) string {
+	if flagURL != "" {
+		return flagURL
+	}
+	return os.Getenv(notifyWebhookEnv)
+}
+
+// NotifyPayload is the JSON body posted by --notify-webhook. Text is a
+// summary in Slack mrkdwn, so the payload can be sent to a Slack incoming
+// webhook as is; the other fields are for webhooks that process them.
+type NotifyPayload struct {
+	Text         string       `json:"text"`
+	Affected     bool         `json:"affected"`
+	ChangedFiles []string     `json:"changed_files"`
+	Roots        []NotifyRoot `json:"roots"`
+}
+
+// NotifyRoot is an affected root or project with the modules the changed
+// files are in and the changed files that affect it. Paths are relative to
+// the working directory.
+type NotifyRoot struct {
+	Path        string         `json:"path"`
+	Application string         `json:"application,omitempty"`
+	Project     string         `json:"project,omitempty"`
+	Modules     []NotifyModule `json:"modules"`
+	Files       []string       `json:"files"`
+}
+
+// NotifyModule is a changed module of an affected root.
+type NotifyModule struct {
+	Kind string `json:"kind"`
+	Name string `json:"name,omitempty"`
+	Path string `json:"path"`
+}
+
+// newNotifyRoot describes the root analyzed in output as affected by those
+// of changedFiles that are in its module tree.
+func newNotifyRoot(output *Output, application string, changedFiles []string) NotifyRoot {
+	root := NotifyRoot{
+		Path:        workingDirRel(output.RootModule.ResolvedPath),
+		Application: application,
+		Modules:     []NotifyModule{},
+		Files:       []string{},
+	}
+	for _, f := range changedFiles {
+		if IsAffected([]string{f}, output) {
+			root.Files = append(root.Files, f)
+		}
+	}
+	for _, m := range AffectedModules(root.Files, output) {
+		root.Modules = append(root.Modules, NotifyModule{Kind: m.Kind, Name: m.Name, Path: workingDirRel(m.ResolvedPath)})
+	}
+	return root
+}
+
+// NewNotifyPayload summarizes the affected roots for changedFiles.
+func NewNotifyPayload(changedFiles []string, roots []NotifyRoot) NotifyPayload {
+	if changedFiles == nil {
+		changedFiles = []string{}
+	}
+	if roots == nil {
+		roots = []NotifyRoot{}
+	}
+	payload := NotifyPayload{Affected: len(roots) > 0, ChangedFiles: changedFiles, Roots: roots}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "*%s affected by %s*", pluralize(len(roots), "Terraform root"), pluralize(len(changedFiles), "changed file"))
+	for _, root := range roots {
+		fmt.Fprintf(&text, "\n• `%s`", root.Path)
+		if root.Application != "" {
+			fmt.Fprintf(&text, " (%s)", root.Application)
+		}
+		if root.Project != "" {
+			fmt.Fprintf(&text, " (project %s)", root.Project)
+		}
+		var modules []string
+		for _, m := range root.Modules {
+			if m.Kind != kindRoot {
+				modules = append(modules, "`"+m.Path+"`")
+			}
+		}
+		if len(modules) > 0 {
+			fmt.Fprintf(&text, ": %s", strings.Join(modules, ", "))
+		}
+	}
+	payload.Text = text.String()
+	return payload
+}
+
+// postWebhook posts payload as JSON to webhookURL. The URL is a secret,
+// so errors only name its scheme and host.
+func postWebhook(ctx context.Context, client *http.Client, webhookURL string, payload NotifyPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return errors.New("invalid webhook URL")
+	}
+	req, err := http.NewRequestWithContext(withSecretURL(ctx), http.MethodPost, webhookURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL %s", redactURL(u))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := checkOnline("POST " + redactURL(u)); err != nil {
+		return err
+	}
+	resp, err := doHTTP(client, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST %s: %s", redactURL(u), resp.Status)
+	}
+	return nil
+}
+
+// notifyWebhook posts the payload of the affected roots to webhookURL if
+// any root is affected. Failures are reported as warnings so that a
+// notification outage does not change the outcome of the analysis.
+func notifyWebhook(webhookURL string, changedFiles []string, roots []NotifyRoot) {
+	if webhookURL == "" || len(roots) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if err := postWebhook(ctx, networkClient(), webhookURL, NewNotifyPayload(changedFiles, roots)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: notifying webhook: %v\n", err)
+	}
+}
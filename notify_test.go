@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewNotifyPayload(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+	t.Chdir(tempDir)
+	output, err := Analyze(filepath.Join(tempDir, "envs", "prod"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	changed := []string{"modules/vpc/main.tf", "README.md"}
+	payload := NewNotifyPayload(changed, []NotifyRoot{newNotifyRoot(output, "network", changed)})
+
+	if !payload.Affected || len(payload.Roots) != 1 {
+		t.Fatalf("expected one affected root, got %+v", payload)
+	}
+	root := payload.Roots[0]
+	if root.Path != "envs/prod" || len(root.Files) != 1 || root.Files[0] != "modules/vpc/main.tf" {
+		t.Errorf("expected the root with its triggering file, got %+v", root)
+	}
+	if len(root.Modules) != 1 || root.Modules[0] != (NotifyModule{Kind: kindLocal, Name: "vpc", Path: "modules/vpc"}) {
+		t.Errorf("expected the changed vpc module, got %+v", root.Modules)
+	}
+	if want := "*1 Terraform root affected by 2 changed files*\n• `envs/prod` (network): `modules/vpc`"; payload.Text != want {
+		t.Errorf("expected text %q, got %q", want, payload.Text)
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	var received NotifyPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	payload := NewNotifyPayload([]string{"a.tf"}, nil)
+	if err := postWebhook(t.Context(), server.Client(), server.URL, payload); err != nil {
+		t.Fatalf("postWebhook failed: %v", err)
+	}
+	if received.Text != payload.Text || received.Affected {
+		t.Errorf("expected the payload to be posted, got %+v", received)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer failing.Close()
+	if err := postWebhook(t.Context(), failing.Client(), failing.URL, payload); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected the response status in the error, got %v", err)
+	}
+}
+
+func TestPostWebhook_RedactsURL(t *testing.T) {
+	retries := networkRetries
+	networkRetries = 0
+	t.Cleanup(func() { networkRetries = retries })
+	payload := NewNotifyPayload([]string{"a.tf"}, nil)
+
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	for _, server := range []*httptest.Server{limited, closed} {
+		err := postWebhook(t.Context(), server.Client(), server.URL+"/services/T000/B000/SECRET?token=SECRET", payload)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if strings.Contains(err.Error(), "SECRET") || !strings.Contains(err.Error(), server.URL) {
+			t.Errorf("expected only the scheme and host of the webhook in the error, got %v", err)
+		}
+	}
+}
+
+func TestWebhookURL(t *testing.T) {
+	t.Setenv(notifyWebhookEnv, "https://hooks.example.com/env")
+	if u := webhookURL(""); u != "https://hooks.example.com/env" {
+		t.Errorf("expected the URL of %s, got %s", notifyWebhookEnv, u)
+	}
+	if u := webhookURL("https://hooks.example.com/flag"); u != "https://hooks.example.com/flag" {
+		t.Errorf("expected the flag to take precedence, got %s", u)
+	}
+}
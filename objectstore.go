@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// objectStoreGetter returns the go-getter that downloads an address
+// without a forced getter from its host: s3 for amazonaws.com hosts, gcs
+// for the www.googleapis.com storage API, or "" for other addresses.
+func objectStoreGetter(raw string) string {
+	host := raw
+	if _, rest, ok := strings.Cut(raw, "://"); ok {
+		host = rest
+	}
+	host, path, _ := strings.Cut(host, "/")
+	switch {
+	case strings.HasSuffix(host, ".amazonaws.com"):
+		return "s3"
+	case host == "www.googleapis.com" && strings.HasPrefix(path, "storage/"):
+		return "gcs"
+	}
+	return ""
+}
+
+// s3Request returns the request downloading the S3 object at u, such as
+// https://bucket.s3.eu-west-1.amazonaws.com/vpc.zip or
+// https://s3-eu-west-1.amazonaws.com/bucket/vpc.zip. The version query
+// parameter selects an object version. The request is signed with the
+// aws_access_key_id, aws_access_key_secret and aws_access_token query
+// parameters or, without them, the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables, and
+// is anonymous when neither is set.
+func s3Request(ctx context.Context, u *url.URL) (*http.Request, error) {
+	region, ok := s3Region(u.Host)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an S3 endpoint", u.Host)
+	}
+	query := u.Query()
+	keyID, secret, token := query.Get("aws_access_key_id"), query.Get("aws_access_key_secret"), query.Get("aws_access_token")
+	if keyID == "" {
+		keyID, secret, token = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+	}
+	download := *u
+	download.Scheme = "https"
+	values := url.Values{}
+	if version := query.Get("version"); version != "" {
+		values.Set("versionId", version)
+	}
+	download.RawQuery = values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, download.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if keyID != "" {
+		signAWSv4(req, region, keyID, secret, token, time.Now())
+	}
+	return req, nil
+}
+
+// s3Region returns the region of an S3 endpoint hostname, either
+// s3.<region>.amazonaws.com or s3-<region>.amazonaws.com, optionally below
+// a virtual-hosted bucket. The global s3.amazonaws.com endpoint is in
+// us-east-1.
+func s3Region(host string) (string, bool) {
+	name, ok := strings.CutSuffix(strings.ToLower(host), ".amazonaws.com")
+	if !ok {
+		return "", false
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		switch {
+		case strings.HasPrefix(label, "s3-"):
+			return strings.TrimPrefix(label, "s3-"), true
+		case label == "s3" && i+1 < len(labels):
+			return labels[i+1], true
+		case label == "s3":
+			return "us-east-1", true
+		}
+	}
+	return "", false
+}
+
+// signAWSv4 signs req for Amazon S3 with AWS Signature Version 4.
+func signAWSv4(req *http.Request, region, keyID, secret, token string, now time.Time) {
+	// Send the path encoded as it is signed.
+	req.URL.RawPath = awsURIEncode(req.URL.Path, false)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if name := strings.ToLower(name); strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(values[0])
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	var query []string
+	for key, values := range req.URL.Query() {
+		for _, value := range values {
+			query = append(query, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	slices.Sort(query)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Join(query, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", keyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsURIEncode percent-encodes s as AWS signatures require: every byte
+// except unreserved characters and, unless encodeSlash is set, slashes.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// gcsRequest returns the request downloading the Cloud Storage object at u,
+// addressed as https://www.googleapis.com/storage/v1/<bucket>/<object>,
+// through the JSON API. It is authorized with the access token in the
+// GOOGLE_OAUTH_ACCESS_TOKEN environment variable, and anonymous without
+// it.
+func gcsRequest(ctx context.Context, u *url.URL) (*http.Request, error) {
+	rest, ok := strings.CutPrefix(u.Path, "/storage/v1/")
+	bucket, object, found := strings.Cut(rest, "/")
+	if !ok || !found || bucket == "" || object == "" {
+		return nil, fmt.Errorf("GCS source %q must have the form www.googleapis.com/storage/v1/<bucket>/<object>", u.String())
+	}
+	download := "https://storage.googleapis.com/storage/v1/b/" + url.PathEscape(bucket) + "/o/" + url.PathEscape(object) + "?alt=media"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, download, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errOffline reports a network access attempted with --offline.
+var errOffline = errors.New("network access is disabled by --offline")
+
+// offline is set by --offline. Every code path that reaches the network
+// checks it with checkOnline and fails instead.
+var offline bool
+
+// checkOnline returns an error naming the network access described by
+// access when --offline is set.
+func checkOnline(access string) error {
+	if offline {
+		return fmt.Errorf("%s: %w", access, errOffline)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestOffline(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+	mirror := t.TempDir()
+	writeTestFiles(t, mirror, map[string]string{"registry.terraform.io/org/vpc/aws/1.0.0/main.tf": ""})
+
+	offline = true
+	t.Cleanup(func() { offline = false })
+
+	if err := postWebhook(t.Context(), server.Client(), server.URL, NewNotifyPayload(nil, nil)); !errors.Is(err, errOffline) {
+		t.Errorf("expected the webhook to fail offline, got %v", err)
+	}
+	fetcher := newModuleFetcher(server.Client(), ModuleInstallation{})
+	if _, _, err := fetcher.fetch(context.Background(), "http::"+server.URL+"/vpc.zip", "", filepath.Join(t.TempDir(), "vpc")); !errors.Is(err, errOffline) {
+		t.Errorf("expected the archive download to fail offline, got %v", err)
+	}
+	if _, _, err := fetcher.fetch(context.Background(), "git::https://example.com/vpc.git?ref=v1.0.0", "", filepath.Join(t.TempDir(), "git")); !errors.Is(err, errOffline) {
+		t.Errorf("expected the git fetch to fail offline, got %v", err)
+	}
+	if _, err := lsRemote(context.Background(), "https://example.com/vpc.git", "v1.0.0"); !errors.Is(err, errOffline) {
+		t.Errorf("expected git ls-remote to fail offline, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("expected no requests, got %d", requests)
+	}
+
+	// A filesystem mirror needs no network access.
+	fetcher = newModuleFetcher(nil, ModuleInstallation{FilesystemMirror: mirror})
+	if _, _, err := fetcher.fetch(context.Background(), "org/vpc/aws", "", filepath.Join(t.TempDir(), "mirrored")); err != nil {
+		t.Errorf("expected the filesystem mirror to work offline, got %v", err)
+	}
+}
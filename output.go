@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic replaces the file at path with data, so that readers and
+// interrupted runs see either the previous content or the new one, never a
+// partial file. The data is written to a temporary file in the same
+// directory, which is then renamed over path.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// Keep the mode of an existing file, such as an executable script.
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// outputFile collects what a command writes to stdout when --output is
+// given, and writes it atomically once the command succeeds.
+type outputFile struct {
+	path string
+	buf  bytes.Buffer
+}
+
+// newOutput returns the writer for a command's output: stdout when path is
+// empty, or an outputFile to commit to path.
+func newOutput(path string) (io.Writer, *outputFile) {
+	if path == "" {
+		return os.Stdout, nil
+	}
+	o := &outputFile{path: path}
+	return &o.buf, o
+}
+
+// close writes the collected output to the file unless the command failed
+// with exit code code, leaving an existing file untouched, and returns the
+// exit code of the command. A nil outputFile does nothing.
+func (o *outputFile) close(code int) int {
+	if o == nil || code == exitError {
+		return code
+	}
+	if err := writeFileAtomic(o.path, o.buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		return exitError
+	}
+	return code
+}
+
+// renderToFile returns a formatter that renders with render and atomically
+// replaces the file at path with the result, ignoring the writer it is
+// given. It is used by --output in --watch mode.
+func renderToFile(path string, render formatter) formatter {
+	return func(w io.Writer, output *Output, opts renderOptions) error {
+		var buf bytes.Buffer
+		if err := render(&buf, output, opts); err != nil {
+			return err
+		}
+		return writeFileAtomic(path, buf.Bytes(), 0644)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "atlantis.yaml")
+
+	if err := writeFileAtomic(path, []byte("first\n"), 0644); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("second\n"), 0644); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second\n" {
+		t.Errorf("expected replaced content, got %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("expected the existing mode to be kept, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected no temporary files to remain, got %v", entries)
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	if w, o := newOutput(""); w != os.Stdout || o != nil {
+		t.Errorf("expected stdout without a path, got %v, %v", w, o)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.json")
+	if err := os.WriteFile(path, []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, o := newOutput(path)
+	io.WriteString(w, "partial")
+	if code := o.close(exitError); code != exitError {
+		t.Errorf("expected exit code %d, got %d", exitError, code)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "previous" {
+		t.Errorf("expected a failed command to leave the file untouched, got %q", data)
+	}
+
+	w, o = newOutput(path)
+	io.WriteString(w, "complete")
+	if code := o.close(exitNotAffected); code != exitNotAffected {
+		t.Errorf("expected exit code %d, got %d", exitNotAffected, code)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "complete" {
+		t.Errorf("expected the output to be written, got %q", data)
+	}
+}
+
+func TestRenderToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	render := renderToFile(path, renderJSON)
+	if err := render(io.Discard, &Output{SchemaVersion: outputSchemaVersion}, renderOptions{}); err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 || data[0] != '{' {
+		t.Errorf("expected JSON output in the file, got %q", data)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// PathsFilter is a filter of the dorny/paths-filter GitHub Action: the globs
+// matching every file that can affect one discovered root.
+type PathsFilter struct {
+	Name  string
+	Globs []string
+}
+
+// BuildPathsFilters returns one filter per discovered root, named after the
+// root's path relative to baseDir, or per project, named after the project.
+// Globs cover the root and each local module directory it calls, directly
+// or transitively, and the project's variable files and inputs outside the
+// root, relative to dir, which should be the repository root the workflow
+// checks out.
+func BuildPathsFilters(discovery *Discovery, baseDir, dir string) []PathsFilter {
+	var filters []PathsFilter
+	for _, root := range discovery.Roots {
+		filters = append(filters, PathsFilter{Name: generatedRootName(root, baseDir), Globs: rootGlobs(root, dir, "paths-filter")})
+	}
+	return filters
+}
+
+// generatedRootName returns the name of root in generated CI
+// configuration: its project, or its path relative to baseDir.
+func generatedRootName(root Root, baseDir string) string {
+	if root.Project != "" {
+		return root.Project
+	}
+	name, err := filepath.Rel(baseDir, root.Path)
+	if err != nil || name == "." {
+		name = filepath.Base(root.Path)
+	}
+	return filepath.ToSlash(name)
+}
+
+// rootGlobs returns the globs, relative to dir, matching every file that
+// can affect root: its project's variable files and inputs outside the
+// root, and the root and each local module directory it calls. Files
+// outside dir are reported with a warning naming the format that cannot
+// match them.
+func rootGlobs(root Root, dir, format string) []string {
+	var globs []string
+	for _, f := range slices.Concat(root.VarFiles, root.Inputs) {
+		if isInDirectory(f, root.Path) {
+			continue
+		}
+		rel, err := filepath.Rel(dir, f)
+		if err != nil || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			fmt.Fprintf(os.Stderr, "Warning: %s is outside %s and cannot be matched by %s\n", f, dir, format)
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if info, err := os.Stat(f); err == nil && info.IsDir() {
+			rel += "/**"
+		}
+		globs = append(globs, rel)
+	}
+	for _, moduleDir := range append([]string{root.Path}, localModulePaths(root.Analysis)...) {
+		rel, err := filepath.Rel(dir, moduleDir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			fmt.Fprintf(os.Stderr, "Warning: %s is outside %s and cannot be matched by %s\n", moduleDir, dir, format)
+			continue
+		}
+		if rel == "." {
+			globs = append(globs, "**")
+		} else {
+			globs = append(globs, filepath.ToSlash(rel)+"/**")
+		}
+	}
+	return globs
+}
+
+// yamlQuote returns s as a single-quoted YAML scalar.
+func yamlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// writePathsFilters writes filters in the YAML accepted by the filters
+// input of dorny/paths-filter.
+func writePathsFilters(w io.Writer, filters []PathsFilter) {
+	fmt.Fprintf(w, "# Generated by %s discover --format paths-filter.\n", programName)
+	for _, filter := range filters {
+		fmt.Fprintf(w, "%s:\n", yamlQuote(filter.Name))
+		for _, glob := range filter.Globs {
+			fmt.Fprintf(w, "  - %s\n", yamlQuote(glob))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildPathsFilters(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"infra/envs/prod/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+`,
+		"infra/modules/app/main.tf": `
+module "vpc" {
+  source = "../vpc"
+}
+`,
+		"infra/modules/vpc/main.tf": `variable "cidr" {}`,
+		"infra/global/main.tf":      `variable "name" {}`,
+	})
+	baseDir := filepath.Join(tempDir, "infra")
+
+	discovery, err := Discover(baseDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	filters := BuildPathsFilters(discovery, baseDir, tempDir)
+
+	expected := []PathsFilter{
+		{Name: "envs/prod", Globs: []string{"infra/envs/prod/**", "infra/modules/app/**", "infra/modules/vpc/**"}},
+		{Name: "global", Globs: []string{"infra/global/**"}},
+	}
+	if !reflect.DeepEqual(filters, expected) {
+		t.Errorf("expected %+v, got %+v", expected, filters)
+	}
+
+	var b strings.Builder
+	writePathsFilters(&b, filters[1:])
+	if !strings.HasSuffix(b.String(), "'global':\n  - 'infra/global/**'\n") {
+		t.Errorf("unexpected YAML:\n%s", b.String())
+	}
+}
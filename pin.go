@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// commitSHAPattern matches full SHA-1 and SHA-256 git commit IDs.
+var commitSHAPattern = regexp.MustCompile(`^(?:[0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// PinRewrite replaces the branch or tag ref of a git module source with the
+// commit it currently points to. Ref is empty for sources that follow the
+// default branch.
+type PinRewrite struct {
+	File         string `json:"file"`
+	Module       string `json:"module"`
+	Source       string `json:"source"`
+	Ref          string `json:"ref,omitempty"`
+	Commit       string `json:"commit"`
+	PinnedSource string `json:"pinned_source"`
+}
+
+// Pin plans pinning every git module call of the root module at dir, and
+// of the local modules it calls, to a commit SHA. Refs are resolved with
+// git ls-remote; calls already pinned to a full commit SHA are skipped.
+// With rewrite, the module blocks are edited in place.
+func Pin(ctx context.Context, dir string, rewrite bool) ([]PinRewrite, error) {
+	output, err := AnalyzeContext(ctx, dir, AnalyzeOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	type callSite struct{ caller, name string }
+	seen := make(map[callSite]bool)
+	commits := make(map[[2]string]string)
+	rewrites := []PinRewrite{}
+	for _, remote := range output.RemoteModules {
+		site := callSite{remote.CallerPath, remote.Name}
+		if !isGitSource(remote.Source) || commitSHAPattern.MatchString(remote.Ref) || seen[site] {
+			continue
+		}
+		seen[site] = true
+
+		repo := remoteSourceURL(remote.Source, "")
+		key := [2]string{repo, remote.Ref}
+		commit, ok := commits[key]
+		if !ok {
+			commit, err = lsRemote(ctx, repo, remote.Ref)
+			if err != nil {
+				return nil, fmt.Errorf("module %q: %w", remote.Name, err)
+			}
+			commits[key] = commit
+		}
+		block, err := findModuleBlock(remote.CallerPath, remote.Name)
+		if err != nil {
+			return nil, err
+		}
+		rewrites = append(rewrites, PinRewrite{
+			File:         block.DefRange.Filename,
+			Module:       remote.Name,
+			Source:       remote.Source,
+			Ref:          remote.Ref,
+			Commit:       commit,
+			PinnedSource: withGitRef(remote.Source, commit),
+		})
+	}
+	sort.SliceStable(rewrites, func(i, j int) bool { return rewrites[i].File < rewrites[j].File })
+
+	if rewrite {
+		if err := applyPinRewrites(rewrites); err != nil {
+			return nil, err
+		}
+	}
+	return rewrites, nil
+}
+
+// lsRemote returns the commit that ref, a tag or branch name, or the
+// default branch when ref is empty, points to in repo. Annotated tags are
+// resolved to the commit they tag, and tags take precedence over branches
+// of the same name, as with git checkout.
+func lsRemote(ctx context.Context, repo, ref string) (string, error) {
+	candidates := []string{"HEAD"}
+	args := []string{"ls-remote", "--", repo}
+	if ref != "" {
+		candidates = []string{"refs/tags/" + ref + "^{}", "refs/tags/" + ref, "refs/heads/" + ref, ref}
+		args = append(args, ref, ref+"^{}")
+	} else {
+		args = append(args, "HEAD")
+	}
+	if err := checkOnline("git ls-remote " + repo); err != nil {
+		return "", err
+	}
+	var out []byte
+	err := withRetries(ctx, func() error {
+		var err error
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Env = append(os.Environ(), gitEnv()...)
+		out, err = cmd.Output()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("git ls-remote %s: %v: %s", repo, err, strings.TrimSpace(string(exitErr.Stderr)))
+		} else if err != nil {
+			err = fmt.Errorf("git ls-remote %s: %v", repo, err)
+		}
+		return temporaryUnlessDone(ctx, err)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	refs := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		if commit, name, ok := strings.Cut(scanner.Text(), "\t"); ok {
+			refs[name] = commit
+		}
+	}
+	for _, name := range candidates {
+		if commit, ok := refs[name]; ok {
+			return commit, nil
+		}
+	}
+	if ref == "" {
+		return "", fmt.Errorf("%s has no default branch", repo)
+	}
+	return "", fmt.Errorf("%s has no branch or tag %q", repo, ref)
+}
+
+// withGitRef returns source with its ref query parameter set to ref,
+// keeping the other parameters and the subdirectory as written.
+func withGitRef(source, ref string) string {
+	base, query, ok := strings.Cut(source, "?")
+	if !ok {
+		return source + "?ref=" + ref
+	}
+	params := strings.Split(query, "&")
+	replaced := false
+	for i, p := range params {
+		if strings.HasPrefix(p, "ref=") {
+			params[i] = "ref=" + ref
+			replaced = true
+		}
+	}
+	if !replaced {
+		params = append(params, "ref="+ref)
+	}
+	return base + "?" + strings.Join(params, "&")
+}
+
+// applyPinRewrites edits the module blocks named by rewrites.
+func applyPinRewrites(rewrites []PinRewrite) error {
+	byFile := make(map[string][]PinRewrite)
+	var files []string
+	for _, r := range rewrites {
+		if _, ok := byFile[r.File]; !ok {
+			files = append(files, r.File)
+		}
+		byFile[r.File] = append(byFile[r.File], r)
+	}
+	for _, path := range files {
+		err := editModuleBlocks(path, func(name string, body *hclwrite.Body) {
+			for _, r := range byFile[path] {
+				if r.Module == name {
+					body.SetAttributeValue("source", cty.StringVal(r.PinnedSource))
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePinRewrites(w io.Writer, rewrites []PinRewrite) {
+	for _, r := range rewrites {
+		fmt.Fprintf(w, "%s\tmodule.%s\t%s => %s\n", r.File, r.Module, r.Source, r.PinnedSource)
+	}
+}
+
+func runPin(args []string) int {
+	flags := newFlagSet("pin")
+	rewrite := flags.Bool("rewrite", false, "rewrite the module sources to the commit SHAs instead of only reporting them")
+	format := flags.String("format", "text", "output format: text or json")
+	timeout := flags.Duration("timeout", 5*time.Minute, "abort after this duration (0 means no limit)")
+	addNetworkFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s pin [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Resolve the branch and tag refs of the git module sources called by a root\n")
+		fmt.Fprintf(flags.Output(), "module, and the local modules it calls, to commit SHAs with git ls-remote,\n")
+		fmt.Fprintf(flags.Output(), "and report or rewrite the sources pinned to them.\n")
+		fmt.Fprintf(flags.Output(), "Exit codes: 0=all git sources pinned (or rewritten with --rewrite), 1=unpinned sources found, 2=error\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+
+	ctx, cancel := analysisContext(*timeout)
+	defer cancel()
+	rewrites, err := Pin(ctx, flags.Arg(0), *rewrite)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	if *format == "json" {
+		jsonOutput, _ := json.MarshalIndent(rewrites, "", "  ")
+		fmt.Println(string(jsonOutput))
+	} else {
+		writePinRewrites(os.Stdout, rewrites)
+	}
+	if !*rewrite && len(rewrites) > 0 {
+		return exitInvalid
+	}
+	return exitValid
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPin(t *testing.T) {
+	repo := t.TempDir()
+	initGitRepo(t, repo, map[string]string{"dns/main.tf": `variable "zone" {}`}, "v1.0.0")
+	out, err := exec.Command("git", "-C", repo, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := strings.TrimSpace(string(out))
+
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"main.tf": `
+module "dns" {
+  source = "git::file://` + repo + `//dns?ref=v1.0.0&depth=1"
+}
+
+module "latest" {
+  source = "git::file://` + repo + `"
+}
+
+module "pinned" {
+  source = "git::file://` + repo + `?ref=` + commit + `"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+	})
+
+	rewrites, err := Pin(context.Background(), root, false)
+	if err != nil {
+		t.Fatalf("Pin failed: %v", err)
+	}
+	if len(rewrites) != 2 {
+		t.Fatalf("expected 2 rewrites, got %+v", rewrites)
+	}
+	dns, latest := rewrites[0], rewrites[1]
+	if dns.Module != "dns" || dns.Ref != "v1.0.0" || dns.Commit != commit || dns.File != filepath.Join(root, "main.tf") {
+		t.Errorf("unexpected dns rewrite %+v", dns)
+	}
+	if expected := "git::file://" + repo + "//dns?ref=" + commit + "&depth=1"; dns.PinnedSource != expected {
+		t.Errorf("expected pinned source %s, got %s", expected, dns.PinnedSource)
+	}
+	if latest.Module != "latest" || latest.Ref != "" || latest.PinnedSource != "git::file://"+repo+"?ref="+commit {
+		t.Errorf("expected the default branch to be pinned, got %+v", latest)
+	}
+
+	if _, err := Pin(context.Background(), root, true); err != nil {
+		t.Fatalf("Pin with rewrite failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "main.tf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "ref=v1.0.0") || strings.Count(string(data), commit) != 3 {
+		t.Errorf("expected every git source to be pinned, got:\n%s", data)
+	}
+	if rewrites, err := Pin(context.Background(), root, false); err != nil || len(rewrites) != 0 {
+		t.Errorf("expected nothing left to pin, got %+v (%v)", rewrites, err)
+	}
+}
+
+func TestPin_UnknownRef(t *testing.T) {
+	repo := t.TempDir()
+	initGitRepo(t, repo, map[string]string{"main.tf": ""}, "v1.0.0")
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"main.tf": `
+module "dns" {
+  source = "git::file://` + repo + `?ref=v9.9.9"
+}
+`,
+	})
+	if _, err := Pin(context.Background(), root, false); err == nil || !strings.Contains(err.Error(), `no branch or tag "v9.9.9"`) {
+		t.Errorf("expected an unknown ref error, got %v", err)
+	}
+}
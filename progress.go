@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// progressTerminalInterval is the minimum time between updates on a
+	// terminal, where each update replaces the previous line.
+	progressTerminalInterval = 100 * time.Millisecond
+
+	// progressLogInterval is the minimum time between the lines printed
+	// when the writer is not a terminal, such as a CI log.
+	progressLogInterval = 2 * time.Second
+)
+
+// Progress reports the progress of long scans and downloads, typically on
+// stderr. Updates are throttled: on a terminal each one replaces the status
+// line, elsewhere at most one line is printed per interval so CI logs show
+// that the run is alive. All methods are safe for concurrent use, and a nil
+// *Progress discards updates.
+type Progress struct {
+	w        io.Writer
+	terminal bool
+	interval time.Duration
+	start    time.Time
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewProgress returns a Progress writing to w.
+func NewProgress(w io.Writer) *Progress {
+	p := &Progress{w: w, interval: progressLogInterval, start: time.Now()}
+	if isTerminal(w) {
+		p.terminal = true
+		p.interval = progressTerminalInterval
+	}
+	return p
+}
+
+// Update reports the current status unless an update was reported less
+// than one interval ago.
+func (p *Progress) Update(format string, args ...any) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if now.Sub(p.last) < p.interval {
+		return
+	}
+	p.last = now
+	p.print(fmt.Sprintf(format, args...), false)
+}
+
+// Done reports the final status with the elapsed time, always printed on
+// its own line.
+func (p *Progress) Done(format string, args ...any) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elapsed := time.Since(p.start).Round(time.Millisecond)
+	p.print(fmt.Sprintf(format, args...)+fmt.Sprintf(" in %s", elapsed), true)
+}
+
+func (p *Progress) print(status string, final bool) {
+	if !p.terminal {
+		fmt.Fprintf(p.w, "Progress: %s\n", status)
+		return
+	}
+	// Clear the previous status line before drawing the new one.
+	fmt.Fprintf(p.w, "\r\033[K%s", status)
+	if final {
+		fmt.Fprintln(p.w)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	progress := NewProgress(&buf)
+
+	progress.Update("step %d", 1)
+	progress.Update("step %d", 2)
+	progress.Done("finished %d steps", 2)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected the second update to be throttled, got %q", buf.String())
+	}
+	if lines[0] != "Progress: step 1" {
+		t.Errorf("unexpected update line %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "Progress: finished 2 steps in ") {
+		t.Errorf("unexpected final line %q", lines[1])
+	}
+
+	var nilProgress *Progress
+	nilProgress.Update("ignored")
+	nilProgress.Done("ignored")
+}
+
+func TestAnalyze_Progress(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+
+	var buf bytes.Buffer
+	if _, err := AnalyzeWithOptions(filepath.Join(tempDir, "root"), AnalyzeOptions{Progress: NewProgress(&buf)}); err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "Progress: loaded 1 of ") {
+		t.Errorf("expected a progress line for the first directory, got %q", buf.String())
+	}
+}
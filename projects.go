@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Project is a named deployment of a root module, such as one environment
+// of a root applied with its own variable files and workspace. Inputs are
+// the other files only this environment reads, such as a backend
+// configuration: files or directories, optionally with filepath.Match
+// wildcards, like envs/prod/*.tfvars.
+type Project struct {
+	Name      string   `json:"name"`
+	Dir       string   `json:"dir"`
+	VarFiles  []string `json:"var_files,omitempty"`
+	Inputs    []string `json:"inputs,omitempty"`
+	Workspace string   `json:"workspace,omitempty"`
+}
+
+// validateProjects checks that every project has a directory and a name
+// that no other project uses, and that its inputs are valid patterns.
+func validateProjects(projects []Project) error {
+	names := make(map[string]bool)
+	for i, p := range projects {
+		if p.Name == "" {
+			return fmt.Errorf("project %d has no name", i+1)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate project %q", p.Name)
+		}
+		names[p.Name] = true
+		if p.Dir == "" {
+			return fmt.Errorf("project %q has no dir", p.Name)
+		}
+		for _, input := range p.Inputs {
+			if _, err := filepath.Match(filepath.FromSlash(input), ""); err != nil {
+				return fmt.Errorf("project %q: invalid input %q: %w", p.Name, input, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyProjects replaces every discovered root that projects are declared
+// for with one root per project, in the order of projects, so that each
+// project is detected as affected and generated on its own. Roots without
+// projects are kept. Roots split into projects are removed from their
+// applications, and projects under baseDir whose directory is not a
+// discovered root are reported with a warning.
+func ApplyProjects(discovery *Discovery, projects []Project, baseDir string) {
+	if len(projects) == 0 {
+		return
+	}
+	byDir := make(map[string][]Project)
+	for _, p := range projects {
+		byDir[p.Dir] = append(byDir[p.Dir], p)
+	}
+
+	var roots []Root
+	found := make(map[string]bool)
+	for _, root := range discovery.Roots {
+		ps, ok := byDir[root.Path]
+		if !ok {
+			roots = append(roots, root)
+			continue
+		}
+		found[root.Path] = true
+		for _, p := range ps {
+			roots = append(roots, Root{
+				Path:      root.Path,
+				Project:   p.Name,
+				VarFiles:  p.VarFiles,
+				Inputs:    slices.Concat(root.Inputs, p.Inputs),
+				Workspace: p.Workspace,
+				Stack:     root.Stack,
+				Analysis:  root.Analysis,
+			})
+		}
+	}
+	discovery.Roots = roots
+
+	// An application whose roots are split into projects no longer
+	// groups identical environments.
+	var apps []Application
+	for _, app := range discovery.Applications {
+		if slices.ContainsFunc(app.Roots, func(dir string) bool { return found[dir] }) {
+			for i := range discovery.Roots {
+				if discovery.Roots[i].Application == app.Name {
+					discovery.Roots[i].Application = ""
+				}
+			}
+			continue
+		}
+		apps = append(apps, app)
+	}
+	discovery.Applications = apps
+
+	for _, p := range projects {
+		if !found[p.Dir] && isInDirectory(p.Dir, baseDir) {
+			fmt.Fprintf(os.Stderr, "Warning: project %s: %s is not a discovered root\n", p.Name, p.Dir)
+		}
+	}
+}
+
+// rootName returns the name a root is reported under: its project, or its
+// directory relative to the working directory.
+func rootName(path, project string) string {
+	if project != "" {
+		return project
+	}
+	return workingDirRel(path)
+}
+
+// varFileArgs returns the -var-file arguments selecting the variable files
+// of a project, relative to its root directory where Terraform runs.
+func varFileArgs(root string, varFiles []string) []string {
+	var args []string
+	for _, f := range varFiles {
+		if rel, err := filepath.Rel(root, f); err == nil {
+			f = filepath.ToSlash(rel)
+		}
+		args = append(args, "-var-file="+f)
+	}
+	return args
+}
+
+// isProjectInput reports whether the absolute path is a variable file of
+// the project of root or matches one of its inputs.
+func isProjectInput(root Root, absPath string) bool {
+	if slices.Contains(root.VarFiles, absPath) {
+		return true
+	}
+	for _, input := range root.Inputs {
+		if ok, _ := filepath.Match(input, absPath); ok || isInDirectory(absPath, input) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasProjectInputs reports whether any project among roots has variable
+// files or inputs.
+func hasProjectInputs(roots []Root) bool {
+	return slices.ContainsFunc(roots, func(root Root) bool {
+		return len(root.VarFiles) > 0 || len(root.Inputs) > 0
+	})
+}
+
+// isRootAffected reports whether changedFiles affect the module tree of
+// root or include one of its project's variable files or inputs. As in
+// Terramate, any file in the directory of a stack affects it.
+func isRootAffected(root Root, changedFiles []string) bool {
+	if IsAffected(changedFiles, root.Analysis) {
+		return true
+	}
+	for _, f := range changedFiles {
+		absPath := toAbsPath(f)
+		if isProjectInput(root, absPath) || root.Stack != nil && isInDirectory(absPath, root.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// varFilesEnv returns the TFMR_VAR_FILES value of a project: its
+// -var-file arguments separated by spaces, for use as
+// terraform plan $TFMR_VAR_FILES.
+func varFilesEnv(root string, varFiles []string) string {
+	return strings.Join(varFileArgs(root, varFiles), " ")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyProjects(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"infra/app/main.tf":        `module "net" { source = "../modules/net" }`,
+		"infra/modules/net/net.tf": `variable "cidr" {}`,
+		"infra/app/prod.tfvars":    `x = 1`,
+		"infra/vars/dev.tfvars":    `x = 2`,
+		"infra/dns/main.tf":        `variable "zone" {}`,
+		"infra/.terraform-module-resolve.json": `{
+  "projects": [
+    {"name": "app-prod", "dir": "app", "var_files": ["app/prod.tfvars"], "workspace": "prod"},
+    {"name": "app-dev", "dir": "app", "var_files": ["vars/dev.tfvars"], "workspace": "dev"}
+  ]
+}`,
+	})
+	t.Chdir(tempDir)
+
+	config, err := LoadConfig(filepath.Join("infra", defaultConfigFile))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	app := filepath.Join(tempDir, "infra", "app")
+	if p := config.Projects[1]; p.Dir != app || !reflect.DeepEqual(p.VarFiles, []string{filepath.Join(tempDir, "infra", "vars", "dev.tfvars")}) {
+		t.Errorf("expected project paths resolved against the config directory, got %+v", p)
+	}
+
+	discovery, err := Discover("infra")
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	ApplyProjects(discovery, config.Projects, filepath.Join(tempDir, "infra"))
+	var names []string
+	for _, root := range discovery.Roots {
+		names = append(names, rootName(root.Path, root.Project))
+	}
+	if want := []string{"app-prod", "app-dev", "infra/dns"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected roots %v, got %v", want, names)
+	}
+
+	for _, tc := range []struct {
+		changed  string
+		expected []string
+	}{
+		{"infra/app/prod.tfvars", []string{"app-prod"}},
+		{"infra/vars/dev.tfvars", []string{"app-dev"}},
+		{"infra/modules/net/net.tf", []string{"app-prod", "app-dev"}},
+	} {
+		result := FindAffectedRoots(discovery, []string{tc.changed}, precedenceNearest)
+		if !reflect.DeepEqual(result.Projects, tc.expected) || len(result.Roots) != 0 {
+			t.Errorf("%s: expected projects %v, got %+v", tc.changed, tc.expected, result)
+		}
+	}
+
+	if got := varFilesEnv(app, discovery.Roots[1].VarFiles); got != "-var-file=../vars/dev.tfvars" {
+		t.Errorf("expected -var-file arguments relative to the root, got %q", got)
+	}
+
+	var b strings.Builder
+	writeRootPlanTargets(&b, discovery, RootAffectedResults(discovery, []string{"infra/app/prod.tfvars"}, precedenceNearest))
+	if b.String() != "app-prod\t\n" {
+		t.Errorf("expected an untargeted plan of the project, got %q", b.String())
+	}
+}
+
+func TestValidateProjects(t *testing.T) {
+	for _, projects := range [][]Project{
+		{{Dir: "app"}},
+		{{Name: "app"}},
+		{{Name: "app", Dir: "app"}, {Name: "app", Dir: "other"}},
+	} {
+		if err := validateProjects(projects); err == nil {
+			t.Errorf("expected an error for %+v", projects)
+		}
+	}
+}
+
+func TestExecRoots_Projects(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{"app/main.tf": `variable "x" {}`})
+	t.Chdir(tempDir)
+	app := filepath.Join(tempDir, "app")
+	roots := []ExecRoot{
+		{Path: app, Project: "prod", Workspace: "prod", VarFiles: []string{filepath.Join(app, "prod.tfvars")}},
+		{Path: app, Project: "dev", Workspace: "dev"},
+	}
+
+	script := `echo "$TFMR_PROJECT $TF_WORKSPACE $TFMR_VAR_FILES"; test "$TFMR_PROJECT" = dev`
+	results, err := ExecRoots(t.Context(), roots, []string{"sh", "-c", script}, ExecOptions{Parallel: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Output != "prod prod -var-file=prod.tfvars\n" {
+		t.Errorf("unexpected project environment %q", results[0].Output)
+	}
+	if results[1].Skipped() || results[1].Failed() {
+		t.Errorf("expected projects of one directory to run in turn without skipping, got %+v", results[1])
+	}
+}
+
+func TestFindAffectedRoots_ProjectInputs(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"app/main.tf":              `variable "x" {}`,
+		"app/backend-prod.hcl":     `bucket = "prod"`,
+		"envs/prod/prod.tfvars":    `x = 1`,
+		"envs/prod/backend.hcl":    `bucket = "prod"`,
+		"envs/dev/dev.tfvars":      `x = 2`,
+		"envs/dev/shared/x.tfvars": `x = 3`,
+		".terraform-module-resolve.json": `{
+  "projects": [
+    {"name": "prod", "dir": "app", "inputs": ["envs/prod", "app/backend-prod.hcl"]},
+    {"name": "dev", "dir": "app", "inputs": ["envs/dev/*.tfvars"]}
+  ]
+}`,
+	})
+	t.Chdir(tempDir)
+
+	config, err := LoadConfig(defaultConfigFile)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	discovery, err := Discover(".")
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	ApplyProjects(discovery, config.Projects, tempDir)
+
+	for _, tc := range []struct {
+		changed  string
+		expected []string
+	}{
+		{"envs/prod/backend.hcl", []string{"prod"}},
+		{"app/backend-prod.hcl", []string{"prod"}},
+		{"envs/dev/dev.tfvars", []string{"dev"}},
+		{"envs/dev/shared/x.tfvars", nil},
+		{"app/main.tf", []string{"prod", "dev"}},
+	} {
+		result := FindAffectedRoots(discovery, []string{tc.changed}, precedenceNearest)
+		if !reflect.DeepEqual(result.Projects, tc.expected) {
+			t.Errorf("%s: expected projects %v, got %v", tc.changed, tc.expected, result.Projects)
+		}
+	}
+
+	filters := BuildPathsFilters(discovery, tempDir, tempDir)
+	if want := []string{"envs/prod/**", "app/**"}; !reflect.DeepEqual(filters[0].Globs, want) {
+		t.Errorf("expected input globs %v, got %v", want, filters[0].Globs)
+	}
+
+	if err := validateProjects([]Project{{Name: "prod", Dir: "app", Inputs: []string{"envs/[prod"}}}); err == nil {
+		t.Error("expected an error for an invalid input pattern")
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// callGraph is the module call graph of the discovered roots. Nodes are
+// the directories of roots and local modules, by absolute path, and remote
+// modules, by remoteModuleKey. Query arguments and results name
+// directories relative to dir, or to the working directory when it is
+// empty.
+type callGraph struct {
+	roots   []string
+	callees map[string][]string
+	callers map[string][]string
+	dir     string
+}
+
+func newCallGraph(discovery *Discovery) *callGraph {
+	g := &callGraph{callees: make(map[string][]string), callers: make(map[string][]string)}
+	for _, root := range discovery.Roots {
+		g.roots = append(g.roots, root.Path)
+		g.addNode(root.Path)
+		for _, m := range root.Analysis.LocalModules {
+			g.addEdge(m.CallerPath, m.ResolvedPath)
+		}
+		for _, m := range root.Analysis.RemoteModules {
+			g.addEdge(m.CallerPath, remoteModuleKey(m))
+		}
+	}
+	for _, edges := range []map[string][]string{g.callees, g.callers} {
+		for _, nodes := range edges {
+			sort.Strings(nodes)
+		}
+	}
+	return g
+}
+
+func (g *callGraph) addNode(node string) {
+	if _, ok := g.callees[node]; !ok {
+		g.callees[node] = nil
+		g.callers[node] = nil
+	}
+}
+
+func (g *callGraph) addEdge(from, to string) {
+	g.addNode(from)
+	g.addNode(to)
+	if !slices.Contains(g.callees[from], to) {
+		g.callees[from] = append(g.callees[from], to)
+		g.callers[to] = append(g.callers[to], from)
+	}
+}
+
+// node resolves a query argument: a remote module key, or a directory
+// relative to g.dir.
+func (g *callGraph) node(arg string) (string, error) {
+	if _, ok := g.callees[arg]; ok && !filepath.IsAbs(arg) {
+		return arg, nil
+	}
+	dir := toAbsPath(arg)
+	if g.dir != "" && !filepath.IsAbs(arg) {
+		dir = filepath.Join(g.dir, arg)
+	}
+	if _, ok := g.callees[dir]; ok {
+		return dir, nil
+	}
+	return "", fmt.Errorf("%s is not a module in the graph", arg)
+}
+
+// reachable returns the nodes reachable from node through edges, excluding
+// node itself, sorted.
+func reachable(node string, edges map[string][]string) []string {
+	seen := map[string]bool{node: true}
+	var found []string
+	queue := []string{node}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[n] {
+			if !seen[next] {
+				seen[next] = true
+				found = append(found, next)
+				queue = append(queue, next)
+			}
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// shortestPath returns the nodes of a shortest call chain from one node to
+// another, both included, or nil if from does not reach to.
+func (g *callGraph) shortestPath(from, to string) []string {
+	previous := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n == to {
+			var path []string
+			for ; n != from; n = previous[n] {
+				path = append(path, n)
+			}
+			path = append(path, from)
+			slices.Reverse(path)
+			return path
+		}
+		for _, next := range g.callees[n] {
+			if _, ok := previous[next]; !ok {
+				previous[next] = n
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// graphQueries lists the functions of graph query with their arity and
+// description.
+var graphQueries = map[string]struct {
+	args        int
+	description string
+	eval        func(g *callGraph, args []string) []string
+}{
+	"callers": {1, "modules and roots that call the module directly", func(g *callGraph, args []string) []string {
+		return g.callers[args[0]]
+	}},
+	"callees": {1, "modules the module calls directly", func(g *callGraph, args []string) []string {
+		return g.callees[args[0]]
+	}},
+	"dependencies": {1, "modules the module calls, directly or transitively", func(g *callGraph, args []string) []string {
+		return reachable(args[0], g.callees)
+	}},
+	"dependents": {1, "modules and roots that call the module, directly or transitively", func(g *callGraph, args []string) []string {
+		return reachable(args[0], g.callers)
+	}},
+	"roots": {1, "roots whose module tree includes the module", func(g *callGraph, args []string) []string {
+		var roots []string
+		for _, root := range g.roots {
+			if root == args[0] || slices.Contains(reachable(args[0], g.callers), root) {
+				roots = append(roots, root)
+			}
+		}
+		return roots
+	}},
+	"path": {2, "a shortest call chain from the first module to the second", func(g *callGraph, args []string) []string {
+		return g.shortestPath(args[0], args[1])
+	}},
+}
+
+var queryPattern = regexp.MustCompile(`^\s*([a-z]+)\s*\((.*)\)\s*$`)
+
+// query evaluates an expression such as callers(modules/vpc) or
+// path(envs/prod, modules/subnets) against g. Results name directories
+// relative to g.dir and remote modules by their address.
+func (g *callGraph) query(expr string) ([]string, error) {
+	m := queryPattern.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, fmt.Errorf("invalid query %q: expected function(argument, ...)", expr)
+	}
+	q, ok := graphQueries[m[1]]
+	if !ok {
+		return nil, fmt.Errorf("unknown query function %q", m[1])
+	}
+	var args []string
+	if strings.TrimSpace(m[2]) != "" {
+		for _, arg := range strings.Split(m[2], ",") {
+			args = append(args, strings.Trim(strings.TrimSpace(arg), `"'`))
+		}
+	}
+	if len(args) != q.args {
+		return nil, fmt.Errorf("%s takes %s, got %d", m[1], pluralize(q.args, "argument"), len(args))
+	}
+	for i, arg := range args {
+		node, err := g.node(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = node
+	}
+
+	results := []string{}
+	for _, node := range q.eval(g, args) {
+		if filepath.IsAbs(node) {
+			node = g.relative(node)
+		}
+		results = append(results, node)
+	}
+	return results, nil
+}
+
+// relative returns path relative to g.dir, or to the working directory
+// when it is empty, with forward slashes.
+func (g *callGraph) relative(path string) string {
+	if g.dir == "" {
+		return workingDirRel(path)
+	}
+	rel, err := filepath.Rel(g.dir, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func writeGraphQueryHelp(w io.Writer) {
+	names := make([]string, 0, len(graphQueries))
+	for name := range graphQueries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "Functions:\n")
+	for _, name := range names {
+		q := graphQueries[name]
+		params := "module"
+		if q.args == 2 {
+			params = "from, to"
+		}
+		fmt.Fprintf(w, "  %-24s %s\n", name+"("+params+")", q.description)
+	}
+}
+
+func runGraph(args []string) int {
+	flags := newFlagSet("graph")
+	format := flags.String("format", "text", "output format: text, one module per line, or json")
+	configPath := flags.String("config", "", "configuration file (default "+defaultConfigFile+" in the working directory, if present)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s graph query [options] <directory> <expression>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Evaluate a query against the module call graph of the roots under a\n")
+		fmt.Fprintf(flags.Output(), "directory (exit 0=results, 1=no results). Modules are directories relative to\n")
+		fmt.Fprintf(flags.Output(), "the working directory or remote module addresses; path lists the modules of\n")
+		fmt.Fprintf(flags.Output(), "the chain in call order.\n\n")
+		writeGraphQueryHelp(flags.Output())
+		fmt.Fprintf(flags.Output(), "\nOptions:\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\nExamples:\n")
+		fmt.Fprintf(flags.Output(), "  %s graph query infra 'callers(infra/modules/vpc)'\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  %s graph query infra 'path(infra/envs/prod, infra/modules/subnets)'\n", os.Args[0])
+	}
+	query := len(args) > 0 && args[0] == "query"
+	if query {
+		args = args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if !query || flags.NArg() != 2 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	discovery, err := DiscoverWithOptions(flags.Arg(0), config.analyzeOptions())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	results, err := newCallGraph(discovery).query(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	if *format == "json" {
+		jsonOutput, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(jsonOutput))
+	} else {
+		for _, r := range results {
+			fmt.Println(r)
+		}
+	}
+	if len(results) == 0 {
+		return exitNotAffected
+	}
+	return exitAffected
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCallGraphQuery(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+		"envs/dev/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`,
+		"modules/app/main.tf": `
+module "vpc" {
+  source = "../vpc"
+}
+`,
+		"modules/vpc/main.tf": `
+module "subnets" {
+  source = "./subnets"
+}
+`,
+		"modules/vpc/subnets/main.tf": `variable "cidr" {}`,
+	})
+	t.Chdir(tempDir)
+
+	discovery, err := Discover("envs")
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	g := newCallGraph(discovery)
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"callers(modules/vpc)", []string{"envs/dev", "modules/app"}},
+		{"callees(envs/prod)", []string{"modules/app", "registry.terraform.io/cloudposse/label/null"}},
+		{"dependencies(envs/prod)", []string{"modules/app", "modules/vpc", "modules/vpc/subnets", "registry.terraform.io/cloudposse/label/null"}},
+		{"dependents(modules/vpc/subnets)", []string{"envs/dev", "envs/prod", "modules/app", "modules/vpc"}},
+		{"roots(modules/app)", []string{"envs/prod"}},
+		{"roots(registry.terraform.io/cloudposse/label/null)", []string{"envs/prod"}},
+		{" path( envs/prod, 'modules/vpc/subnets' ) ", []string{"envs/prod", "modules/app", "modules/vpc", "modules/vpc/subnets"}},
+		{"path(envs/dev, modules/app)", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := g.query(tt.query)
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			if !reflect.DeepEqual(results, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, results)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"callers", "unknown(envs/prod)", "path(envs/prod)", "callers(modules/missing)"} {
+		if _, err := g.query(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
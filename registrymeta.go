@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// RegistryMetadata describes the version of a registry module that a call
+// selects, as published by its registry: the version, its description,
+// when it was published and whether the registry marks the module
+// verified.
+type RegistryMetadata struct {
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+	PublishedAt string `json:"published_at,omitempty"`
+	Verified    bool   `json:"verified"`
+}
+
+// EnrichRegistryMetadata sets the Metadata of every registry module call in
+// output from the module registry API of its host. The version described
+// is the installed version when known, or else the newest version matching
+// the call's constraint. Mirrors do not serve metadata, so the origin
+// registries are always contacted. Modules a registry does not have are
+// left without metadata; other errors, such as an unreachable registry,
+// abort the enrichment.
+func EnrichRegistryMetadata(ctx context.Context, output *Output, client *http.Client) error {
+	fetcher := newModuleFetcher(client, ModuleInstallation{})
+	registry := registryAPI{fetcher: fetcher}
+	fetched := make(map[string]*RegistryMetadata) // address and version -> metadata
+	for i := range output.RemoteModules {
+		remote := &output.RemoteModules[i]
+		if remote.Registry == nil {
+			continue
+		}
+		addr := remote.Registry
+		version := remote.InstalledVersion
+		if version == "" {
+			module, err := registry.versions(ctx, addr.Host, addr.path())
+			if errors.Is(err, errNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			version, err = latestAllowedVersion(module.versionNames(), remote.Version)
+			if err != nil {
+				continue
+			}
+		}
+
+		key := addr.Address + "@" + version
+		metadata, ok := fetched[key]
+		if !ok {
+			var err error
+			metadata, err = registry.metadata(ctx, addr.Host, addr.path(), version)
+			if err != nil && !errors.Is(err, errNotFound) {
+				return err
+			}
+			fetched[key] = metadata
+		}
+		remote.Metadata = metadata
+	}
+	return nil
+}
+
+// metadata returns the published metadata of a version of a module.
+func (r registryAPI) metadata(ctx context.Context, host, path, version string) (*RegistryMetadata, error) {
+	api, err := r.base(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var metadata RegistryMetadata
+	if err := r.fetcher.getJSON(ctx, api.JoinPath(path, strings.TrimPrefix(version, "v")).String(), &metadata); err != nil {
+		return nil, err
+	}
+	if metadata.Version == "" {
+		metadata.Version = version
+	}
+	return &metadata, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnrichRegistryMetadata(t *testing.T) {
+	metadataRequests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/terraform.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"modules.v1": "/api/modules/v1/"}`))
+	})
+	mux.HandleFunc("/api/modules/v1/org/vpc/aws/versions", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"modules":[{"versions":[{"version":"1.0.0"},{"version":"1.2.0"},{"version":"2.0.0"}]}]}`))
+	})
+	mux.HandleFunc("/api/modules/v1/org/vpc/aws/1.2.0", func(w http.ResponseWriter, r *http.Request) {
+		metadataRequests++
+		w.Write([]byte(`{"version":"1.2.0","description":"A VPC","published_at":"2024-05-01T10:00:00Z","verified":true,"downloads":42}`))
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source  = "` + host + `/org/vpc/aws"
+  version = "~> 1.0"
+}
+
+module "vpc_copy" {
+  source  = "` + host + `/org/vpc/aws"
+  version = "~> 1.1"
+}
+
+module "missing" {
+  source = "` + host + `/org/missing/aws"
+}
+
+module "label" {
+  source = "git::https://example.com/label.git"
+}
+`,
+	})
+	output, err := Analyze(tempDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if err := EnrichRegistryMetadata(t.Context(), output, server.Client()); err != nil {
+		t.Fatalf("EnrichRegistryMetadata failed: %v", err)
+	}
+
+	expected := &RegistryMetadata{Version: "1.2.0", Description: "A VPC", PublishedAt: "2024-05-01T10:00:00Z", Verified: true}
+	for _, remote := range output.RemoteModules {
+		switch remote.Name {
+		case "vpc", "vpc_copy":
+			if !reflect.DeepEqual(remote.Metadata, expected) {
+				t.Errorf("expected %s to have %+v, got %+v", remote.Name, expected, remote.Metadata)
+			}
+		default:
+			if remote.Metadata != nil {
+				t.Errorf("expected no metadata for %s, got %+v", remote.Name, remote.Metadata)
+			}
+		}
+	}
+	if metadataRequests != 1 {
+		t.Errorf("expected the metadata of a version to be fetched once, got %d requests", metadataRequests)
+	}
+}
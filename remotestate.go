@@ -0,0 +1,191 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// stateLocation identifies where a root stores its state, or which state a
+// terraform_remote_state data source reads: a backend type and the constant
+// string settings of its configuration. Nested settings are keyed by their
+// dotted path, such as workspaces.name.
+type stateLocation struct {
+	Backend string
+	Config  map[string]string
+}
+
+// stateIdentityKeys lists the settings that identify a state of a backend
+// type. Backends not listed are compared on every setting of the root.
+var stateIdentityKeys = map[string][]string{
+	"azurerm": {"storage_account_name", "container_name", "key"},
+	"consul":  {"path"},
+	"gcs":     {"bucket", "prefix"},
+	"http":    {"address"},
+	"local":   {"path"},
+	"remote":  {"organization", "workspaces.name"},
+	"s3":      {"bucket", "key"},
+}
+
+var (
+	terraformBlockSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "terraform"}, {Type: "data", LabelNames: []string{"type", "name"}}},
+	}
+	backendBlockSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "backend", LabelNames: []string{"type"}}, {Type: "cloud"}},
+	}
+	remoteStateSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "backend"}, {Name: "config"}},
+	}
+)
+
+// flattenBody adds the constant string attributes of body and its nested
+// blocks to config, keyed by their dotted path below prefix.
+func flattenBody(body hcl.Body, prefix string, config map[string]string) {
+	// The workspaces block of the remote backend and the cloud block is
+	// the only nested block that identifies a state.
+	nested, remain, _ := body.PartialContent(&hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{{Type: "workspaces"}}})
+	for _, block := range nested.Blocks {
+		flattenBody(block.Body, prefix+block.Type+".", config)
+	}
+	attrs, _ := remain.JustAttributes()
+	for name, attr := range attrs {
+		if value, ok := literalString(attr); ok {
+			config[prefix+name] = value
+		}
+	}
+}
+
+// flattenExpr adds the constant strings of an object expression, such as
+// the config argument of terraform_remote_state, to config.
+func flattenExpr(expr hcl.Expression, prefix string, config map[string]string) {
+	pairs, diags := hcl.ExprMap(expr)
+	if diags.HasErrors() {
+		return
+	}
+	for _, pair := range pairs {
+		key, diags := pair.Key.Value(nil)
+		if diags.HasErrors() || !key.IsKnown() || key.IsNull() || !key.Type().Equals(cty.String) {
+			continue
+		}
+		if _, diags := hcl.ExprMap(pair.Value); !diags.HasErrors() {
+			flattenExpr(pair.Value, prefix+key.AsString()+".", config)
+			continue
+		}
+		if value, ok := literalString(&hcl.Attribute{Expr: pair.Value}); ok {
+			config[prefix+key.AsString()] = value
+		}
+	}
+}
+
+// stateLocations returns where the root module in dir stores its state and
+// the states its terraform_remote_state data sources read. A root without a
+// backend or cloud block keeps its state in terraform.tfstate. Paths of the
+// local backend are resolved against dir.
+func stateLocations(dir string) (own stateLocation, reads []stateLocation) {
+	var backend *Backend
+	own = backend.stateLocation()
+	files, err := parseConfigFiles(dir)
+	if err != nil {
+		return own, nil
+	}
+	for _, file := range files {
+		content, _, _ := file.Body.PartialContent(terraformBlockSchema)
+		for _, block := range content.Blocks {
+			switch {
+			case block.Type == "terraform":
+				backends, _, _ := block.Body.PartialContent(backendBlockSchema)
+				for _, b := range backends.Blocks {
+					own = newBackend(b).stateLocation()
+				}
+			case block.Labels[0] == "terraform_remote_state":
+				attrs, _, _ := block.Body.PartialContent(remoteStateSchema)
+				backend, ok := literalString(attrs.Attributes["backend"])
+				if !ok {
+					continue
+				}
+				loc := stateLocation{Backend: backend, Config: make(map[string]string)}
+				if attr := attrs.Attributes["config"]; attr != nil {
+					flattenExpr(attr.Expr, "", loc.Config)
+				}
+				reads = append(reads, loc)
+			}
+		}
+	}
+
+	resolve := func(loc stateLocation) {
+		if path, ok := loc.Config["path"]; ok && loc.Backend == "local" && !filepath.IsAbs(path) {
+			loc.Config["path"] = filepath.Join(dir, filepath.FromSlash(path))
+		}
+	}
+	resolve(own)
+	for _, loc := range reads {
+		resolve(loc)
+	}
+	return own, reads
+}
+
+// readsState reports whether a terraform_remote_state configuration read
+// refers to the state a root stores at own.
+func readsState(read, own stateLocation) bool {
+	if read.Backend != own.Backend {
+		return false
+	}
+	keys := stateIdentityKeys[own.Backend]
+	if keys == nil {
+		if len(own.Config) == 0 {
+			return false
+		}
+		for key := range own.Config {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		value, ok := own.Config[key]
+		if !ok || read.Config[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// RootDependencies returns, for every discovered root, the roots it depends
+// on: the roots whose state it reads through terraform_remote_state data
+// sources with constant settings, and those configured in dependencies.
+// Configured dependencies on directories that are not discovered roots are
+// kept, so that ordering can follow them transitively.
+func RootDependencies(discovery *Discovery, dependencies map[string][]string) map[string][]string {
+	owns := make(map[string]stateLocation)
+	readsOf := make(map[string][]stateLocation)
+	for _, root := range discovery.Roots {
+		owns[root.Path], readsOf[root.Path] = stateLocations(root.Path)
+	}
+
+	result := make(map[string][]string)
+	add := func(root, dep string) {
+		if root != dep && !slices.Contains(result[root], dep) {
+			result[root] = append(result[root], dep)
+		}
+	}
+	for root, deps := range dependencies {
+		for _, dep := range deps {
+			add(root, dep)
+		}
+	}
+	for _, consumer := range discovery.Roots {
+		for _, read := range readsOf[consumer.Path] {
+			for _, producer := range discovery.Roots {
+				if readsState(read, owns[producer.Path]) {
+					add(consumer.Path, producer.Path)
+				}
+			}
+		}
+	}
+	for _, deps := range result {
+		sort.Strings(deps)
+	}
+	return result
+}
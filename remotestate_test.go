@@ -0,0 +1,86 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRootDependencies(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"network/main.tf": `
+terraform {
+  backend "s3" {
+    bucket = "acme-state"
+    key    = "network.tfstate"
+    region = "us-east-1"
+  }
+}
+`,
+		"dns/main.tf": `
+terraform {
+  cloud {
+    organization = "acme"
+    workspaces {
+      name = "dns"
+    }
+  }
+}
+`,
+		"local/main.tf": `variable "x" {}`,
+		"app/main.tf": `
+data "terraform_remote_state" "network" {
+  backend = "s3"
+  config = {
+    bucket = "acme-state"
+    key    = "network.tfstate"
+    region = var.region
+  }
+}
+
+data "terraform_remote_state" "dns" {
+  backend = "remote"
+  config = {
+    organization = "acme"
+    workspaces = {
+      name = "dns"
+    }
+  }
+}
+
+data "terraform_remote_state" "local" {
+  backend = "local"
+  config = {
+    path = "../local/terraform.tfstate"
+  }
+}
+
+data "terraform_remote_state" "other" {
+  backend = "s3"
+  config = {
+    bucket = "acme-state"
+    key    = var.key
+  }
+}
+`,
+		"batch/main.tf": `variable "x" {}`,
+	})
+
+	discovery, err := Discover(tempDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	dir := func(name string) string { return filepath.Join(tempDir, name) }
+	deps := RootDependencies(discovery, map[string][]string{
+		dir("batch"): {dir("app"), filepath.Join(tempDir, "external")},
+	})
+
+	expected := map[string][]string{
+		dir("app"):   {dir("dns"), dir("local"), dir("network")},
+		dir("batch"): {dir("app"), filepath.Join(tempDir, "external")},
+	}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("expected %v, got %v", expected, deps)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ModuleRename is a module directory that changed files show was renamed:
+// every changed file of From was deleted, From no longer exists, and To
+// holds changed files of the same names.
+type ModuleRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DetectModuleRenames returns the module directories of output renamed by
+// changedFiles, checked against the working tree: directories that were
+// deleted, either called by a module call that now cannot be read or known
+// from the base analysis, or renamed to a local module directory. Calls
+// of the old directory are broken, and the files of both directories
+// affect their callers, so both the roots still calling the old path and
+// those calling the new one are affected.
+func DetectModuleRenames(changedFiles []string, output *Output) []ModuleRename {
+	deleted := make(map[string][]string)
+	present := make(map[string]map[string]bool)
+	for _, f := range changedFiles {
+		absPath := toAbsPath(f)
+		dir, name := filepath.Dir(absPath), filepath.Base(absPath)
+		if _, err := os.Lstat(absPath); os.IsNotExist(err) {
+			deleted[dir] = append(deleted[dir], name)
+			continue
+		}
+		if present[dir] == nil {
+			present[dir] = make(map[string]bool)
+		}
+		present[dir][name] = true
+	}
+
+	modules := make(map[string]bool)
+	for _, m := range output.LocalModules {
+		modules[m.ResolvedPath] = true
+	}
+	for _, m := range output.deletedModules {
+		modules[m.ResolvedPath] = true
+	}
+
+	var renames []ModuleRename
+	for from, names := range deleted {
+		if _, err := os.Stat(from); !os.IsNotExist(err) {
+			continue
+		}
+		var candidates []string
+		for to, toNames := range present {
+			matched := true
+			for _, name := range names {
+				matched = matched && toNames[name]
+			}
+			if matched {
+				candidates = append(candidates, to)
+			}
+		}
+		// A directory whose files all moved to several places was split,
+		// not renamed.
+		if len(candidates) == 1 && (modules[from] || modules[candidates[0]]) {
+			renames = append(renames, ModuleRename{From: from, To: candidates[0]})
+		}
+	}
+	sort.Slice(renames, func(i, j int) bool { return renames[i].From < renames[j].From })
+	return renames
+}
+
+// renameDiagnostic describes a module rename as a warning for calls of the
+// old directory.
+func renameDiagnostic(r ModuleRename) Diagnostic {
+	return Diagnostic{
+		Severity: severityWarning,
+		Code:     codeModuleRenamed,
+		Message:  fmt.Sprintf("module directory %s was renamed to %s; calls of the old path are broken", workingDirRel(r.From), workingDirRel(r.To)),
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectModuleRenames(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		// prod still calls the old path, dev was updated.
+		"envs/prod/main.tf": `
+module "network" {
+  source = "../../modules/net"
+}
+`,
+		"envs/dev/main.tf": `
+module "network" {
+  source = "../../modules/network"
+}
+`,
+		"envs/stage/main.tf":           `variable "name" {}`,
+		"modules/network/main.tf":      `resource "aws_vpc" "this" {}`,
+		"modules/network/variables.tf": `variable "cidr" {}`,
+		"docs/new/README.md":           "# Network\n",
+	})
+	oldDir := filepath.Join(tempDir, "modules", "net")
+	newDir := filepath.Join(tempDir, "modules", "network")
+	changedFiles := []string{
+		filepath.Join(oldDir, "main.tf"),
+		filepath.Join(oldDir, "variables.tf"),
+		filepath.Join(newDir, "main.tf"),
+		filepath.Join(newDir, "variables.tf"),
+		filepath.Join(tempDir, "docs", "old", "README.md"),
+		filepath.Join(tempDir, "docs", "new", "README.md"),
+	}
+	expected := []ModuleRename{{From: oldDir, To: newDir}}
+
+	discovery, err := Discover(tempDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	for _, root := range discovery.Roots {
+		renames := DetectModuleRenames(changedFiles, root.Analysis)
+		switch filepath.Base(root.Path) {
+		case "prod", "dev":
+			if !reflect.DeepEqual(renames, expected) {
+				t.Errorf("expected the rename to be detected for %s, got %+v", root.Path, renames)
+			}
+			if !IsAffected(changedFiles, root.Analysis) {
+				t.Errorf("expected %s to be affected by the rename", root.Path)
+			}
+		case "stage":
+			if len(renames) != 0 {
+				t.Errorf("expected no module rename for a root calling neither path, got %+v", renames)
+			}
+			if IsAffected(changedFiles, root.Analysis) {
+				t.Errorf("expected %s not to be affected", root.Path)
+			}
+		}
+	}
+
+	// Files that moved to several directories were not renamed.
+	writeTestFiles(t, tempDir, map[string]string{"modules/network2/main.tf": "", "modules/network2/variables.tf": ""})
+	split := append(changedFiles, filepath.Join(tempDir, "modules", "network2", "main.tf"), filepath.Join(tempDir, "modules", "network2", "variables.tf"))
+	if renames := DetectModuleRenames(split, discovery.Roots[0].Analysis); len(renames) != 0 {
+		t.Errorf("expected no rename for a split directory, got %+v", renames)
+	}
+}
+
+func TestRenameDiagnostic(t *testing.T) {
+	d := renameDiagnostic(ModuleRename{From: "/repo/modules/net", To: "/repo/modules/network"})
+	if d.Code != codeModuleRenamed || d.Severity != severityWarning || diagnosticRules[d.Code] == "" {
+		t.Errorf("unexpected diagnostic %+v", d)
+	}
+}
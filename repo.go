@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cloneRepo shallowly clones the ref selected by repo, a git URL with an
+// optional ?ref= query and // subdirectory as in a module source, into a
+// temporary directory that cleanup removes. The repository is fetched
+// through a git cache in cacheDir, or the user cache directory when
+// cacheDir is empty, so that analyzing it again does not clone it again.
+// The checkout is mapped at archiveRoot, so paths reported for it are the
+// same for every run; the returned directory is the subdirectory selected
+// with //, if any.
+func cloneRepo(ctx context.Context, repo, cacheDir string, ttl time.Duration) (*MappedFS, string, func(), error) {
+	pkg := repo
+	if !isGitSource(pkg) {
+		pkg = "git::" + pkg
+	}
+	pkg, subdir := splitSourceSubdir(pkg)
+
+	tempDir, err := os.MkdirTemp("", "terraform-module-resolve-repo-")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(tempDir) }
+	dest := filepath.Join(tempDir, "repo")
+
+	if cacheDir == "" {
+		if userCache, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(userCache, programName)
+		}
+	}
+	if cacheDir != "" {
+		cache := &gitCache{dir: cacheDir, ttl: ttl}
+		err = cache.checkout(ctx, pkg, dest)
+	} else {
+		err = fetchGit(ctx, pkg, dest)
+	}
+	if err != nil {
+		cleanup()
+		return nil, "", nil, fmt.Errorf("cannot clone %s: %w", repo, err)
+	}
+	return &MappedFS{FS: os.DirFS(dest), Root: archiveRoot}, subdir, cleanup, nil
+}
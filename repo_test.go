@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCloneRepo(t *testing.T) {
+	repo := t.TempDir()
+	initGitRepo(t, repo, map[string]string{
+		"stacks/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	}, "v1.0.0")
+
+	fsys, subdir, cleanup, err := cloneRepo(context.Background(), "file://"+repo+"//stacks?ref=v1.0.0", t.TempDir(), defaultGitCacheTTL)
+	if err != nil {
+		t.Fatalf("cloneRepo failed: %v", err)
+	}
+	if subdir != "stacks" {
+		t.Errorf("expected the subdirectory stacks, got %q", subdir)
+	}
+	root := filepath.Join(archiveRoot, subdir, "prod")
+	output, err := AnalyzeWithOptions(root, AnalyzeOptions{FS: fsys})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(output.LocalModules) != 1 || output.LocalModules[0].ResolvedPath != filepath.Join(archiveRoot, "modules", "vpc") {
+		t.Errorf("expected the local module at its path within the repository, got %+v", output.LocalModules)
+	}
+	if len(output.RemoteModules) != 1 || output.RemoteModules[0].Source != "cloudposse/label/null" {
+		t.Errorf("expected the registry module, got %+v", output.RemoteModules)
+	}
+
+	checkout := fsys.FS
+	cleanup()
+	if _, err := checkout.Open("stacks"); !os.IsNotExist(err) {
+		t.Errorf("expected cleanup to remove the checkout, got %v", err)
+	}
+}
+
+func TestCloneRepo_Missing(t *testing.T) {
+	retries := networkRetries
+	networkRetries = 0
+	t.Cleanup(func() { networkRetries = retries })
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	if _, _, _, err := cloneRepo(context.Background(), "file://"+missing, t.TempDir(), defaultGitCacheTTL); err == nil {
+		t.Error("expected an error for a missing repository")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Classes of files that Terraform only reads in the root module: the
+// dependency lock file, partial backend configuration passed to terraform
+// init -backend-config, and Terraform files that only hold the backend or
+// cloud block. Changes to them affect the root they belong to, unless the
+// class is disabled, and never the callers of a module.
+const (
+	rootFileLock    = "lock"
+	rootFileBackend = "backend"
+	rootFileCloud   = "cloud"
+)
+
+var rootFileClassNames = []string{rootFileLock, rootFileBackend, rootFileCloud}
+
+// validateRootFiles checks that classes only names known file classes.
+func validateRootFiles(classes map[string]bool) error {
+	for class := range classes {
+		if !slices.Contains(rootFileClassNames, class) {
+			return fmt.Errorf("unknown root file class %q: expected %s", class, strings.Join(rootFileClassNames, ", "))
+		}
+	}
+	return nil
+}
+
+// rootFileClass returns the class of the file at path, or "" for files
+// that affect any module containing them.
+func rootFileClass(path string) string {
+	name := filepath.Base(path)
+	switch {
+	case name == ".terraform.lock.hcl":
+		return rootFileLock
+	case name == "backend.hcl" || strings.HasSuffix(name, ".backend.hcl") || strings.HasSuffix(name, ".backend.tfvars"):
+		return rootFileBackend
+	case strings.HasSuffix(name, ".tf") && onlyBackendConfig(path):
+		return rootFileCloud
+	}
+	return ""
+}
+
+// onlyBackendConfig reports whether the Terraform file at path only holds
+// terraform blocks with nothing but a backend or cloud block, such as a
+// backend.tf. Files that cannot be read, such as deleted ones, do not.
+func onlyBackendConfig(path string) bool {
+	file, diags := hclparse.NewParser().ParseHCLFile(path)
+	if diags.HasErrors() {
+		return false
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok || len(body.Attributes) > 0 || len(body.Blocks) == 0 {
+		return false
+	}
+	for _, block := range body.Blocks {
+		if block.Type != "terraform" || len(block.Body.Attributes) > 0 || len(block.Body.Blocks) == 0 {
+			return false
+		}
+		for _, inner := range block.Body.Blocks {
+			if inner.Type != "backend" && inner.Type != "cloud" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// changeAffects reports whether a change to absPath affects the module in
+// dir with files, which is the root module of output when root is set:
+// whether the module contains it, or calls the deleted module containing
+// it, and, for files of a root file class, whether the module is the root
+// and the class is enabled.
+func (o *Output) changeAffects(dir string, files []string, absPath string, root bool) bool {
+	if !moduleContains(dir, files, absPath) {
+		if _, caller, ok := o.deletedModuleCaller(absPath); !ok || caller != dir {
+			return false
+		}
+	}
+	return o.classAffects(absPath, root)
+}
+
+// classAffects reports whether the class of the file at absPath lets it
+// affect a module containing it, which is the root module when root is
+// set.
+func (o *Output) classAffects(absPath string, root bool) bool {
+	class := rootFileClass(absPath)
+	return class == "" || root && o.rootFileEnabled(class)
+}
+
+// rootFileEnabled reports whether the root file class is enabled.
+func (o *Output) rootFileEnabled(class string) bool {
+	enabled, ok := o.rootFiles[class]
+	return enabled || !ok
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIsAffected_RootFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`,
+		"envs/prod/backend.tf": `
+terraform {
+  backend "s3" {}
+}
+`,
+		"envs/prod/versions.tf": `
+terraform {
+  required_version = ">= 1.5"
+  cloud {}
+}
+`,
+		"envs/prod/.terraform.lock.hcl":    "# lock\n",
+		"envs/prod/prod.backend.tfvars":    "bucket = \"state\"\n",
+		"modules/vpc/main.tf":              `variable "cidr" {}`,
+		"modules/vpc/cloud.tf":             "terraform {\n  cloud {}\n}\n",
+		"modules/vpc/.terraform.lock.hcl":  "# lock\n",
+		"modules/vpc/backend.hcl":          "bucket = \"state\"\n",
+		"modules/vpc/examples/backend.hcl": "bucket = \"state\"\n",
+	})
+	root := filepath.Join(tempDir, "envs", "prod")
+	vpc := filepath.Join(tempDir, "modules", "vpc")
+
+	tests := []struct {
+		name      string
+		rootFiles map[string]bool
+		file      string
+		expected  bool
+	}{
+		{"root lock file", nil, filepath.Join(root, ".terraform.lock.hcl"), true},
+		{"root backend config", nil, filepath.Join(root, "prod.backend.tfvars"), true},
+		{"root backend block file", nil, filepath.Join(root, "backend.tf"), true},
+		{"disabled lock file", map[string]bool{rootFileLock: false}, filepath.Join(root, ".terraform.lock.hcl"), false},
+		{"disabled backend config", map[string]bool{rootFileBackend: false}, filepath.Join(root, "prod.backend.tfvars"), false},
+		{"disabled backend block file", map[string]bool{rootFileCloud: false}, filepath.Join(root, "backend.tf"), false},
+		{"terraform block with other settings", map[string]bool{rootFileCloud: false}, filepath.Join(root, "versions.tf"), true},
+		{"other classes stay enabled", map[string]bool{rootFileLock: false}, filepath.Join(root, "backend.tf"), true},
+		{"module lock file", nil, filepath.Join(vpc, ".terraform.lock.hcl"), false},
+		{"module backend config", nil, filepath.Join(vpc, "examples", "backend.hcl"), false},
+		{"module cloud block file", nil, filepath.Join(vpc, "cloud.tf"), false},
+		{"module Terraform file", map[string]bool{rootFileCloud: false}, filepath.Join(vpc, "main.tf"), true},
+		{"deleted backend block file", map[string]bool{rootFileCloud: false}, filepath.Join(root, "deleted.tf"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := AnalyzeWithOptions(root, AnalyzeOptions{RootFiles: tt.rootFiles})
+			if err != nil {
+				t.Fatalf("Analyze failed: %v", err)
+			}
+			if got := IsAffected([]string{tt.file}, output); got != tt.expected {
+				t.Errorf("expected IsAffected %v for %s, got %v", tt.expected, tt.file, got)
+			}
+		})
+	}
+}
+
+func TestExplainAndPlanTargets_RootFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`,
+		"envs/prod/.terraform.lock.hcl":   "# lock\n",
+		"modules/vpc/main.tf":             `variable "cidr" {}`,
+		"modules/vpc/.terraform.lock.hcl": "# lock\n",
+	})
+	root := filepath.Join(tempDir, "envs", "prod")
+	output, err := AnalyzeWithOptions(root, AnalyzeOptions{RootFiles: map[string]bool{rootFileLock: false}})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	rootLock := filepath.Join(root, ".terraform.lock.hcl")
+	moduleLock := filepath.Join(tempDir, "modules", "vpc", ".terraform.lock.hcl")
+
+	explanations := ExplainAffected([]string{rootLock, moduleLock}, output)
+	if e := explanations[0]; len(e.Matches) != 0 || e.Ignored != "lock files are disabled by root_files" {
+		t.Errorf("unexpected explanation of the root lock file: %+v", e)
+	}
+	if e := explanations[1]; len(e.Matches) != 0 || e.Ignored != "lock files only affect the root module" {
+		t.Errorf("unexpected explanation of the module lock file: %+v", e)
+	}
+
+	if targets, full := PlanTargets([]string{rootLock, moduleLock}, output); len(targets) != 0 || full {
+		t.Errorf("expected no targets for ignored lock files, got %v, full %v", targets, full)
+	}
+	output.rootFiles = nil
+	if _, full := PlanTargets([]string{rootLock}, output); !full {
+		t.Error("expected the root lock file to require a full plan")
+	}
+}
+
+func TestLoadConfig_RootFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"good.json": `{"root_files": {"lock": false, "cloud": true}}`,
+		"bad.json":  `{"root_files": {"lockfile": false}}`,
+	})
+	config, err := LoadConfig(filepath.Join(tempDir, "good.json"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if opts := config.analyzeOptions(); opts.RootFiles[rootFileLock] || !opts.RootFiles[rootFileCloud] {
+		t.Errorf("expected the root file classes to be passed on, got %v", opts.RootFiles)
+	}
+	if _, err := LoadConfig(filepath.Join(tempDir, "bad.json")); err == nil {
+		t.Error("expected an error for an unknown root file class")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// diagnosticRules describes each diagnostic code as a SARIF rule.
+var diagnosticRules = map[string]string{
+	codeMissingModule: "Local module source path does not exist or cannot be read",
+	codeEmptyModule:   "Local module source path contains no Terraform files",
+	codeInvalidSource: "Module registry source address is malformed",
+	codeUnpinned:      "Remote module is not pinned to a version or git ref",
+	codeUnresolved:    "No registry or mirror provides a version of the module matching its constraint",
+	codeMaxDepth:      "Module call is nested deeper than the --max-depth limit and was not followed",
+	codeDeprecated:    "Registry marks the selected module version or the module's namespace deprecated",
+	codeUnresolvable:  "Module source is an expression rather than a literal string and cannot be resolved",
+	codeModuleRenamed: "Changed files rename a module directory, breaking calls of its old path",
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// renderSARIF writes every diagnostic of output as a SARIF log.
+func renderSARIF(w io.Writer, output *Output, opts renderOptions) error {
+	return writeSARIF(w, output.Diagnostics)
+}
+
+// writeSARIF writes diags as a SARIF 2.1.0 log for code scanning tools.
+// File locations are made relative to the working directory, which is the
+// repository root in a typical CI job.
+func writeSARIF(w io.Writer, diags []Diagnostic) error {
+	cwd, _ := os.Getwd()
+
+	var ruleIDs []string
+	for id := range diagnosticRules {
+		ruleIDs = append(ruleIDs, id)
+	}
+	sort.Strings(ruleIDs)
+
+	driver := sarifDriver{
+		Name:           "terraform-module-resolve",
+		InformationURI: "https://github.com/mkusaka/terraform-module-resolve",
+		Rules:          []sarifRule{},
+	}
+	for _, id := range ruleIDs {
+		driver.Rules = append(driver.Rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: diagnosticRules[id]}})
+	}
+
+	results := []sarifResult{}
+	for _, d := range diags {
+		result := sarifResult{
+			RuleID:  d.Code,
+			Level:   d.Severity,
+			Message: sarifMessage{Text: fmt.Sprintf("module %q: %s", d.Module, d.Message)},
+		}
+		if d.Filename != "" {
+			uri := d.Filename
+			if rel, err := filepath.Rel(cwd, d.Filename); err == nil {
+				uri = rel
+			}
+			loc := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(uri)},
+			}}
+			if d.Line > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: d.Line}
+			}
+			result.Locations = []sarifLocation{loc}
+		}
+		results = append(results, result)
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diags := []Diagnostic{
+		{
+			Severity: severityError,
+			Code:     codeMissingModule,
+			Message:  "local module path cannot be read",
+			Module:   "vpc",
+			Filename: filepath.Join(cwd, "envs", "prod", "main.tf"),
+			Line:     3,
+		},
+		{
+			Severity: severityWarning,
+			Code:     codeUnpinned,
+			Message:  "registry module has no version constraint",
+			Module:   "eks",
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeSARIF(&buf, diags); err != nil {
+		t.Fatalf("writeSARIF failed: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("invalid SARIF JSON: %v", err)
+	}
+
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected SARIF log %+v", log)
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(diagnosticRules) {
+		t.Errorf("expected %d rules, got %d", len(diagnosticRules), len(run.Tool.Driver.Rules))
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(run.Results))
+	}
+
+	first := run.Results[0]
+	if first.RuleID != codeMissingModule || first.Level != "error" {
+		t.Errorf("unexpected result %+v", first)
+	}
+	loc := first.Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "envs/prod/main.tf" || loc.Region.StartLine != 3 {
+		t.Errorf("unexpected location %+v", loc)
+	}
+
+	if run.Results[1].Level != "warning" || len(run.Results[1].Locations) != 0 {
+		t.Errorf("unexpected result %+v", run.Results[1])
+	}
+}
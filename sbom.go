@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// remoteDependency is a distinct remote module (source and version) with
+// every place it is called from, and the license of its installed copy
+// when known.
+type remoteDependency struct {
+	Source  string
+	Version string
+	URL     string
+	License string
+	Callers []string
+}
+
+// remoteDependencies de-duplicates the remote module calls of output by
+// source and version, sorted by source.
+func remoteDependencies(output *Output) []remoteDependency {
+	index := make(map[string]int)
+	var deps []remoteDependency
+	for _, r := range output.RemoteModules {
+		key := r.Source + "@" + r.Version
+		i, ok := index[key]
+		if !ok {
+			i = len(deps)
+			index[key] = i
+			deps = append(deps, remoteDependency{
+				Source:  r.Source,
+				Version: r.Version,
+				URL:     remoteSourceURL(r.Source, r.Version),
+			})
+		}
+		if deps[i].License == "" {
+			deps[i].License = r.License
+		}
+		deps[i].Callers = append(deps[i].Callers, r.CalledFrom)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Source != deps[j].Source {
+			return deps[i].Source < deps[j].Source
+		}
+		return deps[i].Version < deps[j].Version
+	})
+	return deps
+}
+
+type cycloneDXBOM struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	SerialNumber string                `json:"serialNumber"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     cycloneDXTools     `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type               string                       `json:"type"`
+	BOMRef             string                       `json:"bom-ref,omitempty"`
+	Name               string                       `json:"name"`
+	Version            string                       `json:"version,omitempty"`
+	Licenses           []cycloneDXLicenseChoice     `json:"licenses,omitempty"`
+	ExternalReferences []cycloneDXExternalReference `json:"externalReferences,omitempty"`
+	Properties         []cycloneDXProperty          `json:"properties,omitempty"`
+}
+
+type cycloneDXLicenseChoice struct {
+	License cycloneDXLicense `json:"license"`
+}
+
+type cycloneDXLicense struct {
+	ID string `json:"id"`
+}
+
+type cycloneDXExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// renderCycloneDX writes the remote module dependencies of output as a
+// CycloneDX 1.5 JSON SBOM with the root module as the described component.
+func renderCycloneDX(w io.Writer, output *Output, opts renderOptions) error {
+	rootRef := "root"
+	bom := cycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools: cycloneDXTools{Components: []cycloneDXComponent{
+				{Type: "application", Name: "terraform-module-resolve"},
+			}},
+			Component: cycloneDXComponent{
+				Type:   "application",
+				BOMRef: rootRef,
+				Name:   filepath.Base(output.RootModule.ResolvedPath),
+			},
+		},
+		Components: []cycloneDXComponent{},
+	}
+
+	rootDeps := cycloneDXDependency{Ref: rootRef, DependsOn: []string{}}
+	for _, dep := range remoteDependencies(output) {
+		ref := dep.Source + "@" + dep.Version
+		refType := "distribution"
+		if isGitSource(dep.Source) {
+			refType = "vcs"
+		}
+		component := cycloneDXComponent{
+			Type:    "library",
+			BOMRef:  ref,
+			Name:    dep.Source,
+			Version: dep.Version,
+			ExternalReferences: []cycloneDXExternalReference{
+				{Type: refType, URL: dep.URL},
+			},
+			Properties: []cycloneDXProperty{
+				{Name: "terraform:module:source", Value: dep.Source},
+			},
+		}
+		if dep.License != "" && dep.License != spdxNoAssertion {
+			component.Licenses = []cycloneDXLicenseChoice{{License: cycloneDXLicense{ID: dep.License}}}
+		}
+		for _, caller := range dep.Callers {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: "terraform:module:called_from", Value: caller})
+		}
+		bom.Components = append(bom.Components, component)
+		rootDeps.DependsOn = append(rootDeps.DependsOn, ref)
+	}
+	bom.Dependencies = []cycloneDXDependency{rootDeps}
+
+	data, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
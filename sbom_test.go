@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func sbomTestOutput() *Output {
+	return &Output{
+		RootModule: ModuleDetail{ResolvedPath: "/repo/envs/prod"},
+		RemoteModules: []RemoteModule{
+			{Name: "eks", Source: "terraform-aws-modules/eks/aws", Version: "19.0.0", CalledFrom: "(root)"},
+			{Name: "network", Source: "git::https://example.com/network.git?ref=v1.2.0", CalledFrom: "(root)"},
+			{Name: "eks_blue", Source: "terraform-aws-modules/eks/aws", Version: "19.0.0", CalledFrom: "clusters"},
+		},
+	}
+}
+
+func TestRemoteDependencies(t *testing.T) {
+	deps := remoteDependencies(sbomTestOutput())
+
+	if len(deps) != 2 {
+		t.Fatalf("expected 2 distinct dependencies, got %+v", deps)
+	}
+	if deps[1].Source != "terraform-aws-modules/eks/aws" || len(deps[1].Callers) != 2 {
+		t.Errorf("expected eks to be called twice, got %+v", deps[1])
+	}
+}
+
+func TestRenderCycloneDX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := renderCycloneDX(&buf, sbomTestOutput(), renderOptions{}); err != nil {
+		t.Fatalf("renderCycloneDX failed: %v", err)
+	}
+
+	var bom cycloneDXBOM
+	if err := json.Unmarshal(buf.Bytes(), &bom); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	if bom.BOMFormat != "CycloneDX" || bom.SpecVersion != "1.5" {
+		t.Errorf("unexpected BOM header %s %s", bom.BOMFormat, bom.SpecVersion)
+	}
+	if bom.Metadata.Component.Name != "prod" {
+		t.Errorf("expected root component prod, got %s", bom.Metadata.Component.Name)
+	}
+	if len(bom.Components) != 2 {
+		t.Fatalf("expected 2 components, got %d", len(bom.Components))
+	}
+
+	git := bom.Components[0]
+	if git.ExternalReferences[0].Type != "vcs" || git.ExternalReferences[0].URL != "https://example.com/network.git" {
+		t.Errorf("unexpected git reference %+v", git.ExternalReferences)
+	}
+	registry := bom.Components[1]
+	if registry.Version != "19.0.0" || registry.ExternalReferences[0].URL != "https://registry.terraform.io/modules/terraform-aws-modules/eks/aws/19.0.0" {
+		t.Errorf("unexpected registry component %+v", registry)
+	}
+
+	if len(bom.Dependencies) != 1 || len(bom.Dependencies[0].DependsOn) != 2 {
+		t.Errorf("expected root to depend on both components, got %+v", bom.Dependencies)
+	}
+}
+
+func TestRenderSPDX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := renderSPDX(&buf, sbomTestOutput(), renderOptions{}); err != nil {
+		t.Fatalf("renderSPDX failed: %v", err)
+	}
+
+	var doc spdxDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	if doc.SPDXVersion != "SPDX-2.3" || doc.DataLicense != "CC0-1.0" {
+		t.Errorf("unexpected document header %s %s", doc.SPDXVersion, doc.DataLicense)
+	}
+	if len(doc.Packages) != 3 {
+		t.Fatalf("expected root and 2 module packages, got %d", len(doc.Packages))
+	}
+
+	git := doc.Packages[1]
+	if git.DownloadLocation != "git+https://example.com/network.git@v1.2.0" {
+		t.Errorf("unexpected git download location %s", git.DownloadLocation)
+	}
+	registry := doc.Packages[2]
+	if registry.VersionInfo != "19.0.0" || registry.Comment != "called from (root), clusters" {
+		t.Errorf("unexpected registry package %+v", registry)
+	}
+
+	if len(doc.Relationships) != 3 || doc.Relationships[0].RelationshipType != "DESCRIBES" {
+		t.Errorf("unexpected relationships %+v", doc.Relationships)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// outputSchemaVersion is the schema_version of the JSON output. It is bumped
+// whenever a field is removed or renamed or its meaning changes; new
+// optional fields do not change it.
+const outputSchemaVersion = 1
+
+// outputSchemaID identifies the JSON Schema of the current output version.
+var outputSchemaID = fmt.Sprintf("https://github.com/mkusaka/terraform-module-resolve/schema/v%d/output.json", outputSchemaVersion)
+
+// cacheSchemaID identifies the JSON Schema of the current cache file version.
+var cacheSchemaID = fmt.Sprintf("https://github.com/mkusaka/terraform-module-resolve/schema/v%d/cache.json", cacheVersion)
+
+func runSchema(args []string) int {
+	flags := newFlagSet("schema")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s schema [output|cache]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Print the JSON Schema of the JSON output for schema_version %d, or of the\n", outputSchemaVersion)
+		fmt.Fprintf(flags.Output(), "--cache file format for version %d.\n", cacheVersion)
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	var schema map[string]any
+	switch flags.Arg(0) {
+	case "", "output":
+		schema = OutputSchema()
+	case "cache":
+		schema = CacheSchema()
+	default:
+		flags.Usage()
+		return exitError
+	}
+	jsonOutput, _ := json.MarshalIndent(schema, "", "  ")
+	fmt.Println(string(jsonOutput))
+	return 0
+}
+
+// OutputSchema returns the JSON Schema (draft 2020-12) of Output, derived
+// from its Go types so that it cannot drift from the encoding. Fields
+// without omitempty are required. Objects allow additional properties, so
+// output with optional fields added in a later release still validates.
+func OutputSchema() map[string]any {
+	schema := jsonSchema(reflect.TypeOf(Output{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = outputSchemaID
+	schema["title"] = "terraform-module-resolve output"
+	schema["properties"].(map[string]any)["schema_version"] = map[string]any{
+		"const": outputSchemaVersion,
+	}
+	return schema
+}
+
+// CacheSchema returns the JSON Schema (draft 2020-12) of the files written
+// by Cache.Save, derived from its Go types like OutputSchema.
+func CacheSchema() map[string]any {
+	schema := jsonSchema(reflect.TypeOf(Cache{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = cacheSchemaID
+	schema["title"] = "terraform-module-resolve cache"
+	schema["properties"].(map[string]any)["version"] = map[string]any{
+		"const": cacheVersion,
+	}
+	return schema
+}
+
+// jsonSchema returns the schema of the JSON encoding of values of type t.
+func jsonSchema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if !field.IsExported() || tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = jsonSchema(field.Type)
+			if !strings.Contains(options, "omitempty") && !strings.Contains(options, "omitzero") {
+				required = append(required, name)
+			}
+		}
+		return map[string]any{"type": "object", "properties": properties, "required": required}
+	}
+	panic(fmt.Sprintf("jsonSchema: unsupported type %s", t))
+}
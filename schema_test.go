@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestOutputSchema(t *testing.T) {
+	schema := OutputSchema()
+	if schema["$id"] != outputSchemaID {
+		t.Errorf("expected $id %s, got %v", outputSchemaID, schema["$id"])
+	}
+	properties := schema["properties"].(map[string]any)
+	if v := properties["schema_version"].(map[string]any)["const"]; v != outputSchemaVersion {
+		t.Errorf("expected schema_version const %d, got %v", outputSchemaVersion, v)
+	}
+	required := schema["required"].([]string)
+	for _, name := range []string{"schema_version", "root_module", "local_modules", "remote_modules"} {
+		if !slices.Contains(required, name) {
+			t.Errorf("expected %s to be required, got %v", name, required)
+		}
+	}
+	if slices.Contains(required, "diagnostics") {
+		t.Errorf("expected optional diagnostics, got %v", required)
+	}
+	remote := properties["remote_modules"].(map[string]any)["items"].(map[string]any)
+	if registry := remote["properties"].(map[string]any)["registry"].(map[string]any); registry["type"] != "object" {
+		t.Errorf("expected registry object schema, got %v", registry)
+	}
+}
+
+func TestOutputSchema_ValidatesOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "empty" {
+  source = "../modules/empty"
+}
+
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "5.1.2"
+}
+
+module "dns" {
+  source = "git::https://example.com/dns.git?ref=v1"
+}
+`,
+		"modules/empty/README.md": "no terraform files",
+	})
+
+	output, err := Analyze(filepath.Join(tempDir, "root"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if output.SchemaVersion != outputSchemaVersion {
+		t.Errorf("expected schema_version %d, got %d", outputSchemaVersion, output.SchemaVersion)
+	}
+
+	// Round-trip both documents through JSON to validate what consumers see.
+	var schema, document any
+	data, _ := json.Marshal(OutputSchema())
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = json.Marshal(output)
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateSchema(schema.(map[string]any), document, "$"); err != nil {
+		t.Errorf("output does not match its schema: %v\n%s", err, data)
+	}
+}
+
+func TestCacheSchema_ValidatesCache(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+  count   = 2
+}
+`,
+		"root/override.tf": `
+module "label" {
+  version = "0.26.0"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+	cache := NewCache()
+	if _, err := AnalyzeWithOptions(filepath.Join(tempDir, "root"), AnalyzeOptions{Cache: cache}); err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	cachePath := filepath.Join(tempDir, "cache.json")
+	if err := cache.Save(cachePath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	schema := CacheSchema()
+	if schema["$id"] != cacheSchemaID {
+		t.Errorf("expected $id %s, got %v", cacheSchemaID, schema["$id"])
+	}
+	var document, decoded any
+	data, _ := json.Marshal(schema)
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(cachePath)
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateSchema(decoded.(map[string]any), document, "$"); err != nil {
+		t.Errorf("cache file does not match its schema: %v\n%s", err, data)
+	}
+}
+
+// validateSchema checks the subset of JSON Schema produced by jsonSchema.
+func validateSchema(schema map[string]any, value any, path string) error {
+	if c, ok := schema["const"]; ok {
+		if value != c {
+			return fmt.Errorf("%s: expected %v, got %v", path, c, value)
+		}
+		return nil
+	}
+	switch schema["type"] {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected string, got %v", path, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %v", path, value)
+		}
+	case "integer", "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: expected number, got %v", path, value)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %v", path, value)
+		}
+		for i, item := range items {
+			if err := validateSchema(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %v", path, value)
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required property %s", path, name)
+			}
+		}
+		for name, v := range object {
+			property, ok := properties[name].(map[string]any)
+			if !ok {
+				property, ok = schema["additionalProperties"].(map[string]any)
+			}
+			if !ok {
+				return fmt.Errorf("%s: unexpected property %s", path, name)
+			}
+			if err := validateSchema(property, v, path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// server serves analyses of module directories under baseDir over HTTP.
+// Parsed module calls are shared between requests through cache. In daemon
+// mode, memo also keeps whole analyses until a file changes.
+type server struct {
+	baseDir string
+	opts    AnalyzeOptions
+	timeout time.Duration
+	metrics *serverMetrics
+	memo    *analysisMemo
+}
+
+func runServe(args []string) int {
+	flags := newFlagSet("serve")
+	listen := flags.String("listen", ":8080", "address to listen on")
+	concurrency := flags.Int("concurrency", runtime.NumCPU(), "number of module directories to load in parallel per request")
+	timeout := flags.Duration("timeout", time.Minute, "abort a request's analysis after this duration (0 means no limit)")
+	cachePath := flags.String("cache", "", "load parsed module calls from this cache file at startup and save them on shutdown")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s serve [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Serve analyses of the module directories under a directory over HTTP.\n\n")
+		fmt.Fprintf(flags.Output(), "Endpoints:\n")
+		fmt.Fprintf(flags.Output(), "  GET  /analyze?dir=PATH   analysis of the root module at PATH\n")
+		fmt.Fprintf(flags.Output(), "  POST /analyze?dir=PATH   analysis of the root module at PATH in the .tar.gz or\n")
+		fmt.Fprintf(flags.Output(), "                           .zip archive in the body\n")
+		fmt.Fprintf(flags.Output(), "  POST /affected?dir=PATH  affected roots under PATH for changed files in the body\n")
+		fmt.Fprintf(flags.Output(), "  GET  /graph?dir=PATH&query=EXPR\n")
+		fmt.Fprintf(flags.Output(), "                           graph query results for the roots under PATH\n")
+		fmt.Fprintf(flags.Output(), "  GET  /metrics            Prometheus metrics\n")
+		fmt.Fprintf(flags.Output(), "  GET  /healthz            liveness check\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	baseDir, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	cache := NewCache()
+	if *cachePath != "" {
+		cache = loadCacheOrWarn(*cachePath)
+	}
+	s := &server{
+		baseDir: baseDir,
+		opts:    AnalyzeOptions{Cache: cache, Concurrency: *concurrency},
+		timeout: *timeout,
+		metrics: newServerMetrics(cache),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	httpServer := &http.Server{Addr: *listen, Handler: s.handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving %s on %s\n", baseDir, *listen)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	if *cachePath != "" {
+		if err := cache.Save(*cachePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing cache: %v\n", err)
+			return exitError
+		}
+	}
+	return 0
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /analyze", s.handleAnalyze)
+	mux.HandleFunc("POST /analyze", s.handleAnalyzeArchive)
+	mux.HandleFunc("POST /affected", s.handleAffected)
+	mux.HandleFunc("GET /graph", s.handleGraph)
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.metrics.write(w)
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	return mux
+}
+
+func (s *server) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	output, err := s.analyze(r)
+	s.metrics.observe("analyze", time.Since(start), err)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeHTTPJSON(w, output)
+}
+
+func (s *server) handleAnalyzeArchive(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	output, err := s.analyzeArchive(r)
+	s.metrics.observe("analyze_archive", time.Since(start), err)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeHTTPJSON(w, output)
+}
+
+func (s *server) handleAffected(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	result, err := s.affected(r)
+	s.metrics.observe("affected", time.Since(start), err)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeHTTPJSON(w, result)
+}
+
+func (s *server) handleGraph(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	results, err := s.graphQuery(r)
+	s.metrics.observe("graph", time.Since(start), err)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeHTTPJSON(w, results)
+}
+
+func (s *server) analyze(r *http.Request) (*Output, error) {
+	dir, err := s.resolveDir(r.URL.Query().Get("dir"))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+	return s.memo.output(dir, func() (*Output, error) {
+		output, err := AnalyzeContext(ctx, dir, s.opts)
+		if err == nil {
+			s.metrics.countModules(output)
+		}
+		return output, err
+	})
+}
+
+// analyzeArchive analyzes the root module at the dir parameter, a name in
+// the archive of the request body, in memory. Reported paths are archive
+// names rooted at /.
+func (s *server) analyzeArchive(r *http.Request) (*Output, error) {
+	dir := r.URL.Query().Get("dir")
+	if dir == "" {
+		dir = "."
+	}
+	if !fs.ValidPath(dir) {
+		return nil, badRequest(fmt.Errorf("invalid directory %q in the archive", dir))
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxArchiveSize+1))
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	fsys, err := openArchive(data)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+
+	opts := s.opts
+	opts.FS = &MappedFS{FS: fsys, Root: archiveRoot}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+	output, err := AnalyzeContext(ctx, filepath.Join(archiveRoot, filepath.FromSlash(dir)), opts)
+	if err == nil {
+		s.metrics.countModules(output)
+	}
+	return output, err
+}
+
+// discover discovers the roots under dir for a request.
+func (s *server) discover(ctx context.Context, dir string) (*Discovery, error) {
+	return s.memo.discovery(dir, func() (*Discovery, error) {
+		discovery, err := DiscoverContext(ctx, dir, s.opts)
+		if err == nil {
+			for _, root := range discovery.Roots {
+				s.metrics.countModules(root.Analysis)
+			}
+		}
+		return discovery, err
+	})
+}
+
+// graphQuery evaluates the query parameter, as graph query does, against
+// the call graph of the roots under the dir parameter. Arguments and
+// results name directories relative to the served directory.
+func (s *server) graphQuery(r *http.Request) ([]string, error) {
+	dir, err := s.resolveDir(r.URL.Query().Get("dir"))
+	if err != nil {
+		return nil, err
+	}
+	expr := r.URL.Query().Get("query")
+	if expr == "" {
+		return nil, badRequest(errors.New("missing query"))
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+	discovery, err := s.discover(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	g := newCallGraph(discovery)
+	g.dir = s.baseDir
+	results, err := g.query(expr)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	return results, nil
+}
+
+func (s *server) affected(r *http.Request) (*AffectedRoots, error) {
+	dir, err := s.resolveDir(r.URL.Query().Get("dir"))
+	if err != nil {
+		return nil, err
+	}
+	precedence := r.URL.Query().Get("overlap_precedence")
+	switch precedence {
+	case "":
+		precedence = precedenceNearest
+	case precedenceNearest, precedenceOutermost, precedenceAll:
+	default:
+		return nil, badRequest(fmt.Errorf("invalid overlap_precedence %q", precedence))
+	}
+
+	inputFormat := r.URL.Query().Get("input_format")
+	if inputFormat == "" {
+		inputFormat = "lines"
+	}
+	parse, ok := changedFilesParsers[inputFormat]
+	if !ok {
+		return nil, badRequest(fmt.Errorf("invalid input_format %q", inputFormat))
+	}
+	paths, err := parse(io.LimitReader(r.Body, 16*1024*1024))
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	var changedFiles []string
+	for _, path := range paths {
+		changedFiles = append(changedFiles, s.resolvePath(path))
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+	discovery, err := s.discover(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	result := FindAffectedRoots(discovery, changedFiles, precedence)
+	return &result, nil
+}
+
+func (s *server) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), s.timeout)
+}
+
+// resolvePath resolves a path relative to the served directory.
+func (s *server) resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(s.baseDir, path)
+}
+
+// resolveDir resolves a dir query parameter and rejects directories outside
+// the served directory.
+func (s *server) resolveDir(dir string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	resolved := s.resolvePath(dir)
+	if !isInDirectory(resolved, s.baseDir) {
+		return "", badRequest(fmt.Errorf("directory %s is outside %s", dir, s.baseDir))
+	}
+	return resolved, nil
+}
+
+// httpError is an error caused by the request rather than the analysis.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+
+func badRequest(err error) error {
+	return &httpError{status: http.StatusBadRequest, err: err}
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var he *httpError
+	switch {
+	case errors.As(err, &he):
+		status = he.status
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func writeHTTPJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
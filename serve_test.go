@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+	})
+
+	cache := NewCache()
+	s := &server{
+		baseDir: tempDir,
+		opts:    AnalyzeOptions{Cache: cache},
+		metrics: newServerMetrics(cache),
+	}
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	for i := 0; i < 2; i++ {
+		status, body := get("/analyze?dir=envs/prod")
+		if status != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", status, body)
+		}
+		var output Output
+		if err := json.Unmarshal([]byte(body), &output); err != nil || len(output.RemoteModules) != 1 {
+			t.Fatalf("unexpected analysis: %s", body)
+		}
+	}
+
+	if status, _ := get("/analyze?dir=../outside"); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for a directory outside the served tree, got %d", status)
+	}
+	if status, _ := get("/analyze?dir=missing"); status != http.StatusInternalServerError {
+		t.Errorf("expected 500 for a missing directory, got %d", status)
+	}
+
+	resp, err := http.Post(ts.URL+"/affected", "text/plain", strings.NewReader("modules/vpc/main.tf\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var affected AffectedRoots
+	json.NewDecoder(resp.Body).Decode(&affected)
+	resp.Body.Close()
+	if len(affected.Roots) != 1 || !strings.HasSuffix(affected.Roots[0], "prod") {
+		t.Errorf("expected envs/prod to be affected, got %+v", affected)
+	}
+
+	_, metrics := get("/metrics")
+	for _, want := range []string{
+		`terraform_module_resolve_requests_total{endpoint="analyze"} 4`,
+		`terraform_module_resolve_request_errors_total{endpoint="analyze"} 2`,
+		`terraform_module_resolve_requests_total{endpoint="affected"} 1`,
+		`terraform_module_resolve_analysis_duration_seconds_count{endpoint="analyze"} 4`,
+		`terraform_module_resolve_analysis_duration_seconds_bucket{endpoint="analyze",le="+Inf"} 4`,
+		`terraform_module_resolve_modules_resolved_total{kind="remote"} 3`,
+		`terraform_module_resolve_cache_hits_total 6`,
+		`terraform_module_resolve_cache_misses_total 2`,
+		`# TYPE terraform_module_resolve_analysis_duration_seconds histogram`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("expected metrics to contain %q\n%s", want, metrics)
+		}
+	}
+}
+
+func TestServer_GraphQuery(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+	s := &server{baseDir: tempDir, metrics: newServerMetrics(nil), memo: newAnalysisMemo()}
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/graph?query=" + url.QueryEscape("callers(modules/vpc)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []string
+	json.NewDecoder(resp.Body).Decode(&results)
+	resp.Body.Close()
+	if len(results) != 1 || results[0] != "envs/prod" {
+		t.Errorf("expected envs/prod to call modules/vpc, got %v", results)
+	}
+	if len(s.memo.discoveries) != 1 {
+		t.Errorf("expected the discovery to be kept, got %v", s.memo.discoveries)
+	}
+
+	for _, query := range []string{"", "callers(modules/missing)"} {
+		resp, err := http.Get(ts.URL + "/graph?query=" + url.QueryEscape(query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for query %q, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestServer_AnalyzeArchive(t *testing.T) {
+	s := &server{metrics: newServerMetrics(nil)}
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	archive := tarGz(t, map[string]string{
+		"envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+	resp, err := http.Post(ts.URL+"/analyze?dir=envs/prod", "application/gzip", bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output Output
+	json.NewDecoder(resp.Body).Decode(&output)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(output.LocalModules) != 1 || output.LocalModules[0].ResolvedPath != filepath.Join(archiveRoot, "modules", "vpc") {
+		t.Errorf("expected the vpc module of the archive, got %d: %+v", resp.StatusCode, output)
+	}
+
+	for _, tt := range []struct{ dir, body string }{
+		{"envs/prod", "not an archive"},
+		{"../outside", string(archive)},
+	} {
+		resp, err := http.Post(ts.URL+"/analyze?dir="+tt.dir, "application/gzip", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for dir %s, got %d", tt.dir, resp.StatusCode)
+		}
+	}
+}
+
+func TestServer_AffectedInputFormat(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+	s := &server{baseDir: tempDir, metrics: newServerMetrics(nil)}
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	post := func(format, body string) (int, AffectedRoots) {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/affected?input_format="+format, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var affected AffectedRoots
+		json.NewDecoder(resp.Body).Decode(&affected)
+		return resp.StatusCode, affected
+	}
+
+	status, affected := post("json", `[{"filename": "modules/vpc/main.tf", "status": "modified"}]`)
+	if status != http.StatusOK || len(affected.Roots) != 1 || !strings.HasSuffix(affected.Roots[0], "prod") {
+		t.Errorf("expected envs/prod to be affected, got %d %+v", status, affected)
+	}
+	if status, _ := post("json", "modules/vpc/main.tf"); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for input that is not JSON, got %d", status)
+	}
+	if status, _ := post("csv", "modules/vpc/main.tf"); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown input format, got %d", status)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// manifestVersion is bumped whenever the Manifest encoding changes
+// incompatibly.
+const manifestVersion = 1
+
+// Manifest records the content hash of every module reachable from a root
+// so that two states of a tree can be compared without a git diff.
+type Manifest struct {
+	Version int              `json:"version"`
+	Root    string           `json:"root"`
+	Modules []ManifestModule `json:"modules"`
+}
+
+// ManifestModule is a module directory, relative to the manifest root.
+type ManifestModule struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// ModuleChange is a difference between two manifests.
+type ModuleChange struct {
+	Change string `json:"change"`
+	Path   string `json:"path"`
+}
+
+const (
+	changeAdded    = "added"
+	changeRemoved  = "removed"
+	changeModified = "modified"
+)
+
+func runSnapshot(args []string) int {
+	flags := newFlagSet("snapshot")
+	outputPath := flags.String("o", "", "write the manifest to this file instead of stdout")
+	includeDownloaded := flags.Bool("include-downloaded", false, "also record remote modules installed under .terraform/modules by terraform init")
+	ref := flags.String("ref", "", "snapshot the files of this git ref, such as origin/main, read from the repository's objects instead of the working directory")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s snapshot [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Write a manifest of the modules reachable from a root and their content hashes.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	dir := flags.Arg(0)
+	opts := AnalyzeOptions{IncludeDownloaded: *includeDownloaded}
+	if *ref != "" {
+		var err error
+		if opts.FS, err = gitRefFS(dir, *ref); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		dir = toAbsPath(dir)
+	}
+	output, err := AnalyzeWithOptions(dir, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	data, _ := json.MarshalIndent(NewManifest(output), "", "  ")
+	data = append(data, '\n')
+	if *outputPath == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := writeFileAtomic(*outputPath, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return 0
+}
+
+func runDiff(args []string) int {
+	flags := newFlagSet("diff")
+	includeDownloaded := flags.Bool("include-downloaded", false, "when snapshotting a directory, also record remote modules installed under .terraform/modules")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s diff [options] <manifest|directory> <manifest|directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Compare two snapshots, or a snapshot with the current state of a directory.\n")
+		fmt.Fprintf(flags.Output(), "Exit codes: 0=modules changed, 1=no changes, 2=error\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitError
+	}
+
+	opts := AnalyzeOptions{IncludeDownloaded: *includeDownloaded}
+	base, err := loadManifestOrDir(flags.Arg(0), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	head, err := loadManifestOrDir(flags.Arg(1), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	changes := DiffManifests(base, head)
+	writeModuleChanges(os.Stdout, changes)
+	if len(changes) > 0 {
+		return exitAffected
+	}
+	return exitNotAffected
+}
+
+// NewManifest builds the manifest of output's root and local modules, and
+// of its downloaded remote modules when they were included.
+func NewManifest(output *Output) *Manifest {
+	root := output.RootModule.ResolvedPath
+	m := &Manifest{
+		Version: manifestVersion,
+		Root:    root,
+		Modules: []ManifestModule{{Path: ".", Hash: output.RootModule.Hash}},
+	}
+
+	seen := map[string]bool{root: true}
+	for _, local := range output.LocalModules {
+		if seen[local.ResolvedPath] {
+			continue
+		}
+		seen[local.ResolvedPath] = true
+		m.Modules = append(m.Modules, ManifestModule{
+			Path: relativeGraphPath(root, local.ResolvedPath),
+			Hash: local.Hash,
+		})
+	}
+	for _, remote := range output.RemoteModules {
+		if remote.ResolvedPath == "" || seen[remote.ResolvedPath] {
+			continue
+		}
+		seen[remote.ResolvedPath] = true
+		m.Modules = append(m.Modules, ManifestModule{
+			Path: relativeGraphPath(root, remote.ResolvedPath),
+			Hash: remote.Hash,
+		})
+	}
+
+	sort.Slice(m.Modules, func(i, j int) bool { return m.Modules[i].Path < m.Modules[j].Path })
+	return m
+}
+
+// ReadManifest loads a manifest written by the snapshot subcommand.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("manifest %s has version %d, expected %d", path, m.Version, manifestVersion)
+	}
+	return &m, nil
+}
+
+// loadManifestOrDir reads path as a manifest, or snapshots it with opts
+// when it is a directory.
+func loadManifestOrDir(path string, opts AnalyzeOptions) (*Manifest, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return ReadManifest(path)
+	}
+	output, err := AnalyzeWithOptions(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewManifest(output), nil
+}
+
+// DiffManifests returns the modules added, removed or modified between base
+// and head, sorted by path.
+func DiffManifests(base, head *Manifest) []ModuleChange {
+	baseHashes := make(map[string]string)
+	for _, m := range base.Modules {
+		baseHashes[m.Path] = m.Hash
+	}
+	headHashes := make(map[string]string)
+	for _, m := range head.Modules {
+		headHashes[m.Path] = m.Hash
+	}
+
+	var changes []ModuleChange
+	for path, hash := range headHashes {
+		baseHash, ok := baseHashes[path]
+		switch {
+		case !ok:
+			changes = append(changes, ModuleChange{Change: changeAdded, Path: path})
+		case baseHash != hash:
+			changes = append(changes, ModuleChange{Change: changeModified, Path: path})
+		}
+	}
+	for path := range baseHashes {
+		if _, ok := headHashes[path]; !ok {
+			changes = append(changes, ModuleChange{Change: changeRemoved, Path: path})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func writeModuleChanges(w io.Writer, changes []ModuleChange) {
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s\t%s\n", c.Change, c.Path)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotAndDiff(t *testing.T) {
+	tempDir := t.TempDir()
+	rootDir := filepath.Join(tempDir, "root")
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+
+module "iam" {
+  source = "../modules/iam"
+}
+`,
+		"modules/vpc/main.tf": `resource "aws_vpc" "main" {}`,
+		"modules/iam/main.tf": "",
+	})
+
+	output, err := Analyze(rootDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	base := NewManifest(output)
+
+	if len(base.Modules) != 3 {
+		t.Fatalf("expected 3 modules in manifest, got %+v", base.Modules)
+	}
+	if base.Modules[0].Path != "." || base.Modules[1].Path != "../modules/iam" {
+		t.Errorf("expected sorted relative paths, got %+v", base.Modules)
+	}
+
+	manifestPath := filepath.Join(tempDir, "base.json")
+	data, _ := json.Marshal(base)
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+
+module "dns" {
+  source = "../modules/dns"
+}
+`,
+		"modules/vpc/main.tf": `resource "aws_vpc" "other" {}`,
+		"modules/dns/main.tf": "",
+	})
+
+	readBase, err := loadManifestOrDir(manifestPath, AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("loading manifest failed: %v", err)
+	}
+	head, err := loadManifestOrDir(rootDir, AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("snapshotting directory failed: %v", err)
+	}
+
+	changes := DiffManifests(readBase, head)
+	expected := []ModuleChange{
+		{Change: changeModified, Path: "."},
+		{Change: changeAdded, Path: "../modules/dns"},
+		{Change: changeRemoved, Path: "../modules/iam"},
+		{Change: changeModified, Path: "../modules/vpc"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %+v", len(expected), changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("change %d: expected %+v, got %+v", i, expected[i], changes[i])
+		}
+	}
+
+	if unchanged := DiffManifests(head, head); len(unchanged) != 0 {
+		t.Errorf("expected no changes comparing a manifest with itself, got %+v", unchanged)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// defaultRegistryHost is the registry used by sources without a hostname.
+const defaultRegistryHost = "registry.terraform.io"
+
+var (
+	forcedGetterPattern  = regexp.MustCompile(`^[A-Za-z0-9]+::`)
+	registryNamePattern  = regexp.MustCompile(`^[0-9A-Za-z](?:[0-9A-Za-z_-]{0,62}[0-9A-Za-z])?$`)
+	registryProviderPart = regexp.MustCompile(`^[0-9a-z]{1,64}$`)
+	hostnamePattern      = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9.-]*[A-Za-z0-9])?(?::[0-9]+)?$`)
+)
+
+// isRegistrySource reports whether source would be interpreted by Terraform
+// as a module registry address rather than a local path or a go-getter URL.
+func isRegistrySource(source string) bool {
+	if source == "" || isLocalPath(source) {
+		return false
+	}
+	if forcedGetterPattern.MatchString(source) || strings.Contains(source, "://") {
+		return false
+	}
+	for _, prefix := range []string{"github.com/", "bitbucket.org/", "git@", "/"} {
+		if strings.HasPrefix(source, prefix) {
+			return false
+		}
+	}
+	host := strings.SplitN(source, "/", 2)[0]
+	if strings.HasSuffix(host, ".amazonaws.com") || host == "storage.googleapis.com" || host == "www.googleapis.com" {
+		return false
+	}
+	return true
+}
+
+// validateRegistrySource checks that a registry source has the shape
+// [<host>/]<namespace>/<name>/<provider>[//<subdir>].
+func validateRegistrySource(source string) error {
+	addr := source
+	if i := strings.Index(addr, "//"); i >= 0 {
+		addr = addr[:i]
+	}
+
+	parts := strings.Split(addr, "/")
+	if len(parts) == 2 {
+		return fmt.Errorf("registry address must have namespace/name/provider; local paths must start with ./ or ../")
+	}
+	if len(parts) != 3 && len(parts) != 4 {
+		return fmt.Errorf("registry address must have the form [<host>/]<namespace>/<name>/<provider>")
+	}
+	if len(parts) == 4 {
+		if !hostnamePattern.MatchString(parts[0]) {
+			return fmt.Errorf("invalid registry hostname %q", parts[0])
+		}
+		parts = parts[1:]
+	}
+	if !registryNamePattern.MatchString(parts[0]) {
+		return fmt.Errorf("invalid registry namespace %q", parts[0])
+	}
+	if !registryNamePattern.MatchString(parts[1]) {
+		return fmt.Errorf("invalid registry module name %q", parts[1])
+	}
+	if !registryProviderPart.MatchString(parts[2]) {
+		return fmt.Errorf("invalid registry provider %q (must be lowercase letters and digits)", parts[2])
+	}
+	return nil
+}
+
+// RegistryAddress is a module registry source split into its parts, with
+// the implied public registry hostname made explicit.
+type RegistryAddress struct {
+	Address   string `json:"address"`
+	Host      string `json:"host"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Provider  string `json:"provider"`
+}
+
+// parseRegistrySource returns the fully qualified address of a registry
+// source, such as registry.terraform.io/hashicorp/consul/aws for
+// hashicorp/consul/aws. Hostnames are lowercased and any //subdir is
+// dropped.
+func parseRegistrySource(source string) (*RegistryAddress, error) {
+	if err := validateRegistrySource(source); err != nil {
+		return nil, err
+	}
+	pkg, _ := splitSourceSubdir(source)
+	parts := strings.Split(pkg, "/")
+	host := defaultRegistryHost
+	if len(parts) == 4 {
+		host, parts = strings.ToLower(parts[0]), parts[1:]
+	}
+	return &RegistryAddress{
+		Address:   host + "/" + strings.Join(parts, "/"),
+		Host:      host,
+		Namespace: parts[0],
+		Name:      parts[1],
+		Provider:  parts[2],
+	}, nil
+}
+
+// path returns the namespace/name/provider part of the address.
+func (a *RegistryAddress) path() string {
+	return a.Namespace + "/" + a.Name + "/" + a.Provider
+}
+
+// isGitSource reports whether source is fetched with git, either explicitly
+// or through the GitHub and Bitbucket shorthands.
+func isGitSource(source string) bool {
+	for _, prefix := range []string{"git::", "git@", "github.com/", "bitbucket.org/"} {
+		if strings.HasPrefix(source, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// gitRef returns the value of the ref query parameter of a git source, or
+// an empty string if the source does not select a ref.
+func gitRef(source string) string {
+	i := strings.Index(source, "?")
+	if i < 0 {
+		return ""
+	}
+	query, err := url.ParseQuery(source[i+1:])
+	if err != nil {
+		return ""
+	}
+	return query.Get("ref")
+}
+
+// splitSourceSubdir splits a source into its package address and the
+// subdirectory selected with //, keeping any query on the package.
+func splitSourceSubdir(source string) (string, string) {
+	rest := source
+	if i := strings.Index(rest, "::"); i >= 0 && forcedGetterPattern.MatchString(rest) {
+		rest = rest[i+2:]
+	}
+	offset := len(source) - len(rest)
+	if i := strings.Index(rest, "://"); i >= 0 {
+		offset += i + 3
+		rest = rest[i+3:]
+	}
+
+	i := strings.Index(rest, "//")
+	if i < 0 {
+		return source, ""
+	}
+	pkg, subdir := source[:offset+i], source[offset+i+2:]
+	if q := strings.Index(subdir, "?"); q >= 0 {
+		pkg += subdir[q:]
+		subdir = subdir[:q]
+	}
+	return pkg, subdir
+}
+
+// parseRemoteSource splits a git or HTTP module source into the URL of its
+// package, the subdirectory selected with // and the value of its ref query
+// parameter. Forced getters such as git:: and the ref parameter are removed
+// from the URL, and the GitHub, Bitbucket and scp-like git shorthands are
+// expanded to the URLs go-getter would fetch.
+func parseRemoteSource(source string) (pkgURL, subdir, ref string) {
+	pkg, subdir := splitSourceSubdir(source)
+	if i := strings.Index(pkg, "::"); i >= 0 && forcedGetterPattern.MatchString(pkg) {
+		pkg = pkg[i+2:]
+	}
+	raw, query, _ := strings.Cut(pkg, "?")
+	values, _ := url.ParseQuery(query)
+	ref = values.Get("ref")
+	values.Del("ref")
+
+	switch {
+	case strings.HasPrefix(raw, "github.com/"):
+		raw = "https://" + raw
+		if !strings.HasSuffix(raw, ".git") {
+			raw += ".git"
+		}
+	case strings.HasPrefix(raw, "git@"):
+		raw = "ssh://" + strings.Replace(raw, ":", "/", 1)
+	case !strings.Contains(raw, "://"):
+		raw = "https://" + raw
+	}
+	if len(values) > 0 {
+		raw += "?" + values.Encode()
+	}
+	return raw, subdir, ref
+}
+
+var exactVersionPattern = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+(?:-[0-9A-Za-z.-]+)?$`)
+
+// remoteSourceURL returns the URL a remote module is downloaded from or
+// documented at: the registry page for registry sources and the repository
+// URL (without subdirectory and query) for git and HTTP sources.
+func remoteSourceURL(source, version string) string {
+	if isRegistrySource(source) {
+		addr := strings.SplitN(source, "//", 2)[0]
+		host := "registry.terraform.io"
+		parts := strings.Split(addr, "/")
+		if len(parts) == 4 {
+			host, parts = parts[0], parts[1:]
+		}
+		url := "https://" + host + "/modules/" + strings.Join(parts, "/")
+		if exactVersionPattern.MatchString(version) {
+			url += "/" + strings.TrimPrefix(version, "v")
+		}
+		return url
+	}
+
+	pkgURL, _, _ := parseRemoteSource(source)
+	base, _, _ := strings.Cut(pkgURL, "?")
+	return base
+}
@@ -0,0 +1,163 @@
+package main
+
+import "testing"
+
+func TestIsRegistrySource(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected bool
+	}{
+		{"terraform-aws-modules/eks/aws", true},
+		{"app.terraform.io/example-corp/k8s-cluster/azurerm", true},
+		{"hashicorp/consul/aws//modules/consul-cluster", true},
+		{"./modules/vpc", false},
+		{"github.com/hashicorp/example", false},
+		{"git@github.com:hashicorp/example.git", false},
+		{"git::https://example.com/vpc.git", false},
+		{"https://example.com/vpc-module.zip", false},
+		{"s3::https://s3-eu-west-1.amazonaws.com/bucket/vpc.zip", false},
+		{"bucket.s3.amazonaws.com/vpc.zip", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			result := isRegistrySource(tt.source)
+			if result != tt.expected {
+				t.Errorf("isRegistrySource(%q) = %v, expected %v", tt.source, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateRegistrySource(t *testing.T) {
+	tests := []struct {
+		source string
+		valid  bool
+	}{
+		{"terraform-aws-modules/eks/aws", true},
+		{"app.terraform.io/example-corp/k8s-cluster/azurerm", true},
+		{"hashicorp/consul/aws//modules/consul-cluster", true},
+		{"localhost:8080/org/name/aws", true},
+		{"modules/vpc", false},
+		{"vpc", false},
+		{"org/name/AWS", false},
+		{"org/-name/aws", false},
+		{"a/b/c/d/e", false},
+		{"bad_host/org/name/aws", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			err := validateRegistrySource(tt.source)
+			if (err == nil) != tt.valid {
+				t.Errorf("validateRegistrySource(%q) error = %v, expected valid=%v", tt.source, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestGitRef(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"git::https://example.com/vpc.git?ref=v1.2.0", "v1.2.0"},
+		{"git::https://example.com/network.git//vpc?ref=main&depth=1", "main"},
+		{"github.com/org/repo?ref=abc123", "abc123"},
+		{"git::https://example.com/vpc.git", ""},
+		{"git::https://example.com/vpc.git?depth=1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if result := gitRef(tt.source); result != tt.expected {
+				t.Errorf("gitRef(%q) = %q, expected %q", tt.source, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRemoteSourceURL(t *testing.T) {
+	tests := []struct {
+		source   string
+		version  string
+		expected string
+	}{
+		{"terraform-aws-modules/eks/aws", "19.0.0", "https://registry.terraform.io/modules/terraform-aws-modules/eks/aws/19.0.0"},
+		{"terraform-aws-modules/eks/aws", "~> 19.0", "https://registry.terraform.io/modules/terraform-aws-modules/eks/aws"},
+		{"app.terraform.io/corp/k8s/azurerm//modules/node", "", "https://app.terraform.io/modules/corp/k8s/azurerm"},
+		{"git::https://example.com/network.git//vpc?ref=v1.2.0", "", "https://example.com/network.git"},
+		{"github.com/org/repo//modules/vpc?ref=main", "", "https://github.com/org/repo.git"},
+		{"git@github.com:org/repo.git?ref=v1", "", "ssh://git@github.com/org/repo.git"},
+		{"https://example.com/vpc-module.zip", "", "https://example.com/vpc-module.zip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if result := remoteSourceURL(tt.source, tt.version); result != tt.expected {
+				t.Errorf("remoteSourceURL(%q, %q) = %q, expected %q", tt.source, tt.version, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSplitSourceSubdir(t *testing.T) {
+	tests := []struct {
+		source, pkg, subdir string
+	}{
+		{"terraform-aws-modules/iam/aws//modules/iam-user", "terraform-aws-modules/iam/aws", "modules/iam-user"},
+		{"git::https://example.com/network.git//modules/vpc?ref=v1.2.0", "git::https://example.com/network.git?ref=v1.2.0", "modules/vpc"},
+		{"github.com/org/repo", "github.com/org/repo", ""},
+		{"https://example.com/module.tar.gz//*?archive=tar.gz", "https://example.com/module.tar.gz?archive=tar.gz", "*"},
+	}
+	for _, tt := range tests {
+		pkg, subdir := splitSourceSubdir(tt.source)
+		if pkg != tt.pkg || subdir != tt.subdir {
+			t.Errorf("splitSourceSubdir(%q) = %q, %q, want %q, %q", tt.source, pkg, subdir, tt.pkg, tt.subdir)
+		}
+	}
+}
+
+func TestParseRemoteSource(t *testing.T) {
+	tests := []struct {
+		source, url, subdir, ref string
+	}{
+		{"git::https://example.com/network.git//modules/vpc?ref=v1.2.0", "https://example.com/network.git", "modules/vpc", "v1.2.0"},
+		{"github.com/org/repo//modules/vpc?ref=main", "https://github.com/org/repo.git", "modules/vpc", "main"},
+		{"git@github.com:org/repo.git?ref=v1&depth=1", "ssh://git@github.com/org/repo.git?depth=1", "", "v1"},
+		{"bitbucket.org/org/repo", "https://bitbucket.org/org/repo", "", ""},
+		{"git::ssh://git@example.com/infra.git", "ssh://git@example.com/infra.git", "", ""},
+		{"https://example.com/vpc.zip//modules/vpc?archive=zip", "https://example.com/vpc.zip?archive=zip", "modules/vpc", ""},
+	}
+	for _, tt := range tests {
+		url, subdir, ref := parseRemoteSource(tt.source)
+		if url != tt.url || subdir != tt.subdir || ref != tt.ref {
+			t.Errorf("parseRemoteSource(%q) = %q, %q, %q, want %q, %q, %q", tt.source, url, subdir, ref, tt.url, tt.subdir, tt.ref)
+		}
+	}
+}
+
+func TestParseRegistrySource(t *testing.T) {
+	tests := []struct {
+		source string
+		want   RegistryAddress
+	}{
+		{"hashicorp/consul/aws", RegistryAddress{"registry.terraform.io/hashicorp/consul/aws", "registry.terraform.io", "hashicorp", "consul", "aws"}},
+		{"App.Terraform.io/corp/k8s/azurerm//modules/node", RegistryAddress{"app.terraform.io/corp/k8s/azurerm", "app.terraform.io", "corp", "k8s", "azurerm"}},
+	}
+	for _, tt := range tests {
+		got, err := parseRegistrySource(tt.source)
+		if err != nil {
+			t.Errorf("parseRegistrySource(%q) failed: %v", tt.source, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("parseRegistrySource(%q) = %+v, want %+v", tt.source, *got, tt.want)
+		}
+	}
+
+	if _, err := parseRegistrySource("hashicorp/consul"); err == nil {
+		t.Error("expected an error for a malformed address")
+	}
+}
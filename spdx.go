@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string `json:"name"`
+	SPDXID           string `json:"SPDXID"`
+	VersionInfo      string `json:"versionInfo,omitempty"`
+	DownloadLocation string `json:"downloadLocation"`
+	FilesAnalyzed    bool   `json:"filesAnalyzed"`
+	LicenseConcluded string `json:"licenseConcluded"`
+	LicenseDeclared  string `json:"licenseDeclared"`
+	CopyrightText    string `json:"copyrightText"`
+	Comment          string `json:"comment,omitempty"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+const spdxNoAssertion = "NOASSERTION"
+
+// renderSPDX writes the remote module dependencies of output as an SPDX 2.3
+// JSON document describing the root module.
+func renderSPDX(w io.Writer, output *Output, opts renderOptions) error {
+	rootName := filepath.Base(output.RootModule.ResolvedPath)
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              rootName,
+		DocumentNamespace: "https://github.com/mkusaka/terraform-module-resolve/spdx/" + rootName + "-" + newUUID(),
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: terraform-module-resolve"},
+		},
+		Packages: []spdxPackage{{
+			Name:             rootName,
+			SPDXID:           "SPDXRef-Root",
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+			CopyrightText:    spdxNoAssertion,
+			Comment:          output.RootModule.ResolvedPath,
+		}},
+		Relationships: []spdxRelationship{
+			{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Root"},
+		},
+	}
+
+	for i, dep := range remoteDependencies(output) {
+		id := fmt.Sprintf("SPDXRef-Module-%d", i+1)
+		license := spdxNoAssertion
+		if dep.License != "" {
+			license = dep.License
+		}
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             dep.Source,
+			SPDXID:           id,
+			VersionInfo:      dep.Version,
+			DownloadLocation: spdxDownloadLocation(dep),
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  license,
+			CopyrightText:    spdxNoAssertion,
+			Comment:          "called from " + strings.Join(dep.Callers, ", "),
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      "SPDXRef-Root",
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// spdxDownloadLocation formats the download location of a dependency, using
+// the VCS form (git+<url>@<ref>) for git sources.
+func spdxDownloadLocation(dep remoteDependency) string {
+	if dep.URL == "" {
+		return spdxNoAssertion
+	}
+	if isGitSource(dep.Source) {
+		location := "git+" + dep.URL
+		if ref := gitRef(dep.Source); ref != "" {
+			location += "@" + ref
+		}
+		return location
+	}
+	return dep.URL
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// StateModule is a module instance of a Terraform state, such as
+// module.app["a"].module.vpc, with the addresses of its resources and the
+// module call its address resolves to in the configuration. Kind is root,
+// local or remote, or unknown when no call of the configuration matches,
+// such as for a module removed since the state was written. Addresses
+// below a remote module resolve to that remote call, whose nested calls
+// are not followed, and ResolvedPath is only set for remote modules found
+// with AnalyzeOptions.IncludeDownloaded.
+type StateModule struct {
+	Address      string   `json:"address"`
+	Kind         string   `json:"kind"`
+	Source       string   `json:"source,omitempty"`
+	ResolvedPath string   `json:"resolved_path,omitempty"`
+	Resources    []string `json:"resources"`
+}
+
+const kindUnknown = "unknown"
+
+// stateJSON is the part of the output of terraform show -json read by
+// MapStateModules. The output for a saved plan holds the state in
+// prior_state.
+type stateJSON struct {
+	Values     *stateValues `json:"values"`
+	PriorState *struct {
+		Values *stateValues `json:"values"`
+	} `json:"prior_state"`
+}
+
+type stateValues struct {
+	RootModule stateModuleJSON `json:"root_module"`
+}
+
+type stateModuleJSON struct {
+	Address   string `json:"address"`
+	Resources []struct {
+		Address string `json:"address"`
+	} `json:"resources"`
+	ChildModules []stateModuleJSON `json:"child_modules"`
+}
+
+// MapStateModules maps every module instance of the state read from r, as
+// printed by terraform show -json, to its module call in output, in state
+// order: each module followed by its child modules.
+func MapStateModules(r io.Reader, output *Output) ([]StateModule, error) {
+	var state stateJSON
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	values := state.Values
+	if values == nil && state.PriorState != nil {
+		values = state.PriorState.Values
+	}
+	modules := []StateModule{}
+	if values == nil {
+		return modules, nil
+	}
+
+	var visit func(m stateModuleJSON)
+	visit = func(m stateModuleJSON) {
+		module := resolveStateModule(m.Address, output)
+		module.Resources = []string{}
+		for _, r := range m.Resources {
+			module.Resources = append(module.Resources, r.Address)
+		}
+		modules = append(modules, module)
+		for _, child := range m.ChildModules {
+			visit(child)
+		}
+	}
+	visit(values.RootModule)
+	return modules, nil
+}
+
+// resolveStateModule follows the module calls named by a module instance
+// address from the root module of output.
+func resolveStateModule(address string, output *Output) StateModule {
+	module := StateModule{Address: address, Kind: kindRoot, ResolvedPath: output.RootModule.ResolvedPath}
+	names, ok := moduleCallNames(address)
+	if !ok {
+		return StateModule{Address: address, Kind: kindUnknown}
+	}
+	dir := output.RootModule.ResolvedPath
+	for _, name := range names {
+		if local, ok := findLocalCall(output, dir, name); ok {
+			module = StateModule{Address: address, Kind: kindLocal, Source: local.Source, ResolvedPath: local.ResolvedPath}
+			dir = local.ResolvedPath
+			continue
+		}
+		if remote, ok := findRemoteCall(output, dir, name); ok {
+			return StateModule{Address: address, Kind: kindRemote, Source: remote.Source, ResolvedPath: remote.ResolvedPath}
+		}
+		return StateModule{Address: address, Kind: kindUnknown}
+	}
+	return module
+}
+
+func findLocalCall(output *Output, callerPath, name string) (ModuleDetail, bool) {
+	for _, m := range output.LocalModules {
+		if m.CallerPath == callerPath && m.Name == name {
+			return m, true
+		}
+	}
+	return ModuleDetail{}, false
+}
+
+func findRemoteCall(output *Output, callerPath, name string) (RemoteModule, bool) {
+	for _, m := range output.RemoteModules {
+		if m.CallerPath == callerPath && m.Name == name {
+			return m, true
+		}
+	}
+	return RemoteModule{}, false
+}
+
+// moduleCallNames returns the call names of a module instance address,
+// such as app and vpc for module.app["a"].module.vpc[0], or none for the
+// root module's empty address.
+func moduleCallNames(address string) ([]string, bool) {
+	var names []string
+	for address != "" {
+		rest, ok := strings.CutPrefix(address, "module.")
+		if !ok {
+			return nil, false
+		}
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			return nil, false
+		}
+		names = append(names, rest[:end])
+		rest = rest[end:]
+		if strings.HasPrefix(rest, "[") {
+			n, ok := instanceKeyLen(rest)
+			if !ok {
+				return nil, false
+			}
+			rest = rest[n:]
+		}
+		if rest != "" && !strings.HasPrefix(rest, ".") {
+			return nil, false
+		}
+		address = strings.TrimPrefix(rest, ".")
+	}
+	return names, true
+}
+
+// instanceKeyLen returns the length of the instance key at the start of s,
+// such as [0] or ["a.b"], whose strings may contain escaped quotes.
+func instanceKeyLen(s string) (int, bool) {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == ']':
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+func runStateMap(args []string) int {
+	flags := newFlagSet("state-map")
+	format := flags.String("format", "text", "output format: text (tab-separated address, kind and resolved path or source) or json")
+	includeDownloaded := flags.Bool("include-downloaded", false, "resolve remote modules to the copies installed under .terraform/modules by terraform init")
+	configPath := flags.String("config", "", "configuration file (default "+defaultConfigFile+" in the working directory, if present)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s state-map [options] <directory> [state.json]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Map the module instances of a state, as printed by terraform show -json and read\n")
+		fmt.Fprintf(flags.Output(), "from the file or stdin, to the module directories of a root (exit 0=all mapped,\n")
+		fmt.Fprintf(flags.Output(), "1=some module addresses have no call in the configuration).\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\nExamples:\n")
+		fmt.Fprintf(flags.Output(), "  terraform -chdir=terraform/prod show -json | %s state-map ./terraform/prod\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  %s state-map --format json ./terraform/prod state.json\n", os.Args[0])
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	opts := config.analyzeOptions()
+	opts.IncludeDownloaded = *includeDownloaded
+	output, err := AnalyzeWithOptions(flags.Arg(0), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	var r io.Reader = os.Stdin
+	if path := flags.Arg(1); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		r = f
+	}
+	modules, err := MapStateModules(r, output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	if *format == "json" {
+		jsonOutput, _ := json.MarshalIndent(modules, "", "  ")
+		fmt.Println(string(jsonOutput))
+	} else {
+		writeStateModules(os.Stdout, modules)
+	}
+	for _, m := range modules {
+		if m.Kind == kindUnknown {
+			return exitNotAffected
+		}
+	}
+	return exitAffected
+}
+
+// writeStateModules prints each module instance with its kind and its
+// directory relative to the working directory, or its source for remote
+// modules that were not found installed.
+func writeStateModules(w io.Writer, modules []StateModule) {
+	for _, m := range modules {
+		address := m.Address
+		if address == "" {
+			address = "(root)"
+		}
+		location := m.Source
+		if m.ResolvedPath != "" {
+			location = workingDirRel(m.ResolvedPath)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", address, m.Kind, location)
+	}
+}
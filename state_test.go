@@ -0,0 +1,103 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMapStateModules(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "app" {
+  source   = "../modules/app"
+  for_each = toset(["a.b"])
+}
+`,
+		"modules/app/main.tf": `
+module "network" {
+  source = "../network"
+  count  = 1
+}
+
+module "dns" {
+  source  = "terraform-aws-modules/route53/aws"
+  version = "2.0.0"
+}
+`,
+		"modules/network/main.tf": `resource "aws_vpc" "this" {}`,
+	})
+	root := filepath.Join(tempDir, "root")
+	output, err := Analyze(root)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	state := `{
+  "format_version": "1.0",
+  "values": {
+    "root_module": {
+      "child_modules": [
+        {
+          "address": "module.app[\"a.b\"]",
+          "child_modules": [
+            {
+              "address": "module.app[\"a.b\"].module.network[0]",
+              "resources": [{"address": "module.app[\"a.b\"].module.network[0].aws_vpc.this"}]
+            },
+            {
+              "address": "module.app[\"a.b\"].module.dns.module.records",
+              "resources": [{"address": "module.app[\"a.b\"].module.dns.module.records.aws_route53_record.this[\"www\"]"}]
+            },
+            {
+              "address": "module.app[\"a.b\"].module.removed",
+              "resources": [{"address": "module.app[\"a.b\"].module.removed.null_resource.this"}]
+            }
+          ]
+        }
+      ],
+      "resources": [{"address": "aws_s3_bucket.logs"}]
+    }
+  }
+}`
+	modules, err := MapStateModules(strings.NewReader(state), output)
+	if err != nil {
+		t.Fatalf("MapStateModules failed: %v", err)
+	}
+	expected := []StateModule{
+		{Address: "", Kind: kindRoot, ResolvedPath: root, Resources: []string{"aws_s3_bucket.logs"}},
+		{Address: `module.app["a.b"]`, Kind: kindLocal, Source: "../modules/app", ResolvedPath: filepath.Join(tempDir, "modules", "app"), Resources: []string{}},
+		{Address: `module.app["a.b"].module.network[0]`, Kind: kindLocal, Source: "../network", ResolvedPath: filepath.Join(tempDir, "modules", "network"), Resources: []string{`module.app["a.b"].module.network[0].aws_vpc.this`}},
+		{Address: `module.app["a.b"].module.dns.module.records`, Kind: kindRemote, Source: "terraform-aws-modules/route53/aws", Resources: []string{`module.app["a.b"].module.dns.module.records.aws_route53_record.this["www"]`}},
+		{Address: `module.app["a.b"].module.removed`, Kind: kindUnknown, Resources: []string{`module.app["a.b"].module.removed.null_resource.this`}},
+	}
+	if !reflect.DeepEqual(modules, expected) {
+		t.Errorf("expected %+v, got %+v", expected, modules)
+	}
+
+	if _, err := MapStateModules(strings.NewReader("not json"), output); err == nil {
+		t.Error("expected an error for a malformed state")
+	}
+}
+
+func TestModuleCallNames(t *testing.T) {
+	tests := []struct {
+		address string
+		names   []string
+		ok      bool
+	}{
+		{"", nil, true},
+		{"module.app", []string{"app"}, true},
+		{`module.app["x\"].y"].module.vpc[0]`, []string{"app", "vpc"}, true},
+		{"aws_vpc.this", nil, false},
+		{"module.app[0", nil, false},
+	}
+	for _, tt := range tests {
+		names, ok := moduleCallNames(tt.address)
+		if ok != tt.ok || !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("moduleCallNames(%q) = %v, %v; expected %v, %v", tt.address, names, ok, tt.names, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// statsTopCalled is the number of most-called modules in the text summary.
+const statsTopCalled = 10
+
+// Stats summarizes the module tree of a root module.
+type Stats struct {
+	LocalModuleCalls      int           `json:"local_module_calls"`
+	LocalModules          int           `json:"local_modules"`
+	RemoteModuleCalls     int           `json:"remote_module_calls"`
+	RemoteModules         int           `json:"remote_modules"`
+	MaxDepth              int           `json:"max_depth"`
+	TotalFiles            int           `json:"total_files"`
+	AverageFilesPerModule float64       `json:"average_files_per_module"`
+	FilesPerModule        []ModuleFiles `json:"files_per_module"`
+	MostCalled            []CallCount   `json:"most_called"`
+}
+
+// ModuleFiles is the number of Terraform files in a module directory.
+type ModuleFiles struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+}
+
+// CallCount is the number of calls to a module, identified by its resolved
+// path for local modules and by its source for remote modules.
+type CallCount struct {
+	Module string `json:"module"`
+	Kind   string `json:"kind"`
+	Calls  int    `json:"calls"`
+}
+
+func runStats(args []string) int {
+	flags := newFlagSet("stats")
+	format := flags.String("format", "text", "output format: text or json")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s stats [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Summarize the module tree of a root module.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+
+	output, err := Analyze(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	stats := ComputeStats(output)
+	if *format == "json" {
+		jsonOutput, _ := json.MarshalIndent(stats, "", "  ")
+		fmt.Println(string(jsonOutput))
+		return 0
+	}
+	writeStats(os.Stdout, stats)
+	return 0
+}
+
+// ComputeStats counts the modules, files and call depth of output.
+func ComputeStats(output *Output) *Stats {
+	stats := &Stats{
+		LocalModuleCalls:  len(output.LocalModules),
+		RemoteModuleCalls: len(output.RemoteModules),
+		FilesPerModule:    []ModuleFiles{},
+		MostCalled:        []CallCount{},
+		MaxDepth:          treeDepth(buildModuleTree(output)),
+	}
+
+	files := make(map[string]bool)
+	seen := make(map[string]bool)
+	addModule := func(path string, moduleFiles []string) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		stats.FilesPerModule = append(stats.FilesPerModule, ModuleFiles{Path: path, Files: len(moduleFiles)})
+		for _, f := range moduleFiles {
+			files[f] = true
+		}
+	}
+	addModule(output.RootModule.ResolvedPath, output.RootModule.Files)
+
+	calls := make(map[CallCount]int)
+	for _, m := range output.LocalModules {
+		addModule(m.ResolvedPath, m.Files)
+		calls[CallCount{Module: m.ResolvedPath, Kind: kindLocal}]++
+	}
+	for _, r := range output.RemoteModules {
+		key := CallCount{Module: r.Source, Kind: kindRemote}
+		if calls[key] == 0 {
+			stats.RemoteModules++
+		}
+		calls[key]++
+	}
+
+	stats.LocalModules = len(localModulePaths(output))
+	stats.TotalFiles = len(files)
+	stats.AverageFilesPerModule = float64(len(files)) / float64(len(seen))
+
+	sort.SliceStable(stats.FilesPerModule, func(i, j int) bool {
+		return stats.FilesPerModule[i].Files > stats.FilesPerModule[j].Files
+	})
+
+	for c, n := range calls {
+		c.Calls = n
+		stats.MostCalled = append(stats.MostCalled, c)
+	}
+	sort.Slice(stats.MostCalled, func(i, j int) bool {
+		a, b := stats.MostCalled[i], stats.MostCalled[j]
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		return a.Module < b.Module
+	})
+	return stats
+}
+
+// treeDepth returns the number of nested module calls below node.
+func treeDepth(node *moduleNode) int {
+	depth := 0
+	for _, child := range node.Children {
+		depth = max(depth, 1+treeDepth(child))
+	}
+	return depth
+}
+
+func writeStats(w io.Writer, stats *Stats) {
+	fmt.Fprintf(w, "Local modules:    %d (%d calls)\n", stats.LocalModules, stats.LocalModuleCalls)
+	fmt.Fprintf(w, "Remote modules:   %d (%d calls)\n", stats.RemoteModules, stats.RemoteModuleCalls)
+	fmt.Fprintf(w, "Max depth:        %d\n", stats.MaxDepth)
+	fmt.Fprintf(w, "Total files:      %d\n", stats.TotalFiles)
+	fmt.Fprintf(w, "Files per module: %.1f on average", stats.AverageFilesPerModule)
+	if len(stats.FilesPerModule) > 0 {
+		largest := stats.FilesPerModule[0]
+		fmt.Fprintf(w, ", at most %d in %s", largest.Files, largest.Path)
+	}
+	fmt.Fprintln(w)
+
+	if len(stats.MostCalled) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nMost called modules:\n")
+	for i, c := range stats.MostCalled {
+		if i == statsTopCalled {
+			break
+		}
+		fmt.Fprintf(w, "  %4d  %s\n", c.Calls, c.Module)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComputeStats(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "app" {
+  source = "../modules/app"
+}
+
+module "vpc" {
+  source = "../modules/vpc"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+		"root/variables.tf": `variable "name" {}`,
+		"modules/app/main.tf": `
+module "network" {
+  source = "../vpc"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+		"modules/vpc/main.tf": `
+module "subnets" {
+  source = "terraform-aws-modules/vpc/aws//modules/subnets"
+}
+`,
+	})
+
+	output, err := Analyze(filepath.Join(tempDir, "root"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	stats := ComputeStats(output)
+
+	if stats.LocalModules != 2 || stats.LocalModuleCalls != 3 {
+		t.Errorf("expected 2 local modules in 3 calls, got %d in %d", stats.LocalModules, stats.LocalModuleCalls)
+	}
+	if stats.RemoteModules != 2 || stats.RemoteModuleCalls != 3 {
+		t.Errorf("expected 2 remote modules in 3 calls, got %d in %d", stats.RemoteModules, stats.RemoteModuleCalls)
+	}
+	if stats.MaxDepth != 3 {
+		t.Errorf("expected max depth 3 (root -> app -> network -> subnets), got %d", stats.MaxDepth)
+	}
+	if stats.TotalFiles != 4 {
+		t.Errorf("expected 4 files, got %d", stats.TotalFiles)
+	}
+	if stats.FilesPerModule[0].Path != filepath.Join(tempDir, "root") || stats.FilesPerModule[0].Files != 2 {
+		t.Errorf("expected the root to have the most files, got %+v", stats.FilesPerModule[0])
+	}
+
+	top := stats.MostCalled[0]
+	if top.Calls != 2 {
+		t.Errorf("expected the most called module to have 2 calls, got %+v", top)
+	}
+
+	var buf bytes.Buffer
+	writeStats(&buf, stats)
+	for _, want := range []string{"Local modules:    2 (3 calls)", "Max depth:        3", "Most called modules:"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected summary to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
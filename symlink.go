@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// maxSymlinkHops bounds the chain of symbolic links followed from one file,
+// so that link cycles end.
+const maxSymlinkHops = 40
+
+// linkedFiles returns the files outside dir that the symbolic links among
+// files point to, such as a providers.tf shared between modules, sorted by
+// name. Changes to them change the module like changes to its own files.
+func linkedFiles(fsys fileSystem, dir string, files []string) []string {
+	var linked []string
+	for _, f := range files {
+		if target := linkTarget(fsys, f); target != "" && !isInDirectory(target, dir) {
+			linked = append(linked, target)
+		}
+	}
+	sort.Strings(linked)
+	return linked
+}
+
+// linkTarget returns the file that the symbolic link at path points to,
+// following chains of links, or "" when path is not a link or the chain
+// does not end. Relative targets are resolved against the directory of the
+// link without resolving links in its parent directories, so the target is
+// named like the changed files of the repository it is in.
+func linkTarget(fsys fileSystem, path string) string {
+	target := path
+	for hops := 0; hops < maxSymlinkHops; hops++ {
+		dest, err := fsys.readLink(target)
+		if err != nil {
+			if hops == 0 {
+				return ""
+			}
+			return target
+		}
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(filepath.Dir(target), dest)
+		}
+		target = filepath.Clean(dest)
+	}
+	return ""
+}
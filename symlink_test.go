@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIsAffected_SymlinkedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`,
+		"modules/vpc/main.tf":     `variable "cidr" {}`,
+		"shared/providers.tf":     `provider "aws" {}`,
+		"shared/versions.tf":      `terraform {}`,
+		"shared/unused.tf":        `variable "unused" {}`,
+		"envs/prod/variables.tf":  `variable "name" {}`,
+		"shared/chain/backend.tf": `terraform {}`,
+	})
+	for link, target := range map[string]string{
+		"envs/prod/providers.tf":  "../../shared/providers.tf",
+		"envs/prod/local.tf":      "variables.tf",
+		"modules/vpc/versions.tf": "../../shared/versions.tf",
+		"shared/chained.tf":       "chain/backend.tf",
+		"modules/vpc/chained.tf":  "../../shared/chained.tf",
+		"modules/vpc/dangling.tf": "../../shared/deleted.tf",
+		"modules/vpc/cycle.tf":    "cycle.tf",
+		"modules/vpc/absolute.tf": filepath.Join(tempDir, "shared", "versions.tf"),
+		"modules/vpc/not-tf.txt":  "../../shared/unused.tf",
+	} {
+		if err := os.Symlink(target, filepath.Join(tempDir, link)); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+	root := filepath.Join(tempDir, "envs", "prod")
+	shared := filepath.Join(tempDir, "shared")
+
+	output, err := Analyze(root)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if !slices.Contains(output.RootModule.Files, filepath.Join(shared, "providers.tf")) {
+		t.Errorf("expected the link target among the root files, got %v", output.RootModule.Files)
+	}
+	if !slices.Contains(output.RootModule.Files, filepath.Join(root, "variables.tf")) {
+		t.Errorf("expected the root's own files, got %v", output.RootModule.Files)
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		expected bool
+	}{
+		{"target of a root file", filepath.Join(shared, "providers.tf"), true},
+		{"target of a module file", filepath.Join(shared, "versions.tf"), true},
+		{"end of a chain of links", filepath.Join(shared, "chain", "backend.tf"), true},
+		{"dangling target", filepath.Join(shared, "deleted.tf"), true},
+		{"target of a non-Terraform file", filepath.Join(shared, "unused.tf"), false},
+		{"link inside the module", filepath.Join(root, "variables.tf"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsAffected([]string{tt.file}, output); got != tt.expected {
+				t.Errorf("expected IsAffected %v for %s, got %v", tt.expected, tt.file, got)
+			}
+		})
+	}
+}
+
+func TestMappedFS_ReadLink(t *testing.T) {
+	m := &MappedFS{FS: fstest.MapFS{
+		"envs/prod/providers.tf": {Data: []byte("../../shared/providers.tf"), Mode: os.ModeSymlink},
+		"envs/prod/absolute.tf":  {Data: []byte("/shared/providers.tf"), Mode: os.ModeSymlink},
+		"shared/providers.tf":    {Data: []byte(`provider "aws" {}`)},
+	}, Root: "/repo"}
+
+	if got := linkTarget(m, "/repo/envs/prod/providers.tf"); got != filepath.FromSlash("/repo/shared/providers.tf") {
+		t.Errorf("expected the relative target below the root, got %q", got)
+	}
+	if got := linkTarget(m, "/repo/envs/prod/absolute.tf"); got != filepath.FromSlash("/repo/shared/providers.tf") {
+		t.Errorf("expected the absolute target below the root, got %q", got)
+	}
+	if got := linkTarget(m, "/repo/shared/providers.tf"); got != "" {
+		t.Errorf("expected no target for a regular file, got %q", got)
+	}
+}
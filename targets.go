@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PlanTargets returns the minimal module addresses to pass to terraform plan
+// as -target for changedFiles: the addresses of every call of the module
+// directory nearest to each changed file, without addresses nested in
+// another one. A file of a deleted module directory counts as a change to
+// the module calling it. full reports that a changed file belongs to the root module
+// itself, which only an untargeted plan covers; no targets are returned
+// then.
+func PlanTargets(changedFiles []string, output *Output) (targets []string, full bool) {
+	type call struct{ name, caller string }
+	calls := make(map[string][]call)
+	for _, m := range output.LocalModules {
+		calls[m.ResolvedPath] = append(calls[m.ResolvedPath], call{m.Name, m.CallerPath})
+	}
+	for _, m := range output.RemoteModules {
+		if m.ResolvedPath != "" {
+			calls[m.ResolvedPath] = append(calls[m.ResolvedPath], call{m.Name, m.CallerPath})
+		}
+	}
+
+	// addresses returns every address a directory is called at, following
+	// all callers back to the root and skipping calls that form a cycle.
+	root := output.RootModule.ResolvedPath
+	visiting := make(map[string]bool)
+	var addresses func(dir string) []string
+	addresses = func(dir string) []string {
+		if dir == root {
+			return []string{""}
+		}
+		if visiting[dir] {
+			return nil
+		}
+		visiting[dir] = true
+		defer delete(visiting, dir)
+		var addrs []string
+		for _, c := range calls[dir] {
+			for _, prefix := range addresses(c.caller) {
+				addrs = append(addrs, strings.TrimPrefix(prefix+".module."+c.name, "."))
+			}
+		}
+		return addrs
+	}
+
+	found := make(map[string]bool)
+	for _, f := range changedFiles {
+		absPath := toAbsPath(f)
+		nearest := ""
+		if isInDirectory(absPath, root) {
+			nearest = root
+		}
+		for dir := range calls {
+			if isInDirectory(absPath, dir) && len(dir) > len(nearest) {
+				nearest = dir
+			}
+		}
+		if deleted, caller, ok := output.deletedModuleCaller(absPath); ok && len(deleted.ResolvedPath) > len(nearest) {
+			// A deleted module changes the module calling it.
+			nearest = caller
+		}
+		if nearest != "" && !output.classAffects(absPath, nearest == root) {
+			continue
+		}
+		switch nearest {
+		case "":
+		case root:
+			full = true
+		default:
+			for _, addr := range addresses(nearest) {
+				found[addr] = true
+			}
+		}
+	}
+	if full {
+		return nil, true
+	}
+
+	for addr := range found {
+		targets = append(targets, addr)
+	}
+	sort.Strings(targets)
+	minimal := targets[:0]
+	for _, addr := range targets {
+		// Sorting puts a module before the modules nested in it.
+		if len(minimal) > 0 && strings.HasPrefix(addr, minimal[len(minimal)-1]+".") {
+			continue
+		}
+		minimal = append(minimal, addr)
+	}
+	return minimal, false
+}
+
+// targetArgs returns the -target arguments of addresses.
+func targetArgs(addresses []string) []string {
+	var args []string
+	for _, addr := range addresses {
+		args = append(args, "-target="+addr)
+	}
+	return args
+}
+
+// writeRootPlanTargets writes a line per affected root with its directory,
+// relative to the working directory, or its project name, a tab and its
+// -target arguments. The arguments are empty when the root needs an
+// untargeted plan, as it does when a project's variable file or input
+// changed.
+func writeRootPlanTargets(w io.Writer, discovery *Discovery, results []RootResult) {
+	for i, r := range results {
+		if !r.Affected {
+			continue
+		}
+		targets, _ := PlanTargets(r.MatchedFiles, discovery.Roots[i].Analysis)
+		if slices.ContainsFunc(r.MatchedFiles, func(f string) bool { return isProjectInput(discovery.Roots[i], toAbsPath(f)) }) {
+			targets = nil
+		}
+		fmt.Fprintf(w, "%s\t%s\n", rootName(r.Path, r.Project), strings.Join(targetArgs(targets), " "))
+	}
+}
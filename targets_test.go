@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlanTargets(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "blue" {
+  source = "../modules/app"
+}
+
+module "green" {
+  source = "../modules/app"
+}
+
+module "dns" {
+  source = "../modules/dns"
+}
+`,
+		"modules/app/main.tf": `
+module "vpc" {
+  source = "./vpc"
+}
+`,
+		"modules/app/vpc/main.tf": `variable "cidr" {}`,
+		"modules/dns/main.tf":     `variable "zone" {}`,
+	})
+
+	output, err := Analyze(filepath.Join(tempDir, "root"))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	vpcFile := filepath.Join(tempDir, "modules", "app", "vpc", "main.tf")
+	appFile := filepath.Join(tempDir, "modules", "app", "main.tf")
+	dnsFile := filepath.Join(tempDir, "modules", "dns", "main.tf")
+	rootFile := filepath.Join(tempDir, "root", "main.tf")
+
+	tests := []struct {
+		name    string
+		changed []string
+		targets []string
+		full    bool
+	}{
+		{"every call of a nested module", []string{vpcFile}, []string{"module.blue.module.vpc", "module.green.module.vpc"}, false},
+		{"nested addresses are covered by their parent", []string{vpcFile, appFile, dnsFile}, []string{"module.blue", "module.dns", "module.green"}, false},
+		{"root module change", []string{dnsFile, rootFile}, nil, true},
+		{"unrelated file", []string{filepath.Join(tempDir, "README.md")}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, full := PlanTargets(tt.changed, output)
+			if !reflect.DeepEqual(targets, tt.targets) || full != tt.full {
+				t.Errorf("expected %v (full %v), got %v (full %v)", tt.targets, tt.full, targets, full)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// templateData is the value --format template executes its template with:
+// the fields of Output, such as .RootModule and .RemoteModules, and with
+// --affected the .Affected modules.
+type templateData struct {
+	*Output
+	Affected []AffectedModule
+}
+
+// templateFuncs are the functions available to --template besides the
+// text/template builtins.
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"rel": workingDirRel,
+}
+
+// parseOutputTemplate parses the --template text of --format template.
+func parseOutputTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, errors.New("--format template requires --template")
+	}
+	return template.New("output").Funcs(templateFuncs).Parse(text)
+}
+
+// renderTemplate writes output through opts.Template.
+func renderTemplate(w io.Writer, output *Output, opts renderOptions) error {
+	if opts.Template == nil {
+		return errors.New("--format template requires --template")
+	}
+	return opts.Template.Execute(w, templateData{Output: output, Affected: opts.Affected})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "5.0.0"
+}
+
+module "app" {
+  source = "./modules/app"
+}
+`,
+		"modules/app/main.tf": `variable "name" {}`,
+	})
+	output, err := Analyze(tempDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	tmpl, err := parseOutputTemplate(`{{range .RemoteModules}}{{.Source}}@{{.Version}}{{"\n"}}{{end}}{{range .Affected}}{{.Name}} {{end}}{{json (index .LocalModules 0).Name}}`)
+	if err != nil {
+		t.Fatalf("parseOutputTemplate failed: %v", err)
+	}
+	affected := []AffectedModule{{Name: "app", ResolvedPath: filepath.Join(tempDir, "modules", "app")}}
+	var buf bytes.Buffer
+	if err := renderTemplate(&buf, output, renderOptions{Template: tmpl, Affected: affected}); err != nil {
+		t.Fatalf("renderTemplate failed: %v", err)
+	}
+	expected := "terraform-aws-modules/vpc/aws@5.0.0\napp \"app\""
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	if _, err := parseOutputTemplate(""); err == nil {
+		t.Error("expected an error without a template")
+	}
+	if _, err := parseOutputTemplate("{{.RemoteModules"); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
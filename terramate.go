@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// TerramateStack is the stack block of a Terramate stack directory. Watch
+// holds the absolute paths of the files it declares, which affect the
+// stack like the files in its directory.
+type TerramateStack struct {
+	Name        string   `json:"name"`
+	ID          string   `json:"id,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	After       []string `json:"after,omitempty"`
+	Watch       []string `json:"watch,omitempty"`
+}
+
+var terramateStackSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{{Type: "stack"}},
+}
+
+// isTerramateFile reports whether name is a Terramate configuration file.
+func isTerramateFile(name string) bool {
+	return strings.HasSuffix(name, ".tm") || strings.HasSuffix(name, ".tm.hcl")
+}
+
+// loadTerramateStack returns the stack declared by the Terramate
+// configuration files in dir, or nil when dir is not a stack. Watched
+// paths starting with / are relative to projectDir, the root of the
+// Terramate project, and others to dir.
+func loadTerramateStack(dir, projectDir string) (*TerramateStack, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	parser := hclparse.NewParser()
+	for _, entry := range entries {
+		if entry.IsDir() || !isTerramateFile(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		file, diags := parser.ParseHCLFile(path)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse %s: %s", path, diags.Error())
+		}
+		content, _, _ := file.Body.PartialContent(terramateStackSchema)
+		if len(content.Blocks) == 0 {
+			continue
+		}
+		attrs, _ := content.Blocks[0].Body.JustAttributes()
+		stack := &TerramateStack{
+			Name:        terramateString(attrs["name"]),
+			ID:          terramateString(attrs["id"]),
+			Description: terramateString(attrs["description"]),
+			Tags:        terramateStrings(attrs["tags"]),
+			After:       terramateStrings(attrs["after"]),
+		}
+		if stack.Name == "" {
+			stack.Name = filepath.Base(dir)
+		}
+		for _, watch := range terramateStrings(attrs["watch"]) {
+			if strings.HasPrefix(watch, "/") {
+				stack.Watch = append(stack.Watch, filepath.Join(projectDir, filepath.FromSlash(watch)))
+			} else {
+				stack.Watch = append(stack.Watch, filepath.Join(dir, filepath.FromSlash(watch)))
+			}
+		}
+		return stack, nil
+	}
+	return nil, nil
+}
+
+// terramateString returns the value of a string attribute, or "" when it
+// is missing or not a literal string, such as one interpolating globals.
+func terramateString(attr *hcl.Attribute) string {
+	if attr == nil {
+		return ""
+	}
+	v, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || v.Type() != cty.String || v.IsNull() {
+		return ""
+	}
+	return v.AsString()
+}
+
+// terramateStrings returns the literal strings of a list or set attribute.
+func terramateStrings(attr *hcl.Attribute) []string {
+	if attr == nil {
+		return nil
+	}
+	v, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || v.IsNull() || !v.IsKnown() || !v.CanIterateElements() {
+		return nil
+	}
+	var values []string
+	for it := v.ElementIterator(); it.Next(); {
+		_, elem := it.Element()
+		if elem.Type() == cty.String && !elem.IsNull() {
+			values = append(values, elem.AsString())
+		}
+	}
+	return values
+}
+
+// writeTerramateChanged writes the directories of the affected roots, or
+// of every root with all, relative to the working directory and one per
+// line in sorted order, as terramate list --changed prints changed stacks.
+// Projects of the same root directory are listed once.
+func writeTerramateChanged(w io.Writer, discovery *Discovery, results []RootResult, all bool) {
+	seen := make(map[string]bool)
+	var dirs []string
+	for i, root := range discovery.Roots {
+		if !all && !results[i].Affected {
+			continue
+		}
+		dir := workingDirRel(root.Path)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		fmt.Fprintln(w, dir)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDiscover_TerramateStacks(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"stacks/vpc/stack.tm.hcl": `
+stack {
+  name        = "network"
+  description = "Shared VPC"
+  tags        = ["net", "prod"]
+  watch       = ["/config/vpc.yaml", "values.json"]
+}
+`,
+		"stacks/vpc/main.tf": `
+module "net" {
+  source = "../../modules/net"
+}
+`,
+		"stacks/app/stack.tm": `
+stack {
+  id    = "app"
+  after = ["/stacks/vpc"]
+}
+`,
+		"stacks/shared/stack.tm.hcl": `stack {}`,
+		"stacks/shared/main.tf":      `variable "name" {}`,
+		"stacks/caller/main.tf": `
+module "shared" {
+  source = "../shared"
+}
+`,
+		"config/terramate.tm.hcl": `terramate {}`,
+		"config/vpc.yaml":         "cidr: 10.0.0.0/16\n",
+		"modules/net/main.tf":     `variable "cidr" {}`,
+		"plain/main.tf":           `variable "region" {}`,
+	})
+
+	discovery, err := Discover(tempDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	stacks := make(map[string]*TerramateStack)
+	var paths []string
+	for _, root := range discovery.Roots {
+		rel, _ := filepath.Rel(tempDir, root.Path)
+		paths = append(paths, filepath.ToSlash(rel))
+		stacks[filepath.ToSlash(rel)] = root.Stack
+	}
+	// The app stack has no Terraform files yet and the shared stack is
+	// called as a module, but both are stacks; the config directory only
+	// holds project configuration.
+	expected := []string{"plain", "stacks/app", "stacks/caller", "stacks/shared", "stacks/vpc"}
+	if !slices.Equal(paths, expected) {
+		t.Fatalf("expected roots %v, got %v", expected, paths)
+	}
+	vpc := stacks["stacks/vpc"]
+	if vpc == nil || vpc.Name != "network" || vpc.Description != "Shared VPC" || !slices.Equal(vpc.Tags, []string{"net", "prod"}) {
+		t.Errorf("unexpected vpc stack: %+v", vpc)
+	}
+	expectedWatch := []string{filepath.Join(tempDir, "config", "vpc.yaml"), filepath.Join(tempDir, "stacks", "vpc", "values.json")}
+	if vpc != nil && !slices.Equal(vpc.Watch, expectedWatch) {
+		t.Errorf("expected watched files %v, got %v", expectedWatch, vpc.Watch)
+	}
+	if app := stacks["stacks/app"]; app == nil || app.Name != "app" || app.ID != "app" || !slices.Equal(app.After, []string{"/stacks/vpc"}) {
+		t.Errorf("unexpected app stack: %+v", app)
+	}
+	if stacks["plain"] != nil || stacks["stacks/caller"] != nil {
+		t.Error("expected plain roots to have no stack")
+	}
+
+	tests := []struct {
+		changed  []string
+		expected []string
+	}{
+		{[]string{filepath.Join(tempDir, "config", "vpc.yaml")}, []string{"stacks/vpc"}},
+		{[]string{filepath.Join(tempDir, "stacks", "app", "README.md")}, []string{"stacks/app"}},
+		{[]string{filepath.Join(tempDir, "modules", "net", "main.tf"), filepath.Join(tempDir, "plain", "main.tf")}, []string{"plain", "stacks/vpc"}},
+		{[]string{filepath.Join(tempDir, "stacks", "shared", "main.tf")}, []string{"stacks/caller", "stacks/shared"}},
+	}
+	for _, tt := range tests {
+		var affected []string
+		for _, r := range RootAffectedResults(discovery, tt.changed, precedenceNearest) {
+			if r.Affected {
+				rel, _ := filepath.Rel(tempDir, r.Path)
+				affected = append(affected, filepath.ToSlash(rel))
+			}
+		}
+		if !slices.Equal(affected, tt.expected) {
+			t.Errorf("changed %v: expected %v, got %v", tt.changed, tt.expected, affected)
+		}
+	}
+}
+
+func TestWriteTerramateChanged(t *testing.T) {
+	discovery := &Discovery{Roots: []Root{
+		{Path: toAbsPath("stacks/vpc"), Project: "vpc-prod"},
+		{Path: toAbsPath("stacks/vpc"), Project: "vpc-dev"},
+		{Path: toAbsPath("stacks/app")},
+		{Path: toAbsPath("plain")},
+	}}
+	results := []RootResult{{Affected: false}, {Affected: true}, {Affected: true}, {Affected: false}}
+
+	var buf bytes.Buffer
+	writeTerramateChanged(&buf, discovery, results, false)
+	if expected := "stacks/app\nstacks/vpc\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	writeTerramateChanged(&buf, discovery, nil, true)
+	if expected := "plain\nstacks/app\nstacks/vpc\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
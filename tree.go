@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// moduleNode is a module call in the call tree rebuilt from an Output.
+type moduleNode struct {
+	Name     string
+	Source   string
+	Version  string
+	Path     string
+	Remote   bool
+	Files    []string
+	Children []*moduleNode
+}
+
+// buildModuleTree arranges the modules of output under the module that
+// calls them. A module called from several places appears under each
+// caller; cycles are cut at the first repeated directory.
+func buildModuleTree(output *Output) *moduleNode {
+	root := &moduleNode{
+		Name:  "(root)",
+		Path:  output.RootModule.ResolvedPath,
+		Files: output.RootModule.Files,
+	}
+	addModuleChildren(root, output, map[string]bool{root.Path: true})
+	return root
+}
+
+func addModuleChildren(node *moduleNode, output *Output, ancestors map[string]bool) {
+	for _, m := range output.LocalModules {
+		if m.CallerPath != node.Path {
+			continue
+		}
+		child := &moduleNode{
+			Name:   m.Name,
+			Source: m.Source,
+			Path:   m.ResolvedPath,
+			Files:  m.Files,
+		}
+		if !ancestors[m.ResolvedPath] {
+			ancestors[m.ResolvedPath] = true
+			addModuleChildren(child, output, ancestors)
+			delete(ancestors, m.ResolvedPath)
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	for _, r := range output.RemoteModules {
+		if r.CallerPath != node.Path {
+			continue
+		}
+		node.Children = append(node.Children, &moduleNode{
+			Name:    r.Name,
+			Source:  r.Source,
+			Version: r.Version,
+			Remote:  true,
+		})
+	}
+
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		return node.Children[i].Name < node.Children[j].Name
+	})
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// useColor reports whether output to w should be colored: w must be a
+// terminal and NO_COLOR (https://no-color.org) must be unset.
+func useColor(w io.Writer) bool {
+	return isTerminal(w) && os.Getenv("NO_COLOR") == ""
+}
+
+// renderTree writes the module hierarchy as an indented tree: local modules
+// with their source and file count, remote modules with their source and
+// version, followed by any diagnostics. It is the default on a terminal.
+func renderTree(w io.Writer, output *Output, opts renderOptions) error {
+	var b strings.Builder
+	writeTree(&b, output, opts, useColor(w))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeTree(b *strings.Builder, output *Output, opts renderOptions, color bool) {
+	paint := func(style, s string) string {
+		if !color || s == "" {
+			return s
+		}
+		return style + s + ansiReset
+	}
+
+	impact := make(map[string]string)
+	for _, a := range opts.Affected {
+		impact[a.ResolvedPath] = a.Impact
+	}
+
+	var walk func(node *moduleNode, prefix string, last bool, depth int)
+	walk = func(node *moduleNode, prefix string, last bool, depth int) {
+		line := prefix
+		childPrefix := prefix
+		if depth > 0 {
+			if last {
+				line += "└── "
+				childPrefix += "    "
+			} else {
+				line += "├── "
+				childPrefix += "│   "
+			}
+		}
+
+		switch {
+		case depth == 0:
+			line += paint(ansiBold, node.Name) + " " + paint(ansiDim, node.Path)
+		case node.Remote:
+			line += paint(ansiYellow, node.Name) + " " + node.Source
+			if node.Version != "" {
+				line += " " + paint(ansiGreen, node.Version)
+			}
+		default:
+			line += paint(ansiCyan, node.Name) + " " + node.Source
+		}
+		if !node.Remote {
+			line += " " + paint(ansiDim, "("+pluralize(len(node.Files), "file")+")")
+		}
+		if opts.HasChanges && !node.Remote {
+			switch i, ok := impact[node.Path]; {
+			case ok && i == impactTransitive:
+				line += " " + paint(ansiYellow, "(affected via a module it calls)")
+			case ok:
+				line += " " + paint(ansiRed, "(affected)")
+			}
+		}
+		b.WriteString(line + "\n")
+
+		for i, child := range node.Children {
+			walk(child, childPrefix, i == len(node.Children)-1, depth+1)
+		}
+	}
+	walk(buildModuleTree(output), "", true, 0)
+
+	if len(output.Diagnostics) > 0 {
+		b.WriteString("\n")
+	}
+	for _, d := range output.Diagnostics {
+		style := ansiYellow
+		if d.Severity == severityError {
+			style = ansiRed
+		}
+		fmt.Fprintf(b, "%s: %s", paint(style, d.Severity), d.Message)
+		if d.Filename != "" {
+			fmt.Fprintf(b, " %s", paint(ansiDim, fmt.Sprintf("(%s:%d)", d.Filename, d.Line)))
+		}
+		b.WriteString("\n")
+	}
+}
+
+// pluralize formats a count with a noun in singular or plural.
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
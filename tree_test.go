@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteTree(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "app" {
+  source = "../modules/app"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+		"modules/app/main.tf": `
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "5.1.2"
+}
+`,
+		"modules/app/variables.tf": `variable "name" {}`,
+	})
+	rootDir := filepath.Join(tempDir, "root")
+	output, err := Analyze(rootDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	var b strings.Builder
+	writeTree(&b, output, renderOptions{
+		Affected:   []AffectedModule{{Kind: kindLocal, Name: "app", ResolvedPath: filepath.Join(tempDir, "modules", "app")}},
+		HasChanges: true,
+	}, false)
+	expected := "(root) " + output.RootModule.ResolvedPath + " (1 file)\n" +
+		"├── app ../modules/app (2 files) (affected)\n" +
+		"│   └── vpc terraform-aws-modules/vpc/aws 5.1.2\n" +
+		"└── label cloudposse/label/null 0.25.0\n"
+	if b.String() != expected {
+		t.Errorf("unexpected tree\nexpected:\n%s\ngot:\n%s", expected, b.String())
+	}
+
+	b.Reset()
+	writeTree(&b, output, renderOptions{}, true)
+	if !strings.Contains(b.String(), ansiYellow+"label"+ansiReset) || !strings.Contains(b.String(), ansiGreen+"0.25.0"+ansiReset) {
+		t.Errorf("expected colored remote modules, got %q", b.String())
+	}
+}
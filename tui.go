@@ -0,0 +1,400 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ANSI escape sequences used by the TUI and the tree format.
+const (
+	ansiReset      = "\x1b[0m"
+	ansiBold       = "\x1b[1m"
+	ansiDim        = "\x1b[2m"
+	ansiReverse    = "\x1b[7m"
+	ansiRed        = "\x1b[31m"
+	ansiGreen      = "\x1b[32m"
+	ansiYellow     = "\x1b[33m"
+	ansiMagenta    = "\x1b[35m"
+	ansiCyan       = "\x1b[36m"
+	ansiClear      = "\x1b[H\x1b[2J"
+	ansiAltScreen  = "\x1b[?1049h\x1b[?25l"
+	ansiMainScreen = "\x1b[?25h\x1b[?1049l"
+)
+
+// tuiDetailLines is the height of the details pane below the tree.
+const tuiDetailLines = 8
+
+// tuiRow is a visible line of the module tree.
+type tuiRow struct {
+	node  *moduleNode
+	depth int
+}
+
+// tuiModel is the state of the interactive module browser. It is kept free
+// of terminal I/O so that key handling and rendering can be tested.
+type tuiModel struct {
+	root      *moduleNode
+	expanded  map[*moduleNode]bool
+	rows      []tuiRow
+	cursor    int
+	offset    int
+	filter    string
+	filtering bool
+	width     int
+	height    int
+	quit      bool
+}
+
+func newTUIModel(output *Output) *tuiModel {
+	root := buildModuleTree(output)
+	m := &tuiModel{
+		root:     root,
+		expanded: map[*moduleNode]bool{root: true},
+		width:    80,
+		height:   24,
+	}
+	m.refresh()
+	return m
+}
+
+// refresh rebuilds the visible rows, keeping the cursor on the same node
+// when it is still visible.
+func (m *tuiModel) refresh() {
+	var selected *moduleNode
+	if m.cursor < len(m.rows) {
+		selected = m.rows[m.cursor].node
+	}
+
+	m.rows = m.rows[:0]
+	m.addRows(m.root, 0)
+
+	m.cursor = 0
+	for i, row := range m.rows {
+		if row.node == selected {
+			m.cursor = i
+		}
+	}
+}
+
+// addRows appends node and its visible descendants. While a filter is set,
+// only the root, matching nodes and their ancestors are shown, fully
+// expanded.
+func (m *tuiModel) addRows(node *moduleNode, depth int) {
+	if depth > 0 && m.filter != "" && !m.matchesFilter(node) {
+		return
+	}
+	m.rows = append(m.rows, tuiRow{node: node, depth: depth})
+	if m.filter == "" && !m.expanded[node] {
+		return
+	}
+	for _, child := range node.Children {
+		m.addRows(child, depth+1)
+	}
+}
+
+func (m *tuiModel) matchesFilter(node *moduleNode) bool {
+	filter := strings.ToLower(m.filter)
+	for _, s := range []string{node.Name, node.Source, node.Path} {
+		if strings.Contains(strings.ToLower(s), filter) {
+			return true
+		}
+	}
+	for _, child := range node.Children {
+		if m.matchesFilter(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleKey applies a key as returned by parseKeys.
+func (m *tuiModel) handleKey(key string) {
+	if m.filtering {
+		switch key {
+		case "enter":
+			m.filtering = false
+		case "esc":
+			m.filtering = false
+			m.filter = ""
+		case "backspace":
+			if m.filter != "" {
+				_, size := utf8.DecodeLastRuneInString(m.filter)
+				m.filter = m.filter[:len(m.filter)-size]
+			}
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				m.filter += key
+			}
+		}
+		m.refresh()
+		return
+	}
+
+	node := m.rows[m.cursor].node
+	switch key {
+	case "q", "ctrl+c":
+		m.quit = true
+	case "up", "k":
+		m.cursor--
+	case "down", "j":
+		m.cursor++
+	case "pgup":
+		m.cursor -= m.treeHeight()
+	case "pgdown":
+		m.cursor += m.treeHeight()
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.rows) - 1
+	case "right", "l":
+		m.expanded[node] = true
+	case "left", "h":
+		if m.expanded[node] && len(node.Children) > 0 {
+			m.expanded[node] = false
+		} else {
+			m.cursor = m.parentRow(m.cursor)
+		}
+	case "enter", " ":
+		m.expanded[node] = !m.expanded[node]
+	case "/":
+		m.filtering = true
+	case "esc":
+		m.filter = ""
+	}
+	m.cursor = max(0, min(m.cursor, len(m.rows)-1))
+	m.refresh()
+}
+
+// parentRow returns the row of the parent of row i.
+func (m *tuiModel) parentRow(i int) int {
+	for j := i - 1; j >= 0; j-- {
+		if m.rows[j].depth < m.rows[i].depth {
+			return j
+		}
+	}
+	return i
+}
+
+func (m *tuiModel) treeHeight() int {
+	// Header, separator and status lines surround the tree and details.
+	return max(1, m.height-tuiDetailLines-3)
+}
+
+// view renders the whole screen, using CRLF line endings for raw mode.
+func (m *tuiModel) view() string {
+	var lines []string
+	header := "Terraform modules: " + m.root.Path
+	lines = append(lines, ansiBold+truncate(header, m.width)+ansiReset)
+
+	height := m.treeHeight()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+height {
+		m.offset = m.cursor - height + 1
+	}
+	for i := m.offset; i < m.offset+height; i++ {
+		if i >= len(m.rows) {
+			lines = append(lines, "")
+			continue
+		}
+		lines = append(lines, m.renderRow(i))
+	}
+
+	lines = append(lines, ansiDim+strings.Repeat("─", m.width)+ansiReset)
+	details := m.details()
+	for i := 0; i < tuiDetailLines; i++ {
+		switch {
+		case i == 0:
+			lines = append(lines, ansiBold+truncate(details[i], m.width)+ansiReset)
+		case i < len(details):
+			lines = append(lines, truncate(details[i], m.width))
+		default:
+			lines = append(lines, "")
+		}
+	}
+
+	status := "↑/↓ move  →/← expand/collapse  / filter  q quit"
+	if m.filtering {
+		status = "Filter: " + m.filter + "█"
+	} else if m.filter != "" {
+		status = fmt.Sprintf("Filter: %s (esc to clear)  %s", m.filter, status)
+	}
+	lines = append(lines, ansiDim+truncate(status, m.width)+ansiReset)
+	return strings.Join(lines, "\r\n")
+}
+
+func (m *tuiModel) renderRow(i int) string {
+	row := m.rows[i]
+	marker := "  "
+	if len(row.node.Children) > 0 {
+		marker = "▸ "
+		if m.expanded[row.node] || m.filter != "" {
+			marker = "▾ "
+		}
+	}
+
+	label := row.node.Name
+	if row.node.Source != "" {
+		label += "  " + row.node.Source
+	}
+	line := truncate(strings.Repeat("  ", row.depth)+marker+label, m.width)
+
+	switch {
+	case i == m.cursor:
+		return ansiReverse + line + ansiReset
+	case row.node.Remote:
+		return ansiMagenta + line + ansiReset
+	}
+	return line
+}
+
+// details describes the node under the cursor, starting with its name.
+func (m *tuiModel) details() []string {
+	node := m.rows[m.cursor].node
+	lines := []string{node.Name}
+	if node.Source != "" {
+		lines = append(lines, "Source:  "+node.Source)
+	}
+	if node.Remote {
+		version := node.Version
+		if version == "" {
+			version = "(none)"
+		}
+		lines = append(lines, "Version: "+version)
+		if url := remoteSourceURL(node.Source, node.Version); url != "" {
+			lines = append(lines, "URL:     "+url)
+		}
+		return lines
+	}
+
+	lines = append(lines, "Path:    "+node.Path)
+	lines = append(lines, fmt.Sprintf("Files (%d):", len(node.Files)))
+	room := tuiDetailLines - len(lines)
+	for i, f := range node.Files {
+		if i == room-1 && len(node.Files) > room {
+			lines = append(lines, fmt.Sprintf("  … %d more", len(node.Files)-i))
+			break
+		}
+		lines = append(lines, "  "+f)
+	}
+	return lines
+}
+
+// truncate shortens s to at most width runes.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	if width <= 1 {
+		return string(runes[:max(width, 0)])
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// parseKeys splits raw terminal input into key names such as "up",
+// "enter" or single characters.
+func parseKeys(input []byte) []string {
+	sequences := map[string]string{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+		"\x1bOA": "up", "\x1bOB": "down", "\x1bOC": "right", "\x1bOD": "left",
+		"\x1b[5~": "pgup", "\x1b[6~": "pgdown",
+		"\x1b[H": "home", "\x1b[F": "end", "\x1b[1~": "home", "\x1b[4~": "end",
+	}
+
+	var keys []string
+	s := string(input)
+	for len(s) > 0 {
+		if s[0] == 0x1b {
+			matched := false
+			for seq, key := range sequences {
+				if strings.HasPrefix(s, seq) {
+					keys = append(keys, key)
+					s = s[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				keys = append(keys, "esc")
+				s = s[1:]
+			}
+			continue
+		}
+
+		switch s[0] {
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case 0x7f, 0x08:
+			keys = append(keys, "backspace")
+		case 0x03:
+			keys = append(keys, "ctrl+c")
+		default:
+			r, size := utf8.DecodeRuneInString(s)
+			keys = append(keys, string(r))
+			s = s[size:]
+			continue
+		}
+		s = s[1:]
+	}
+	return keys
+}
+
+func runTUI(args []string) int {
+	flags := newFlagSet("tui")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s tui <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Browse the module tree interactively.\n")
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	inFd, outFd := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(inFd) || !term.IsTerminal(outFd) {
+		fmt.Fprintf(os.Stderr, "Error: tui requires an interactive terminal\n")
+		return exitError
+	}
+
+	output, err := Analyze(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	state, err := term.MakeRaw(inFd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	defer term.Restore(inFd, state)
+	os.Stdout.WriteString(ansiAltScreen)
+	defer os.Stdout.WriteString(ansiMainScreen)
+
+	m := newTUIModel(output)
+	buf := make([]byte, 256)
+	for !m.quit {
+		if width, height, err := term.GetSize(outFd); err == nil {
+			m.width, m.height = width, height
+		}
+		os.Stdout.WriteString(ansiClear + m.view())
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			break
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			m.handleKey(key)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("j\x1b[B\x1b[A\r/vpc\x7f\x1b\x1bOCq"))
+	expected := []string{"j", "down", "up", "enter", "/", "v", "p", "c", "backspace", "esc", "right", "q"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
+
+func TestTUIModel(t *testing.T) {
+	output := &Output{
+		RootModule: ModuleDetail{ResolvedPath: "/repo/prod", Files: []string{"/repo/prod/main.tf"}},
+		LocalModules: []ModuleDetail{
+			{Name: "vpc", Source: "../modules/vpc", ResolvedPath: "/repo/modules/vpc", Files: []string{"/repo/modules/vpc/main.tf"}, CallerPath: "/repo/prod"},
+			{Name: "subnets", Source: "./subnets", ResolvedPath: "/repo/modules/vpc/subnets", Files: []string{"/repo/modules/vpc/subnets/main.tf"}, CallerPath: "/repo/modules/vpc"},
+		},
+		RemoteModules: []RemoteModule{
+			{Name: "label", Source: "cloudposse/label/null", Version: "0.25.0", CallerPath: "/repo/prod"},
+		},
+	}
+
+	m := newTUIModel(output)
+	names := func() []string {
+		var names []string
+		for _, row := range m.rows {
+			names = append(names, row.node.Name)
+		}
+		return names
+	}
+
+	if got := names(); !reflect.DeepEqual(got, []string{"(root)", "label", "vpc"}) {
+		t.Fatalf("expected root expanded with its direct calls, got %v", got)
+	}
+
+	m.handleKey("end")
+	m.handleKey("right")
+	if got := names(); !reflect.DeepEqual(got, []string{"(root)", "label", "vpc", "subnets"}) {
+		t.Errorf("expected vpc expanded, got %v", got)
+	}
+	m.handleKey("down")
+	m.handleKey("down")
+	if m.rows[m.cursor].node.Name != "subnets" {
+		t.Errorf("expected cursor to stop at the last row, got %s", m.rows[m.cursor].node.Name)
+	}
+	m.handleKey("left")
+	if m.rows[m.cursor].node.Name != "vpc" {
+		t.Errorf("expected left on a leaf to move to its parent, got %s", m.rows[m.cursor].node.Name)
+	}
+	m.handleKey("left")
+	if got := names(); len(got) != 3 {
+		t.Errorf("expected vpc collapsed, got %v", got)
+	}
+
+	for _, key := range []string{"/", "s", "u", "b", "enter"} {
+		m.handleKey(key)
+	}
+	if got := names(); !reflect.DeepEqual(got, []string{"(root)", "vpc", "subnets"}) {
+		t.Errorf("expected filter to show matches with their ancestors, got %v", got)
+	}
+	m.handleKey("esc")
+	if m.filter != "" {
+		t.Errorf("expected esc to clear the filter, got %q", m.filter)
+	}
+
+	m.handleKey("home")
+	m.handleKey("down")
+	view := m.view()
+	for _, want := range []string{"Terraform modules: /repo/prod", "Source:  cloudposse/label/null", "Version: 0.25.0", "https://registry.terraform.io/modules/cloudposse/label/null/0.25.0"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("expected view to contain %q\n%s", want, view)
+		}
+	}
+	if lines := strings.Count(view, "\r\n") + 1; lines != m.height {
+		t.Errorf("expected %d lines, got %d", m.height, lines)
+	}
+
+	m.handleKey("q")
+	if !m.quit {
+		t.Error("expected q to quit")
+	}
+}
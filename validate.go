@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	exitValid   = 0
+	exitInvalid = 1
+)
+
+func runValidate(args []string) int {
+	flags := newFlagSet("validate")
+	format := flags.String("format", "text", "output format: text or sarif")
+	failOnUnpinned := flags.Bool("fail-on-unpinned", false, "also fail on registry modules without a version and git sources without a ref")
+	checkVersions := flags.Bool("check-versions", false, "check that a registry or configured mirror provides a version of each registry module matching its constraint, and report deprecated versions and namespaces")
+	failOnDeprecated := flags.Bool("fail-on-deprecated", false, "with --check-versions, also fail on deprecated module versions and namespaces")
+	configPath := flags.String("config", "", "configuration file with module_installation mirrors (default "+defaultConfigFile+" in the working directory, if present)")
+	timeout := flags.Duration("timeout", 5*time.Minute, "abort --check-versions after this duration (0 means no limit)")
+	addNetworkFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s validate [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Report broken local module sources, malformed registry addresses and unpinned remote modules.\n")
+		fmt.Fprintf(flags.Output(), "Exit codes: 0=valid, 1=problems found, 2=error\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "sarif" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+
+	output, err := Analyze(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	problems := Validate(output)
+	var deprecated []Diagnostic
+	if *checkVersions {
+		config, err := loadConfigFlag(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		ctx, cancel := analysisContext(*timeout)
+		checked, err := CheckRegistryVersions(ctx, output, config.ModuleInstallation, nil)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		problems = append(problems, filterDiagnostics(checked, codeUnresolved)...)
+		deprecated = filterDiagnostics(checked, codeDeprecated)
+	}
+	unpinned := filterDiagnostics(output.Diagnostics, codeUnpinned)
+	if *format == "sarif" {
+		if err := writeSARIF(os.Stdout, slices.Concat(problems, unpinned, deprecated)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	} else {
+		writeDiagnostics(os.Stdout, problems)
+		writeDiagnostics(os.Stdout, unpinned)
+		writeDiagnostics(os.Stdout, deprecated)
+	}
+	if len(problems) > 0 || (*failOnUnpinned && len(unpinned) > 0) || (*failOnDeprecated && len(deprecated) > 0) {
+		return exitInvalid
+	}
+	return exitValid
+}
+
+// Validate returns the error diagnostics recorded while analyzing output.
+func Validate(output *Output) []Diagnostic {
+	var problems []Diagnostic
+	for _, d := range output.Diagnostics {
+		if d.Severity == severityError {
+			problems = append(problems, d)
+		}
+	}
+	return problems
+}
+
+// CheckRegistryVersions resolves the version constraint of every registry
+// module call in output through the sources selected by installation, and
+// returns an error diagnostic for each call no source can satisfy and a
+// warning for each call whose selected version, or the namespace of its
+// module, the source marks deprecated. Other errors, such as an
+// unreachable registry, abort the check.
+func CheckRegistryVersions(ctx context.Context, output *Output, installation ModuleInstallation, client *http.Client) ([]Diagnostic, error) {
+	fetcher := newModuleFetcher(client, installation)
+	var diags []Diagnostic
+	for _, remote := range output.RemoteModules {
+		if !isRegistrySource(remote.Source) || validateRegistrySource(remote.Source) != nil {
+			continue
+		}
+		report := func(severity, code, message string) {
+			d := Diagnostic{
+				Severity: severity,
+				Code:     code,
+				Message:  message,
+				Module:   remote.Name,
+				Source:   remote.Source,
+			}
+			if block, err := findModuleBlock(remote.CallerPath, remote.Name); err == nil {
+				d.Filename = block.DefRange.Filename
+				d.Line = block.DefRange.Start.Line
+			}
+			diags = append(diags, d)
+		}
+
+		pkg, _ := splitSourceSubdir(remote.Source)
+		_, version, module, err := fetcher.resolveRegistry(ctx, pkg, remote.Version)
+		if err != nil {
+			if ctx.Err() != nil || !errors.Is(err, errUnresolved) {
+				return nil, err
+			}
+			report(severityError, codeUnresolved, err.Error())
+			continue
+		}
+		if d := module.Deprecation; d != nil {
+			report(severityWarning, codeDeprecated, d.message("namespace "+remote.Registry.Namespace+" is deprecated"))
+		}
+		if d := module.versionDeprecation(version); d != nil {
+			report(severityWarning, codeDeprecated, d.message("version "+version+" is deprecated"))
+		}
+	}
+	return diags, nil
+}
+
+// filterDiagnostics returns the diagnostics with the given code.
+func filterDiagnostics(diags []Diagnostic, code string) []Diagnostic {
+	var matched []Diagnostic
+	for _, d := range diags {
+		if d.Code == code {
+			matched = append(matched, d)
+		}
+	}
+	return matched
+}
+
+func writeDiagnostics(w io.Writer, diags []Diagnostic) {
+	for _, d := range diags {
+		location := d.Filename
+		if d.Line > 0 {
+			location = fmt.Sprintf("%s:%d", d.Filename, d.Line)
+		}
+		fmt.Fprintf(w, "%s: %s: module %q: %s\n", location, d.Severity, d.Module, d.Message)
+	}
+}
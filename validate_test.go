@@ -0,0 +1,140 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tempDir := t.TempDir()
+	rootDir := filepath.Join(tempDir, "root")
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf": `
+module "vpc" {
+  source = "../modules/vpc"
+}
+
+module "missing" {
+  source = "../modules/missing"
+}
+
+module "empty" {
+  source = "../modules/empty"
+}
+
+module "eks" {
+  source  = "terraform-aws-modules/eks/aws"
+  version = "~> 19.0"
+}
+
+module "typo" {
+  source = "modules/vpc"
+}
+
+module "dynamic" {
+  source = var.vpc_source
+}
+`,
+		"modules/vpc/main.tf":     "",
+		"modules/empty/README.md": "",
+	})
+
+	output, err := Analyze(rootDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	problems := Validate(output)
+	codes := make(map[string]string)
+	for _, p := range problems {
+		codes[p.Module] = p.Code
+		if p.Filename != filepath.Join(rootDir, "main.tf") || p.Line == 0 {
+			t.Errorf("expected call site for %s, got %s:%d", p.Module, p.Filename, p.Line)
+		}
+	}
+
+	expected := map[string]string{
+		"missing": codeMissingModule,
+		"empty":   codeEmptyModule,
+		"typo":    codeInvalidSource,
+		"dynamic": codeUnresolvable,
+	}
+	if len(problems) != len(expected) {
+		t.Errorf("expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+	for module, code := range expected {
+		if codes[module] != code {
+			t.Errorf("expected %s for module %s, got %q", code, module, codes[module])
+		}
+	}
+}
+
+func TestValidate_Clean(t *testing.T) {
+	tempDir := t.TempDir()
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source = "./modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": "",
+	})
+
+	output, err := Analyze(tempDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	if problems := Validate(output); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
+
+func TestAnalyze_UnpinnedModules(t *testing.T) {
+	tempDir := t.TempDir()
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "pinned" {
+  source  = "terraform-aws-modules/eks/aws"
+  version = "19.0.0"
+}
+
+module "no_version" {
+  source = "terraform-aws-modules/vpc/aws"
+}
+
+module "git_ref" {
+  source = "git::https://example.com/network.git//vpc?ref=v1.2.0"
+}
+
+module "git_no_ref" {
+  source = "github.com/org/network"
+}
+`,
+	})
+
+	output, err := Analyze(tempDir)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	unpinned := filterDiagnostics(output.Diagnostics, codeUnpinned)
+	modules := make(map[string]bool)
+	for _, d := range unpinned {
+		if d.Severity != severityWarning {
+			t.Errorf("expected warning severity for %s, got %s", d.Module, d.Severity)
+		}
+		modules[d.Module] = true
+	}
+
+	if len(unpinned) != 2 || !modules["no_version"] || !modules["git_no_ref"] {
+		t.Errorf("expected no_version and git_no_ref to be unpinned, got %v", unpinned)
+	}
+
+	if problems := Validate(output); len(problems) != 0 {
+		t.Errorf("unpinned modules should not be validation errors, got %v", problems)
+	}
+}
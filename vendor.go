@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// defaultVendorDir is where remote modules are vendored, relative to the
+// root module.
+const defaultVendorDir = "vendor/modules"
+
+// VendorOptions controls Vendor.
+type VendorOptions struct {
+	// Dir is the directory modules are downloaded to. Relative paths are
+	// resolved against the root module directory.
+	Dir string
+
+	// Rewrite edits the module blocks of the calls to point at their
+	// vendored copies instead of only planning the edits.
+	Rewrite bool
+
+	// Client is used for registry and archive downloads. Nil means
+	// http.DefaultClient, or a client trusting the --ca-bundle
+	// certificates.
+	Client *http.Client
+
+	// Installation selects the mirrors registry modules are fetched from.
+	Installation ModuleInstallation
+
+	// CacheDir, when set, keeps a bare repository for each git repository
+	// that sources are fetched from, shared by later runs.
+	CacheDir string
+
+	// GitCacheTTL is how long a branch or tag in CacheDir is reused before
+	// it is fetched again.
+	GitCacheTTL time.Duration
+
+	// Progress, when set, receives the modules analyzed and the packages
+	// being downloaded.
+	Progress *Progress
+}
+
+// VendorResult lists the downloaded module packages and the source
+// rewrites that make the module tree path-only.
+type VendorResult struct {
+	Modules  []VendoredModule `json:"modules"`
+	Rewrites []VendorRewrite  `json:"rewrites"`
+}
+
+// VendoredModule is a remote module package downloaded into the vendor
+// directory. Version is the registry version that was selected, License
+// the SPDX identifier of the package's license file, NOASSERTION when it
+// is not recognized or empty without a license file, and Checksum the
+// digest the downloaded archive was verified against, such as
+// sha256:<hex>, when the registry or source address provided one.
+type VendoredModule struct {
+	Source   string `json:"source"`
+	Version  string `json:"version,omitempty"`
+	Path     string `json:"path"`
+	License  string `json:"license,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// VendorRewrite replaces the source of a module call with the relative path
+// of its vendored copy. Rewriting also removes the call's version argument,
+// which Terraform rejects for local paths.
+type VendorRewrite struct {
+	File           string `json:"file"`
+	Module         string `json:"module"`
+	Source         string `json:"source"`
+	Version        string `json:"version,omitempty"`
+	VendoredSource string `json:"vendored_source"`
+}
+
+func runVendor(args []string) int {
+	flags := newFlagSet("vendor")
+	vendorDir := flags.String("dir", defaultVendorDir, "directory to download modules to, relative to the root module")
+	rewrite := flags.Bool("rewrite", false, "rewrite module sources to the vendored paths instead of only printing the rewrite plan")
+	format := flags.String("format", "text", "output format of the rewrite plan: text or json")
+	timeout := flags.Duration("timeout", 10*time.Minute, "abort after this duration (0 means no limit)")
+	configPath := flags.String("config", "", "configuration file with module_installation mirrors (default "+defaultConfigFile+" in the working directory, if present)")
+	progress := flags.Bool("progress", false, "report the modules analyzed and packages downloaded on stderr")
+	cacheDir := flags.String("cache-dir", "", "directory keeping the repositories of git sources between runs")
+	gitCacheTTL := flags.Duration("git-cache-ttl", defaultGitCacheTTL, "with --cache-dir, fetch cached branches and tags again after this duration")
+	addNetworkFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s vendor [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Download the remote modules called by a root module, directly or transitively,\n")
+		fmt.Fprintf(flags.Output(), "and plan or apply rewriting their sources to local paths.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	ctx, cancel := analysisContext(*timeout)
+	defer cancel()
+	opts := VendorOptions{
+		Dir:          *vendorDir,
+		Rewrite:      *rewrite,
+		Installation: config.ModuleInstallation,
+		CacheDir:     *cacheDir,
+		GitCacheTTL:  *gitCacheTTL,
+	}
+	if *progress {
+		opts.Progress = NewProgress(os.Stderr)
+	}
+	result, err := Vendor(ctx, flags.Arg(0), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	opts.Progress.Done("vendored %d packages", len(result.Modules))
+
+	if *format == "json" {
+		jsonOutput, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(jsonOutput))
+		return 0
+	}
+	writeVendorResult(os.Stdout, result)
+	return 0
+}
+
+// Vendor downloads every remote module reachable from the root module at
+// dir into opts.Dir, following remote calls made by the downloaded modules
+// too, and returns the source rewrites that point each call at its copy.
+// Each package is downloaded once per source and version constraint;
+// existing copies are replaced.
+func Vendor(ctx context.Context, dir string, opts VendorOptions) (*VendorResult, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	vendorDir := opts.Dir
+	if vendorDir == "" {
+		vendorDir = defaultVendorDir
+	}
+	if !filepath.IsAbs(vendorDir) {
+		vendorDir = filepath.Join(absDir, vendorDir)
+	}
+	if err := os.MkdirAll(vendorDir, 0755); err != nil {
+		return nil, err
+	}
+
+	fetcher := newModuleFetcher(opts.Client, opts.Installation)
+	if opts.CacheDir != "" {
+		fetcher.gitCache = &gitCache{dir: opts.CacheDir, ttl: opts.GitCacheTTL}
+	}
+	result := &VendorResult{Modules: []VendoredModule{}, Rewrites: []VendorRewrite{}}
+	packages := make(map[string]string) // source and constraint -> package dir
+	analyzed := map[string]bool{absDir: true}
+	queue := []string{absDir}
+
+	for len(queue) > 0 {
+		moduleDir := queue[0]
+		queue = queue[1:]
+
+		output, err := AnalyzeContext(ctx, moduleDir, AnalyzeOptions{Progress: opts.Progress})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, remote := range output.RemoteModules {
+			pkg, subdir := splitSourceSubdir(remote.Source)
+			key := pkg + "\x00" + remote.Version
+			pkgDir, ok := packages[key]
+			if !ok {
+				opts.Progress.Update("downloading package %d: %s", len(packages)+1, pkg)
+				pkgDir, err = vendorPackage(ctx, fetcher, pkg, remote.Version, vendorDir, result)
+				if err != nil {
+					return nil, fmt.Errorf("module %q (%s): %w", remote.Name, remote.Source, err)
+				}
+				packages[key] = pkgDir
+			}
+
+			target := pkgDir
+			if subdir != "" {
+				if target, err = resolveSubdir(pkgDir, subdir); err != nil {
+					return nil, fmt.Errorf("module %q (%s): %w", remote.Name, remote.Source, err)
+				}
+			}
+
+			rewrite, err := planVendorRewrite(remote, target)
+			if err != nil {
+				return nil, err
+			}
+			result.Rewrites = append(result.Rewrites, rewrite)
+
+			if !analyzed[target] {
+				analyzed[target] = true
+				queue = append(queue, target)
+			}
+		}
+	}
+
+	if opts.Rewrite {
+		if err := applyVendorRewrites(result.Rewrites); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// vendorPackage downloads pkg into a directory of vendorDir named after
+// the package and selected version, and records it in result.
+func vendorPackage(ctx context.Context, fetcher *moduleFetcher, pkg, constraint, vendorDir string, result *VendorResult) (string, error) {
+	staging, err := os.MkdirTemp(vendorDir, ".download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(staging)
+
+	download := filepath.Join(staging, "module")
+	version, checksum, err := fetcher.fetch(ctx, pkg, constraint, download)
+	if err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(vendorDir, vendorName(pkg, version))
+	for _, m := range result.Modules {
+		if m.Path == dest {
+			// Another constraint selected the same version.
+			return dest, nil
+		}
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return "", err
+	}
+	if err := os.Rename(download, dest); err != nil {
+		return "", err
+	}
+	license := detectLicense(localFS{}, dest)
+	if license != "" {
+		fmt.Fprintf(os.Stderr, "Vendored %s to %s (license %s)\n", pkg, dest, license)
+	} else {
+		fmt.Fprintf(os.Stderr, "Vendored %s to %s (no license file)\n", pkg, dest)
+	}
+	if checksum != "" {
+		fmt.Fprintf(os.Stderr, "Verified %s against %s\n", pkg, checksum)
+	}
+	result.Modules = append(result.Modules, VendoredModule{Source: pkg, Version: version, Path: dest, License: license, Checksum: checksum})
+	return dest, nil
+}
+
+var vendorNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// vendorName returns a directory name for a package address and version,
+// such as terraform-aws-modules-vpc-aws-5.1.2.
+func vendorName(pkg, version string) string {
+	name := pkg
+	if i := strings.Index(name, "::"); i >= 0 && forcedGetterPattern.MatchString(name) {
+		name = name[i+2:]
+	}
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	name = strings.TrimPrefix(name, "git@")
+	name = strings.TrimPrefix(name, defaultRegistryHost+"/")
+	if version != "" {
+		name += "-" + version
+	}
+	return strings.Trim(vendorNameUnsafe.ReplaceAllString(name, "-"), "-.")
+}
+
+// planVendorRewrite finds the module block of remote and builds the
+// rewrite of its source to target.
+func planVendorRewrite(remote RemoteModule, target string) (VendorRewrite, error) {
+	block, err := findModuleBlock(remote.CallerPath, remote.Name)
+	if err != nil {
+		return VendorRewrite{}, err
+	}
+
+	source, err := filepath.Rel(remote.CallerPath, target)
+	if err != nil {
+		return VendorRewrite{}, err
+	}
+	source = filepath.ToSlash(source)
+	if !strings.HasPrefix(source, "../") {
+		source = "./" + source
+	}
+	return VendorRewrite{
+		File:           block.DefRange.Filename,
+		Module:         remote.Name,
+		Source:         remote.Source,
+		Version:        remote.Version,
+		VendoredSource: source,
+	}, nil
+}
+
+// applyVendorRewrites edits the module blocks named by rewrites.
+func applyVendorRewrites(rewrites []VendorRewrite) error {
+	byFile := make(map[string][]VendorRewrite)
+	var files []string
+	for _, r := range rewrites {
+		if _, ok := byFile[r.File]; !ok {
+			files = append(files, r.File)
+		}
+		byFile[r.File] = append(byFile[r.File], r)
+	}
+	sort.Strings(files)
+
+	for _, path := range files {
+		err := editModuleBlocks(path, func(name string, body *hclwrite.Body) {
+			for _, r := range byFile[path] {
+				if r.Module == name {
+					body.SetAttributeValue("source", cty.StringVal(r.VendoredSource))
+					body.RemoveAttribute("version")
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// editModuleBlocks calls edit with the name and body of every module block
+// in the configuration file at path and writes the file back, keeping the
+// rest of its formatting. JSON configuration files cannot be edited and are
+// reported as an error.
+func editModuleBlocks(path string, edit func(name string, body *hclwrite.Body)) error {
+	if strings.HasSuffix(path, ".tf.json") {
+		return fmt.Errorf("cannot rewrite module sources in JSON file %s", path)
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file, diags := hclwrite.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to parse %s: %s", path, diags.Error())
+	}
+	for _, block := range file.Body().Blocks() {
+		if block.Type() == "module" && len(block.Labels()) > 0 {
+			edit(block.Labels()[0], block.Body())
+		}
+	}
+	return os.WriteFile(path, file.Bytes(), 0644)
+}
+
+func writeVendorResult(w io.Writer, result *VendorResult) {
+	for _, r := range result.Rewrites {
+		fmt.Fprintf(w, "%s\tmodule.%s\t%s => %s\n", r.File, r.Module, r.Source, r.VendoredSource)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVendor(t *testing.T) {
+	repo := t.TempDir()
+	initGitRepo(t, repo, map[string]string{
+		"main.tf": `
+module "inner" {
+  source = "./modules/inner"
+}
+`,
+		"modules/inner/main.tf":     `variable "name" {}`,
+		"modules/submodule/main.tf": `output "id" { value = "x" }`,
+	}, "v1.0.0")
+	source := "git::file://" + repo + "?ref=v1.0.0"
+	subSource := "git::file://" + repo + "//modules/submodule?ref=v1.0.0"
+
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"main.tf": `
+module "label" {
+  source = "` + source + `"
+}
+
+module "app" {
+  source = "./modules/app"
+}
+`,
+		"modules/app/main.tf": `
+module "sub" {
+  source = "` + subSource + `"
+}
+`,
+	})
+
+	result, err := Vendor(context.Background(), root, VendorOptions{})
+	if err != nil {
+		t.Fatalf("Vendor failed: %v", err)
+	}
+	if len(result.Modules) != 1 {
+		t.Fatalf("expected the shared package to be downloaded once, got %+v", result.Modules)
+	}
+	pkgDir := result.Modules[0].Path
+	if filepath.Dir(pkgDir) != filepath.Join(root, "vendor", "modules") {
+		t.Errorf("expected the package under vendor/modules, got %s", pkgDir)
+	}
+	if _, err := os.Stat(filepath.Join(pkgDir, "modules", "inner", "main.tf")); err != nil {
+		t.Errorf("expected the package contents to be vendored: %v", err)
+	}
+
+	if len(result.Rewrites) != 2 {
+		t.Fatalf("expected 2 rewrites, got %+v", result.Rewrites)
+	}
+	name := filepath.Base(pkgDir)
+	if r := result.Rewrites[0]; r.Module != "label" || r.File != filepath.Join(root, "main.tf") || r.VendoredSource != "./vendor/modules/"+name {
+		t.Errorf("unexpected root rewrite %+v", r)
+	}
+	if r := result.Rewrites[1]; r.Module != "sub" || r.VendoredSource != "../../vendor/modules/"+name+"/modules/submodule" {
+		t.Errorf("unexpected nested rewrite %+v", r)
+	}
+
+	// Planning must not touch the configuration.
+	data, _ := os.ReadFile(filepath.Join(root, "main.tf"))
+	if !strings.Contains(string(data), source) {
+		t.Errorf("expected main.tf to be unchanged without Rewrite, got:\n%s", data)
+	}
+
+	if _, err := Vendor(context.Background(), root, VendorOptions{Rewrite: true}); err != nil {
+		t.Fatalf("Vendor failed: %v", err)
+	}
+	output, err := Analyze(root)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(output.RemoteModules) != 0 {
+		t.Errorf("expected no remote modules after rewriting, got %+v", output.RemoteModules)
+	}
+	if len(output.LocalModules) != 4 {
+		t.Errorf("expected label, inner, app and sub as local modules, got %+v", output.LocalModules)
+	}
+}
+
+func TestVendorName(t *testing.T) {
+	tests := []struct {
+		pkg, version, want string
+	}{
+		{"terraform-aws-modules/vpc/aws", "5.1.2", "terraform-aws-modules-vpc-aws-5.1.2"},
+		{"app.terraform.io/org/vpc/aws", "1.0.0", "app.terraform.io-org-vpc-aws-1.0.0"},
+		{"git::https://github.com/org/repo.git?ref=v1.0.0", "", "github.com-org-repo.git-ref-v1.0.0"},
+		{"git@github.com:org/repo.git", "", "github.com-org-repo.git"},
+	}
+	for _, tt := range tests {
+		if got := vendorName(tt.pkg, tt.version); got != tt.want {
+			t.Errorf("vendorName(%q, %q) = %q, want %q", tt.pkg, tt.version, got, tt.want)
+		}
+	}
+}
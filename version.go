@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var versionPattern = regexp.MustCompile(`^v?([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// moduleVersion is a parsed module version such as 1.2.3 or 2.0.0-beta1.
+// Omitted segments are zero; segments records how many were written, which
+// matters for the ~> operator.
+type moduleVersion struct {
+	parts      [3]int
+	segments   int
+	prerelease string
+}
+
+func parseModuleVersion(s string) (moduleVersion, error) {
+	m := versionPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return moduleVersion{}, fmt.Errorf("invalid version %q", s)
+	}
+	var v moduleVersion
+	for i := 0; i < 3; i++ {
+		if m[i+1] == "" {
+			break
+		}
+		v.parts[i], _ = strconv.Atoi(m[i+1])
+		v.segments++
+	}
+	v.prerelease = m[4]
+	return v, nil
+}
+
+func (v moduleVersion) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.parts[0], v.parts[1], v.parts[2])
+	if v.prerelease != "" {
+		s += "-" + v.prerelease
+	}
+	return s
+}
+
+// compare returns -1, 0 or 1 as v is lower than, equal to or higher than o.
+// A prerelease is lower than its release.
+func (v moduleVersion) compare(o moduleVersion) int {
+	for i := range v.parts {
+		if v.parts[i] != o.parts[i] {
+			if v.parts[i] < o.parts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.prerelease == o.prerelease:
+		return 0
+	case v.prerelease == "":
+		return 1
+	case o.prerelease == "":
+		return -1
+	case v.prerelease < o.prerelease:
+		return -1
+	}
+	return 1
+}
+
+// versionConstraint is a comma-separated list of Terraform version
+// constraints, all of which must hold.
+type versionConstraint []versionCondition
+
+type versionCondition struct {
+	op      string
+	version moduleVersion
+}
+
+var constraintOperators = []string{">=", "<=", "!=", "~>", ">", "<", "="}
+
+func parseVersionConstraint(s string) (versionConstraint, error) {
+	var constraint versionConstraint
+	if strings.TrimSpace(s) == "" {
+		return constraint, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		op := "="
+		for _, candidate := range constraintOperators {
+			if strings.HasPrefix(part, candidate) {
+				op = candidate
+				part = part[len(candidate):]
+				break
+			}
+		}
+		v, err := parseModuleVersion(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %w", s, err)
+		}
+		constraint = append(constraint, versionCondition{op: op, version: v})
+	}
+	return constraint, nil
+}
+
+// allows reports whether v satisfies every condition. Prereleases are only
+// allowed when a condition names that exact version.
+func (c versionConstraint) allows(v moduleVersion) bool {
+	if v.prerelease != "" {
+		exact := false
+		for _, cond := range c {
+			exact = exact || (cond.op == "=" && cond.version.compare(v) == 0)
+		}
+		if !exact {
+			return false
+		}
+	}
+
+	for _, cond := range c {
+		cmp := v.compare(cond.version)
+		var ok bool
+		switch cond.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case "~>":
+			// All but the last written segment must match; a single
+			// segment fixes the major version.
+			fixed := max(cond.version.segments-1, 1)
+			ok = cmp >= 0
+			for i := 0; i < fixed; i++ {
+				ok = ok && v.parts[i] == cond.version.parts[i]
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// latestAllowedVersion returns the highest of versions allowed by
+// constraint, as written in versions.
+func latestAllowedVersion(versions []string, constraint string) (string, error) {
+	c, err := parseVersionConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+
+	best, bestVersion := "", moduleVersion{}
+	for _, s := range versions {
+		v, err := parseModuleVersion(s)
+		if err != nil || !c.allows(v) {
+			continue
+		}
+		if best == "" || v.compare(bestVersion) > 0 {
+			best, bestVersion = s, v
+		}
+	}
+	if best == "" {
+		if constraint == "" {
+			return "", fmt.Errorf("no versions available")
+		}
+		return "", fmt.Errorf("no version matches %q", constraint)
+	}
+	return best, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestLatestAllowedVersion(t *testing.T) {
+	versions := []string{"1.0.0", "1.2.0", "1.2.5", "1.3.0-beta1", "2.0.0", "v2.1.0"}
+
+	tests := []struct {
+		constraint string
+		want       string
+	}{
+		{"", "v2.1.0"},
+		{"1.2.0", "1.2.0"},
+		{"= 1.2.5", "1.2.5"},
+		{"~> 1.2", "1.2.5"},
+		{"~> 1.2.0", "1.2.5"},
+		{"~> 1", "1.2.5"},
+		{">= 1.0, < 2.0", "1.2.5"},
+		{"> 1.0, != 1.2.5, < 2", "1.2.0"},
+		{"<= 2.0.0", "2.0.0"},
+		{"1.3.0-beta1", "1.3.0-beta1"},
+	}
+	for _, tt := range tests {
+		got, err := latestAllowedVersion(versions, tt.constraint)
+		if err != nil {
+			t.Errorf("latestAllowedVersion(%q) failed: %v", tt.constraint, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("latestAllowedVersion(%q) = %q, want %q", tt.constraint, got, tt.want)
+		}
+	}
+
+	if _, err := latestAllowedVersion(versions, "~> 3.0"); err == nil {
+		t.Error("expected an error when no version matches")
+	}
+	if _, err := latestAllowedVersion(versions, ">= banana"); err == nil {
+		t.Error("expected an error for an invalid constraint")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ModuleVersions lists the version constraints or git refs that the call
+// sites of a remote module select across the analyzed roots. Modules are
+// identified as in the fanout report, by registry address or package URL
+// with any subdirectory.
+type ModuleVersions struct {
+	Module   string       `json:"module"`
+	Versions []VersionUse `json:"versions"`
+}
+
+// VersionUse is a version constraint, or a git ref for non-registry
+// sources, and the call sites selecting it. Version is empty for unpinned
+// calls.
+type VersionUse struct {
+	Version string          `json:"version"`
+	Calls   []VersionCaller `json:"calls"`
+}
+
+// VersionCaller is a module block, identified by its calling directory
+// relative to the working directory and its call name.
+type VersionCaller struct {
+	Caller string `json:"caller"`
+	Name   string `json:"name"`
+}
+
+// remoteModuleVersion returns the version constraint of a registry call or
+// the ref of any other remote call.
+func remoteModuleVersion(m RemoteModule) string {
+	if m.Registry != nil {
+		return m.Version
+	}
+	return m.Ref
+}
+
+// FindVersionConflicts returns the remote modules whose call sites select
+// more than one version constraint or ref, sorted by module, with their
+// versions sorted and the calls of each version sorted by caller and name.
+// A call site shared by several roots, such as a call inside a shared local
+// module, is listed once.
+func FindVersionConflicts(discovery *Discovery) []ModuleVersions {
+	versions := make(map[string]map[string]map[VersionCaller]bool)
+	for _, root := range discovery.Roots {
+		for _, m := range root.Analysis.RemoteModules {
+			key, version := remoteModuleKey(m), remoteModuleVersion(m)
+			if versions[key] == nil {
+				versions[key] = make(map[string]map[VersionCaller]bool)
+			}
+			if versions[key][version] == nil {
+				versions[key][version] = make(map[VersionCaller]bool)
+			}
+			versions[key][version][VersionCaller{Caller: workingDirRel(m.CallerPath), Name: m.Name}] = true
+		}
+	}
+
+	conflicts := []ModuleVersions{}
+	for key, uses := range versions {
+		if len(uses) < 2 {
+			continue
+		}
+		mv := ModuleVersions{Module: key}
+		for version, callers := range uses {
+			use := VersionUse{Version: version}
+			for c := range callers {
+				use.Calls = append(use.Calls, c)
+			}
+			sort.Slice(use.Calls, func(i, j int) bool {
+				if use.Calls[i].Caller != use.Calls[j].Caller {
+					return use.Calls[i].Caller < use.Calls[j].Caller
+				}
+				return use.Calls[i].Name < use.Calls[j].Name
+			})
+			mv.Versions = append(mv.Versions, use)
+		}
+		sort.Slice(mv.Versions, func(i, j int) bool { return mv.Versions[i].Version < mv.Versions[j].Version })
+		conflicts = append(conflicts, mv)
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Module < conflicts[j].Module })
+	return conflicts
+}
+
+func writeVersionConflicts(w io.Writer, conflicts []ModuleVersions) {
+	for _, mv := range conflicts {
+		fmt.Fprintf(w, "%s\n", mv.Module)
+		for _, use := range mv.Versions {
+			version := use.Version
+			if version == "" {
+				version = "(unpinned)"
+			}
+			var calls []string
+			for _, c := range use.Calls {
+				calls = append(calls, fmt.Sprintf("%s (%s)", c.Caller, c.Name))
+			}
+			fmt.Fprintf(w, "  %s\t%s\n", version, strings.Join(calls, ", "))
+		}
+	}
+}
+
+func runVersions(args []string) (code int) {
+	flags := newFlagSet("versions")
+	format := flags.String("format", "text", "output format: text or json")
+	failOnConflict := flags.Bool("fail-on-conflict", false, "exit 1 when a remote module is called with more than one version or ref")
+	configPath := flags.String("config", "", "configuration file (default "+defaultConfigFile+" in the working directory, if present)")
+	outputPath := flags.String("output", "", "write the report to this file, atomically replacing it, instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s versions [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Report the remote modules that the roots under a directory call with\n")
+		fmt.Fprintf(flags.Output(), "differing version constraints or git refs, grouped by registry address or\n")
+		fmt.Fprintf(flags.Output(), "package URL, with the call sites selecting each version.\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	discovery, err := DiscoverWithOptions(flags.Arg(0), config.analyzeOptions())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	stdout, outputFile := newOutput(*outputPath)
+	defer func() { code = outputFile.close(code) }()
+	conflicts := FindVersionConflicts(discovery)
+	if *format == "json" {
+		jsonOutput, _ := json.MarshalIndent(conflicts, "", "  ")
+		fmt.Fprintln(stdout, string(jsonOutput))
+	} else {
+		writeVersionConflicts(stdout, conflicts)
+	}
+	if *failOnConflict && len(conflicts) > 0 {
+		return exitInvalid
+	}
+	return exitValid
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindVersionConflicts(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+
+module "dns" {
+  source = "git::https://github.com/org/infra.git//dns?ref=v1.0.0"
+}
+`,
+		"envs/dev/main.tf": `
+module "app" {
+  source = "../../modules/app"
+}
+
+module "label" {
+  source  = "registry.terraform.io/cloudposse/label/null"
+  version = "0.24.0"
+}
+
+module "dns" {
+  source = "github.com/org/infra//dns?ref=v1.0.0"
+}
+`,
+		"modules/app/main.tf": `
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+
+module "vpc" {
+  source = "terraform-aws-modules/vpc/aws"
+}
+`,
+		"envs/legacy/main.tf": `
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "~> 5.0"
+}
+`,
+	})
+	t.Chdir(tempDir)
+
+	discovery, err := Discover("envs")
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	conflicts := FindVersionConflicts(discovery)
+
+	expected := []ModuleVersions{
+		{Module: "registry.terraform.io/cloudposse/label/null", Versions: []VersionUse{
+			{Version: "0.24.0", Calls: []VersionCaller{{Caller: "envs/dev", Name: "label"}}},
+			{Version: "0.25.0", Calls: []VersionCaller{{Caller: "envs/prod", Name: "label"}, {Caller: "modules/app", Name: "label"}}},
+		}},
+		{Module: "registry.terraform.io/terraform-aws-modules/vpc/aws", Versions: []VersionUse{
+			{Version: "", Calls: []VersionCaller{{Caller: "modules/app", Name: "vpc"}}},
+			{Version: "~> 5.0", Calls: []VersionCaller{{Caller: "envs/legacy", Name: "vpc"}}},
+		}},
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("expected %+v, got %+v", expected, conflicts)
+	}
+
+	var b strings.Builder
+	writeVersionConflicts(&b, conflicts)
+	if !strings.Contains(b.String(), "  0.25.0\tenvs/prod (label), modules/app (label)\n") ||
+		!strings.Contains(b.String(), "  (unpinned)\tmodules/app (vpc)\n") {
+		t.Errorf("unexpected report:\n%s", b.String())
+	}
+}
+
+func TestRunVersions_FailOnConflict(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/prod/main.tf": `
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+		"envs/dev/main.tf": `
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.25.0"
+}
+`,
+	})
+	t.Chdir(tempDir)
+
+	if code := runVersions([]string{"--fail-on-conflict", "--output", "report.txt", "envs"}); code != exitValid {
+		t.Errorf("expected exit %d with a single version, got %d", exitValid, code)
+	}
+	writeTestFiles(t, tempDir, map[string]string{
+		"envs/dev/main.tf": `
+module "label" {
+  source  = "cloudposse/label/null"
+  version = "0.24.0"
+}
+`,
+	})
+	if code := runVersions([]string{"--output", "report.txt", "envs"}); code != exitValid {
+		t.Errorf("expected exit %d without --fail-on-conflict, got %d", exitValid, code)
+	}
+	if code := runVersions([]string{"--fail-on-conflict", "--output", "report.txt", "envs"}); code != exitInvalid {
+		t.Errorf("expected exit %d with conflicting versions, got %d", exitInvalid, code)
+	}
+}
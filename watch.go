@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long Watch waits after a change before analyzing
+// again, so that editors writing several files trigger a single run.
+const watchDebounce = 200 * time.Millisecond
+
+// Watch analyzes dir, passes the result to onResult and analyzes again
+// whenever a Terraform file in the root or in one of its resolved local
+// modules changes, or one of their files matched by include globs or
+// linked from outside them. The set of watched directories follows the
+// latest analysis. Watch returns when ctx is done.
+func Watch(ctx context.Context, dir string, opts AnalyzeOptions, onResult func(*Output, error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	watched := make(map[string]bool)
+	files := make(map[string]bool)
+	for {
+		output, err := AnalyzeContext(ctx, absDir, opts)
+		if ctx.Err() != nil {
+			return nil
+		}
+		onResult(output, err)
+
+		dirs := map[string]bool{absDir: true}
+		if output != nil {
+			var moduleDirs []string
+			moduleDirs, files = watchTargets(output)
+			for _, d := range moduleDirs {
+				dirs[d] = true
+			}
+		} else {
+			for d := range watched {
+				dirs[d] = true
+			}
+		}
+		for d := range watched {
+			if !dirs[d] {
+				watcher.Remove(d)
+				delete(watched, d)
+			}
+		}
+		for d := range dirs {
+			if watched[d] {
+				continue
+			}
+			if err := watcher.Add(d); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: cannot watch %s: %v\n", d, err)
+				continue
+			}
+			watched[d] = true
+		}
+
+		if err := waitForChange(ctx, watcher, files); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// watchTargets returns the directories to watch for changes to the root
+// and local modules of output, which are the module directories and the
+// directories of their other files, and those other files: the files
+// matched by include globs and linked from outside the modules, which are
+// not Terraform files or not in a module directory.
+func watchTargets(output *Output) ([]string, map[string]bool) {
+	dirs := append([]string{output.RootModule.ResolvedPath}, localModulePaths(output)...)
+	files := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, d := range dirs {
+		seen[d] = true
+	}
+	addFiles := func(dir string, moduleFiles []string) {
+		for _, f := range moduleFiles {
+			if isTerraformFile(f) && filepath.Dir(f) == dir {
+				continue
+			}
+			files[f] = true
+			if d := filepath.Dir(f); !seen[d] {
+				seen[d] = true
+				dirs = append(dirs, d)
+			}
+		}
+	}
+	addFiles(output.RootModule.ResolvedPath, output.RootModule.Files)
+	for _, m := range output.LocalModules {
+		addFiles(m.ResolvedPath, m.Files)
+	}
+	sort.Strings(dirs)
+	return dirs, files
+}
+
+// waitForChange blocks until an event for a Terraform file or one of files
+// is followed by watchDebounce of quiet, or until ctx is done.
+func waitForChange(ctx context.Context, watcher *fsnotify.Watcher, files map[string]bool) error {
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if isTerraformFile(event.Name) || files[event.Name] {
+				debounce = time.After(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("watch error: %w", err)
+		case <-debounce:
+			return nil
+		}
+	}
+}
+
+// runWatchCommand runs command through the shell after an analysis,
+// passing the analyzed directory in TFMR_MODULE_PATH, as exec does. It is
+// also passed in TF_MODULE_ROOT, its former name, for existing commands.
+func runWatchCommand(ctx context.Context, command, root string) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "TFMR_MODULE_PATH="+root, "TF_MODULE_ROOT="+root)
+	if err := cmd.Run(); err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "Warning: command failed: %v\n", err)
+	}
+}
+
+// runWatch implements --watch: it renders every analysis to stdout and runs
+// command, if set, after each successful one until interrupted.
+func runWatch(dir string, opts AnalyzeOptions, render formatter, command string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return Watch(ctx, dir, opts, func(output *Output, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		if err := render(os.Stdout, output, renderOptions{}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		if command != "" {
+			runWatchCommand(ctx, command, output.RootModule.ResolvedPath)
+		}
+	})
+}
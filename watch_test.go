@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatch_ReanalyzesOnChange(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"main.tf": `
+module "vpc" {
+  source = "./modules/vpc"
+}
+`,
+		"modules/vpc/main.tf": `variable "cidr" {}`,
+	})
+	if err := os.Mkdir(filepath.Join(tempDir, "modules", "subnets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan *Output, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(ctx, tempDir, AnalyzeOptions{}, func(output *Output, err error) {
+			if err != nil {
+				t.Errorf("analysis failed: %v", err)
+				return
+			}
+			results <- output
+		})
+	}()
+
+	next := func() *Output {
+		t.Helper()
+		select {
+		case output := <-results:
+			return output
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for analysis")
+			return nil
+		}
+	}
+
+	first := next()
+	if len(first.LocalModules) != 1 {
+		t.Fatalf("expected 1 local module, got %+v", first.LocalModules)
+	}
+
+	vpcMain := filepath.Join(tempDir, "modules", "vpc", "main.tf")
+	if err := os.WriteFile(vpcMain, []byte(`module "subnets" {
+  source = "../subnets"
+}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second := next()
+	if second.LocalModules[0].Hash == first.LocalModules[0].Hash {
+		t.Error("expected a changed module hash after editing the local module")
+	}
+	if len(second.LocalModules) != 2 {
+		t.Fatalf("expected the new local module to be resolved, got %+v", second.LocalModules)
+	}
+
+	writeTestFiles(t, tempDir, map[string]string{"modules/subnets/main.tf": `variable "count" {}`})
+	if third := next(); len(third.LocalModules[1].Files) != 1 {
+		t.Errorf("expected files of the newly watched module, got %+v", third.LocalModules[1])
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch returned %v", err)
+	}
+}
+
+func TestWatchTargets_IncludedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root/main.tf":                   `module "vpc" { source = "../modules/vpc" }`,
+		"modules/vpc/main.tf":            "",
+		"modules/vpc/templates/user.tpl": "",
+	})
+	output, err := AnalyzeWithOptions(filepath.Join(tempDir, "root"), AnalyzeOptions{IncludeGlobs: []string{"templates/*"}})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	dirs, files := watchTargets(output)
+	vpc := filepath.Join(tempDir, "modules", "vpc")
+	expectedDirs := []string{vpc, filepath.Join(vpc, "templates"), filepath.Join(tempDir, "root")}
+	if !reflect.DeepEqual(dirs, expectedDirs) {
+		t.Errorf("expected watched directories %v, got %v", expectedDirs, dirs)
+	}
+	expectedFiles := map[string]bool{filepath.Join(vpc, "templates", "user.tpl"): true}
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Errorf("expected watched files %v, got %v", expectedFiles, files)
+	}
+}
+
+func TestRunWatchCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "env")
+	runWatchCommand(t.Context(), `echo "$TFMR_MODULE_PATH $TF_MODULE_ROOT" > `+out, "/repo/prod")
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "/repo/prod /repo/prod\n" {
+		t.Errorf("expected the analyzed directory in TFMR_MODULE_PATH and TF_MODULE_ROOT, got %q", data)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Workspace is a Terraform Cloud workspace or a Spacelift stack that plans
+// and applies a root module.
+type Workspace struct {
+	// TFC is a Terraform Cloud or Enterprise workspace as
+	// organization/workspace.
+	TFC string `json:"tfc,omitempty"`
+
+	// Spacelift is the ID of a Spacelift stack.
+	Spacelift string `json:"spacelift,omitempty"`
+}
+
+const (
+	workspaceTFC       = "tfc"
+	workspaceSpacelift = "spacelift"
+)
+
+// WorkspaceTarget is a workspace or stack to trigger for a change set, with
+// the affected roots mapped to it.
+type WorkspaceTarget struct {
+	Kind  string   `json:"kind"`
+	Name  string   `json:"name"`
+	Roots []string `json:"roots"`
+}
+
+// PlanWorkspaceTargets returns the workspaces and stacks mapped to roots in
+// workspaces, in the order of roots, each listed once. Roots without a
+// mapping are returned separately.
+func PlanWorkspaceTargets(roots []string, workspaces map[string][]Workspace) (targets []WorkspaceTarget, unmapped []string) {
+	index := make(map[[2]string]int)
+	add := func(kind, name, root string) {
+		key := [2]string{kind, name}
+		if i, ok := index[key]; ok {
+			targets[i].Roots = append(targets[i].Roots, root)
+			return
+		}
+		index[key] = len(targets)
+		targets = append(targets, WorkspaceTarget{Kind: kind, Name: name, Roots: []string{root}})
+	}
+	for _, root := range roots {
+		mapped := workspaces[root]
+		if len(mapped) == 0 {
+			unmapped = append(unmapped, root)
+			continue
+		}
+		for _, ws := range mapped {
+			if ws.TFC != "" {
+				add(workspaceTFC, ws.TFC, root)
+			}
+			if ws.Spacelift != "" {
+				add(workspaceSpacelift, ws.Spacelift, root)
+			}
+		}
+	}
+	return targets, unmapped
+}
+
+func writeWorkspaceTargets(w io.Writer, targets []WorkspaceTarget) {
+	for _, t := range targets {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", t.Kind, t.Name, strings.Join(t.Roots, ","))
+	}
+}
+
+// tfcClient queues runs through the Terraform Cloud API.
+type tfcClient struct {
+	client  *http.Client
+	address *url.URL
+	token   string
+}
+
+// tfcTokenVariable returns the environment variable the Terraform CLI reads
+// the API token of host from.
+func tfcTokenVariable(host string) string {
+	return "TF_TOKEN_" + strings.NewReplacer("-", "__", ".", "_").Replace(host)
+}
+
+// tfcToken returns the API token for the Terraform Cloud host: TFE_TOKEN,
+// or the TF_TOKEN_<host> variable the Terraform CLI reads.
+func tfcToken(host string) string {
+	if token := os.Getenv("TFE_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv(tfcTokenVariable(host))
+}
+
+func (c *tfcClient) do(ctx context.Context, method, path string, body, v any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	endpoint := c.address.JoinPath("api", "v2", path).String()
+	if err := checkOnline(method + " " + endpoint); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+	resp, err := doHTTP(c.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s", method, endpoint, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s %s: %w", method, endpoint, err)
+	}
+	return nil
+}
+
+// queueRun creates a run in workspace, given as organization/workspace, and
+// returns its ID.
+func (c *tfcClient) queueRun(ctx context.Context, workspace, message string) (string, error) {
+	org, name, ok := strings.Cut(workspace, "/")
+	if !ok || org == "" || name == "" {
+		return "", fmt.Errorf("invalid workspace %q: expected organization/workspace", workspace)
+	}
+	var ws struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "organizations/"+url.PathEscape(org)+"/workspaces/"+url.PathEscape(name), nil, &ws); err != nil {
+		return "", err
+	}
+
+	run := map[string]any{
+		"data": map[string]any{
+			"type":       "runs",
+			"attributes": map[string]any{"message": message},
+			"relationships": map[string]any{
+				"workspace": map[string]any{
+					"data": map[string]any{"type": "workspaces", "id": ws.Data.ID},
+				},
+			},
+		},
+	}
+	var created struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodPost, "runs", run, &created); err != nil {
+		return "", err
+	}
+	return created.Data.ID, nil
+}
+
+func runWorkspaces(args []string) (code int) {
+	flags := newFlagSet("workspaces")
+	format := flags.String("format", "text", "output format: text (tab-separated kind, workspace or stack, and roots) or json")
+	trigger := flags.Bool("trigger", false, "queue a run in every Terraform Cloud workspace to trigger")
+	address := flags.String("tfc-address", "https://app.terraform.io", "address of Terraform Cloud or Enterprise for --trigger; the token is read from TFE_TOKEN or TF_TOKEN_<host>")
+	message := flags.String("message", "Triggered by "+programName, "message of the runs queued by --trigger")
+	precedence := flags.String("overlap-precedence", precedenceNearest, "root that owns files of a nested root: nearest, outermost or all")
+	configPath := flags.String("config", "", "configuration file with workspaces (default "+defaultConfigFile+" in the working directory, if present)")
+	timeout := flags.Duration("timeout", 0, "abort discovery and triggering after this duration (0 means no limit)")
+	outputPath := flags.String("output", "", "write the output to this file, atomically replacing it, instead of stdout")
+	var includeGlobs stringsFlag
+	flags.Var(&includeGlobs, "include-glob", "also list files matching this glob, relative to each module directory, such as 'templates/**', as module files that affect the module (may be repeated)")
+	stdinFormat := addStdinFormatFlag(flags)
+	var ignoreChanged stringsFlag
+	flags.Var(&ignoreChanged, "ignore-changed", "ignore changed files from stdin matching this glob, such as '**/*.md' (** matches any number of directories; may be repeated)")
+	addNetworkFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s workspaces [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "List the Terraform Cloud workspaces and Spacelift stacks to trigger for the\n")
+		fmt.Fprintf(flags.Output(), "changed files read from stdin, from the workspaces mapping of the\n")
+		fmt.Fprintf(flags.Output(), "configuration file or, for unmapped roots, the workspace named in their cloud\n")
+		fmt.Fprintf(flags.Output(), "block or remote backend (exit 0=workspaces to trigger, 1=none).\n\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+	switch *precedence {
+	case precedenceNearest, precedenceOutermost, precedenceAll:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --overlap-precedence %q\n", *precedence)
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+	if *trigger && offline {
+		fmt.Fprintf(os.Stderr, "Error: --trigger cannot be combined with --offline\n")
+		return exitError
+	}
+	var tfc *tfcClient
+	if *trigger {
+		u, err := url.Parse(*address)
+		if err != nil || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "Error: invalid --tfc-address %q\n", *address)
+			return exitError
+		}
+		tfc = &tfcClient{client: networkClient(), address: u, token: tfcToken(u.Hostname())}
+		if tfc.token == "" {
+			fmt.Fprintf(os.Stderr, "Error: --trigger requires TFE_TOKEN or %s\n", tfcTokenVariable(u.Hostname()))
+			return exitError
+		}
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	ctx, cancel := analysisContext(*timeout)
+	defer cancel()
+	opts := config.analyzeOptions()
+	opts.IncludeGlobs = includeGlobs
+	discovery, err := DiscoverContext(ctx, flags.Arg(0), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	changedFiles, err := readChangedFiles(*stdinFormat, ignoreChanged)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+		return exitError
+	}
+
+	var roots []string
+	for _, r := range RootAffectedResults(discovery, changedFiles, *precedence) {
+		if r.Affected {
+			roots = append(roots, r.Path)
+		}
+	}
+	targets, unmapped := PlanWorkspaceTargets(roots, backendWorkspaces(discovery, config.Workspaces))
+	for _, root := range unmapped {
+		fmt.Fprintf(os.Stderr, "Warning: no workspace configured for affected root %s\n", root)
+	}
+
+	stdout, outputFile := newOutput(*outputPath)
+	defer func() { code = outputFile.close(code) }()
+	if *format == "json" {
+		if targets == nil {
+			targets = []WorkspaceTarget{}
+		}
+		jsonOutput, _ := json.MarshalIndent(map[string][]WorkspaceTarget{"workspaces": targets}, "", "  ")
+		fmt.Fprintln(stdout, string(jsonOutput))
+	} else {
+		writeWorkspaceTargets(stdout, targets)
+	}
+
+	if tfc != nil {
+		failed := false
+		for _, t := range targets {
+			if t.Kind != workspaceTFC {
+				fmt.Fprintf(os.Stderr, "Warning: --trigger does not queue runs for %s stack %s\n", t.Kind, t.Name)
+				continue
+			}
+			id, err := tfc.queueRun(ctx, t.Name, *message)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: queueing a run in %s: %v\n", t.Name, err)
+				failed = true
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Queued run %s in %s\n", id, t.Name)
+		}
+		if failed {
+			return exitError
+		}
+	}
+	if len(targets) > 0 {
+		return exitAffected
+	}
+	return exitNotAffected
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanWorkspaceTargets(t *testing.T) {
+	workspaces := map[string][]Workspace{
+		"/infra/envs/prod":    {{TFC: "acme/prod"}, {Spacelift: "prod-stack"}},
+		"/infra/envs/prod-eu": {{TFC: "acme/prod"}},
+	}
+	targets, unmapped := PlanWorkspaceTargets([]string{"/infra/envs/prod", "/infra/envs/dev", "/infra/envs/prod-eu"}, workspaces)
+
+	expected := []WorkspaceTarget{
+		{Kind: workspaceTFC, Name: "acme/prod", Roots: []string{"/infra/envs/prod", "/infra/envs/prod-eu"}},
+		{Kind: workspaceSpacelift, Name: "prod-stack", Roots: []string{"/infra/envs/prod"}},
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected %+v, got %+v", expected, targets)
+	}
+	if !reflect.DeepEqual(unmapped, []string{"/infra/envs/dev"}) {
+		t.Errorf("expected dev to be unmapped, got %v", unmapped)
+	}
+}
+
+func TestTFCClient_QueueRun(t *testing.T) {
+	var body map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2/organizations/acme/workspaces/prod", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data": {"id": "ws-123", "type": "workspaces"}}`))
+	})
+	mux.HandleFunc("POST /api/v2/runs", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"data": {"id": "run-456", "type": "runs"}}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	address, _ := url.Parse(server.URL)
+	client := &tfcClient{client: server.Client(), address: address, token: "secret"}
+	id, err := client.queueRun(t.Context(), "acme/prod", "module change")
+	if err != nil {
+		t.Fatalf("queueRun failed: %v", err)
+	}
+	if id != "run-456" {
+		t.Errorf("expected run-456, got %s", id)
+	}
+	data, _ := json.Marshal(body)
+	for _, want := range []string{`"message":"module change"`, `"id":"ws-123"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected the run request to contain %s, got %s", want, data)
+		}
+	}
+
+	if _, err := client.queueRun(t.Context(), "acme/missing", "module change"); err == nil {
+		t.Error("expected an error for an unknown workspace")
+	}
+	if _, err := client.queueRun(t.Context(), "prod", "module change"); err == nil {
+		t.Error("expected an error for a workspace without an organization")
+	}
+}
+
+func TestTFCToken(t *testing.T) {
+	t.Setenv("TFE_TOKEN", "")
+	t.Setenv("TF_TOKEN_tfe_example__corp_com", "host-token")
+	if got := tfcToken("tfe.example-corp.com"); got != "host-token" {
+		t.Errorf("expected the TF_TOKEN_<host> token, got %q", got)
+	}
+	t.Setenv("TFE_TOKEN", "tfe-token")
+	if got := tfcToken("tfe.example-corp.com"); got != "tfe-token" {
+		t.Errorf("expected TFE_TOKEN to take precedence, got %q", got)
+	}
+}